@@ -0,0 +1,159 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/saneechka/ManageSubscription/internal/app"
+	"github.com/saneechka/ManageSubscription/internal/migrations"
+	"github.com/saneechka/ManageSubscription/internal/oidc"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/internal/services"
+)
+
+// runCommand выполняет служебную команду вместо запуска HTTP-сервера
+func runCommand(args []string) {
+	switch name := args[0]; name {
+	case "migrate":
+		app.ConnectDB()
+		defer app.CloseDB()
+
+		runMigrate(migrations.New(app.DB), args[1:])
+	case "hash-passwords":
+		app.InitDB()
+		defer app.CloseDB()
+
+		store := repository.NewGormStore(app.DB)
+		migrated, err := services.NewUserService(store, services.SystemClock(), services.NewEventBus()).MigrateLegacyPasswords()
+		if err != nil {
+			log.Fatalf("Failed to hash legacy passwords: %v", err)
+		}
+		log.Printf("Hashed %d legacy plaintext passwords", migrated)
+	case "purge-accounts":
+		app.InitDB()
+		defer app.CloseDB()
+
+		svc := newServices(oidc.NewRegistry())
+		purged, err := svc.Accounts.PurgeDeletedAccounts()
+		if err != nil {
+			log.Fatalf("Failed to purge deleted accounts: %v", err)
+		}
+		log.Printf("Purged %d deleted accounts", purged)
+		svc.Events.Wait()
+	case "apply-price-changes":
+		app.InitDB()
+		defer app.CloseDB()
+
+		svc := newServices(oidc.NewRegistry())
+		applied, err := svc.PriceChanges.ApplyDuePriceChanges()
+		if err != nil {
+			log.Fatalf("Failed to apply price changes: %v", err)
+		}
+		log.Printf("Applied %d scheduled price changes", applied)
+		svc.Events.Wait()
+	case "bill-usage":
+		app.InitDB()
+		defer app.CloseDB()
+
+		svc := newServices(oidc.NewRegistry())
+		closed, err := svc.Usage.BillClosedPeriods()
+		if err != nil {
+			log.Fatalf("Failed to bill usage: %v", err)
+		}
+		log.Printf("Closed %d usage billing periods", closed)
+	case "purge-audit-log":
+		app.InitDB()
+		defer app.CloseDB()
+
+		svc := newServices(oidc.NewRegistry())
+		purged, err := svc.Audit.PurgeExpired()
+		if err != nil {
+			log.Fatalf("Failed to purge audit log: %v", err)
+		}
+		log.Printf("Purged %d audit log entries older than %s", purged, svc.Audit.GetRetention())
+	case "deliver-webhooks":
+		app.InitDB()
+		defer app.CloseDB()
+
+		svc := newServices(oidc.NewRegistry())
+		attempted, err := svc.Webhooks.DeliverDue()
+		if err != nil {
+			log.Fatalf("Failed to deliver webhooks: %v", err)
+		}
+		log.Printf("Attempted %d webhook deliveries", attempted)
+	case "purge-idempotency-keys":
+		app.InitDB()
+		defer app.CloseDB()
+
+		svc := newServices(oidc.NewRegistry())
+		purged, err := svc.Idempotency.PurgeExpired()
+		if err != nil {
+			log.Fatalf("Failed to purge idempotency keys: %v", err)
+		}
+		log.Printf("Purged %d expired idempotency keys", purged)
+	default:
+		log.Fatalf("Unknown command %q. Available commands: migrate, hash-passwords, purge-accounts, apply-price-changes, bill-usage, purge-audit-log, deliver-webhooks, purge-idempotency-keys", name)
+	}
+}
+
+// runMigrate выполняет подкоманду migrate: up (по умолчанию), down [N], status, force VERSION
+func runMigrate(migrator *migrations.Migrator, args []string) {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+		log.Printf("Applied %d migrations", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid number of migrations to roll back: %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			log.Fatalf("Failed to roll back migrations: %v", err)
+		}
+		log.Printf("Rolled back %d migrations", reverted)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			switch {
+			case status.Dirty:
+				state = "dirty"
+			case status.Modified:
+				state = "modified after apply"
+			case status.Applied:
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			log.Printf("%04d_%s: %s", status.Version, status.Name, state)
+		}
+	case "force":
+		if len(args) < 2 {
+			log.Fatal("Usage: migrate force VERSION")
+		}
+		version, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			log.Fatalf("Invalid migration version: %q", args[1])
+		}
+		if err := migrator.Force(uint(version)); err != nil {
+			log.Fatalf("Failed to force migration version: %v", err)
+		}
+		log.Printf("Schema version set to %d", version)
+	default:
+		log.Fatalf("Unknown migrate action %q. Available actions: up, down [N], status, force VERSION", action)
+	}
+}
@@ -1,15 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"path/filepath"
 
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/saneechka/ManageSubscription/internal/app"
-	"github.com/saneechka/ManageSubscription/internal/handlers"
-	"github.com/saneechka/ManageSubscription/internal/middleware"
+	"github.com/saneechka/ManageSubscription/internal/oidc"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/internal/services"
 )
 
 func main() {
@@ -23,83 +24,19 @@ func main() {
 		}
 	}
 
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
 	app.InitDB()
 	defer app.CloseDB()
 
-	router := gin.Default()
-
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Authorization, Content-Type")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	})
-
-	router.Static("/static", "./web/frontend/build/static")
-	router.StaticFile("/favicon.ico", "./web/frontend/build/favicon.ico")
-	router.StaticFile("/manifest.json", "./web/frontend/build/manifest.json")
-	router.StaticFile("/logo192.png", "./web/frontend/build/logo192.png")
-	router.StaticFile("/logo512.png", "./web/frontend/build/logo512.png")
-
-	userHandler := handlers.NewUserHandler()
-	planHandler := handlers.NewPlanHandler()
-	subscriptionHandler := handlers.NewSubscriptionHandler()
-
-	api := router.Group("/api")
-	{
-		// Публичные эндпоинты
-		api.POST("/register", userHandler.Register)
-		api.POST("/login", userHandler.Login)
-
-		// Новые маршруты для подтверждения email
-		api.GET("/verify-email", userHandler.VerifyEmail)
-		api.POST("/resend-verification", userHandler.ResendVerification)
+	svc := newServices(oidc.LoadRegistryFromEnv())
+	router := app.NewRouter(svc)
 
-		// Эндпоинты для планов
-		// Важно: более специфичные маршруты должны быть выше, чем общие
-		api.GET("/plans/filter", planHandler.FilterPlansByPrice)
-		api.GET("/plans/service", subscriptionHandler.GetPlansForService)
-		api.GET("/plans/related/:planId", subscriptionHandler.GetRelatedPlans) // Изменили маршрут
-		api.GET("/plans/:id", planHandler.GetPlanByID)
-		api.GET("/plans", planHandler.GetAllPlans)
-
-		protected := api.Group("/")
-		protected.Use(middleware.AuthMiddleware())
-		{
-			// ...existing code...
-
-			protected.GET("/profile", userHandler.GetProfile)
-			protected.PUT("/profile", userHandler.UpdateProfile)
-
-			protected.GET("/subscriptions", subscriptionHandler.GetUserSubscriptions)
-			protected.GET("/subscriptions/active", subscriptionHandler.GetActiveSubscriptions)
-			protected.GET("/subscriptions/stats", subscriptionHandler.GetSubscriptionStats)
-			protected.GET("/subscriptions/search", subscriptionHandler.SearchSubscriptions)
-			protected.GET("/subscriptions/:id", subscriptionHandler.GetSubscriptionByID)
-			protected.POST("/subscriptions", subscriptionHandler.Subscribe)
-			protected.PUT("/subscriptions/:id/cancel", subscriptionHandler.CancelSubscription)
-			protected.PUT("/subscriptions/:id/auto-renew", subscriptionHandler.UpdateAutoRenewal)
-			protected.PUT("/subscriptions/:id/renew", subscriptionHandler.RenewSubscription)
-
-			admin := protected.Group("/admin")
-			admin.Use(middleware.AdminRequired())
-			{
-				admin.POST("/plans", planHandler.CreatePlan)
-				admin.PUT("/plans/:id", planHandler.UpdatePlan)
-				admin.DELETE("/plans/:id", planHandler.DeletePlan)
-			}
-		}
-	}
-
-	router.NoRoute(func(c *gin.Context) {
-		c.File("./web/frontend/build/index.html")
-	})
+	// События подписок отправляются внешним системам в фоне, неудачные доставки повторяются
+	go svc.Webhooks.Run(context.Background(), svc.Webhooks.GetDispatchInterval())
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -111,3 +48,10 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// newServices собирает сервисы поверх подключения app.DB и подписывает реакции на их события
+func newServices(registry *oidc.Registry) *app.Services {
+	svc := app.NewServices(repository.NewGormStore(app.DB), services.SystemClock(), registry)
+	app.RegisterSubscribers(svc)
+	return svc
+}
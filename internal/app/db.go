@@ -8,7 +8,8 @@ import (
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
-	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/migrations"
+	"github.com/saneechka/ManageSubscription/internal/repository"
 	gormysql "gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -18,7 +19,24 @@ import (
 var DB *gorm.DB
 
 
+// InitDB подключается к базе и проверяет, что все миграции применены.
+// Сервер не запускается на устаревшей или незавершённой схеме
 func InitDB() {
+	ConnectDB()
+
+	if err := migrations.New(DB).Check(); err != nil {
+		log.Fatalf("Database schema is not up to date: %v. Run `go run ./cmd migrate` first", err)
+	}
+
+
+	SeedPopularSubscriptions(repository.NewGormStore(DB).Plans())
+
+	log.Println("Database connection established successfully")
+}
+
+
+// ConnectDB только открывает подключение к базе, без проверки схемы
+func ConnectDB() {
 	var err error
 
 
@@ -26,17 +44,12 @@ func InitDB() {
 		log.Println("Warning: .env file not found, using environment variables")
 	}
 
-	dbUser := getEnv("DB_USER", "root")
-	dbPassword := getEnv("DB_PASSWORD", "")
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "3306")
-	dbName := getEnv("DB_NAME", "subscription_manager")
-
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		dbUser, dbPassword, dbHost, dbPort, dbName)
+	config := LoadDBConfig()
+	if !isSupportedDriver(config.Driver) {
+		log.Fatalf("Unsupported DB_DRIVER %q (expected mysql, postgres or sqlite)", config.Driver)
+	}
 
-	log.Printf("Attempting to connect to MySQL at %s:%s...", dbHost, dbPort)
+	log.Printf("Attempting to connect to %s database %s...", config.Driver, config.address())
 
 
 	gormLogger := logger.Default
@@ -47,9 +60,7 @@ func InitDB() {
 
 	maxRetries := 5
 	for i := 0; i < maxRetries; i++ {
-		DB, err = gorm.Open(gormysql.Open(dsn), &gorm.Config{
-			Logger: gormLogger,
-		})
+		DB, err = OpenDB(config, gormLogger)
 
 		if err == nil {
 			break
@@ -58,8 +69,8 @@ func InitDB() {
 		log.Printf("Failed to connect to database (attempt %d/%d): %v", i+1, maxRetries, err)
 
 
-		if i == 1 {
-			tryCreateDatabase(dbUser, dbPassword, dbHost, dbPort, dbName)
+		if i == 1 && config.Driver == DriverMySQL {
+			tryCreateDatabase(config.User, config.Password, config.Host, config.Port, config.Name)
 		}
 
 		if i < maxRetries-1 {
@@ -71,27 +82,6 @@ func InitDB() {
 	if err != nil {
 		log.Fatalf("Failed to connect to database after %d attempts: %v", maxRetries, err)
 	}
-
-
-	sqlDB, err := DB.DB()
-	if err != nil {
-		log.Fatalf("Failed to get database connection: %v", err)
-	}
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-
-	log.Println("Auto-migrating database schema...")
-	err = DB.AutoMigrate(&models.User{}, &models.Plan{}, &models.Subscription{})
-	if err != nil {
-		log.Fatalf("Failed to migrate database schema: %v", err)
-	}
-
-
-	SeedPopularSubscriptions()
-
-	log.Println("Database connection established successfully")
 }
 
 
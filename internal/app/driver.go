@@ -0,0 +1,115 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	gormysql "gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Поддерживаемые значения DB_DRIVER
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// DBConfig описывает подключение к базе данных
+type DBConfig struct {
+	Driver   string
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Name     string
+	SSLMode  string
+	// Path - файл базы SQLite (":memory:" для базы в памяти)
+	Path string
+}
+
+// LoadDBConfig читает настройки подключения из переменных окружения
+func LoadDBConfig() DBConfig {
+	driver := strings.ToLower(getEnv("DB_DRIVER", DriverMySQL))
+	if driver == "postgresql" {
+		driver = DriverPostgres
+	}
+
+	defaultPort := "3306"
+	if driver == DriverPostgres {
+		defaultPort = "5432"
+	}
+
+	return DBConfig{
+		Driver:   driver,
+		User:     getEnv("DB_USER", "root"),
+		Password: getEnv("DB_PASSWORD", ""),
+		Host:     getEnv("DB_HOST", "localhost"),
+		Port:     getEnv("DB_PORT", defaultPort),
+		Name:     getEnv("DB_NAME", "subscription_manager"),
+		SSLMode:  getEnv("DB_SSLMODE", "disable"),
+		Path:     getEnv("DB_PATH", "subscription_manager.db"),
+	}
+}
+
+func isSupportedDriver(driver string) bool {
+	return driver == DriverMySQL || driver == DriverPostgres || driver == DriverSQLite
+}
+
+// address возвращает адрес базы для логов, без пароля
+func (c DBConfig) address() string {
+	if c.Driver == DriverSQLite {
+		return c.Path
+	}
+	return fmt.Sprintf("%s:%s/%s", c.Host, c.Port, c.Name)
+}
+
+// Dialector возвращает диалект GORM для выбранного драйвера
+func (c DBConfig) Dialector() (gorm.Dialector, error) {
+	switch c.Driver {
+	case DriverMySQL:
+		return gormysql.Open(fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			c.User, c.Password, c.Host, c.Port, c.Name)), nil
+	case DriverPostgres:
+		return postgres.Open(fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+			c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode)), nil
+	case DriverSQLite:
+		// Без внешних ключей SQLite не проверяет связи, а без busy_timeout
+		// параллельные запросы сразу получают "database is locked"
+		return sqlite.Open(c.Path + "?_foreign_keys=on&_busy_timeout=5000"), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", c.Driver)
+	}
+}
+
+// OpenDB открывает подключение и настраивает пул соединений
+func OpenDB(config DBConfig, gormLogger logger.Interface) (*gorm.DB, error) {
+	dialector, err := config.Dialector()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: gormLogger})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if config.Driver == DriverSQLite {
+		// SQLite допускает только одну пишущую транзакцию
+		sqlDB.SetMaxOpenConns(1)
+	} else {
+		sqlDB.SetMaxIdleConns(10)
+		sqlDB.SetMaxOpenConns(100)
+		sqlDB.SetConnMaxLifetime(time.Hour)
+	}
+
+	return db, nil
+}
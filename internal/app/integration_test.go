@@ -0,0 +1,1048 @@
+package app_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/app"
+	"github.com/saneechka/ManageSubscription/internal/migrations"
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/oidc"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	"github.com/saneechka/ManageSubscription/pkg/email"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/logger"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+// integrationEnv - сервисы приложения поверх настоящей базы SQLite во временном каталоге
+type integrationEnv struct {
+	store    *repository.GormStore
+	services *app.Services
+	clock    *fixedClock
+}
+
+func newIntegrationEnv(t *testing.T) *integrationEnv {
+	t.Helper()
+	t.Setenv("BCRYPT_COST", "4")
+	email.SetTransport(email.TransportFunc(func(toEmail, subject, body string) error { return nil }))
+
+	config := app.DBConfig{Driver: app.DriverSQLite, Path: filepath.Join(t.TempDir(), "test.db")}
+	db, err := app.OpenDB(config, logger.Default.LogMode(logger.Silent))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	_, err = migrations.New(db).Up()
+	require.NoError(t, err)
+
+	store := repository.NewGormStore(db)
+	clock := &fixedClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	env := &integrationEnv{
+		store:    store,
+		services: app.NewServices(store, clock, oidc.NewRegistry()),
+		clock:    clock,
+	}
+	app.RegisterSubscribers(env.services)
+
+	// ID 1 зарезервирован за администратором
+	require.NoError(t, store.Users().Create(&models.User{Email: "admin@example.com", IsEmailVerified: true}))
+	return env
+}
+
+func (e *integrationEnv) registerUser(t *testing.T, userEmail string) *models.User {
+	t.Helper()
+
+	user := &models.User{Email: userEmail, Password: "password123", FirstName: "Test"}
+	require.NoError(t, e.services.Users.Register(user))
+	require.NoError(t, e.services.Users.VerifyEmail(user.VerificationToken))
+	return user
+}
+
+func (e *integrationEnv) createPlan(t *testing.T, name string, price float64) *models.Plan {
+	t.Helper()
+
+	plan := &models.Plan{Name: name, Price: price, Duration: 1, PeriodType: "months", IsActive: true}
+	require.NoError(t, e.services.Plans.CreatePlan(plan))
+	return plan
+}
+
+func TestSQLiteUserLifecycle(t *testing.T) {
+	env := newIntegrationEnv(t)
+	users := env.services.Users
+
+	user := env.registerUser(t, "user@example.com")
+	assert.Error(t, users.Register(&models.User{Email: "USER@example.com", Password: "password123"}),
+		"email uniqueness is case-insensitive")
+
+	_, err := users.Login("User@Example.com", "password123")
+	require.NoError(t, err)
+
+	require.NoError(t, users.RequestEmailChange(user.ID, "new@example.com", "password123"))
+	changes, err := env.store.EmailChanges().FindByUser(user.ID)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.NoError(t, users.ConfirmEmailChange(changes[0].Token))
+
+	deletion, err := env.services.Accounts.DeleteAccount(user.ID, "password123")
+	require.NoError(t, err)
+	exists, err := users.UserExists(user.ID)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, env.services.Accounts.RestoreAccount(deletion.RestoreToken))
+	_, err = users.Login("new@example.com", "password123")
+	require.NoError(t, err)
+
+	deletion, err = env.services.Accounts.DeleteAccount(user.ID, "password123")
+	require.NoError(t, err)
+	env.clock.now = deletion.PurgeAfter.Add(time.Minute)
+	purged, err := env.services.Accounts.PurgeDeletedAccounts()
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	_, err = env.store.Users().FindByIDUnscoped(user.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestSQLiteSubscriptionLifecycle(t *testing.T) {
+	env := newIntegrationEnv(t)
+	subscriptions := env.services.Subscriptions
+	user := env.registerUser(t, "user@example.com")
+	movies := env.createPlan(t, "Кинопоиск", 299)
+	music := env.createPlan(t, "Spotify", 169)
+
+	first, err := subscriptions.Subscribe(user.ID, movies.ID, "payment-1", "")
+	require.NoError(t, err)
+	second, err := subscriptions.Subscribe(user.ID, music.ID, "", "")
+	require.NoError(t, err)
+	require.NoError(t, subscriptions.UpdateAutoRenewal(second.ID, false, second.UserID))
+
+	found, err := subscriptions.SearchSubscriptions(user.ID, "spoti", "", "price_asc")
+	require.NoError(t, err)
+	require.Len(t, found, 1, "plan name search is case-insensitive")
+	assert.Equal(t, "Spotify", found[0].Plan.Name)
+
+	plans, err := env.services.Plans.GetPlansByPrice(200, 300)
+	require.NoError(t, err)
+	require.Len(t, plans, 1)
+	assert.Equal(t, 299.0, plans[0].Price)
+
+	env.clock.now = first.EndDate.Add(-12 * time.Hour)
+	require.NoError(t, subscriptions.RenewSubscriptions())
+	renewed, err := subscriptions.GetSubscriptionByID(first.ID)
+	require.NoError(t, err)
+	assert.True(t, renewed.EndDate.After(first.EndDate))
+
+	env.clock.now = second.EndDate.Add(time.Hour)
+	require.NoError(t, subscriptions.CheckExpiredSubscriptions())
+	expired, err := subscriptions.GetSubscriptionByID(second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "expired", expired.Status)
+
+	// Фоновые изменения попадают в журнал аудита, действия пользователя - только в историю подписки
+	audited, err := env.services.Audit.GetEntries(repository.AuditFilter{TargetType: "subscription"})
+	require.NoError(t, err)
+	require.Len(t, audited, 2)
+	assert.Equal(t, "subscription.expired", audited[0].Action)
+	assert.Equal(t, fmt.Sprint(second.ID), audited[0].TargetID)
+	assert.Nil(t, audited[0].ActorID)
+	assert.Equal(t, "subscription.renewed", audited[1].Action)
+
+	active, err := subscriptions.GetActiveSubscriptions(user.ID)
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	assert.Equal(t, first.ID, active[0].ID)
+
+	require.NoError(t, subscriptions.CancelSubscription(first.ID, first.UserID))
+	active, err = subscriptions.GetActiveSubscriptions(user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+}
+
+func TestSQLiteOrganizationSubscriptions(t *testing.T) {
+	env := newIntegrationEnv(t)
+	organizations := env.services.Organizations
+	owner := env.registerUser(t, "owner@example.com")
+	member := env.registerUser(t, "member@example.com")
+	plan := env.createPlan(t, "Notion", 800)
+
+	org, err := organizations.CreateOrganization(owner.ID, "Команда")
+	require.NoError(t, err)
+
+	invitation, err := organizations.InviteMember(org.ID, owner.ID, "Member@Example.com", models.RoleBillingManager)
+	require.NoError(t, err)
+	_, err = organizations.AcceptInvitation(member.ID, invitation.Token)
+	require.NoError(t, err)
+
+	subscription, err := env.services.Subscriptions.SubscribeOrganization(member.ID, org.ID, plan.ID, "", "")
+	require.NoError(t, err)
+	require.NotNil(t, subscription.OrganizationID)
+
+	orgSubscriptions, err := organizations.GetOrganizationSubscriptions(org.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Len(t, orgSubscriptions, 1)
+
+	personal, err := env.services.Subscriptions.GetUserSubscriptions(member.ID)
+	require.NoError(t, err)
+	assert.Empty(t, personal, "organization subscriptions are not listed as personal")
+
+	members, err := organizations.GetMembers(org.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+}
+
+func TestSQLiteTransactionRollback(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	errAbort := errors.New("abort")
+	err := env.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Plans().Create(&models.Plan{Name: "Временный", Price: 1, Duration: 1, PeriodType: "days"}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+
+	plans, err := env.store.Plans().FindAll()
+	require.NoError(t, err)
+	assert.Empty(t, plans)
+}
+
+func TestSQLiteForeignKeys(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "user@example.com")
+	plan := env.createPlan(t, "Кинопоиск", 299)
+
+	err := env.store.Subscriptions().Create(&models.Subscription{UserID: user.ID, PlanID: 999, Status: "active"})
+	assert.Error(t, err, "subscription must reference an existing plan")
+	err = env.store.Subscriptions().Create(&models.Subscription{UserID: 999, PlanID: plan.ID, Status: "active"})
+	assert.Error(t, err, "subscription must reference an existing user")
+
+	_, err = env.services.Subscriptions.Subscribe(user.ID, plan.ID, "", "")
+	require.NoError(t, err)
+	assert.Error(t, env.store.Users().HardDelete(user.ID), "user with subscriptions cannot be removed")
+
+	identity := &models.UserIdentity{UserID: user.ID, Provider: "google", Subject: "123"}
+	require.NoError(t, env.store.Identities().Create(identity))
+	assert.Error(t, env.store.Identities().Create(&models.UserIdentity{UserID: user.ID, Provider: "google", Subject: "123"}),
+		"unique indexes survive adding foreign keys")
+}
+
+func TestSQLitePlanDeletionPolicies(t *testing.T) {
+	env := newIntegrationEnv(t)
+	plans := env.services.Plans
+	user := env.registerUser(t, "user@example.com")
+	old := env.createPlan(t, "Кинопоиск", 299)
+	replacement := env.createPlan(t, "Кинопоиск HD", 399)
+
+	subscription, err := env.services.Subscriptions.Subscribe(user.ID, old.ID, "", "")
+	require.NoError(t, err)
+
+	_, err = plans.DeletePlan(old.ID, services.PlanDeletionBlock, 0, 1)
+	assert.ErrorIs(t, err, services.ErrPlanHasSubscribers)
+
+	result, err := plans.DeletePlan(old.ID, services.PlanDeletionMigrate, replacement.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.MigratedSubscriptions)
+
+	moved, err := env.services.Subscriptions.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, replacement.ID, moved.Plan.ID)
+	history, err := env.services.Subscriptions.GetHistory(subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, models.SubscriptionEventPlanChanged, history[0].Type)
+	assert.Equal(t, uint(1), *history[0].ActorID)
+	assert.JSONEq(t, fmt.Sprintf(`{"plan_id": %d, "plan_version_id": %d}`, replacement.ID, *moved.PlanVersionID), string(history[0].After))
+	assert.Equal(t, models.SubscriptionEventCreated, history[1].Type)
+
+	result, err = plans.DeletePlan(replacement.ID, services.PlanDeletionArchive, 0, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Archived)
+	_, err = env.services.Subscriptions.Subscribe(user.ID, replacement.ID, "", "")
+	assert.Error(t, err, "archived plan is not available for new subscriptions")
+
+	report, err := env.services.Subscriptions.GetOrphanedSubscriptions()
+	require.NoError(t, err)
+	assert.Empty(t, report)
+
+	require.NoError(t, env.store.Users().Delete(user.ID))
+	report, err = env.services.Subscriptions.GetOrphanedSubscriptions()
+	require.NoError(t, err)
+	require.Len(t, report, 1)
+	assert.Equal(t, services.OrphanUserDeleted, report[0].Reason)
+}
+
+func TestSQLiteScheduledPriceChange(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "user@example.com")
+	plan := env.createPlan(t, "Кинопоиск", 299)
+
+	subscription, err := env.services.Subscriptions.Subscribe(user.ID, plan.ID, "", "")
+	require.NoError(t, err)
+
+	effectiveFrom := env.clock.now.AddDate(0, 0, 45)
+	change, err := env.services.PriceChanges.SchedulePriceChange(plan.ID, 349, effectiveFrom)
+	require.NoError(t, err)
+	assert.Equal(t, 1, change.NotifiedCount)
+
+	notices, err := env.store.PriceChanges().FindNoticesByChange(change.ID)
+	require.NoError(t, err)
+	require.Len(t, notices, 1)
+	assert.Equal(t, subscription.EndDate.AddDate(0, 1, 0), notices[0].AppliesFrom,
+		"the renewal before the effective date keeps the old price")
+
+	// Продление до даты изменения идёт по старой цене
+	env.clock.now = subscription.EndDate.Add(-12 * time.Hour)
+	require.NoError(t, env.services.Subscriptions.RenewSubscriptions())
+	renewed, err := env.services.Subscriptions.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 299.0, renewed.BilledPlan().Price)
+
+	env.clock.now = effectiveFrom.Add(time.Hour)
+	applied, err := env.services.PriceChanges.ApplyDuePriceChanges()
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied)
+	updated, err := env.services.Plans.GetPlanByID(plan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 349.0, updated.Price)
+
+	env.clock.now = renewed.EndDate.Add(-12 * time.Hour)
+	require.NoError(t, env.services.Subscriptions.RenewSubscriptions())
+	renewed, err = env.services.Subscriptions.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 349.0, renewed.BilledPlan().Price)
+
+	_, err = env.services.PriceChanges.DeclinePriceChange(notices[0].Token)
+	assert.Error(t, err, "the new price already applies")
+}
+
+func TestSQLitePlanFeatures(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "user@example.com")
+	plan := env.createPlan(t, "Кинопоиск", 299)
+
+	_, err := env.services.Plans.SetPlanFeatures(plan.ID, []models.PlanFeature{
+		{Key: "quality", Type: models.FeatureTypeText, Value: "4K"},
+		{Key: "devices", Type: models.FeatureTypeLimit, Limit: 3},
+	})
+	require.NoError(t, err)
+	features, err := env.services.Plans.SetPlanFeatures(plan.ID, []models.PlanFeature{
+		{Key: "devices", Type: models.FeatureTypeLimit, Limit: 4},
+	})
+	require.NoError(t, err)
+	require.Len(t, features, 1, "features are replaced")
+
+	_, err = env.services.Subscriptions.Subscribe(user.ID, plan.ID, "", "")
+	require.NoError(t, err)
+	entitlements, err := env.services.Entitlements.Entitlements(user.ID)
+	require.NoError(t, err)
+	assert.True(t, entitlements.Allows("devices", 4))
+	assert.False(t, entitlements.Has("quality"))
+}
+
+func TestSQLiteMeteredBilling(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "user@example.com")
+	plan := env.createPlan(t, "Облако", 100)
+
+	_, err := env.services.Plans.SetMeteredComponents(plan.ID, []models.MeteredComponent{
+		{Key: "api_calls", Label: "Вызовы API", IncludedQuantity: 1000, OverageUnitPrice: 0.01},
+	})
+	require.NoError(t, err)
+	subscription, err := env.services.Subscriptions.Subscribe(user.ID, plan.ID, "", "")
+	require.NoError(t, err)
+	key, _, err := env.services.APIKeys.CreateAPIKey("gateway")
+	require.NoError(t, err)
+
+	for i, quantity := range []float64{800, 700} {
+		env.clock.now = env.clock.now.Add(time.Hour)
+		_, created, err := env.services.Usage.RecordUsage(key.ID, services.UsageReport{
+			SubscriptionID: subscription.ID,
+			Component:      "api_calls",
+			Quantity:       quantity,
+			EventID:        fmt.Sprintf("evt-%d", i),
+		})
+		require.NoError(t, err)
+		require.True(t, created)
+	}
+	_, created, err := env.services.Usage.RecordUsage(key.ID, services.UsageReport{
+		SubscriptionID: subscription.ID, Component: "api_calls", Quantity: 800, EventID: "evt-0",
+	})
+	require.NoError(t, err)
+	assert.False(t, created, "duplicate event is not counted")
+
+	other := env.registerUser(t, "other@example.com")
+	otherSubscription, err := env.services.Subscriptions.Subscribe(other.ID, plan.ID, "", "")
+	require.NoError(t, err)
+	_, created, err = env.services.Usage.RecordUsage(key.ID, services.UsageReport{
+		SubscriptionID: otherSubscription.ID, Component: "api_calls", Quantity: 1, EventID: "evt-0",
+	})
+	require.NoError(t, err)
+	assert.True(t, created, "event ids are scoped to the subscription")
+
+	env.clock.now = subscription.EndDate.Add(-12 * time.Hour)
+	require.NoError(t, env.services.Subscriptions.RenewSubscriptions())
+
+	invoices, err := env.services.Subscriptions.GetInvoices(subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, invoices, 2)
+	renewal := invoices[0]
+	assert.Equal(t, subscription.EndDate.Unix(), renewal.PeriodStart.Unix())
+	assert.Len(t, renewal.Lines, 1, "overage is billed after the period ends")
+	assert.Equal(t, 100.0, renewal.Total)
+
+	env.clock.now = subscription.EndDate.Add(-time.Hour)
+	_, created, err = env.services.Usage.RecordUsage(key.ID, services.UsageReport{
+		SubscriptionID: subscription.ID, Component: "api_calls", Quantity: 500, EventID: "evt-late",
+	})
+	require.NoError(t, err)
+	require.True(t, created, "usage after an early renewal belongs to the open period")
+	closed, err := env.services.Usage.BillClosedPeriods()
+	require.NoError(t, err)
+	assert.Zero(t, closed, "period has not ended")
+
+	env.clock.now = subscription.EndDate.Add(time.Hour)
+	closed, err = env.services.Usage.BillClosedPeriods()
+	require.NoError(t, err)
+	assert.Equal(t, 1, closed)
+	closed, err = env.services.Usage.BillClosedPeriods()
+	require.NoError(t, err)
+	assert.Zero(t, closed, "period is billed once")
+
+	// Перерасход закрытого периода добавляется в неоплаченный счёт продления
+	invoices, err = env.services.Subscriptions.GetInvoices(subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, invoices, 2)
+	renewal = invoices[0]
+	require.Len(t, renewal.Lines, 2)
+	assert.Equal(t, models.InvoiceLineOverage, renewal.Lines[1].Kind)
+	assert.Equal(t, 1000.0, renewal.Lines[1].Quantity)
+	assert.Equal(t, 110.0, renewal.Total)
+
+	_, _, err = env.services.Usage.RecordUsage(key.ID, services.UsageReport{
+		SubscriptionID: subscription.ID, Component: "api_calls", Quantity: 1, RecordedAt: subscription.EndDate.Add(-time.Minute),
+	})
+	assert.Error(t, err, "closed period")
+
+	usage, err := env.services.Usage.GetCurrentUsage(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, subscription.EndDate.Unix(), usage.PeriodStart.Unix())
+	assert.Zero(t, usage.OverageAmount, "new period starts empty")
+
+	// Оплаченный счёт продления не меняется: перерасход выставляется отдельным счётом
+	_, _, err = env.services.Usage.RecordUsage(key.ID, services.UsageReport{
+		SubscriptionID: subscription.ID, Component: "api_calls", Quantity: 1200, EventID: "evt-next",
+	})
+	require.NoError(t, err)
+	current, err := env.services.Subscriptions.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	env.clock.now = current.EndDate.Add(-12 * time.Hour)
+	require.NoError(t, env.services.Subscriptions.RenewSubscriptions())
+	invoices, err = env.services.Subscriptions.GetInvoices(subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, invoices, 3)
+	paid := invoices[0]
+	require.NoError(t, paid.MarkPaid("pay_next", env.clock.now))
+	require.NoError(t, env.store.Invoices().Save(&paid))
+
+	env.clock.now = current.EndDate.Add(time.Hour)
+	closed, err = env.services.Usage.BillClosedPeriods()
+	require.NoError(t, err)
+	assert.Equal(t, 1, closed)
+	invoices, err = env.services.Subscriptions.GetInvoices(subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, invoices, 4)
+	assert.Len(t, invoices[0].Lines, 1, "paid renewal invoice is not changed")
+	overage := invoices[1]
+	assert.Equal(t, current.StartDate.Unix(), overage.PeriodStart.Unix())
+	assert.Equal(t, current.EndDate.Unix(), overage.PeriodEnd.Unix())
+	require.Len(t, overage.Lines, 1)
+	assert.Equal(t, models.InvoiceLineOverage, overage.Lines[0].Kind)
+	assert.Equal(t, 2.0, overage.Total)
+
+	export, err := env.services.Accounts.ExportUserData(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, export.Invoices, 4)
+	assert.Len(t, export.Usage, 4)
+	assert.Equal(t, "evt-next", *export.Usage[0].EventID, "latest usage first")
+}
+
+func TestSQLiteCouponRedemption(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "user@example.com")
+	plan := env.createPlan(t, "Кинопоиск", 299)
+
+	coupon := &models.Coupon{Code: "welcome", DiscountType: models.CouponTypeFixed, AmountOff: 100, Duration: models.CouponDurationOnce, PlanIDs: []uint{plan.ID}}
+	require.NoError(t, env.services.Coupons.CreateCoupon(coupon))
+	assert.Equal(t, "WELCOME", coupon.Code)
+
+	stale, err := env.store.Coupons().FindByID(coupon.ID)
+	require.NoError(t, err)
+	subscription, err := env.services.Subscriptions.Subscribe(user.ID, plan.ID, "", "Welcome")
+	require.NoError(t, err)
+
+	// Купон, прочитанный до применения, не сбрасывает счётчик применений при сохранении
+	require.NoError(t, env.store.Coupons().Save(stale))
+	name := "Welcome back"
+	updated, err := env.services.Coupons.UpdateCoupon(coupon.ID, services.CouponUpdate{Name: &name})
+	require.NoError(t, err)
+	assert.Equal(t, []uint{plan.ID}, updated.PlanIDs)
+	stored, err := env.store.Coupons().FindByID(coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.RedemptionCount)
+	assert.Equal(t, name, stored.Name)
+	require.NoError(t, env.services.Coupons.DeleteCoupon(coupon.ID))
+
+	env.clock.now = subscription.EndDate.Add(-12 * time.Hour)
+	require.NoError(t, env.services.Subscriptions.RenewSubscriptions())
+	invoices, err := env.services.Subscriptions.GetInvoices(subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, invoices, 2)
+	assert.Equal(t, 299.0, invoices[0].Total, "once coupon covers only the first period")
+	assert.Equal(t, 199.0, invoices[1].Total)
+	assert.Equal(t, models.InvoiceLineDiscount, invoices[1].Lines[1].Kind)
+
+	other := env.registerUser(t, "other@example.com")
+	_, err = env.services.Subscriptions.Subscribe(other.ID, plan.ID, "", "WELCOME")
+	assert.ErrorIs(t, err, services.ErrInvalidPromoCode, "deleted coupon")
+}
+
+func TestSQLiteGiftRedemption(t *testing.T) {
+	env := newIntegrationEnv(t)
+	buyer := env.registerUser(t, "buyer@example.com")
+	friend := env.registerUser(t, "friend@example.com")
+	plan := env.createPlan(t, "Кинопоиск", 299)
+
+	gift, err := env.services.Gifts.PurchaseGift(buyer.ID, services.GiftPurchase{PlanID: plan.ID, RecipientEmail: "friend@example.com"})
+	require.NoError(t, err)
+	_, _, err = env.services.Gifts.RedeemGift(friend.ID, gift.Code)
+	assert.ErrorIs(t, err, services.ErrInvalidGiftCode, "unpaid gift")
+	gift.Status = models.GiftStatusPending
+	require.NoError(t, env.store.Gifts().Save(gift))
+
+	_, subscription, err := env.services.Gifts.RedeemGift(friend.ID, gift.Code)
+	require.NoError(t, err)
+	stored, err := env.services.Subscriptions.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.AutoRenew, "gift subscriptions do not renew automatically")
+	assert.Equal(t, plan.CalculateEndDate(env.clock.now).Unix(), stored.EndDate.Unix())
+
+	expired, err := env.services.Gifts.PurchaseGift(buyer.ID, services.GiftPurchase{PlanID: plan.ID, RecipientEmail: "friend@example.com"})
+	require.NoError(t, err)
+	expired.Status = models.GiftStatusPending
+	require.NoError(t, env.store.Gifts().Save(expired))
+	env.clock.now = expired.ExpiresAt
+	_, _, err = env.services.Gifts.RedeemGift(friend.ID, expired.Code)
+	assert.ErrorIs(t, err, services.ErrInvalidGiftCode)
+
+	gifts, err := env.services.Gifts.GetPurchasedGifts(buyer.ID)
+	require.NoError(t, err)
+	require.Len(t, gifts, 2)
+	assert.Equal(t, models.GiftStatusExpired, gifts[0].Status)
+	assert.Equal(t, models.GiftStatusRedeemed, gifts[1].Status)
+
+	export, err := env.services.Accounts.ExportUserData(friend.ID)
+	require.NoError(t, err)
+	require.Len(t, export.Gifts, 1, "redeemed gifts are exported to the recipient")
+	assert.Equal(t, gift.ID, export.Gifts[0].ID)
+	export, err = env.services.Accounts.ExportUserData(buyer.ID)
+	require.NoError(t, err)
+	assert.Len(t, export.Gifts, 2)
+}
+
+func TestSQLiteGiftDuplicatePolicy(t *testing.T) {
+	env := newIntegrationEnv(t)
+	buyer := env.registerUser(t, "buyer@example.com")
+	friend := env.registerUser(t, "friend@example.com")
+	monthly := env.createPlan(t, "Кинопоиск", 299)
+	yearly := &models.Plan{Name: "кинопоиск ", Price: 2990, Duration: 1, PeriodType: "years", IsActive: true}
+	require.NoError(t, env.services.Plans.CreatePlan(yearly))
+
+	existing, err := env.services.Subscriptions.Subscribe(friend.ID, monthly.ID, "", "")
+	require.NoError(t, err)
+	paidGift := func() *models.Gift {
+		gift, err := env.services.Gifts.PurchaseGift(buyer.ID, services.GiftPurchase{PlanID: yearly.ID, RecipientEmail: "friend@example.com"})
+		require.NoError(t, err)
+		gift.Status = models.GiftStatusPending
+		require.NoError(t, env.store.Gifts().Save(gift))
+		return gift
+	}
+
+	gift := paidGift()
+	_, _, err = env.services.Gifts.RedeemGift(friend.ID, gift.Code)
+	assert.ErrorIs(t, err, services.ErrDuplicateSubscription, "the default policy rejects another variant of the service")
+
+	t.Setenv("DUPLICATE_SUBSCRIPTION_POLICY", "change_plan")
+	redeemed, subscription, err := env.services.Gifts.RedeemGift(friend.ID, gift.Code)
+	require.NoError(t, err)
+	assert.True(t, redeemed.Extended)
+	assert.Equal(t, existing.ID, subscription.ID)
+	assert.Equal(t, yearly.ID, subscription.PlanID)
+	assert.Equal(t, yearly.CalculateEndDate(env.clock.now).Unix(), subscription.EndDate.Unix())
+
+	_, _, err = env.services.Gifts.RedeemGift(friend.ID, paidGift().Code)
+	assert.ErrorIs(t, err, services.ErrDuplicateSubscription, "change_plan rejects the same plan")
+
+	active, err := env.store.Subscriptions().FindActiveByUser(friend.ID)
+	require.NoError(t, err)
+	assert.Len(t, active, 1)
+}
+
+func TestSQLiteFamilySeats(t *testing.T) {
+	env := newIntegrationEnv(t)
+	owner := env.registerUser(t, "owner@example.com")
+	member := env.registerUser(t, "member@example.com")
+	single := env.createPlan(t, "Индивидуальный", 199)
+	assert.Equal(t, 1, single.Seats)
+
+	plan := &models.Plan{Name: "Семейный", Price: 300, Duration: 1, PeriodType: "months", IsActive: true, Seats: 2}
+	require.NoError(t, env.services.Plans.CreatePlan(plan))
+	subscription, err := env.services.Subscriptions.Subscribe(owner.ID, plan.ID, "", "")
+	require.NoError(t, err)
+
+	invitation, err := env.services.Family.InviteMember(owner.ID, subscription.ID, "member@example.com")
+	require.NoError(t, err)
+	_, err = env.services.Family.InviteMember(owner.ID, subscription.ID, "other@example.com")
+	assert.ErrorIs(t, err, services.ErrNoFreeSeats)
+
+	_, err = env.services.Family.AcceptInvitation(member.ID, invitation.Token)
+	require.NoError(t, err)
+	active, err := env.services.Subscriptions.GetActiveSubscriptions(member.ID)
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	assert.True(t, active[0].Shared)
+	assert.Equal(t, 2, active[0].Plan.Seats)
+
+	overview, err := env.services.Family.GetFamily(owner.ID, subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, overview.OccupiedSeats)
+	assert.Equal(t, 150.0, overview.Members[1].MonthlyShare)
+}
+
+func TestSQLiteCostSplitRenewal(t *testing.T) {
+	env := newIntegrationEnv(t)
+	owner := env.registerUser(t, "owner@example.com")
+	flatmate := env.registerUser(t, "flatmate@example.com")
+	plan := env.createPlan(t, "Музыка", 300)
+	subscription, err := env.services.Subscriptions.Subscribe(owner.ID, plan.ID, "", "")
+	require.NoError(t, err)
+
+	split, err := env.services.Splits.SetSplit(owner.ID, subscription.ID, services.SplitConfig{
+		Mode: models.SplitModeCustom,
+		Participants: []services.SplitParticipantInput{
+			{Email: "flatmate@example.com", Share: 40}, {Name: "Гость", Share: 10},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, split.Participants, 2)
+
+	env.clock.now = subscription.EndDate.Add(-12 * time.Hour)
+	require.NoError(t, env.services.Subscriptions.RenewSubscriptions())
+
+	splits, err := env.services.Splits.GetSplits(flatmate.ID)
+	require.NoError(t, err)
+	require.Len(t, splits, 1)
+	assert.Equal(t, 120.0, splits[0].Participants[0].Balance)
+	assert.Equal(t, 30.0, splits[0].Participants[1].Balance)
+	assert.True(t, splits[0].Participants[1].Active)
+
+	_, err = env.services.Splits.SettleUp(flatmate.ID, subscription.ID, services.SettleUp{ParticipantID: split.Participants[0].ID, Amount: 120})
+	require.NoError(t, err)
+	entries, err := env.services.Splits.GetLedger(owner.ID, subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, models.SplitEntryPayment, entries[0].Kind)
+	assert.Equal(t, 0.0, entries[0].BalanceAfter)
+
+	stats, err := env.services.Subscriptions.GetSubscriptionStats(flatmate.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 120.0, stats["effective_monthly_share"])
+	assert.Equal(t, 0.0, stats["split_owed_by_me"])
+}
+
+func TestSQLiteAuditRetention(t *testing.T) {
+	t.Setenv("AUDIT_RETENTION_DAYS", "30")
+	env := newIntegrationEnv(t)
+	admin := env.registerUser(t, "security@example.com")
+
+	_, err := env.services.Audit.Record(services.AuditRequest{ActorID: &admin.ID, RequestID: "old", Status: 200},
+		services.AuditChange{Action: "plan.update", TargetType: "plan", TargetID: "1", Before: map[string]float64{"price": 199}, After: map[string]float64{"price": 249}})
+	require.NoError(t, err)
+
+	env.clock.now = env.clock.now.AddDate(0, 0, 20)
+	_, err = env.services.Audit.Record(services.AuditRequest{RequestID: "recent", Status: 401},
+		services.AuditChange{Action: "auth.login", TargetType: "user", TargetID: "security@example.com"})
+	require.NoError(t, err)
+
+	entries, err := env.services.Audit.GetEntries(repository.AuditFilter{TargetType: "plan", TargetID: "1"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.JSONEq(t, `{"price": {"before": 199, "after": 249}}`, string(entries[0].Changes))
+
+	entries, err = env.services.Audit.GetEntries(repository.AuditFilter{Action: "user.email_verified"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "email verification is recorded by the event subscriber")
+	assert.Equal(t, &admin.ID, entries[0].ActorID)
+
+	env.clock.now = env.clock.now.AddDate(0, 0, 15)
+	purged, err := env.services.Audit.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+
+	entries, err = env.services.Audit.GetEntries(repository.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "recent", entries[0].RequestID)
+}
+
+func TestSQLiteWebhookRetries(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "hooks@example.com")
+	plan := env.createPlan(t, "Музыка", 300)
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+
+	var calls int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer receiver.Close()
+
+	endpoint, _, err := env.services.Webhooks.CreateEndpoint(&user.ID, services.WebhookInput{
+		URL: receiver.URL, Events: []string{models.WebhookEventSubscriptionCreated},
+	})
+	require.NoError(t, err)
+	_, err = env.services.Subscriptions.Subscribe(user.ID, plan.ID, "", "")
+	require.NoError(t, err)
+
+	// Доставку, занятую другим обработчиком, задача не отправляет до окончания срока
+	due, err := env.store.Webhooks().FindDueDeliveries(env.clock.now)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	claimed, err := env.store.Webhooks().ClaimDelivery(due[0].ID, env.clock.now, env.clock.now.Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, claimed)
+	claimed, err = env.store.Webhooks().ClaimDelivery(due[0].ID, env.clock.now, env.clock.now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed, "a delivery is claimed once")
+	attempted, err := env.services.Webhooks.DeliverDue()
+	require.NoError(t, err)
+	assert.Zero(t, attempted)
+	assert.Zero(t, calls)
+
+	env.clock.now = env.clock.now.Add(time.Minute)
+	attempted, err = env.services.Webhooks.DeliverDue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted, "an abandoned claim expires")
+
+	env.clock.now = env.clock.now.Add(time.Minute)
+	attempted, err = env.services.Webhooks.DeliverDue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	deliveries, err := env.services.Webhooks.GetDeliveries(&user.ID, endpoint.ID)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.WebhookDeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusOK, deliveries[0].ResponseCode)
+	assert.Equal(t, 2, calls)
+}
+
+func TestSQLiteIdempotencyKeys(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "user@example.com")
+
+	record, replay, err := env.services.Idempotency.Begin(user.ID, "key-1", "hash-1")
+	require.NoError(t, err)
+	assert.False(t, replay)
+	_, _, err = env.services.Idempotency.Begin(user.ID, "key-1", "hash-1")
+	assert.ErrorIs(t, err, services.ErrIdempotencyInProgress)
+
+	// Ключ запроса, который упал и не сохранил ответ, освобождается после окончания аренды
+	abandoned, _, err := env.services.Idempotency.Begin(user.ID, "crashed", "hash-1")
+	require.NoError(t, err)
+	env.clock.now = env.clock.now.Add(env.services.Idempotency.GetLease() - time.Second)
+	_, _, err = env.services.Idempotency.Begin(user.ID, "crashed", "hash-1")
+	assert.ErrorIs(t, err, services.ErrIdempotencyInProgress)
+	env.clock.now = env.clock.now.Add(time.Second)
+	reclaimed, replay, err := env.services.Idempotency.Begin(user.ID, "crashed", "hash-1")
+	require.NoError(t, err)
+	assert.False(t, replay)
+	assert.True(t, reclaimed.CreatedAt.After(abandoned.CreatedAt))
+
+	require.NoError(t, env.services.Idempotency.Complete(record, 201, "application/json", []byte(`{"id":1}`)))
+	replayed, replay, err := env.services.Idempotency.Begin(user.ID, "key-1", "hash-1")
+	require.NoError(t, err)
+	assert.True(t, replay)
+	assert.Equal(t, `{"id":1}`, replayed.ResponseBody)
+	_, _, err = env.services.Idempotency.Begin(user.ID, "key-1", "hash-2")
+	assert.ErrorIs(t, err, services.ErrIdempotencyKeyReused)
+
+	env.clock.now = env.clock.now.Add(25 * time.Hour)
+	purged, err := env.services.Idempotency.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+	_, replay, err = env.services.Idempotency.Begin(user.ID, "key-1", "hash-2")
+	require.NoError(t, err)
+	assert.False(t, replay, "expired key can be used again")
+}
+
+// Тесты TestSQLiteConcurrent* проверяют итог одновременных запросов на SQLite. Соединение с базой
+// одно (SetMaxOpenConns(1)), а FOR UPDATE SQLite не поддерживает, поэтому транзакции выполняются
+// по очереди и блокировки строк здесь не проверяются. Конфликт версии при сохранении устаревшей
+// копии через сервис проверяет TestRenewSubscriptionWithStaleVersionConflicts в пакете services
+func TestSQLiteConcurrentRenewals(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "user@example.com")
+	plan := env.createPlan(t, "Кинопоиск", 299)
+	subscription, err := env.services.Subscriptions.Subscribe(user.ID, plan.ID, "", "")
+	require.NoError(t, err)
+	env.clock.now = subscription.EndDate.Add(-12 * time.Hour)
+
+	const manual = 10
+	// Все запросы стартуют одновременно, чтобы задача успела выбрать подписку до ручных продлений
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < manual; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			assert.NoError(t, env.services.Subscriptions.RenewSubscription(subscription.ID, user.ID))
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			assert.NoError(t, env.services.Subscriptions.RenewSubscriptions())
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	invoices, err := env.services.Subscriptions.GetInvoices(subscription.ID)
+	require.NoError(t, err)
+	renewals := len(invoices) - 1
+	assert.GreaterOrEqual(t, renewals, manual)
+	assert.LessOrEqual(t, renewals, manual+1, "the job renews a period only once")
+
+	stored, err := env.services.Subscriptions.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, subscription.EndDate.AddDate(0, renewals, 0).Unix(), stored.EndDate.Unix())
+	assert.Equal(t, uint(renewals), stored.Version)
+
+	// Копия, прочитанная до продлений, не перезаписывает их
+	subscription.Status = "cancelled"
+	assert.ErrorIs(t, env.store.Subscriptions().Save(subscription), repository.ErrConflict)
+	stored, err = env.services.Subscriptions.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "active", stored.Status)
+}
+
+func TestSQLiteConcurrentDuplicateSubscriptions(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "user@example.com")
+	plan := env.createPlan(t, "Кинопоиск", 299)
+
+	const requests = 8
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := env.services.Subscriptions.Subscribe(user.ID, plan.ID, "", "")
+			if err != nil {
+				assert.ErrorIs(t, err, services.ErrDuplicateSubscription)
+				return
+			}
+			mu.Lock()
+			created++
+			mu.Unlock()
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, 1, created)
+	active, err := env.services.Subscriptions.GetActiveSubscriptions(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, active, 1, "parallel requests do not both pass the duplicate check")
+}
+
+// runConcurrently запускает fn в n горутинах одновременно и ждёт их завершения
+func runConcurrently(n int, fn func(i int)) {
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+}
+
+func TestSQLiteConcurrentGiftRedemptions(t *testing.T) {
+	env := newIntegrationEnv(t)
+	buyer := env.registerUser(t, "buyer@example.com")
+	plan := env.createPlan(t, "Кинопоиск", 299)
+	gift, err := env.services.Gifts.PurchaseGift(buyer.ID, services.GiftPurchase{PlanID: plan.ID, RecipientEmail: "friend@example.com"})
+	require.NoError(t, err)
+	gift.Status = models.GiftStatusPending
+	require.NoError(t, env.store.Gifts().Save(gift))
+
+	const recipients = 6
+	users := make([]*models.User, recipients)
+	for i := range users {
+		users[i] = env.registerUser(t, fmt.Sprintf("friend%d@example.com", i))
+	}
+	var redeemed atomic.Int32
+	runConcurrently(recipients, func(i int) {
+		_, _, err := env.services.Gifts.RedeemGift(users[i].ID, gift.Code)
+		if err != nil {
+			assert.ErrorIs(t, err, services.ErrInvalidGiftCode)
+			return
+		}
+		redeemed.Add(1)
+	})
+
+	assert.Equal(t, int32(1), redeemed.Load(), "a gift code is redeemed once")
+	stored, err := env.store.Gifts().FindByID(gift.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.GiftStatusRedeemed, stored.Status)
+}
+
+func TestSQLiteConcurrentPriceChangeDeclines(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "user@example.com")
+	plan := env.createPlan(t, "Кинопоиск", 299)
+	subscription, err := env.services.Subscriptions.Subscribe(user.ID, plan.ID, "", "")
+	require.NoError(t, err)
+	change, err := env.services.PriceChanges.SchedulePriceChange(plan.ID, 349, env.clock.now.AddDate(0, 0, 45))
+	require.NoError(t, err)
+	notices, err := env.store.PriceChanges().FindNoticesByChange(change.ID)
+	require.NoError(t, err)
+	require.Len(t, notices, 1)
+
+	runConcurrently(6, func(int) {
+		_, err := env.services.PriceChanges.DeclinePriceChange(notices[0].Token)
+		assert.NoError(t, err)
+	})
+
+	stored, err := env.store.PriceChanges().FindByID(change.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.DeclinedCount, "repeated clicks on the link count one decline")
+	declined, err := env.services.Subscriptions.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.False(t, declined.AutoRenew)
+	history, err := env.services.Subscriptions.GetHistory(subscription.ID)
+	require.NoError(t, err)
+	assert.Len(t, history, 2, "auto-renewal is switched off once")
+}
+
+func TestSQLiteConcurrentPlanDeletion(t *testing.T) {
+	env := newIntegrationEnv(t)
+	user := env.registerUser(t, "user@example.com")
+	plan := env.createPlan(t, "Кинопоиск", 299)
+
+	var subscribeErr, deleteErr error
+	runConcurrently(2, func(i int) {
+		if i == 0 {
+			_, subscribeErr = env.services.Subscriptions.Subscribe(user.ID, plan.ID, "", "")
+		} else {
+			_, deleteErr = env.services.Plans.DeletePlan(plan.ID, services.PlanDeletionBlock, 0, 1)
+		}
+	})
+
+	// Либо подписка оформлена и удаление заблокировано, либо план удалён до подписки
+	if subscribeErr == nil {
+		assert.ErrorIs(t, deleteErr, services.ErrPlanHasSubscribers)
+		_, err := env.services.Plans.GetPlanByID(plan.ID)
+		assert.NoError(t, err)
+	} else {
+		assert.NoError(t, deleteErr)
+		active, err := env.services.Subscriptions.GetActiveSubscriptions(user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, active)
+	}
+}
+
+func TestSQLiteConcurrentCouponRedemptions(t *testing.T) {
+	env := newIntegrationEnv(t)
+	plan := env.createPlan(t, "Кинопоиск", 299)
+	coupon := &models.Coupon{Code: "limited", DiscountType: models.CouponTypeFixed, AmountOff: 100, Duration: models.CouponDurationOnce, MaxRedemptions: 3}
+	require.NoError(t, env.services.Coupons.CreateCoupon(coupon))
+
+	const subscribers = 8
+	users := make([]*models.User, subscribers)
+	for i := range users {
+		users[i] = env.registerUser(t, fmt.Sprintf("user%d@example.com", i))
+	}
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	redeemed := 0
+	for _, user := range users {
+		wg.Add(1)
+		go func(userID uint) {
+			defer wg.Done()
+			<-start
+			_, err := env.services.Subscriptions.Subscribe(userID, plan.ID, "", "LIMITED")
+			if err != nil {
+				assert.ErrorIs(t, err, services.ErrInvalidPromoCode)
+				return
+			}
+			mu.Lock()
+			redeemed++
+			mu.Unlock()
+		}(user.ID)
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, 3, redeemed)
+	stored, err := env.store.Coupons().FindByID(coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stored.RedemptionCount)
+	incremented, err := env.store.Coupons().IncrementRedemptions(coupon.ID)
+	require.NoError(t, err)
+	assert.False(t, incremented, "limit is checked by the update itself")
+}
+
+func TestSQLitePaymentEventDuplicateInsert(t *testing.T) {
+	env := newIntegrationEnv(t)
+	event := models.PaymentEvent{EventID: "evt_1", Type: models.PaymentEventPaymentSucceeded, Result: models.PaymentEventIgnored}
+	require.NoError(t, env.store.PaymentEvents().Create(&event))
+
+	copied := models.PaymentEvent{EventID: "evt_1", Type: models.PaymentEventPaymentSucceeded, Result: models.PaymentEventIgnored}
+	assert.ErrorIs(t, env.store.PaymentEvents().Create(&copied), repository.ErrDuplicate)
+}
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/handlers"
+	"github.com/saneechka/ManageSubscription/internal/middleware"
+	"github.com/saneechka/ManageSubscription/internal/oidc"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/internal/services"
+)
+
+// Services содержит сервисы приложения, собранные поверх одного хранилища
+type Services struct {
+	// Events - шина доменных событий, на которую подписываются реакции на действия сервисов
+	Events        *services.EventBus
+	Users         *services.UserService
+	Plans         *services.PlanService
+	Subscriptions *services.SubscriptionService
+	Accounts      *services.AccountService
+	OIDC          *services.OIDCService
+	Organizations *services.OrganizationService
+	PriceChanges  *services.PriceChangeService
+	Entitlements  *services.EntitlementService
+	Usage         *services.UsageService
+	APIKeys       *services.APIKeyService
+	Coupons       *services.CouponService
+	Gifts         *services.GiftService
+	Family        *services.FamilyService
+	Splits        *services.SplitService
+	Audit         *services.AuditService
+	Webhooks      *services.WebhookService
+	Payments      *services.PaymentService
+	Idempotency   *services.IdempotencyService
+}
+
+// NewServices создает сервисы и связывает их зависимости
+func NewServices(store repository.Store, clock services.Clock, registry *oidc.Registry) *Services {
+	events := services.NewEventBus()
+	users := services.NewUserService(store, clock, events)
+	subscriptions := services.NewSubscriptionService(store, clock, events)
+	gifts := services.NewGiftService(store, clock, events, users)
+
+	return &Services{
+		Events:        events,
+		Users:         users,
+		Plans:         services.NewPlanService(store, clock, events),
+		Subscriptions: subscriptions,
+		Accounts:      services.NewAccountService(store, clock, subscriptions, users),
+		OIDC:          services.NewOIDCService(store, clock, registry, users),
+		Organizations: services.NewOrganizationService(store, clock, users),
+		PriceChanges:  services.NewPriceChangeService(store, clock, subscriptions, users),
+		Entitlements:  services.NewEntitlementService(store, clock),
+		Usage:         services.NewUsageService(store, clock),
+		APIKeys:       services.NewAPIKeyService(store, clock, users),
+		Coupons:       services.NewCouponService(store, clock),
+		Gifts:         gifts,
+		Family:        services.NewFamilyService(store, clock, users),
+		Splits:        services.NewSplitService(store, clock),
+		Audit:         services.NewAuditService(store, clock),
+		Webhooks:      services.NewWebhookService(store, clock),
+		Payments:      services.NewPaymentService(store, clock, events),
+		Idempotency:   services.NewIdempotencyService(store, clock),
+	}
+}
+
+// RegisterSubscribers подписывает реакции на доменные события: вебхуки, письма и журнал аудита.
+// Сервисы публикуют события и не вызывают эти реакции напрямую
+func RegisterSubscribers(svc *Services) {
+	services.SubscribeSubscriptionEvents(svc.Events, svc.Webhooks.EnqueueSubscriptionEvent)
+	services.SubscribeSubscriptionEvents(svc.Events, svc.Audit.RecordSubscriptionEvent)
+	services.Subscribe(svc.Events, svc.Audit.RecordEmailVerified)
+
+	services.SubscribeAsync(svc.Events, svc.Users.SendVerificationEmail)
+	services.SubscribeAsync(svc.Events, svc.Gifts.SendGiftCode)
+}
+
+// NewRouter создает HTTP-роутер со всеми маршрутами API и раздачей фронтенда
+func NewRouter(svc *Services) *gin.Engine {
+	router := gin.Default()
+	router.Use(middleware.RequestID())
+
+	router.Use(func(c *gin.Context) {
+		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Authorization, Content-Type, X-API-Key, X-Request-ID, Idempotency-Key")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Idempotent-Replayed")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	})
+
+	router.Static("/static", "./web/frontend/build/static")
+	router.StaticFile("/favicon.ico", "./web/frontend/build/favicon.ico")
+	router.StaticFile("/manifest.json", "./web/frontend/build/manifest.json")
+	router.StaticFile("/logo192.png", "./web/frontend/build/logo192.png")
+	router.StaticFile("/logo512.png", "./web/frontend/build/logo512.png")
+
+	userHandler := handlers.NewUserHandler(svc.Users, svc.Accounts)
+	planHandler := handlers.NewPlanHandler(svc.Plans)
+	subscriptionHandler := handlers.NewSubscriptionHandler(svc.Subscriptions, svc.Organizations)
+	oidcHandler := handlers.NewOIDCHandler(svc.OIDC)
+	organizationHandler := handlers.NewOrganizationHandler(svc.Organizations)
+	priceChangeHandler := handlers.NewPriceChangeHandler(svc.PriceChanges)
+	entitlementHandler := handlers.NewEntitlementHandler(svc.Entitlements)
+	usageHandler := handlers.NewUsageHandler(svc.Usage, svc.Subscriptions, svc.Organizations)
+	apiKeyHandler := handlers.NewAPIKeyHandler(svc.APIKeys)
+	couponHandler := handlers.NewCouponHandler(svc.Coupons)
+	giftHandler := handlers.NewGiftHandler(svc.Gifts)
+	familyHandler := handlers.NewFamilyHandler(svc.Family)
+	splitHandler := handlers.NewSplitHandler(svc.Splits)
+	auditHandler := handlers.NewAuditHandler(svc.Audit)
+	webhookHandler := handlers.NewWebhookHandler(svc.Webhooks, false)
+	adminWebhookHandler := handlers.NewWebhookHandler(svc.Webhooks, true)
+	paymentHandler := handlers.NewPaymentHandler(svc.Payments)
+
+	api := router.Group("/api")
+	{
+		// Публичные эндпоинты
+		api.POST("/register", userHandler.Register)
+		api.POST("/login", middleware.Audit(svc.Audit, "auth.login"), userHandler.Login)
+
+		// Вход через внешних провайдеров (OpenID Connect)
+		api.GET("/auth/providers", oidcHandler.GetProviders)
+		api.GET("/auth/:provider/login", oidcHandler.Login)
+		api.GET("/auth/:provider/callback", middleware.Audit(svc.Audit, "auth.oidc_login"), oidcHandler.Callback)
+
+		// Новые маршруты для подтверждения email
+		api.GET("/verify-email", userHandler.VerifyEmail)
+		api.POST("/resend-verification", userHandler.ResendVerification)
+		api.GET("/confirm-email-change", middleware.Audit(svc.Audit, "user.email_change_confirm"), userHandler.ConfirmEmailChange)
+		api.GET("/account/restore", middleware.Audit(svc.Audit, "user.restore"), userHandler.RestoreAccount)
+		api.GET("/price-changes/decline", priceChangeHandler.DeclinePriceChange)
+
+		// Эндпоинты для планов
+		// Важно: более специфичные маршруты должны быть выше, чем общие
+		api.GET("/plans/filter", planHandler.FilterPlansByPrice)
+		api.GET("/plans/service", subscriptionHandler.GetPlansForService)
+		api.GET("/plans/related/:planId", subscriptionHandler.GetRelatedPlans) // Изменили маршрут
+		api.GET("/plans/:id", planHandler.GetPlanByID)
+		api.GET("/plans/:id/history", planHandler.GetPriceHistory)
+		api.GET("/plans/:id/features", planHandler.GetPlanFeatures)
+		api.GET("/plans/:id/metered-components", planHandler.GetMeteredComponents)
+		api.GET("/plans", planHandler.GetAllPlans)
+
+		// Служебные эндпоинты внешних систем, авторизация по ключу API
+		integrations := api.Group("/")
+		integrations.Use(middleware.APIKeyRequired(svc.APIKeys))
+		{
+			integrations.POST("/usage", usageHandler.RecordUsage)
+		}
+
+		// События платёжного провайдера, авторизация по подписи тела запроса
+		api.POST("/payments/webhook", paymentHandler.HandleWebhook)
+
+		protected := api.Group("/")
+		// Повтор POST и PUT запроса с тем же Idempotency-Key получает сохранённый ответ
+		protected.Use(middleware.AuthMiddleware(svc.Users), middleware.Idempotency(svc.Idempotency))
+		{
+			protected.GET("/profile", userHandler.GetProfile)
+			protected.PUT("/profile", userHandler.UpdateProfile)
+			protected.DELETE("/profile", middleware.Audit(svc.Audit, "user.delete"), userHandler.DeleteAccount)
+			protected.GET("/profile/export", userHandler.ExportProfile)
+			protected.POST("/profile/email", middleware.Audit(svc.Audit, "user.email_change_request"), userHandler.RequestEmailChange)
+
+			protected.GET("/subscriptions", subscriptionHandler.GetUserSubscriptions)
+			protected.GET("/subscriptions/active", subscriptionHandler.GetActiveSubscriptions)
+			protected.GET("/subscriptions/stats", subscriptionHandler.GetSubscriptionStats)
+			protected.GET("/subscriptions/search", subscriptionHandler.SearchSubscriptions)
+			protected.GET("/subscriptions/duplicates", subscriptionHandler.GetDuplicateSubscriptions)
+			protected.GET("/subscriptions/:id", subscriptionHandler.GetSubscriptionByID)
+			protected.POST("/subscriptions", subscriptionHandler.Subscribe)
+			protected.PUT("/subscriptions/:id/cancel", subscriptionHandler.CancelSubscription)
+			protected.PUT("/subscriptions/:id/auto-renew", subscriptionHandler.UpdateAutoRenewal)
+			protected.PUT("/subscriptions/:id/renew", subscriptionHandler.RenewSubscription)
+			protected.GET("/subscriptions/:id/history", subscriptionHandler.GetSubscriptionHistory)
+			protected.GET("/subscriptions/:id/usage", usageHandler.GetSubscriptionUsage)
+			protected.GET("/subscriptions/:id/invoices", usageHandler.GetSubscriptionInvoices)
+			protected.GET("/subscriptions/:id/family", familyHandler.GetFamily)
+			protected.POST("/subscriptions/:id/family/invitations", familyHandler.InviteMember)
+			protected.DELETE("/subscriptions/:id/family/invitations/:invitationId", familyHandler.RevokeInvitation)
+			protected.DELETE("/subscriptions/:id/family/members/:userId", familyHandler.RemoveMember)
+			protected.POST("/family/accept", familyHandler.AcceptInvitation)
+			protected.GET("/splits", splitHandler.GetSplits)
+			protected.GET("/subscriptions/:id/split", splitHandler.GetSplit)
+			protected.PUT("/subscriptions/:id/split", splitHandler.SetSplit)
+			protected.POST("/subscriptions/:id/split/settle", splitHandler.SettleUp)
+			protected.GET("/subscriptions/:id/split/ledger", splitHandler.GetLedger)
+			protected.POST("/gifts", giftHandler.PurchaseGift)
+			protected.GET("/gifts", giftHandler.GetGifts)
+			protected.POST("/gifts/redeem", giftHandler.RedeemGift)
+
+			protected.GET("/entitlements", entitlementHandler.GetEntitlements)
+
+			protected.GET("/webhooks", webhookHandler.GetWebhooks)
+			protected.POST("/webhooks", webhookHandler.CreateWebhook)
+			protected.PUT("/webhooks/:id", webhookHandler.UpdateWebhook)
+			protected.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+			protected.GET("/webhooks/:id/deliveries", webhookHandler.GetDeliveries)
+			protected.POST("/webhooks/:id/test", webhookHandler.SendTestEvent)
+
+			protected.POST("/organizations", organizationHandler.CreateOrganization)
+			protected.GET("/organizations", organizationHandler.GetUserOrganizations)
+			protected.GET("/organizations/:id", organizationHandler.GetOrganization)
+			protected.GET("/organizations/:id/members", organizationHandler.GetMembers)
+			protected.PUT("/organizations/:id/members/:userId", middleware.Audit(svc.Audit, "organization.member_role_change"), organizationHandler.UpdateMemberRole)
+			protected.DELETE("/organizations/:id/members/:userId", middleware.Audit(svc.Audit, "organization.member_remove"), organizationHandler.RemoveMember)
+			protected.POST("/organizations/:id/invitations", organizationHandler.InviteMember)
+			protected.GET("/organizations/:id/subscriptions", organizationHandler.GetOrganizationSubscriptions)
+			protected.GET("/organizations/:id/stats", organizationHandler.GetOrganizationStats)
+			protected.POST("/invitations/accept", organizationHandler.AcceptInvitation)
+
+			admin := protected.Group("/admin")
+			// Журнал аудита подключается до проверки прав, чтобы записывать и отклонённые попытки
+			admin.Use(middleware.Audit(svc.Audit, ""), middleware.AdminRequired(svc.Users))
+			{
+				admin.POST("/plans", planHandler.CreatePlan)
+				admin.PUT("/plans/:id", planHandler.UpdatePlan)
+				admin.DELETE("/plans/:id", planHandler.DeletePlan)
+				admin.PUT("/plans/:id/features", planHandler.SetPlanFeatures)
+				admin.PUT("/plans/:id/metered-components", planHandler.SetMeteredComponents)
+				admin.POST("/plans/:id/price-changes", priceChangeHandler.SchedulePriceChange)
+				admin.GET("/plans/:id/price-changes", priceChangeHandler.GetPriceChanges)
+				admin.GET("/subscriptions/orphaned", subscriptionHandler.GetOrphanedSubscriptions)
+				admin.GET("/subscriptions/duplicates", subscriptionHandler.GetAllDuplicateSubscriptions)
+				admin.POST("/api-keys", apiKeyHandler.CreateAPIKey)
+				admin.GET("/api-keys", apiKeyHandler.GetAPIKeys)
+				admin.DELETE("/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+				admin.GET("/coupons", couponHandler.GetCoupons)
+				admin.POST("/coupons", couponHandler.CreateCoupon)
+				admin.GET("/coupons/:id", couponHandler.GetCoupon)
+				admin.PUT("/coupons/:id", couponHandler.UpdateCoupon)
+				admin.DELETE("/coupons/:id", couponHandler.DeleteCoupon)
+				admin.GET("/coupons/:id/stats", couponHandler.GetCouponStats)
+				admin.GET("/audit-log", auditHandler.GetAuditLog)
+				admin.GET("/webhooks", adminWebhookHandler.GetWebhooks)
+				admin.POST("/webhooks", adminWebhookHandler.CreateWebhook)
+				admin.PUT("/webhooks/:id", adminWebhookHandler.UpdateWebhook)
+				admin.DELETE("/webhooks/:id", adminWebhookHandler.DeleteWebhook)
+				admin.GET("/webhooks/:id/deliveries", adminWebhookHandler.GetDeliveries)
+				admin.POST("/webhooks/:id/test", adminWebhookHandler.SendTestEvent)
+			}
+		}
+	}
+
+	router.NoRoute(func(c *gin.Context) {
+		c.File("./web/frontend/build/index.html")
+	})
+
+	return router
+}
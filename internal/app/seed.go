@@ -4,10 +4,11 @@ import (
 	"log"
 
 	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
 )
 
 // SeedPopularSubscriptions adds popular subscription services to the database if they don't exist
-func SeedPopularSubscriptions() {
+func SeedPopularSubscriptions(plans repository.PlanRepository) {
 	log.Println("Инициализация данных популярных подписок...")
 
 	// Список популярных сервисов с месячными подписками
@@ -244,14 +245,12 @@ func SeedPopularSubscriptions() {
 
 	// Добавляем каждый сервис, если он ещё не существует
 	for _, service := range allPlans {
-		var existingService models.Plan
 		// Ищем по имени, длительности и типу периода
-		result := DB.Where("name = ? AND duration = ? AND period_type = ?",
-			service.Name, service.Duration, service.PeriodType).First(&existingService)
+		_, err := plans.FindByNameAndPeriod(service.Name, service.Duration, service.PeriodType)
 
 		// Если сервис не существует, добавляем его
-		if result.Error != nil {
-			if err := DB.Create(&service).Error; err != nil {
+		if err != nil {
+			if err := plans.Create(&service); err != nil {
 				log.Printf("Ошибка при добавлении сервиса %s (%s): %v", service.Name, service.PeriodType, err)
 			} else {
 				log.Printf("Добавлен новый сервис: %s (%s)", service.Name, service.PeriodType)
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateAPIKey создает ключ; значение ключа возвращается только в этом ответе
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	auditAction(c, "api_key.create", "api_key", "")
+
+	var request CreateAPIKeyRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, raw, err := h.apiKeyService.CreateAPIKey(request.Name)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	auditAction(c, "", "api_key", strconv.FormatUint(uint64(key.ID), 10))
+	auditChanges(c, nil, key)
+
+	serializer.MyJSON(c, http.StatusCreated, gin.H{"api_key": key, "key": raw})
+}
+
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeyService.GetAPIKeys()
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"api_keys": keys})
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	auditAction(c, "api_key.revoke", "api_key", c.Param("id"))
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	key, err := h.apiKeyService.RevokeAPIKey(uint(id))
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"api_key": key})
+}
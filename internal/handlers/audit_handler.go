@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// GetAuditLog возвращает записи журнала аудита с фильтрами по пользователю, действию, объекту,
+// запросу и интервалу времени
+func (h *AuditHandler) GetAuditLog(c *gin.Context) {
+	filter := repository.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		RequestID:  c.Query("request_id"),
+		Limit:      defaultAuditLimit,
+	}
+
+	if value := c.Query("actor_id"); value != "" {
+		actorID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid actor ID"})
+			return
+		}
+		id := uint(actorID)
+		filter.ActorID = &id
+	}
+	var ok bool
+	if filter.From, ok = parseAuditTime(c, "from"); !ok {
+		return
+	}
+	if filter.To, ok = parseAuditTime(c, "to"); !ok {
+		return
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxAuditLimit)})
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		filter.Offset = offset
+	}
+
+	entries, err := h.auditService.GetEntries(filter)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"entries": entries})
+}
+
+// parseAuditTime разбирает необязательный параметр запроса со временем в формате RFC 3339
+func parseAuditTime(c *gin.Context, param string) (*time.Time, bool) {
+	value := c.Query(param)
+	if value == "" {
+		return nil, true
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid " + param + " time, expected RFC 3339"})
+		return nil, false
+	}
+	return &at, true
+}
+
+// auditAction называет действие и его объект для журнала аудита. Пустое action оставляет
+// название, заданное маршруту
+func auditAction(c *gin.Context, action, targetType, targetID string) {
+	change := currentAuditChange(c)
+	if action != "" {
+		change.Action = action
+	}
+	change.TargetType = targetType
+	change.TargetID = targetID
+	c.Set(services.AuditChangeKey, change)
+}
+
+// auditChanges добавляет к записи журнала аудита состояние объекта до и после действия
+func auditChanges(c *gin.Context, before, after interface{}) {
+	change := currentAuditChange(c)
+	change.Before = before
+	change.After = after
+	c.Set(services.AuditChangeKey, change)
+}
+
+func currentAuditChange(c *gin.Context) services.AuditChange {
+	if value, ok := c.Get(services.AuditChangeKey); ok {
+		return value.(services.AuditChange)
+	}
+	return services.AuditChange{}
+}
@@ -0,0 +1,73 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	env := newTestEnv(t)
+	user, userToken := env.createUser("user@example.com")
+	plan := env.createPlan("Okko", 199, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/login", "", map[string]interface{}{"email": "user@example.com", "password": "wrong-password"})
+	require.Equal(t, http.StatusUnauthorized, res.Code)
+
+	res = env.request(http.MethodDelete, fmt.Sprintf("/api/admin/plans/%d", plan.ID), userToken, nil)
+	require.Equal(t, http.StatusForbidden, res.Code)
+
+	res = env.requestWithHeaders(http.MethodPut, fmt.Sprintf("/api/admin/plans/%d", plan.ID),
+		map[string]string{"Authorization": "Bearer " + env.adminToken, "X-Request-ID": "req-42"},
+		map[string]interface{}{"name": "Okko", "price": 199, "duration": 3, "period_type": "months", "is_active": true})
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "req-42", res.Raw.Header().Get("X-Request-ID"))
+
+	res = env.request(http.MethodGet, "/api/plans", "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.Raw.Header().Get("X-Request-ID"), 32, "request ID is generated when the client sends none")
+
+	res = env.request(http.MethodGet, "/api/admin/audit-log", userToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	res = env.request(http.MethodGet, "/api/admin/audit-log", env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	entries := res.list("entries")
+	require.Len(t, entries, 3, "reads are not audited, rejected attempts are")
+
+	update := entries[0].(map[string]interface{})
+	assert.Equal(t, "plan.update", update["action"])
+	assert.Equal(t, "plan", update["target_type"])
+	assert.Equal(t, fmt.Sprint(plan.ID), update["target_id"])
+	assert.Equal(t, "req-42", update["request_id"])
+	assert.Equal(t, float64(1), update["actor_id"])
+	assert.Equal(t, float64(http.StatusOK), update["status"])
+	assert.Equal(t, map[string]interface{}{"before": float64(1), "after": float64(3)},
+		update["changes"].(map[string]interface{})["duration"])
+	assert.NotContains(t, update["changes"], "updated_at")
+
+	rejected := entries[1].(map[string]interface{})
+	assert.Equal(t, "DELETE /api/admin/plans/:id", rejected["action"], "handler did not run, the route names the action")
+	assert.Equal(t, float64(user.ID), rejected["actor_id"])
+	assert.Equal(t, float64(http.StatusForbidden), rejected["status"])
+
+	login := entries[2].(map[string]interface{})
+	assert.Equal(t, "auth.login", login["action"])
+	assert.Equal(t, "user@example.com", login["target_id"])
+	assert.Nil(t, login["actor_id"])
+	assert.Equal(t, float64(http.StatusUnauthorized), login["status"])
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/admin/audit-log?actor_id=%d", user.ID), env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("entries"), 1)
+
+	res = env.request(http.MethodGet, "/api/admin/audit-log?action=auth.login&limit=10", env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("entries"), 1)
+
+	res = env.request(http.MethodGet, "/api/admin/audit-log?from=yesterday", env.adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
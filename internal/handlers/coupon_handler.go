@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+type CouponHandler struct {
+	couponService *services.CouponService
+}
+
+func NewCouponHandler(couponService *services.CouponService) *CouponHandler {
+	return &CouponHandler{
+		couponService: couponService,
+	}
+}
+
+func (h *CouponHandler) GetCoupons(c *gin.Context) {
+	coupons, err := h.couponService.GetCoupons()
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"coupons": coupons})
+}
+
+func (h *CouponHandler) GetCoupon(c *gin.Context) {
+	id, ok := couponID(c)
+	if !ok {
+		return
+	}
+
+	coupon, err := h.couponService.GetCoupon(id)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"coupon": coupon})
+}
+
+func (h *CouponHandler) CreateCoupon(c *gin.Context) {
+	auditAction(c, "coupon.create", "coupon", "")
+
+	var coupon models.Coupon
+	if err := serializer.MyBindJSON(c, &coupon); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.couponService.CreateCoupon(&coupon); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	auditAction(c, "", "coupon", strconv.FormatUint(uint64(coupon.ID), 10))
+	auditChanges(c, nil, coupon)
+
+	serializer.MyJSON(c, http.StatusCreated, gin.H{"coupon": coupon})
+}
+
+// UpdateCoupon меняет название, ограничения и планы купона; условия скидки не меняются
+func (h *CouponHandler) UpdateCoupon(c *gin.Context) {
+	auditAction(c, "coupon.update", "coupon", c.Param("id"))
+
+	id, ok := couponID(c)
+	if !ok {
+		return
+	}
+
+	var update services.CouponUpdate
+	if err := serializer.MyBindJSON(c, &update); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, _ := h.couponService.GetCoupon(id)
+
+	coupon, err := h.couponService.UpdateCoupon(id, update)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	auditChanges(c, before, coupon)
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"coupon": coupon})
+}
+
+func (h *CouponHandler) DeleteCoupon(c *gin.Context) {
+	auditAction(c, "coupon.delete", "coupon", c.Param("id"))
+
+	id, ok := couponID(c)
+	if !ok {
+		return
+	}
+
+	before, _ := h.couponService.GetCoupon(id)
+
+	if err := h.couponService.DeleteCoupon(id); err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	auditChanges(c, before, nil)
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"message": "Coupon deleted successfully"})
+}
+
+func (h *CouponHandler) GetCouponStats(c *gin.Context) {
+	id, ok := couponID(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.couponService.GetCouponStats(id)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"stats": stats})
+}
+
+func couponID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCouponRedemption(t *testing.T) {
+	env := newTestEnv(t)
+	_, firstToken := env.createUser("first@example.com")
+	_, secondToken := env.createUser("second@example.com")
+	movies := env.createPlan("Кинопоиск", 200, 1, "months")
+	music := env.createPlan("Spotify", 169, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/admin/coupons", firstToken, map[string]interface{}{"code": "SPRING"})
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	res = env.request(http.MethodPost, "/api/admin/coupons", env.adminToken, map[string]interface{}{
+		"code": "spring25", "name": "Весенняя скидка", "discount_type": "percent", "percent_off": 25,
+		"duration": "repeating", "duration_periods": 2, "max_redemptions": 1, "plan_ids": []uint{movies.ID},
+	})
+	require.Equal(t, http.StatusCreated, res.Code)
+	couponID := res.id("coupon")
+	assert.Equal(t, "SPRING25", res.Body["coupon"].(map[string]interface{})["code"])
+
+	res = env.request(http.MethodPost, "/api/admin/coupons", env.adminToken, map[string]interface{}{
+		"code": "SPRING25", "discount_type": "fixed", "amount_off": 10, "duration": "once",
+	})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "duplicate code")
+
+	res = env.request(http.MethodPost, "/api/subscriptions", firstToken,
+		map[string]interface{}{"plan_id": music.ID, "promo_code": "spring25"})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "coupon is limited to another plan")
+	res = env.request(http.MethodPost, "/api/subscriptions", firstToken,
+		map[string]interface{}{"plan_id": movies.ID, "promo_code": "UNKNOWN"})
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodPost, "/api/subscriptions", firstToken,
+		map[string]interface{}{"plan_id": movies.ID, "promo_code": "spring25"})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subscriptionID := res.id("subscription")
+
+	res = env.request(http.MethodPost, "/api/subscriptions", secondToken,
+		map[string]interface{}{"plan_id": movies.ID, "promo_code": "SPRING25"})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "redemption limit reached")
+
+	for i := 0; i < 2; i++ {
+		res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/renew", subscriptionID), firstToken, nil)
+		require.Equal(t, http.StatusOK, res.Code)
+	}
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d/invoices", subscriptionID), firstToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	var totals []float64
+	for _, invoice := range res.list("invoices") {
+		totals = append(totals, invoice.(map[string]interface{})["total"].(float64))
+	}
+	assert.Equal(t, []float64{200, 150, 150}, totals, "two discounted periods, newest first")
+
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/admin/coupons/%d", couponID), env.adminToken,
+		map[string]interface{}{"max_redemptions": 0, "plan_ids": []uint{}})
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodPost, "/api/subscriptions", secondToken,
+		map[string]interface{}{"plan_id": music.ID, "promo_code": "SPRING25"})
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/admin/coupons/%d/stats", couponID), env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	stats := res.Body["stats"].(map[string]interface{})
+	assert.Equal(t, 2.0, stats["redemptions"])
+	assert.Equal(t, 2.0, stats["active_subscriptions"])
+	assert.Equal(t, 142.25, stats["total_discount"])
+
+	res = env.request(http.MethodDelete, fmt.Sprintf("/api/admin/coupons/%d", couponID), env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodGet, "/api/admin/coupons", env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.list("coupons"))
+}
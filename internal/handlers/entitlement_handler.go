@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+type EntitlementHandler struct {
+	entitlementService *services.EntitlementService
+}
+
+func NewEntitlementHandler(entitlementService *services.EntitlementService) *EntitlementHandler {
+	return &EntitlementHandler{
+		entitlementService: entitlementService,
+	}
+}
+
+// GetEntitlements возвращает функции, доступные пользователю. С параметром feature
+// проверяет одну функцию, min задаёт минимально необходимый лимит
+func (h *EntitlementHandler) GetEntitlements(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	entitlements, err := h.entitlementService.Entitlements(userID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	feature := c.Query("feature")
+	if feature == "" {
+		serializer.MyJSON(c, http.StatusOK, gin.H{"entitlements": entitlements.List()})
+		return
+	}
+
+	var minLimit int64
+	if value := c.Query("min"); value != "" {
+		minLimit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid min limit"})
+			return
+		}
+	}
+
+	response := gin.H{"feature": feature, "allowed": entitlements.Allows(feature, minLimit)}
+	if entitlement, ok := entitlements[feature]; ok {
+		response["entitlement"] = entitlement
+	}
+	serializer.MyJSON(c, http.StatusOK, response)
+}
@@ -0,0 +1,77 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntitlements(t *testing.T) {
+	env := newTestEnv(t)
+	owner, ownerToken := env.createUser("owner@example.com")
+	_, userToken := env.createUser("user@example.com")
+	basic := env.createPlan("Кинопоиск", 299, 1, "months")
+	team := env.createPlan("Кинопоиск Команда", 999, 1, "months")
+
+	features := map[string]interface{}{"features": []map[string]interface{}{
+		{"key": "devices", "label": "Устройства", "type": "limit", "limit": 2},
+		{"key": "quality", "label": "Качество", "type": "text", "value": "1080p"},
+	}}
+	path := fmt.Sprintf("/api/admin/plans/%d/features", basic.ID)
+	res := env.request(http.MethodPut, path, userToken, features)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	res = env.request(http.MethodPut, path, env.adminToken, features)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("features"), 2)
+
+	invalid := map[string]interface{}{"features": []map[string]interface{}{
+		{"key": "devices", "type": "limit", "limit": 2},
+		{"key": "devices", "type": "boolean"},
+	}}
+	res = env.request(http.MethodPut, path, env.adminToken, invalid)
+	assert.Equal(t, http.StatusBadRequest, res.Code, "duplicate keys")
+
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/admin/plans/%d/features", team.ID), env.adminToken,
+		map[string]interface{}{"features": []map[string]interface{}{
+			{"key": "devices", "label": "Устройства", "type": "limit", "limit": -1},
+			{"key": "shared_library", "label": "Общая библиотека", "type": "boolean"},
+		}})
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/plans/%d/features", basic.ID), "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("features"), 2)
+
+	res = env.request(http.MethodGet, "/api/entitlements", userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.list("entitlements"))
+
+	res = env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": basic.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	res = env.request(http.MethodGet, "/api/entitlements?feature=devices&min=2", userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, true, res.Body["allowed"])
+	res = env.request(http.MethodGet, "/api/entitlements?feature=devices&min=3", userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, false, res.Body["allowed"])
+	res = env.request(http.MethodGet, "/api/entitlements?feature=devices&min=abc", userToken, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	// Подписка организации даёт функции всем её участникам
+	org, err := env.services.Organizations.CreateOrganization(owner.ID, "Команда")
+	require.NoError(t, err)
+	res = env.request(http.MethodPost, "/api/subscriptions", ownerToken,
+		map[string]interface{}{"plan_id": team.ID, "organization_id": org.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	allowed, err := env.services.Entitlements.HasFeature(owner.ID, "devices", 100)
+	require.NoError(t, err)
+	assert.True(t, allowed, "unlimited team plan")
+	allowed, err = env.services.Entitlements.HasFeature(owner.ID, "quality", 0)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
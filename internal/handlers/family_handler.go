@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+type FamilyHandler struct {
+	familyService *services.FamilyService
+}
+
+func NewFamilyHandler(familyService *services.FamilyService) *FamilyHandler {
+	return &FamilyHandler{
+		familyService: familyService,
+	}
+}
+
+// GetFamily возвращает места семейной подписки и долю каждого участника в её стоимости
+func (h *FamilyHandler) GetFamily(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	family, err := h.familyService.GetFamily(userID, subscriptionID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"family": family})
+}
+
+type InviteFamilyMemberRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+func (h *FamilyHandler) InviteMember(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	var request InviteFamilyMemberRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := h.familyService.InviteMember(userID, subscriptionID, request.Email)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrNoFreeSeats) {
+			status = http.StatusConflict
+		}
+		serializer.MyJSON(c, status, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusCreated, gin.H{"invitation": invitation})
+}
+
+type AcceptFamilyInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (h *FamilyHandler) AcceptInvitation(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var request AcceptFamilyInvitationRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription, err := h.familyService.AcceptInvitation(userID, request.Token)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrNoFreeSeats) {
+			status = http.StatusConflict
+		}
+		serializer.MyJSON(c, status, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription.Shared = true
+	serializer.MyJSON(c, http.StatusOK, gin.H{"subscription": subscription})
+}
+
+// RemoveMember исключает участника (владелец) или освобождает своё место (участник)
+func (h *FamilyHandler) RemoveMember(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+	memberID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.familyService.RemoveMember(userID, subscriptionID, uint(memberID)); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+func (h *FamilyHandler) RevokeInvitation(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+	invitationID, err := strconv.ParseUint(c.Param("invitationId"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	if err := h.familyService.RevokeInvitation(userID, subscriptionID, uint(invitationID)); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+func parseSubscriptionID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Неверный ID подписки"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,81 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFamilySubscriptionSeats(t *testing.T) {
+	env := newTestEnv(t)
+	_, ownerToken := env.createUser("owner@example.com")
+	member, memberToken := env.createUser("member@example.com")
+	_, strangerToken := env.createUser("stranger@example.com")
+	family := env.createPlan("Семейный", 300, 1, "months")
+	family.Seats = 3
+	require.NoError(t, env.store.Plans().Save(family))
+
+	res := env.request(http.MethodPost, "/api/subscriptions", ownerToken, map[string]interface{}{"plan_id": family.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subscriptionID := res.id("subscription")
+	familyPath := fmt.Sprintf("/api/subscriptions/%d/family", subscriptionID)
+
+	res = env.request(http.MethodPost, familyPath+"/invitations", ownerToken, map[string]interface{}{"email": "Member@Example.com"})
+	require.Equal(t, http.StatusCreated, res.Code)
+	res = env.request(http.MethodPost, familyPath+"/invitations", ownerToken, map[string]interface{}{"email": "third@example.com"})
+	require.Equal(t, http.StatusCreated, res.Code)
+	thirdInvitation := res.id("invitation")
+
+	res = env.request(http.MethodPost, familyPath+"/invitations", ownerToken, map[string]interface{}{"email": "fourth@example.com"})
+	assert.Equal(t, http.StatusConflict, res.Code, "pending invitations reserve the remaining seats")
+	res = env.request(http.MethodPost, familyPath+"/invitations", memberToken, map[string]interface{}{"email": "fourth@example.com"})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "only the owner invites")
+
+	token := env.mailbox.waitForToken(t, "member@example.com", "семейную подписку")
+	res = env.request(http.MethodPost, "/api/family/accept", strangerToken, map[string]interface{}{"token": token})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "invitation was sent to another email")
+	res = env.request(http.MethodPost, "/api/family/accept", memberToken, map[string]interface{}{"token": token})
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodPost, "/api/family/accept", memberToken, map[string]interface{}{"token": token})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "invitation is already accepted")
+
+	res = env.request(http.MethodGet, "/api/subscriptions/active", memberToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	active := res.list("active_subscriptions")
+	require.Len(t, active, 1)
+	assert.Equal(t, true, active[0].(map[string]interface{})["shared"])
+
+	res = env.request(http.MethodGet, "/api/subscriptions/stats", memberToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	stats := res.Body["stats"].(map[string]interface{})
+	assert.Equal(t, float64(1), stats["shared_count"])
+	assert.Equal(t, float64(0), stats["total_monthly_spending"])
+	assert.Equal(t, float64(150), stats["monthly_share"])
+
+	res = env.request(http.MethodGet, familyPath, memberToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	overview := res.Body["family"].(map[string]interface{})
+	assert.Equal(t, float64(2), overview["occupied_seats"])
+	assert.Equal(t, float64(0), overview["available_seats"])
+	assert.Nil(t, overview["invitations"], "only the owner sees invitations")
+	res = env.request(http.MethodGet, familyPath, strangerToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = env.request(http.MethodDelete, fmt.Sprintf("%s/invitations/%d", familyPath, thirdInvitation), ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodGet, familyPath, ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	overview = res.Body["family"].(map[string]interface{})
+	assert.Equal(t, float64(1), overview["available_seats"])
+	assert.Empty(t, overview["invitations"])
+
+	// Участник может освободить своё место сам
+	res = env.request(http.MethodDelete, fmt.Sprintf("%s/members/%d", familyPath, member.ID), memberToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodGet, "/api/subscriptions/active", memberToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.list("active_subscriptions"))
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+type GiftHandler struct {
+	giftService *services.GiftService
+}
+
+func NewGiftHandler(giftService *services.GiftService) *GiftHandler {
+	return &GiftHandler{
+		giftService: giftService,
+	}
+}
+
+// PurchaseGift оформляет подарочную подписку; код отправляется получателю на email после оплаты
+func (h *GiftHandler) PurchaseGift(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var purchase services.GiftPurchase
+	if err := serializer.MyBindJSON(c, &purchase); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gift, err := h.giftService.PurchaseGift(userID, purchase)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusCreated, gin.H{
+		"gift":    gift,
+		"message": "Подарок оформлен, код будет отправлен получателю после оплаты",
+	})
+}
+
+// GetGifts возвращает подарки, купленные пользователем, и их статусы
+func (h *GiftHandler) GetGifts(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	gifts, err := h.giftService.GetPurchasedGifts(userID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"gifts": gifts})
+}
+
+type RedeemGiftRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func (h *GiftHandler) RedeemGift(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var request RedeemGiftRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gift, subscription, err := h.giftService.RedeemGift(userID, request.Code)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInvalidGiftCode):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrDuplicateSubscription):
+			status = http.StatusConflict
+		}
+		serializer.MyJSON(c, status, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "Подарочная подписка активирована"
+	if gift.Extended {
+		message = "Подписка продлена подарком"
+	}
+	serializer.MyJSON(c, http.StatusOK, gin.H{
+		"subscription": subscription,
+		"extended":     gift.Extended,
+		"message":      message,
+	})
+}
@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGiftSubscription(t *testing.T) {
+	env := newTestEnv(t)
+	_, buyerToken := env.createUser("buyer@example.com")
+	_, friendToken := env.createUser("friend@example.com")
+	movies := env.createPlan("Кинопоиск", 299, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/gifts", buyerToken, map[string]interface{}{
+		"plan_id": movies.ID, "recipient_email": "Friend@Example.com", "message": "С днём рождения!",
+	})
+	require.Equal(t, http.StatusCreated, res.Code)
+	gift := res.Body["gift"].(map[string]interface{})
+	assert.Equal(t, "awaiting_payment", gift["status"])
+	assert.Nil(t, gift["code"], "the code is only sent to the recipient")
+
+	t.Setenv("PAYMENT_WEBHOOK_SECRET", paymentSecret)
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_gift_0", "payment.succeeded", map[string]interface{}{
+		"gift_id": gift["id"], "payment_id": "pay_gift_1", "amount": 100,
+	}))
+	assert.NotEqual(t, http.StatusOK, res.Code, "payment does not cover the price")
+	res = env.request(http.MethodGet, "/api/gifts", buyerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "awaiting_payment", res.list("gifts")[0].(map[string]interface{})["status"], "code is not sent before payment")
+
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_gift_1", "payment.succeeded", map[string]interface{}{
+		"gift_id": gift["id"], "payment_id": "pay_gift_1", "amount": 299,
+	}))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	code := env.mailbox.waitForMatch(t, "friend@example.com", "Вам подарили подписку", giftCodePattern)
+
+	res = env.request(http.MethodPost, "/api/gifts/redeem", friendToken, map[string]interface{}{"code": "WRONG-CODE1-XXXXX"})
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodPost, "/api/gifts/redeem", friendToken,
+		map[string]interface{}{"code": strings.ToLower(strings.ReplaceAll(code, "-", ""))})
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, false, res.Body["extended"])
+	subscription := res.Body["subscription"].(map[string]interface{})
+	assert.Equal(t, false, subscription["auto_renew"])
+
+	res = env.request(http.MethodPost, "/api/gifts/redeem", friendToken, map[string]interface{}{"code": code})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "already redeemed")
+
+	res = env.request(http.MethodGet, "/api/gifts", buyerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	gifts := res.list("gifts")
+	require.Len(t, gifts, 1)
+	assert.Equal(t, "redeemed", gifts[0].(map[string]interface{})["status"])
+
+	// Второй подарок на тот же сервис подчиняется DUPLICATE_SUBSCRIPTION_POLICY
+	res = env.request(http.MethodPost, "/api/gifts", buyerToken, map[string]interface{}{
+		"plan_id": movies.ID, "recipient_email": "friend@example.com",
+	})
+	require.Equal(t, http.StatusCreated, res.Code)
+	giftID := res.id("gift")
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_gift_2", "payment.succeeded", map[string]interface{}{
+		"gift_id": giftID, "payment_id": "pay_gift_2", "amount": 299,
+	}))
+	require.Equal(t, http.StatusOK, res.Code)
+	var second string
+	require.Eventually(t, func() bool {
+		second = env.mailbox.waitForMatch(t, "friend@example.com", "Вам подарили подписку", giftCodePattern)
+		return second != code
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// По умолчанию дубль отклоняется, а подарок остается неактивированным
+	res = env.request(http.MethodPost, "/api/gifts/redeem", friendToken, map[string]interface{}{"code": second})
+	require.Equal(t, http.StatusConflict, res.Code)
+
+	t.Setenv("DUPLICATE_SUBSCRIPTION_POLICY", "extend")
+	res = env.request(http.MethodPost, "/api/gifts/redeem", friendToken, map[string]interface{}{"code": second})
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, true, res.Body["extended"])
+	extended := res.Body["subscription"].(map[string]interface{})
+	assert.Equal(t, subscription["id"], extended["id"])
+	assert.NotEqual(t, subscription["end_date"], extended["end_date"])
+
+	res = env.request(http.MethodGet, "/api/gifts", buyerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	latest := res.list("gifts")[0].(map[string]interface{})
+	assert.Equal(t, float64(giftID), latest["id"])
+	assert.Equal(t, true, latest["extended"])
+}
@@ -0,0 +1,212 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/app"
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/oidc"
+	"github.com/saneechka/ManageSubscription/internal/oidc/oidctest"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	"github.com/saneechka/ManageSubscription/pkg/email"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testPassword    = "password123"
+	oidcRedirectURL = "http://localhost:8080/api/auth/mock/callback"
+)
+
+// testEnv - приложение поверх хранилища в памяти с перехватом исходящих писем
+type testEnv struct {
+	t        *testing.T
+	store    *repository.MemoryStore
+	services *app.Services
+	router   *gin.Engine
+	mailbox  *mailbox
+	idp      *oidctest.Server
+	// adminToken - JWT администратора (пользователь с ID 1)
+	adminToken string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	box := &mailbox{}
+	email.SetTransport(box)
+
+	idp := oidctest.NewServer("client-id", "client-secret")
+	t.Cleanup(idp.Close)
+	registry := oidc.NewRegistry(oidc.NewProvider(idp.ProviderConfig("mock", oidcRedirectURL)))
+
+	store := repository.NewMemoryStore()
+	svc := app.NewServices(store, services.SystemClock(), registry)
+	app.RegisterSubscribers(svc)
+
+	env := &testEnv{
+		t:        t,
+		store:    store,
+		services: svc,
+		router:   app.NewRouter(svc),
+		mailbox:  box,
+		idp:      idp,
+	}
+
+	// Администратор создаётся первым, чтобы обычные пользователи не получили ID 1
+	admin := &models.User{ID: 1, Email: "admin@example.com", IsEmailVerified: true}
+	require.NoError(t, store.Users().Create(admin))
+	env.adminToken, _ = svc.Users.GenerateJWT(admin.ID)
+
+	return env
+}
+
+// response - ответ API с разобранным JSON-телом
+type response struct {
+	Code int
+	Body map[string]interface{}
+	Raw  *httptest.ResponseRecorder
+}
+
+func (e *testEnv) request(method, path, token string, body interface{}) response {
+	e.t.Helper()
+
+	headers := map[string]string{}
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	return e.requestWithHeaders(method, path, headers, body)
+}
+
+// requestWithHeaders выполняет запрос с произвольными заголовками, например X-API-Key
+func (e *testEnv) requestWithHeaders(method, path string, headers map[string]string, body interface{}) response {
+	e.t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		require.NoError(e.t, json.NewEncoder(&payload).Encode(body))
+	}
+
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+
+	res := response{Code: rec.Code, Raw: rec}
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		require.NoError(e.t, json.Unmarshal(rec.Body.Bytes(), &res.Body), rec.Body.String())
+	}
+	return res
+}
+
+// createUser добавляет подтверждённого пользователя и возвращает его вместе с JWT
+func (e *testEnv) createUser(userEmail string) (*models.User, string) {
+	e.t.Helper()
+
+	user := &models.User{
+		Email:           userEmail,
+		Password:        testPassword,
+		FirstName:       "Test",
+		IsEmailVerified: true,
+	}
+	require.NoError(e.t, user.HashPasswordWithCost(bcrypt.MinCost))
+	require.NoError(e.t, e.store.Users().Create(user))
+
+	token, err := e.services.Users.GenerateJWT(user.ID)
+	require.NoError(e.t, err)
+	return user, token
+}
+
+func (e *testEnv) createPlan(name string, price float64, duration int, periodType string) *models.Plan {
+	e.t.Helper()
+
+	plan := &models.Plan{
+		Name:        name,
+		Price:       price,
+		Duration:    duration,
+		PeriodType:  periodType,
+		IsActive:    true,
+		ServiceType: "streaming",
+	}
+	require.NoError(e.t, e.store.Plans().Create(plan))
+	return plan
+}
+
+// id возвращает числовое поле id вложенного объекта ответа
+func (r response) id(key string) uint {
+	return uint(r.Body[key].(map[string]interface{})["id"].(float64))
+}
+
+func (r response) list(key string) []interface{} {
+	items, _ := r.Body[key].([]interface{})
+	return items
+}
+
+// mailbox перехватывает письма вместо отправки через SMTP
+type mailbox struct {
+	mu       sync.Mutex
+	messages []sentEmail
+}
+
+type sentEmail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+func (m *mailbox) Send(toEmail, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, sentEmail{To: toEmail, Subject: subject, Body: body})
+	return nil
+}
+
+var (
+	tokenPattern    = regexp.MustCompile(`token=([0-9a-f]+)`)
+	giftCodePattern = regexp.MustCompile(`code=([A-Z2-7-]+)`)
+)
+
+// waitForToken ждёт письмо получателю, содержащее ссылку с токеном, и возвращает токен
+func (m *mailbox) waitForToken(t *testing.T, to, subject string) string {
+	t.Helper()
+	return m.waitForMatch(t, to, subject, tokenPattern)
+}
+
+// waitForMatch ждёт письмо получателю, в тексте которого есть pattern, и возвращает первую группу.
+// Письма отправляются асинхронно, поэтому ожидание ограничено по времени
+func (m *mailbox) waitForMatch(t *testing.T, to, subject string, pattern *regexp.Regexp) string {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		for i := len(m.messages) - 1; i >= 0; i-- {
+			msg := m.messages[i]
+			if msg.To == to && strings.Contains(msg.Subject, subject) {
+				if match := pattern.FindStringSubmatch(msg.Body); match != nil {
+					m.mu.Unlock()
+					return match[1]
+				}
+			}
+		}
+		m.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("no email with %q for %s", subject, to)
+	return ""
+}
@@ -0,0 +1,78 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	env := newTestEnv(t)
+	user, userToken := env.createUser("user@example.com")
+	_, otherToken := env.createUser("other@example.com")
+	plan := env.createPlan("Кинопоиск", 299, 1, "months")
+	other := env.createPlan("Okko", 199, 1, "months")
+
+	subscribe := func(token, key string, planID uint) response {
+		headers := map[string]string{"Authorization": "Bearer " + token, "Idempotency-Key": key}
+		return env.requestWithHeaders(http.MethodPost, "/api/subscriptions", headers, map[string]interface{}{"plan_id": planID})
+	}
+
+	// Двойное нажатие создаёт одну подписку, повтор получает тот же ответ
+	first := subscribe(userToken, "subscribe-1", plan.ID)
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Raw.Header().Get("Idempotent-Replayed"))
+	second := subscribe(userToken, "subscribe-1", plan.ID)
+	require.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "true", second.Raw.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.id("subscription"), second.id("subscription"))
+	assert.Equal(t, first.Raw.Body.String(), second.Raw.Body.String())
+
+	res := env.request(http.MethodGet, "/api/subscriptions", userToken, nil)
+	assert.Len(t, res.list("subscriptions"), 1)
+
+	// Ключи разных пользователей не пересекаются
+	res = subscribe(otherToken, "subscribe-1", plan.ID)
+	require.Equal(t, http.StatusCreated, res.Code)
+	assert.NotEqual(t, first.id("subscription"), res.id("subscription"))
+
+	res = subscribe(userToken, "subscribe-1", plan.ID+100)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code, "key reused for a different request")
+
+	// Ответ с ошибкой клиента тоже сохраняется
+	headers := map[string]string{"Authorization": "Bearer " + userToken, "Idempotency-Key": "bad-promo"}
+	body := map[string]interface{}{"plan_id": other.ID, "promo_code": "UNKNOWN"}
+	res = env.requestWithHeaders(http.MethodPost, "/api/subscriptions", headers, body)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = env.requestWithHeaders(http.MethodPost, "/api/subscriptions", headers, body)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, "true", res.Raw.Header().Get("Idempotent-Replayed"))
+
+	// Ответы 5xx не сохраняются, запрос можно повторить с тем же ключом
+	res = subscribe(userToken, "server-error", plan.ID+100)
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	res = subscribe(userToken, "server-error", plan.ID+100)
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Empty(t, res.Raw.Header().Get("Idempotent-Replayed"))
+
+	// Пока первый запрос выполняется, повтор получает 409
+	_, _, err := env.services.Idempotency.Begin(user.ID, "in-flight", "hash")
+	require.NoError(t, err)
+	res = subscribe(userToken, "in-flight", plan.ID)
+	assert.Equal(t, http.StatusConflict, res.Code)
+
+	// Тело запроса с ключом читается в память, поэтому его размер ограничен
+	oversized := map[string]interface{}{"plan_id": plan.ID, "promo_code": strings.Repeat("x", 2<<20)}
+	headers = map[string]string{"Authorization": "Bearer " + userToken, "Idempotency-Key": "oversized"}
+	res = env.requestWithHeaders(http.MethodPost, "/api/subscriptions", headers, oversized)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+
+	// Запросы без ключа и GET запросы не меняются
+	res = env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": other.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	res = env.request(http.MethodGet, "/api/subscriptions", userToken, nil)
+	assert.Len(t, res.list("subscriptions"), 2)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+type OIDCHandler struct {
+	oidcService *services.OIDCService
+}
+
+func NewOIDCHandler(oidcService *services.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+// GetProviders возвращает список провайдеров для кнопок "Войти через ..."
+func (h *OIDCHandler) GetProviders(c *gin.Context) {
+	providers := []gin.H{}
+	for _, provider := range h.oidcService.GetProviders() {
+		providers = append(providers, gin.H{
+			"name":         provider.Name(),
+			"display_name": provider.DisplayName(),
+			"login_url":    "/api/auth/" + provider.Name() + "/login",
+		})
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"providers": providers})
+}
+
+// Login перенаправляет пользователя на страницу входа провайдера
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, err := h.oidcService.StartLogin(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback завершает вход после возврата от провайдера
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	auditAction(c, "", "provider", c.Param("provider"))
+
+	if providerError := c.Query("error"); providerError != "" {
+		serializer.MyJSON(c, http.StatusUnauthorized, gin.H{"error": "Вход отклонён провайдером: " + providerError})
+		return
+	}
+
+	token, err := h.oidcService.FinishLogin(c.Request.Context(), c.Param("provider"), c.Query("state"), c.Query("code"))
+	if err != nil {
+		serializer.MyJSON(c, http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"token": token})
+}
@@ -0,0 +1,54 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/saneechka/ManageSubscription/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	env := newTestEnv(t)
+	env.idp.SetUser(oidctest.User{
+		Subject:       "subject-1",
+		Email:         "sso@example.com",
+		EmailVerified: true,
+		GivenName:     "Анна",
+	})
+
+	res := env.request(http.MethodGet, "/api/auth/providers", "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	providers := res.list("providers")
+	require.Len(t, providers, 1)
+	assert.Equal(t, "mock", providers[0].(map[string]interface{})["name"])
+
+	res = env.request(http.MethodGet, "/api/auth/unknown/login", "", nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodGet, "/api/auth/mock/login", "", nil)
+	require.Equal(t, http.StatusFound, res.Code)
+
+	code, state, err := env.idp.Authorize(res.Raw.Header().Get("Location"))
+	require.NoError(t, err)
+
+	callback := "/api/auth/mock/callback?" + url.Values{"code": {code}, "state": {"other-state"}}.Encode()
+	res = env.request(http.MethodGet, callback, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	callback = "/api/auth/mock/callback?" + url.Values{"code": {code}, "state": {state}}.Encode()
+	res = env.request(http.MethodGet, callback, "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, "/api/profile", res.Body["token"].(string), nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "sso@example.com", res.Body["user"].(map[string]interface{})["email"])
+
+	res = env.request(http.MethodGet, callback, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Code, "state is single use")
+
+	res = env.request(http.MethodGet, "/api/auth/mock/callback?error=access_denied", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+type OrganizationHandler struct {
+	organizationService *services.OrganizationService
+}
+
+func NewOrganizationHandler(organizationService *services.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{
+		organizationService: organizationService,
+	}
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var request CreateOrganizationRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	organization, err := h.organizationService.CreateOrganization(userID, request.Name)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusCreated, gin.H{"organization": organization})
+}
+
+func (h *OrganizationHandler) GetUserOrganizations(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	organizations, err := h.organizationService.GetUserOrganizations(userID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"organizations": organizations})
+}
+
+func (h *OrganizationHandler) GetOrganization(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	orgID, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	organization, err := h.organizationService.GetOrganization(orgID, userID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"organization": organization})
+}
+
+func (h *OrganizationHandler) GetMembers(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	orgID, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	members, err := h.organizationService.GetMembers(orgID, userID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"members": members})
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func (h *OrganizationHandler) UpdateMemberRole(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	auditAction(c, "", "organization_member", c.Param("id")+"/"+c.Param("userId"))
+
+	orgID, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request UpdateMemberRoleRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, _ := h.organizationService.GetMemberRole(orgID, uint(memberID))
+
+	if err := h.organizationService.UpdateMemberRole(orgID, userID, uint(memberID), request.Role); err != nil {
+		serializer.MyJSON(c, http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	auditChanges(c, gin.H{"role": before}, gin.H{"role": request.Role})
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"message": "Роль участника обновлена"})
+}
+
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	auditAction(c, "", "organization_member", c.Param("id")+"/"+c.Param("userId"))
+
+	orgID, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	before, _ := h.organizationService.GetMemberRole(orgID, uint(memberID))
+
+	if err := h.organizationService.RemoveMember(orgID, userID, uint(memberID)); err != nil {
+		serializer.MyJSON(c, http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	auditChanges(c, gin.H{"role": before}, nil)
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"message": "Участник исключён из организации"})
+}
+
+type InviteMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role"`
+}
+
+func (h *OrganizationHandler) InviteMember(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	orgID, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	var request InviteMemberRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := h.organizationService.InviteMember(orgID, userID, request.Email, request.Role)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusCreated, gin.H{
+		"message":    "Приглашение отправлено",
+		"invitation": invitation,
+	})
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (h *OrganizationHandler) AcceptInvitation(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var request AcceptInvitationRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	organization, err := h.organizationService.AcceptInvitation(userID, request.Token)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{
+		"message":      "Вы присоединились к организации",
+		"organization": organization,
+	})
+}
+
+func (h *OrganizationHandler) GetOrganizationSubscriptions(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	orgID, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	subscriptions, err := h.organizationService.GetOrganizationSubscriptions(orgID, userID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"subscriptions": subscriptions})
+}
+
+func (h *OrganizationHandler) GetOrganizationStats(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	orgID, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.organizationService.GetOrganizationStats(orgID, userID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"stats": stats})
+}
+
+// parseOrganizationID читает ID организации из пути и отвечает 400, если он некорректен
+func parseOrganizationID(c *gin.Context) (uint, bool) {
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return 0, false
+	}
+	return uint(orgID), true
+}
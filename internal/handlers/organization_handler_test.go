@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizationMembership(t *testing.T) {
+	env := newTestEnv(t)
+	_, ownerToken := env.createUser("owner@example.com")
+	member, memberToken := env.createUser("member@example.com")
+	_, outsiderToken := env.createUser("outsider@example.com")
+
+	res := env.request(http.MethodPost, "/api/organizations", ownerToken, map[string]string{"name": "Команда"})
+	require.Equal(t, http.StatusCreated, res.Code)
+	orgID := res.id("organization")
+	orgPath := fmt.Sprintf("/api/organizations/%d", orgID)
+
+	res = env.request(http.MethodGet, "/api/organizations", ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("organizations"), 1)
+
+	res = env.request(http.MethodGet, orgPath, outsiderToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = env.request(http.MethodPost, orgPath+"/invitations", ownerToken, map[string]string{
+		"email": "member@example.com",
+		"role":  "billing_manager",
+	})
+	require.Equal(t, http.StatusCreated, res.Code)
+	invitationToken := env.mailbox.waitForToken(t, "member@example.com", "Приглашение в команду")
+
+	res = env.request(http.MethodPost, "/api/invitations/accept", outsiderToken, map[string]string{"token": invitationToken})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "invitation was sent to another email")
+
+	res = env.request(http.MethodPost, "/api/invitations/accept", memberToken, map[string]string{"token": invitationToken})
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodPost, orgPath+"/invitations", ownerToken, map[string]string{"email": "member@example.com"})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "already a member")
+
+	res = env.request(http.MethodGet, orgPath, memberToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, orgPath+"/members", memberToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	members := res.list("members")
+	require.Len(t, members, 2)
+	assert.Equal(t, "member@example.com", members[1].(map[string]interface{})["user"].(map[string]interface{})["email"])
+
+	memberPath := fmt.Sprintf("%s/members/%d", orgPath, member.ID)
+	res = env.request(http.MethodPut, memberPath, memberToken, map[string]string{"role": "member"})
+	assert.Equal(t, http.StatusForbidden, res.Code, "only owner manages roles")
+
+	res = env.request(http.MethodPut, memberPath, ownerToken, map[string]string{"role": "member"})
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodDelete, memberPath, ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, orgPath, memberToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestOrganizationSubscriptions(t *testing.T) {
+	env := newTestEnv(t)
+	_, ownerToken := env.createUser("owner@example.com")
+	_, memberToken := env.createUser("member@example.com")
+	plan := env.createPlan("Яндекс 360", 1200, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/organizations", ownerToken, map[string]string{"name": "Команда"})
+	require.Equal(t, http.StatusCreated, res.Code)
+	orgID := res.id("organization")
+	orgPath := fmt.Sprintf("/api/organizations/%d", orgID)
+
+	res = env.request(http.MethodPost, orgPath+"/invitations", ownerToken, map[string]string{"email": "member@example.com"})
+	require.Equal(t, http.StatusCreated, res.Code)
+	invitationToken := env.mailbox.waitForToken(t, "member@example.com", "Приглашение в команду")
+	res = env.request(http.MethodPost, "/api/invitations/accept", memberToken, map[string]string{"token": invitationToken})
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodPost, "/api/subscriptions", memberToken, map[string]interface{}{
+		"plan_id":         plan.ID,
+		"organization_id": orgID,
+	})
+	assert.Equal(t, http.StatusInternalServerError, res.Code, "member cannot subscribe on behalf of organization")
+
+	res = env.request(http.MethodPost, "/api/subscriptions", ownerToken, map[string]interface{}{
+		"plan_id":         plan.ID,
+		"organization_id": orgID,
+	})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subID := res.id("subscription")
+
+	res = env.request(http.MethodGet, "/api/subscriptions", ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.list("subscriptions"), "organization subscriptions are not personal")
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d", subID), memberToken, nil)
+	assert.Equal(t, http.StatusOK, res.Code, "members can view organization subscriptions")
+
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/cancel", subID), memberToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code, "members cannot manage organization subscriptions")
+
+	res = env.request(http.MethodGet, orgPath+"/subscriptions", memberToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("subscriptions"), 1)
+
+	res = env.request(http.MethodGet, orgPath+"/stats", memberToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	stats := res.Body["stats"].(map[string]interface{})
+	assert.Equal(t, float64(2), stats["members_count"])
+	assert.InDelta(t, 600, stats["per_member_monthly_spending"], 0.01)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+// paymentWebhookMaxSize - максимальный размер тела события провайдера: тело читается в память
+// до проверки подписи, а маршрут доступен без аутентификации
+const paymentWebhookMaxSize = 1 << 20
+
+// PaymentHandler принимает события платёжного провайдера
+type PaymentHandler struct {
+	paymentService *services.PaymentService
+}
+
+func NewPaymentHandler(paymentService *services.PaymentService) *PaymentHandler {
+	return &PaymentHandler{paymentService: paymentService}
+}
+
+// HandleWebhook применяет подписанное событие провайдера. Подпись считается по сырому телу запроса,
+// поэтому тело читается целиком до разбора JSON. На внутренние ошибки отвечает 500, чтобы провайдер
+// повторил доставку; 400 означает, что повтор того же события не поможет
+func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, paymentWebhookMaxSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		serializer.MyJSON(c, http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body must be at most %d bytes", paymentWebhookMaxSize)})
+		return
+	}
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		return
+	}
+
+	event, duplicate, err := h.paymentService.HandleEvent(c.GetHeader("X-Payment-Signature"), payload)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrPaymentWebhookDisabled):
+			status = http.StatusServiceUnavailable
+		case errors.Is(err, services.ErrInvalidPaymentSignature):
+			status = http.StatusUnauthorized
+		case errors.Is(err, services.ErrInvalidPaymentEvent):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrPaymentSubscriptionNotFound), errors.Is(err, services.ErrPaymentGiftNotFound),
+			errors.Is(err, services.ErrPaymentInvoiceNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrPaymentEventConflict), errors.Is(err, repository.ErrConflict):
+			status = http.StatusConflict
+		}
+		serializer.MyJSON(c, status, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"event": event, "duplicate": duplicate})
+}
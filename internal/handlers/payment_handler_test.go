@@ -0,0 +1,168 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const paymentSecret = "provider-secret"
+
+// sendPaymentEvent отправляет событие провайдера, подписанное ключом secret
+func (e *testEnv) sendPaymentEvent(secret string, event map[string]interface{}) response {
+	e.t.Helper()
+
+	payload, err := json.Marshal(event)
+	require.NoError(e.t, err)
+	timestamp := time.Now().Unix()
+	signature := fmt.Sprintf("t=%d,v1=%s", timestamp, models.SignWebhookPayload(secret, timestamp, payload))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Payment-Signature", signature)
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+
+	res := response{Code: rec.Code, Raw: rec}
+	require.NoError(e.t, json.Unmarshal(rec.Body.Bytes(), &res.Body), rec.Body.String())
+	return res
+}
+
+func paymentEvent(id, eventType string, data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"id": id, "type": eventType, "data": data}
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	env := newTestEnv(t)
+	_, userToken := env.createUser("user@example.com")
+	plan := env.createPlan("Кинопоиск", 299, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subscriptionID := res.id("subscription")
+	path := fmt.Sprintf("/api/subscriptions/%d", subscriptionID)
+
+	failed := paymentEvent("evt_1", models.PaymentEventPaymentFailed, map[string]interface{}{
+		"subscription_id": subscriptionID, "payment_id": "pay_1",
+	})
+	res = env.sendPaymentEvent(paymentSecret, failed)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code, "secret is not configured")
+
+	t.Setenv("PAYMENT_WEBHOOK_SECRET", paymentSecret)
+	res = env.sendPaymentEvent("wrong-secret", failed)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	res = env.requestWithHeaders(http.MethodPost, "/api/payments/webhook",
+		map[string]string{"X-Payment-Signature": "t=1,v1=abc"}, failed)
+	assert.Equal(t, http.StatusUnauthorized, res.Code, "stale timestamp")
+
+	// Неудачная оплата переводит подписку в ожидание оплаты
+	res = env.sendPaymentEvent(paymentSecret, failed)
+	require.Equal(t, http.StatusOK, res.Code, res.Raw.Body.String())
+	assert.Equal(t, false, res.Body["duplicate"])
+	res = env.request(http.MethodGet, path, userToken, nil)
+	assert.Equal(t, "past_due", res.Body["subscription"].(map[string]interface{})["status"])
+
+	// Повторная доставка того же события не применяется
+	res = env.sendPaymentEvent(paymentSecret, failed)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, true, res.Body["duplicate"])
+	res = env.request(http.MethodGet, path+"/history", userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	events := res.list("events")
+	require.Len(t, events, 2)
+	assert.Equal(t, models.SubscriptionEventPaymentFailed, events[0].(map[string]interface{})["type"])
+
+	// Успешная оплата возвращает подписку в активное состояние и закрывает счёт
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_2", models.PaymentEventPaymentSucceeded, map[string]interface{}{
+		"subscription_id": subscriptionID, "payment_id": "pay_2", "provider_subscription_id": "sub_ext_1",
+	}))
+	require.Equal(t, http.StatusOK, res.Code, res.Raw.Body.String())
+	res = env.request(http.MethodGet, path, userToken, nil)
+	subscription := res.Body["subscription"].(map[string]interface{})
+	assert.Equal(t, "active", subscription["status"])
+	assert.Equal(t, "sub_ext_1", subscription["stripe_sub_id"])
+
+	res = env.request(http.MethodGet, path+"/invoices", userToken, nil)
+	invoice := res.list("invoices")[0].(map[string]interface{})
+	assert.Equal(t, models.InvoiceStatusPaid, invoice["status"])
+	assert.Equal(t, "pay_2", invoice["payment_id"])
+	assert.Len(t, invoice["lines"], 1, "lines are kept when the invoice is saved")
+
+	// Частичный возврат, затем возврат остатка
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_3", models.PaymentEventPaymentRefunded, map[string]interface{}{
+		"payment_id": "pay_2", "amount": 99,
+	}))
+	require.Equal(t, http.StatusOK, res.Code, res.Raw.Body.String())
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_4", models.PaymentEventPaymentRefunded, map[string]interface{}{
+		"payment_id": "pay_2", "amount": 500,
+	}))
+	assert.Equal(t, http.StatusConflict, res.Code, "refund exceeds the paid amount")
+	res = env.sendPaymentEvent(paymentSecret, map[string]interface{}{"type": models.PaymentEventPaymentRefunded})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "event id is required")
+	oversized := paymentEvent("evt_big", "customer.updated", map[string]interface{}{"note": strings.Repeat("x", 2<<20)})
+	res = env.sendPaymentEvent(paymentSecret, oversized)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code, "the body is limited before the signature is checked")
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_5", models.PaymentEventPaymentRefunded, map[string]interface{}{
+		"payment_id": "pay_2",
+	}))
+	require.Equal(t, http.StatusOK, res.Code, res.Raw.Body.String())
+	res = env.request(http.MethodGet, path+"/invoices", userToken, nil)
+	invoice = res.list("invoices")[0].(map[string]interface{})
+	assert.Equal(t, models.InvoiceStatusRefunded, invoice["status"])
+	assert.Equal(t, 299.0, invoice["amount_refunded"])
+
+	// Запоздавшие события по возвращённому счёту не меняют ни счёт, ни подписку
+	invoiceID := invoice["id"]
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_late_1", models.PaymentEventPaymentFailed, map[string]interface{}{
+		"subscription_id": subscriptionID, "invoice_id": invoiceID, "payment_id": "pay_2",
+	}))
+	require.Equal(t, http.StatusOK, res.Code, res.Raw.Body.String())
+	assert.Equal(t, models.PaymentEventIgnored, res.Body["event"].(map[string]interface{})["result"])
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_late_2", models.PaymentEventPaymentSucceeded, map[string]interface{}{
+		"subscription_id": subscriptionID, "invoice_id": invoiceID, "payment_id": "pay_3",
+	}))
+	assert.Equal(t, http.StatusConflict, res.Code, "a refunded invoice cannot be paid again")
+	res = env.request(http.MethodGet, path, userToken, nil)
+	assert.Equal(t, "active", res.Body["subscription"].(map[string]interface{})["status"])
+	res = env.request(http.MethodGet, path+"/invoices", userToken, nil)
+	invoice = res.list("invoices")[0].(map[string]interface{})
+	assert.Equal(t, models.InvoiceStatusRefunded, invoice["status"])
+	assert.Equal(t, "pay_2", invoice["payment_id"])
+
+	// Неизвестные события принимаются, но ничего не меняют
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_6", "customer.updated", map[string]interface{}{}))
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, models.PaymentEventIgnored, res.Body["event"].(map[string]interface{})["result"])
+
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_7", models.PaymentEventSubscriptionCancelled, map[string]interface{}{
+		"provider_subscription_id": "sub_unknown",
+	}))
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	// Отмена у провайдера отменяет подписку и выключает автопродление
+	res = env.sendPaymentEvent(paymentSecret, paymentEvent("evt_8", models.PaymentEventSubscriptionCancelled, map[string]interface{}{
+		"provider_subscription_id": "sub_ext_1",
+	}))
+	require.Equal(t, http.StatusOK, res.Code, res.Raw.Body.String())
+	assert.Equal(t, float64(subscriptionID), res.Body["event"].(map[string]interface{})["subscription_id"])
+	res = env.request(http.MethodGet, path, userToken, nil)
+	subscription = res.Body["subscription"].(map[string]interface{})
+	assert.Equal(t, "cancelled", subscription["status"])
+	assert.Equal(t, false, subscription["auto_renew"])
+
+	res = env.request(http.MethodGet, path+"/history", userToken, nil)
+	events = res.list("events")
+	require.Len(t, events, 4)
+	assert.Equal(t, models.SubscriptionEventCancelled, events[0].(map[string]interface{})["type"])
+	assert.Nil(t, events[0].(map[string]interface{})["actor_id"], "cancelled by the provider")
+	assert.Equal(t, models.SubscriptionEventPaymentRecovered, events[1].(map[string]interface{})["type"])
+}
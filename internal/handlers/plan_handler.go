@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -12,13 +13,13 @@ import (
 
 
 type PlanHandler struct {
-	planService services.PlanService
+	planService *services.PlanService
 }
 
 
-func NewPlanHandler() *PlanHandler {
+func NewPlanHandler(planService *services.PlanService) *PlanHandler {
 	return &PlanHandler{
-		planService: services.PlanService{},
+		planService: planService,
 	}
 }
 
@@ -51,7 +52,26 @@ func (h *PlanHandler) GetPlanByID(c *gin.Context) {
 }
 
 
+func (h *PlanHandler) GetPriceHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	versions, err := h.planService.GetPriceHistory(uint(id))
+	if err != nil {
+		serializer.MyJSON(c,http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c,http.StatusOK, gin.H{"history": versions})
+}
+
+
 func (h *PlanHandler) CreatePlan(c *gin.Context) {
+	auditAction(c, "plan.create", "plan", "")
+
 	var plan models.Plan
 	if err := serializer.MyBindJSON(c,&plan); err != nil {
 		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -62,12 +82,16 @@ func (h *PlanHandler) CreatePlan(c *gin.Context) {
 		serializer.MyJSON(c,http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	auditAction(c, "", "plan", strconv.FormatUint(uint64(plan.ID), 10))
+	auditChanges(c, nil, plan)
 
 	serializer.MyJSON(c,http.StatusCreated, gin.H{"message": "Plan created successfully", "plan": plan})
 }
 
 
 func (h *PlanHandler) UpdatePlan(c *gin.Context) {
+	auditAction(c, "plan.update", "plan", c.Param("id"))
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
@@ -80,29 +104,64 @@ func (h *PlanHandler) UpdatePlan(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.planService.GetPlanByID(uint(id))
+
 	plan.ID = uint(id)
 	if err := h.planService.UpdatePlan(&plan); err != nil {
-		serializer.MyJSON(c,http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrPriceChangePending):
+			status = http.StatusConflict
+		case errors.Is(err, services.ErrPriceChangeNeedsNotice):
+			status = http.StatusUnprocessableEntity
+		}
+		serializer.MyJSON(c,status, gin.H{"error": err.Error()})
 		return
 	}
+	auditChanges(c, before, plan)
 
 	serializer.MyJSON(c,http.StatusOK, gin.H{"message": "Plan updated successfully", "plan": plan})
 }
 
 
 func (h *PlanHandler) DeletePlan(c *gin.Context) {
+	auditAction(c, "plan.delete", "plan", c.Param("id"))
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
 		return
 	}
 
-	if err := h.planService.DeletePlan(uint(id)); err != nil {
-		serializer.MyJSON(c,http.StatusInternalServerError, gin.H{"error": err.Error()})
+	var replacementID uint64
+	if value := c.Query("replacement_plan_id"); value != "" {
+		replacementID, err = strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": "Invalid replacement plan ID"})
+			return
+		}
+	}
+
+	before, _ := h.planService.GetPlanByID(uint(id))
+
+	result, err := h.planService.DeletePlan(uint(id), c.Query("policy"), uint(replacementID), c.MustGet("userID").(uint))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrPlanHasSubscribers) {
+			status = http.StatusConflict
+		}
+		serializer.MyJSON(c,status, gin.H{"error": err.Error()})
 		return
 	}
 
-	serializer.MyJSON(c,http.StatusOK, gin.H{"message": "Plan deleted successfully"})
+	after, _ := h.planService.GetPlanByID(uint(id))
+	auditChanges(c, before, after)
+
+	message := "Plan deleted successfully"
+	if result.Archived {
+		message = "Plan archived successfully"
+	}
+	serializer.MyJSON(c,http.StatusOK, gin.H{"message": message, "result": result})
 }
 
 
@@ -128,3 +187,105 @@ func (h *PlanHandler) FilterPlansByPrice(c *gin.Context) {
 
 	serializer.MyJSON(c,http.StatusOK, gin.H{"plans": plans})
 }
+
+
+func (h *PlanHandler) GetPlanFeatures(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	features, err := h.planService.GetPlanFeatures(uint(id))
+	if err != nil {
+		serializer.MyJSON(c,http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c,http.StatusOK, gin.H{"features": features})
+}
+
+
+type SetPlanFeaturesRequest struct {
+	Features []models.PlanFeature `json:"features"`
+}
+
+
+// SetPlanFeatures заменяет набор функций плана целиком
+func (h *PlanHandler) SetPlanFeatures(c *gin.Context) {
+	auditAction(c, "plan.features_update", "plan", c.Param("id"))
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	var request SetPlanFeaturesRequest
+	if err := serializer.MyBindJSON(c,&request); err != nil {
+		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, _ := h.planService.GetPlanFeatures(uint(id))
+
+	features, err := h.planService.SetPlanFeatures(uint(id), request.Features)
+	if err != nil {
+		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	auditChanges(c, gin.H{"features": before}, gin.H{"features": features})
+
+	serializer.MyJSON(c,http.StatusOK, gin.H{"features": features})
+}
+
+
+func (h *PlanHandler) GetMeteredComponents(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	components, err := h.planService.GetMeteredComponents(uint(id))
+	if err != nil {
+		serializer.MyJSON(c,http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c,http.StatusOK, gin.H{"metered_components": components})
+}
+
+
+type SetMeteredComponentsRequest struct {
+	Components []models.MeteredComponent `json:"metered_components"`
+}
+
+
+// SetMeteredComponents заменяет набор оплачиваемых по факту составляющих плана
+func (h *PlanHandler) SetMeteredComponents(c *gin.Context) {
+	auditAction(c, "plan.metered_components_update", "plan", c.Param("id"))
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	var request SetMeteredComponentsRequest
+	if err := serializer.MyBindJSON(c,&request); err != nil {
+		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, _ := h.planService.GetMeteredComponents(uint(id))
+
+	components, err := h.planService.SetMeteredComponents(uint(id), request.Components)
+	if err != nil {
+		serializer.MyJSON(c,http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	auditChanges(c, gin.H{"metered_components": before}, gin.H{"metered_components": components})
+
+	serializer.MyJSON(c,http.StatusOK, gin.H{"metered_components": components})
+}
@@ -0,0 +1,198 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicPlanEndpoints(t *testing.T) {
+	env := newTestEnv(t)
+	monthly := env.createPlan("Кинопоиск", 299, 1, "months")
+	yearly := env.createPlan("Кинопоиск", 2990, 1, "years")
+	env.createPlan("Яндекс Плюс", 399, 1, "months")
+
+	res := env.request(http.MethodGet, "/api/plans", "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("plans"), 3)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/plans/%d", monthly.ID), "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, monthly.ID, res.id("plan"))
+
+	res = env.request(http.MethodGet, "/api/plans/999", "", nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = env.request(http.MethodGet, "/api/plans/abc", "", nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodGet, "/api/plans/filter?min=300&max=500", "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("plans"), 1)
+
+	res = env.request(http.MethodGet, "/api/plans/service?name=Кинопоиск", "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("plans"), 2)
+
+	res = env.request(http.MethodGet, "/api/plans/service", "", nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/plans/related/%d", monthly.ID), "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	related := res.list("related_plans")
+	require.Len(t, related, 1)
+	assert.Equal(t, float64(yearly.ID), related[0].(map[string]interface{})["id"])
+}
+
+func TestAdminPlanManagement(t *testing.T) {
+	env := newTestEnv(t)
+	_, userToken := env.createUser("user@example.com")
+
+	newPlan := map[string]interface{}{
+		"name":        "Okko",
+		"price":       199,
+		"duration":    1,
+		"period_type": "months",
+		"is_active":   true,
+	}
+
+	res := env.request(http.MethodPost, "/api/admin/plans", userToken, newPlan)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	res = env.request(http.MethodPost, "/api/admin/plans", env.adminToken, newPlan)
+	require.Equal(t, http.StatusCreated, res.Code)
+	planID := res.id("plan")
+
+	// Цена меняется только через запланированное изменение с уведомлением подписчиков
+	newPlan["price"] = 249
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/admin/plans/%d", planID), env.adminToken, newPlan)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+
+	newPlan["price"] = 199
+	newPlan["name"] = "Okko HD"
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/admin/plans/%d", planID), env.adminToken, newPlan)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/plans/%d", planID), "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, float64(199), res.Body["plan"].(map[string]interface{})["price"])
+	assert.Equal(t, "Okko HD", res.Body["plan"].(map[string]interface{})["name"])
+
+	res = env.request(http.MethodPut, "/api/admin/plans/999", env.adminToken, newPlan)
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+
+	res = env.request(http.MethodDelete, fmt.Sprintf("/api/admin/plans/%d", planID), userToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	res = env.request(http.MethodDelete, fmt.Sprintf("/api/admin/plans/%d", planID), env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/plans/%d", planID), "", nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestDeletePlanWithSubscribers(t *testing.T) {
+	env := newTestEnv(t)
+	_, userToken := env.createUser("user@example.com")
+	plan := env.createPlan("Кинопоиск", 299, 1, "months")
+	replacement := env.createPlan("Кинопоиск", 2990, 1, "years")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subscriptionID := res.id("subscription")
+
+	path := fmt.Sprintf("/api/admin/plans/%d", plan.ID)
+	res = env.request(http.MethodDelete, path, env.adminToken, nil)
+	assert.Equal(t, http.StatusConflict, res.Code, "block is the default policy")
+
+	res = env.request(http.MethodDelete, path+"?policy=unknown", env.adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodDelete, path+"?policy=migrate", env.adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code, "replacement plan is required")
+
+	res = env.request(http.MethodDelete, path+"?policy=archive", env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": plan.ID})
+	assert.Equal(t, http.StatusInternalServerError, res.Code, "archived plan")
+
+	res = env.request(http.MethodDelete, fmt.Sprintf("%s?policy=migrate&replacement_plan_id=%d", path, replacement.ID), env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, float64(1), res.Body["result"].(map[string]interface{})["migrated_subscriptions"])
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d", subscriptionID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, float64(replacement.ID), res.Body["subscription"].(map[string]interface{})["plan"].(map[string]interface{})["id"])
+}
+
+func TestOrphanedSubscriptionsReport(t *testing.T) {
+	env := newTestEnv(t)
+	user, userToken := env.createUser("user@example.com")
+	plan := env.createPlan("Кинопоиск", 299, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	res = env.request(http.MethodGet, "/api/admin/subscriptions/orphaned", userToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	res = env.request(http.MethodGet, "/api/admin/subscriptions/orphaned", env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.list("orphaned_subscriptions"))
+
+	// Удаление в обход политики, как это делала прежняя версия
+	require.NoError(t, env.store.Plans().Delete(plan.ID))
+	require.NoError(t, env.store.Users().Delete(user.ID))
+
+	res = env.request(http.MethodGet, "/api/admin/subscriptions/orphaned", env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	report := res.list("orphaned_subscriptions")
+	require.Len(t, report, 1)
+	entry := report[0].(map[string]interface{})
+	assert.Equal(t, "plan_deleted", entry["reason"])
+	assert.Equal(t, "Кинопоиск", entry["subscription"].(map[string]interface{})["plan"].(map[string]interface{})["name"],
+		"deleted plan is still loaded")
+}
+
+func TestPlanPriceHistory(t *testing.T) {
+	t.Setenv("PRICE_CHANGE_NOTICE_DAYS", "0")
+	env := newTestEnv(t)
+	_, userToken := env.createUser("user@example.com")
+	plan := env.createPlan("Кинопоиск", 299, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	oldSubscriptionID := res.id("subscription")
+
+	update := map[string]interface{}{"name": plan.Name, "price": 349, "duration": 1, "period_type": "months", "is_active": true}
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/admin/plans/%d", plan.ID), env.adminToken, update)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code, "a new price takes effect only after notice")
+	res = env.request(http.MethodPost, fmt.Sprintf("/api/admin/plans/%d/price-changes", plan.ID), env.adminToken, map[string]interface{}{"price": 349})
+	require.Equal(t, http.StatusCreated, res.Code)
+	// Уведомление отправляется асинхронно; без ожидания оно попало бы в почтовый ящик следующего теста
+	env.mailbox.waitForToken(t, "user@example.com", "Изменение цены подписки")
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/plans/%d/history", plan.ID), "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	history := res.list("history")
+	require.Len(t, history, 2)
+	assert.Equal(t, float64(299), history[0].(map[string]interface{})["price"])
+	assert.Equal(t, float64(349), history[1].(map[string]interface{})["price"])
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d", oldSubscriptionID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	version := res.Body["subscription"].(map[string]interface{})["plan_version"].(map[string]interface{})
+	assert.Equal(t, float64(299), version["price"], "existing subscription keeps its version")
+
+	_, otherToken := env.createUser("other@example.com")
+	res = env.request(http.MethodPost, "/api/subscriptions", otherToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	version = res.Body["subscription"].(map[string]interface{})["plan_version"].(map[string]interface{})
+	assert.Equal(t, float64(349), version["price"])
+
+	res = env.request(http.MethodGet, "/api/plans/999/history", "", nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
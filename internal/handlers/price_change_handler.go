@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+type PriceChangeHandler struct {
+	priceChangeService *services.PriceChangeService
+}
+
+func NewPriceChangeHandler(priceChangeService *services.PriceChangeService) *PriceChangeHandler {
+	return &PriceChangeHandler{
+		priceChangeService: priceChangeService,
+	}
+}
+
+type SchedulePriceChangeRequest struct {
+	Price float64 `json:"price" binding:"required"`
+	// EffectiveFrom - дата вступления новой цены в силу; если не задана, используется ближайшая допустимая
+	EffectiveFrom *time.Time `json:"effective_from"`
+}
+
+func (h *PriceChangeHandler) SchedulePriceChange(c *gin.Context) {
+	auditAction(c, "plan.price_change_schedule", "plan", c.Param("id"))
+
+	planID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	var request SchedulePriceChangeRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var effectiveFrom time.Time
+	if request.EffectiveFrom != nil {
+		effectiveFrom = *request.EffectiveFrom
+	}
+
+	change, err := h.priceChangeService.SchedulePriceChange(uint(planID), request.Price, effectiveFrom)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrPriceChangePending) {
+			status = http.StatusConflict
+		}
+		serializer.MyJSON(c, status, gin.H{"error": err.Error()})
+		return
+	}
+	auditChanges(c, nil, change)
+
+	serializer.MyJSON(c, http.StatusCreated, gin.H{"price_change": change})
+}
+
+func (h *PriceChangeHandler) GetPriceChanges(c *gin.Context) {
+	planID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	changes, err := h.priceChangeService.GetPriceChanges(uint(planID))
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"price_changes": changes})
+}
+
+// DeclinePriceChange отключает автопродление по ссылке из письма об изменении цены
+func (h *PriceChangeHandler) DeclinePriceChange(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Токен уведомления отсутствует"})
+		return
+	}
+
+	notice, err := h.priceChangeService.DeclinePriceChange(token)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{
+		"message": "Автопродление отключено. Подписка будет действовать до конца оплаченного периода.",
+		"notice":  notice,
+	})
+}
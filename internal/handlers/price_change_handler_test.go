@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulePriceChange(t *testing.T) {
+	env := newTestEnv(t)
+	_, userToken := env.createUser("user@example.com")
+	_, otherToken := env.createUser("other@example.com")
+	plan := env.createPlan("Кинопоиск", 299, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subscriptionID := res.id("subscription")
+	res = env.request(http.MethodPost, "/api/subscriptions", otherToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	path := fmt.Sprintf("/api/admin/plans/%d/price-changes", plan.ID)
+	res = env.request(http.MethodPost, path, userToken, map[string]interface{}{"price": 349})
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	tooSoon := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+	res = env.request(http.MethodPost, path, env.adminToken, map[string]interface{}{"price": 349, "effective_from": tooSoon})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "subscribers must get notice in advance")
+
+	res = env.request(http.MethodPost, path, env.adminToken, map[string]interface{}{"price": 349})
+	require.Equal(t, http.StatusCreated, res.Code)
+	change := res.Body["price_change"].(map[string]interface{})
+	assert.Equal(t, float64(299), change["old_price"])
+	assert.Equal(t, float64(349), change["new_price"])
+	assert.Equal(t, float64(2), change["notified_count"])
+
+	res = env.request(http.MethodPost, path, env.adminToken, map[string]interface{}{"price": 399})
+	assert.Equal(t, http.StatusConflict, res.Code, "only one pending change per plan")
+
+	// Изменение условий плана вступило бы в силу сразу и отменило бы запланированную цену
+	planPath := fmt.Sprintf("/api/admin/plans/%d", plan.ID)
+	update := map[string]interface{}{"name": plan.Name, "price": 399, "duration": 1, "period_type": "months", "is_active": true}
+	res = env.request(http.MethodPut, planPath, env.adminToken, update)
+	assert.Equal(t, http.StatusConflict, res.Code, "terms cannot change while a price change is pending")
+	update["price"] = 299
+	update["description"] = "Фильмы и сериалы"
+	res = env.request(http.MethodPut, planPath, env.adminToken, update)
+	assert.Equal(t, http.StatusOK, res.Code, "other fields can still be edited")
+
+	// Каталог показывает старую цену до вступления изменения в силу, история - запланированную версию
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/plans/%d", plan.ID), "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, float64(299), res.Body["plan"].(map[string]interface{})["price"])
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/plans/%d/history", plan.ID), "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("history"), 2)
+
+	token := env.mailbox.waitForToken(t, "user@example.com", "Изменение цены подписки")
+	env.mailbox.mu.Lock()
+	for _, msg := range env.mailbox.messages {
+		if msg.To == "user@example.com" && strings.Contains(msg.Subject, "Изменение цены") {
+			assert.Contains(t, msg.Body, "299.00")
+			assert.Contains(t, msg.Body, "349.00")
+		}
+	}
+	env.mailbox.mu.Unlock()
+
+	res = env.request(http.MethodGet, "/api/price-changes/decline?token=unknown", "", nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodGet, "/api/price-changes/decline?token="+token, "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d", subscriptionID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	subscription := res.Body["subscription"].(map[string]interface{})
+	assert.Equal(t, false, subscription["auto_renew"])
+	assert.Equal(t, "active", subscription["status"], "subscription runs until the end of the paid period")
+
+	res = env.request(http.MethodGet, path, env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	changes := res.list("price_changes")
+	require.Len(t, changes, 1)
+	assert.Equal(t, float64(1), changes[0].(map[string]interface{})["declined_count"])
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+type SplitHandler struct {
+	splitService *services.SplitService
+}
+
+func NewSplitHandler(splitService *services.SplitService) *SplitHandler {
+	return &SplitHandler{
+		splitService: splitService,
+	}
+}
+
+// GetSplits возвращает разделения стоимости подписок пользователя и разделения, в которых он участвует
+func (h *SplitHandler) GetSplits(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	splits, err := h.splitService.GetSplits(userID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"splits": splits})
+}
+
+func (h *SplitHandler) GetSplit(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	split, err := h.splitService.GetSplit(userID, subscriptionID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"split": split})
+}
+
+// SetSplit задаёт способ разделения стоимости и полный список участников
+func (h *SplitHandler) SetSplit(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	var config services.SplitConfig
+	if err := serializer.MyBindJSON(c, &config); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	split, err := h.splitService.SetSplit(userID, subscriptionID, config)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"split": split})
+}
+
+// SettleUp записывает оплату участником своего долга владельцу подписки
+func (h *SplitHandler) SettleUp(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	var payment services.SettleUp
+	if err := serializer.MyBindJSON(c, &payment); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.splitService.SettleUp(userID, subscriptionID, payment)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusCreated, gin.H{"entry": entry})
+}
+
+func (h *SplitHandler) GetLedger(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.splitService.GetLedger(userID, subscriptionID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"entries": entries})
+}
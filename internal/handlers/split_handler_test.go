@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCostSplitAndSettleUp(t *testing.T) {
+	env := newTestEnv(t)
+	_, ownerToken := env.createUser("owner@example.com")
+	_, flatmateToken := env.createUser("flatmate@example.com")
+	_, strangerToken := env.createUser("stranger@example.com")
+	music := env.createPlan("Музыка", 300, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", ownerToken, map[string]interface{}{"plan_id": music.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subscriptionID := res.id("subscription")
+	splitPath := fmt.Sprintf("/api/subscriptions/%d/split", subscriptionID)
+
+	res = env.request(http.MethodPut, splitPath, ownerToken, map[string]interface{}{
+		"mode": "custom", "participants": []map[string]interface{}{
+			{"email": "flatmate@example.com", "share": 60}, {"name": "Бабушка", "share": 50},
+		},
+	})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "shares exceed 100 percent")
+	res = env.request(http.MethodPut, splitPath, ownerToken, map[string]interface{}{
+		"mode": "equal", "participants": []map[string]interface{}{{"email": "owner@example.com"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "the owner is not a participant")
+	res = env.request(http.MethodPut, splitPath, flatmateToken, map[string]interface{}{"mode": "equal"})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "only the owner sets the split")
+
+	res = env.request(http.MethodPut, splitPath, ownerToken, map[string]interface{}{
+		"mode": "equal", "participants": []map[string]interface{}{
+			{"email": "Flatmate@Example.com"}, {"name": "Бабушка"},
+		},
+	})
+	require.Equal(t, http.StatusOK, res.Code)
+	participants := res.Body["split"].(map[string]interface{})["participants"].([]interface{})
+	require.Len(t, participants, 2)
+	flatmateID := participants[0].(map[string]interface{})["id"]
+	grannyID := participants[1].(map[string]interface{})["id"]
+
+	res = env.request(http.MethodGet, "/api/subscriptions/stats", ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	stats := res.Body["stats"].(map[string]interface{})
+	assert.Equal(t, float64(300), stats["total_monthly_spending"])
+	assert.Equal(t, float64(100), stats["effective_monthly_share"])
+
+	// Каждое продление добавляет доли участников к их долгу
+	for i := 0; i < 2; i++ {
+		res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/renew", subscriptionID), ownerToken, nil)
+		require.Equal(t, http.StatusOK, res.Code)
+	}
+
+	res = env.request(http.MethodGet, splitPath, flatmateToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	participants = res.Body["split"].(map[string]interface{})["participants"].([]interface{})
+	assert.Equal(t, float64(200), participants[0].(map[string]interface{})["balance"])
+	assert.Equal(t, float64(200), participants[1].(map[string]interface{})["balance"])
+	res = env.request(http.MethodGet, splitPath, strangerToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = env.request(http.MethodPost, splitPath+"/settle", flatmateToken, map[string]interface{}{"participant_id": grannyID, "amount": 50})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "participants only settle their own debt")
+	res = env.request(http.MethodPost, splitPath+"/settle", flatmateToken, map[string]interface{}{"participant_id": flatmateID, "amount": 250})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "more than owed")
+	res = env.request(http.MethodPost, splitPath+"/settle", flatmateToken, map[string]interface{}{"participant_id": flatmateID, "amount": 150, "note": "перевод"})
+	require.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, float64(50), res.Body["entry"].(map[string]interface{})["balance_after"])
+	res = env.request(http.MethodPost, splitPath+"/settle", ownerToken, map[string]interface{}{"participant_id": grannyID, "amount": 200})
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	res = env.request(http.MethodGet, "/api/subscriptions/stats", flatmateToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	stats = res.Body["stats"].(map[string]interface{})
+	assert.Equal(t, float64(0), stats["total_monthly_spending"])
+	assert.Equal(t, float64(100), stats["effective_monthly_share"])
+	assert.Equal(t, float64(50), stats["split_owed_by_me"])
+	res = env.request(http.MethodGet, "/api/subscriptions/stats", ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, float64(50), res.Body["stats"].(map[string]interface{})["split_owed_to_me"])
+
+	res = env.request(http.MethodGet, splitPath+"/ledger", ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	entries := res.list("entries")
+	require.Len(t, entries, 6)
+	assert.Equal(t, "payment", entries[0].(map[string]interface{})["kind"])
+	assert.Equal(t, "charge", entries[5].(map[string]interface{})["kind"])
+
+	// Исключённый участник больше не получает начислений, но его долг сохраняется
+	res = env.request(http.MethodPut, splitPath, ownerToken, map[string]interface{}{
+		"mode": "equal", "participants": []map[string]interface{}{{"name": "бабушка"}},
+	})
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodGet, "/api/splits", flatmateToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	splits := res.list("splits")
+	require.Len(t, splits, 1)
+	flatmate := splits[0].(map[string]interface{})["participants"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, false, flatmate["active"])
+	assert.Equal(t, float64(50), flatmate["balance"])
+
+	res = env.request(http.MethodGet, "/api/subscriptions/stats", ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, float64(150), res.Body["stats"].(map[string]interface{})["effective_monthly_share"])
+}
@@ -1,21 +1,26 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
 	"github.com/saneechka/ManageSubscription/internal/services"
 	serializer "github.com/saneechka/serializer/gin"
 )
 
 type SubscriptionHandler struct {
 	subscriptionService *services.SubscriptionService
+	organizationService *services.OrganizationService
 }
 
-func NewSubscriptionHandler() *SubscriptionHandler {
+func NewSubscriptionHandler(subscriptionService *services.SubscriptionService, organizationService *services.OrganizationService) *SubscriptionHandler {
 	return &SubscriptionHandler{
-		subscriptionService: services.NewSubscriptionService(),
+		subscriptionService: subscriptionService,
+		organizationService: organizationService,
 	}
 }
 
@@ -70,8 +75,10 @@ func (h *SubscriptionHandler) GetSubscriptionStats(c *gin.Context) {
 }
 
 type SubscribeRequest struct {
-	PlanID    uint   `json:"plan_id"`
-	PaymentID string `json:"payment_id"`
+	PlanID         uint   `json:"plan_id"`
+	PaymentID      string `json:"payment_id"`
+	OrganizationID *uint  `json:"organization_id"`
+	PromoCode      string `json:"promo_code"`
 }
 
 func (h *SubscriptionHandler) Subscribe(c *gin.Context) {
@@ -86,9 +93,22 @@ func (h *SubscriptionHandler) Subscribe(c *gin.Context) {
 		return
 	}
 
-	subscription, err := h.subscriptionService.Subscribe(userID, request.PlanID, request.PaymentID)
+	var subscription *models.Subscription
+	var err error
+	if request.OrganizationID != nil {
+		subscription, err = h.subscriptionService.SubscribeOrganization(userID, *request.OrganizationID, request.PlanID, request.PaymentID, request.PromoCode)
+	} else {
+		subscription, err = h.subscriptionService.Subscribe(userID, request.PlanID, request.PaymentID, request.PromoCode)
+	}
 	if err != nil {
-		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInvalidPromoCode):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrDuplicateSubscription), errors.Is(err, repository.ErrConflict):
+			status = http.StatusConflict
+		}
+		serializer.MyJSON(c, status, gin.H{
 			"error": "Error creating subscription: " + err.Error(),
 		})
 		return
@@ -120,16 +140,16 @@ func (h *SubscriptionHandler) CancelSubscription(c *gin.Context) {
 		return
 	}
 
-	if subscription.UserID != userID {
+	if !h.organizationService.CanManageSubscription(userID, subscription) {
 		serializer.MyJSON(c, http.StatusNotFound, gin.H{
 			"error": "Subscription not found or not owned by user",
 		})
 		return
 	}
 
-	err = h.subscriptionService.CancelSubscription(uint(subscriptionID))
+	err = h.subscriptionService.CancelSubscription(uint(subscriptionID), userID)
 	if err != nil {
-		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{
+		serializer.MyJSON(c, updateErrorStatus(err), gin.H{
 			"error": "Error cancelling subscription: " + err.Error(),
 		})
 		return
@@ -164,7 +184,7 @@ func (h *SubscriptionHandler) UpdateAutoRenewal(c *gin.Context) {
 		return
 	}
 
-	if subscription.UserID != userID {
+	if !h.organizationService.CanManageSubscription(userID, subscription) {
 		serializer.MyJSON(c, http.StatusNotFound, gin.H{
 			"error": "Subscription not found or not owned by user",
 		})
@@ -179,9 +199,9 @@ func (h *SubscriptionHandler) UpdateAutoRenewal(c *gin.Context) {
 		return
 	}
 
-	err = h.subscriptionService.UpdateAutoRenewal(uint(subscriptionID), request.AutoRenew)
+	err = h.subscriptionService.UpdateAutoRenewal(uint(subscriptionID), request.AutoRenew, userID)
 	if err != nil {
-		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{
+		serializer.MyJSON(c, updateErrorStatus(err), gin.H{
 			"error": "Error updating auto-renewal: " + err.Error(),
 		})
 		return
@@ -212,7 +232,7 @@ func (h *SubscriptionHandler) GetSubscriptionByID(c *gin.Context) {
 		return
 	}
 
-	if subscription.UserID != userID {
+	if !h.organizationService.CanViewSubscription(userID, subscription) {
 		serializer.MyJSON(c, http.StatusNotFound, gin.H{
 			"error": "Подписка не найдена или не принадлежит пользователю",
 		})
@@ -270,15 +290,15 @@ func (h *SubscriptionHandler) RenewSubscription(c *gin.Context) {
 		return
 	}
 
-	if subscription.UserID != userID {
+	if !h.organizationService.CanManageSubscription(userID, subscription) {
 		serializer.MyJSON(c, http.StatusNotFound, gin.H{
 			"error": "Подписка не найдена или не принадлежит пользователю",
 		})
 		return
 	}
 
-	if err := h.subscriptionService.RenewSubscription(uint(subscriptionID)); err != nil {
-		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{
+	if err := h.subscriptionService.RenewSubscription(uint(subscriptionID), userID); err != nil {
+		serializer.MyJSON(c, updateErrorStatus(err), gin.H{
 			"error": "Ошибка при продлении подписки: " + err.Error(),
 		})
 		return
@@ -289,6 +309,14 @@ func (h *SubscriptionHandler) RenewSubscription(c *gin.Context) {
 	})
 }
 
+// updateErrorStatus возвращает 409, если подписку одновременно изменил другой запрос, и 500 в остальных случаях
+func updateErrorStatus(err error) int {
+	if errors.Is(err, repository.ErrConflict) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 // GetRelatedPlans возвращает все планы, связанные с указанным планом (месячные/годовые варианты)
 func (h *SubscriptionHandler) GetRelatedPlans(c *gin.Context) {
 	// Получаем ID плана из параметра запроса
@@ -339,3 +367,75 @@ func (h *SubscriptionHandler) GetPlansForService(c *gin.Context) {
 		"plans": plans,
 	})
 }
+
+// GetOrphanedSubscriptions возвращает администратору отчёт об активных подписках,
+// ссылающихся на удалённые планы, пользователей или организации
+func (h *SubscriptionHandler) GetOrphanedSubscriptions(c *gin.Context) {
+	report, err := h.subscriptionService.GetOrphanedSubscriptions()
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{
+		"orphaned_subscriptions": report,
+		"count":                  len(report),
+	})
+}
+
+// GetDuplicateSubscriptions возвращает пользователю группы его активных подписок
+// на один сервис или на сервисы одного типа
+func (h *SubscriptionHandler) GetDuplicateSubscriptions(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	report, err := h.subscriptionService.GetUserDuplicateSubscriptions(userID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{
+		"duplicates": report,
+		"count":      len(report),
+	})
+}
+
+// GetAllDuplicateSubscriptions возвращает администратору отчёт о пользователях и организациях
+// с несколькими активными подписками на один сервис или на сервисы одного типа
+func (h *SubscriptionHandler) GetAllDuplicateSubscriptions(c *gin.Context) {
+	report, err := h.subscriptionService.GetDuplicateSubscriptions()
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{
+		"duplicates": report,
+		"count":      len(report),
+	})
+}
+
+// GetSubscriptionHistory возвращает историю подписки: оформление, продления, изменения автопродления,
+// отмену, истечение и переводы на другой план
+func (h *SubscriptionHandler) GetSubscriptionHistory(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	subscription, err := h.subscriptionService.GetSubscriptionByID(subscriptionID)
+	if err != nil || !h.organizationService.CanViewSubscription(userID, subscription) {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": "Подписка не найдена или не принадлежит пользователю"})
+		return
+	}
+
+	events, err := h.subscriptionService.GetHistory(subscription.ID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"events": events})
+}
@@ -0,0 +1,181 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+	_, token := env.createUser("user@example.com")
+	kinopoisk := env.createPlan("Кинопоиск", 299, 1, "months")
+	music := env.createPlan("Яндекс Музыка", 199, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", token, map[string]interface{}{"plan_id": 999})
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+
+	res = env.request(http.MethodPost, "/api/subscriptions", token, map[string]interface{}{"plan_id": kinopoisk.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	kinopoiskSubID := res.id("subscription")
+	assert.Equal(t, "Кинопоиск", res.Body["subscription"].(map[string]interface{})["plan"].(map[string]interface{})["name"])
+
+	res = env.request(http.MethodPost, "/api/subscriptions", token, map[string]interface{}{"plan_id": music.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	musicSubID := res.id("subscription")
+
+	res = env.request(http.MethodGet, "/api/subscriptions", token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("subscriptions"), 2)
+
+	res = env.request(http.MethodGet, "/api/subscriptions/stats", token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	stats := res.Body["stats"].(map[string]interface{})
+	assert.Equal(t, float64(2), stats["active_count"])
+	assert.InDelta(t, 498, stats["total_monthly_spending"], 0.01)
+
+	res = env.request(http.MethodGet, "/api/subscriptions/search?query=музыка", token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Len(t, res.list("subscriptions"), 1)
+
+	res = env.request(http.MethodGet, "/api/subscriptions/search?sort_by=price_asc", token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	sorted := res.list("subscriptions")
+	require.Len(t, sorted, 2)
+	assert.Equal(t, float64(musicSubID), sorted[0].(map[string]interface{})["id"])
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d", kinopoiskSubID), token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/auto-renew", kinopoiskSubID), token, map[string]bool{"auto_renew": false})
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/renew", kinopoiskSubID), token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/cancel", musicSubID), token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, "/api/subscriptions/active", token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	active := res.list("active_subscriptions")
+	require.Len(t, active, 1)
+	assert.Equal(t, float64(kinopoiskSubID), active[0].(map[string]interface{})["id"])
+	assert.Equal(t, false, active[0].(map[string]interface{})["auto_renew"])
+
+	res = env.request(http.MethodGet, "/api/subscriptions/search?status=cancelled", token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("subscriptions"), 1)
+
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/renew", musicSubID), token, nil)
+	assert.Equal(t, http.StatusInternalServerError, res.Code, "cancelled subscription cannot be renewed")
+}
+
+func TestSubscriptionOwnership(t *testing.T) {
+	env := newTestEnv(t)
+	_, ownerToken := env.createUser("owner@example.com")
+	_, otherToken := env.createUser("other@example.com")
+	plan := env.createPlan("Кинопоиск", 299, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", ownerToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subID := res.id("subscription")
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d", subID), otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	for _, action := range []string{"cancel", "auto-renew", "renew"} {
+		res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/%s", subID, action), otherToken, map[string]bool{"auto_renew": false})
+		assert.Equal(t, http.StatusNotFound, res.Code, action)
+	}
+
+	res = env.request(http.MethodGet, "/api/subscriptions", otherToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.list("subscriptions"))
+
+	res = env.request(http.MethodGet, "/api/subscriptions/abc", ownerToken, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestSubscriptionHistory(t *testing.T) {
+	env := newTestEnv(t)
+	owner, ownerToken := env.createUser("owner@example.com")
+	_, otherToken := env.createUser("other@example.com")
+	plan := env.createPlan("Кинопоиск", 299, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", ownerToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subID := res.id("subscription")
+
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/auto-renew", subID), ownerToken, map[string]bool{"auto_renew": false})
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/renew", subID), ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/cancel", subID), ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d/history", subID), otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d/history", subID), ownerToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	events := res.list("events")
+	require.Len(t, events, 4)
+
+	var types []string
+	for _, event := range events {
+		event := event.(map[string]interface{})
+		types = append(types, event["type"].(string))
+		assert.Equal(t, float64(owner.ID), event["actor_id"])
+	}
+	assert.Equal(t, []string{"cancelled", "renewed", "auto_renew_changed", "created"}, types)
+
+	toggled := events[2].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"auto_renew": true}, toggled["before"])
+	assert.Equal(t, map[string]interface{}{"auto_renew": false}, toggled["after"])
+
+	renewed := events[1].(map[string]interface{})
+	assert.Contains(t, renewed["after"], "end_date")
+	assert.Contains(t, renewed["after"], "start_date")
+
+	cancelled := events[0].(map[string]interface{})
+	assert.Equal(t, "cancelled", cancelled["after"].(map[string]interface{})["status"])
+	assert.Nil(t, cancelled["before"].(map[string]interface{})["cancelled_at"])
+
+	created := events[3].(map[string]interface{})
+	assert.Nil(t, created["before"])
+	assert.Equal(t, "active", created["after"].(map[string]interface{})["status"])
+}
+
+func TestDuplicateSubscriptions(t *testing.T) {
+	env := newTestEnv(t)
+	user, userToken := env.createUser("user@example.com")
+	monthly := env.createPlan("Кинопоиск", 299, 1, "months")
+	yearly := env.createPlan("Кинопоиск", 2990, 1, "years")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": monthly.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	res = env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": yearly.ID})
+	assert.Equal(t, http.StatusConflict, res.Code)
+
+	// Дубль, оформленный до появления проверки
+	require.NoError(t, env.store.Subscriptions().Create(&models.Subscription{UserID: user.ID, PlanID: yearly.ID, Status: "active"}))
+
+	res = env.request(http.MethodGet, "/api/subscriptions/duplicates", userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	report := res.list("duplicates")
+	require.Len(t, report, 1)
+	group := report[0].(map[string]interface{})
+	assert.Equal(t, "same_service", group["reason"])
+	assert.Len(t, group["subscriptions"], 2)
+
+	res = env.request(http.MethodGet, "/api/admin/subscriptions/duplicates", userToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	res = env.request(http.MethodGet, "/api/admin/subscriptions/duplicates", env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, float64(1), res.Body["count"])
+}
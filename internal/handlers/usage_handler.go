@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+type UsageHandler struct {
+	usageService        *services.UsageService
+	subscriptionService *services.SubscriptionService
+	organizationService *services.OrganizationService
+}
+
+func NewUsageHandler(usageService *services.UsageService, subscriptionService *services.SubscriptionService, organizationService *services.OrganizationService) *UsageHandler {
+	return &UsageHandler{
+		usageService:        usageService,
+		subscriptionService: subscriptionService,
+		organizationService: organizationService,
+	}
+}
+
+type RecordUsageRequest struct {
+	SubscriptionID uint       `json:"subscription_id" binding:"required"`
+	Component      string     `json:"component" binding:"required"`
+	Quantity       float64    `json:"quantity" binding:"required"`
+	RecordedAt     *time.Time `json:"recorded_at"`
+	EventID        string     `json:"event_id"`
+}
+
+// RecordUsage принимает использование от внешней системы, авторизованной ключом API
+func (h *UsageHandler) RecordUsage(c *gin.Context) {
+	apiKeyID := c.MustGet("apiKeyID").(uint)
+
+	var request RecordUsageRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := services.UsageReport{
+		SubscriptionID: request.SubscriptionID,
+		Component:      request.Component,
+		Quantity:       request.Quantity,
+		EventID:        request.EventID,
+	}
+	if request.RecordedAt != nil {
+		report.RecordedAt = *request.RecordedAt
+	}
+
+	record, created, err := h.usageService.RecordUsage(apiKeyID, report)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	serializer.MyJSON(c, status, gin.H{"usage": record, "duplicate": !created})
+}
+
+// GetSubscriptionUsage возвращает использование и перерасход в текущем периоде подписки
+func (h *UsageHandler) GetSubscriptionUsage(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := h.viewableSubscriptionID(c, userID)
+	if !ok {
+		return
+	}
+
+	usage, err := h.usageService.GetCurrentUsage(subscriptionID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"usage": usage})
+}
+
+// GetSubscriptionInvoices возвращает счета подписки со строками оплаты плана и перерасхода
+func (h *UsageHandler) GetSubscriptionInvoices(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	subscriptionID, ok := h.viewableSubscriptionID(c, userID)
+	if !ok {
+		return
+	}
+
+	invoices, err := h.subscriptionService.GetInvoices(subscriptionID)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"invoices": invoices})
+}
+
+// viewableSubscriptionID разбирает ID подписки из пути и проверяет, что пользователь может её видеть
+func (h *UsageHandler) viewableSubscriptionID(c *gin.Context, userID uint) (uint, bool) {
+	subscriptionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Неверный ID подписки"})
+		return 0, false
+	}
+
+	subscription, err := h.subscriptionService.GetSubscriptionByID(uint(subscriptionID))
+	if err != nil || !h.organizationService.CanViewSubscription(userID, subscription) {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": "Подписка не найдена или не принадлежит пользователю"})
+		return 0, false
+	}
+	return subscription.ID, true
+}
@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeteredUsageBilling(t *testing.T) {
+	env := newTestEnv(t)
+	_, userToken := env.createUser("user@example.com")
+	_, otherToken := env.createUser("other@example.com")
+	plan := env.createPlan("Облако", 100, 1, "months")
+
+	res := env.request(http.MethodPut, fmt.Sprintf("/api/admin/plans/%d/metered-components", plan.ID), env.adminToken,
+		map[string]interface{}{"metered_components": []map[string]interface{}{
+			{"key": "storage_gb", "label": "Хранилище", "unit": "ГБ", "included_quantity": 10, "overage_unit_price": 2.5},
+		}})
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/plans/%d/metered-components", plan.ID), "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("metered_components"), 1)
+
+	res = env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subscriptionID := res.id("subscription")
+
+	res = env.request(http.MethodPost, "/api/admin/api-keys", env.adminToken, map[string]interface{}{"name": "Хранилище"})
+	require.Equal(t, http.StatusCreated, res.Code)
+	apiKey := res.Body["key"].(string)
+	keyID := res.id("api_key")
+
+	usage := map[string]interface{}{"subscription_id": subscriptionID, "component": "storage_gb", "quantity": 14, "event_id": "evt-1"}
+	res = env.request(http.MethodPost, "/api/usage", "", usage)
+	assert.Equal(t, http.StatusUnauthorized, res.Code, "missing key")
+
+	res = env.requestWithHeaders(http.MethodPost, "/api/usage", map[string]string{"X-API-Key": apiKey}, usage)
+	require.Equal(t, http.StatusCreated, res.Code)
+	res = env.requestWithHeaders(http.MethodPost, "/api/usage", map[string]string{"X-API-Key": apiKey}, usage)
+	require.Equal(t, http.StatusOK, res.Code, "duplicate event")
+	assert.Equal(t, true, res.Body["duplicate"])
+
+	res = env.request(http.MethodPost, "/api/subscriptions", otherToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	res = env.requestWithHeaders(http.MethodPost, "/api/usage", map[string]string{"X-API-Key": apiKey},
+		map[string]interface{}{"subscription_id": res.id("subscription"), "component": "storage_gb", "quantity": 1, "event_id": "evt-1"})
+	require.Equal(t, http.StatusCreated, res.Code, "event ids are scoped to the subscription")
+
+	res = env.requestWithHeaders(http.MethodPost, "/api/usage", map[string]string{"X-API-Key": apiKey},
+		map[string]interface{}{"subscription_id": subscriptionID, "component": "cpu", "quantity": 1})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "unknown component")
+
+	path := fmt.Sprintf("/api/subscriptions/%d/usage", subscriptionID)
+	res = env.request(http.MethodGet, path, otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	res = env.request(http.MethodGet, path, userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	current := res.Body["usage"].(map[string]interface{})
+	assert.Equal(t, 10.0, current["overage_amount"])
+
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/renew", subscriptionID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d/invoices", subscriptionID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	invoices := res.list("invoices")
+	require.Len(t, invoices, 2, "subscribe and renewal")
+	renewal := invoices[0].(map[string]interface{})
+	assert.Equal(t, 100.0, renewal["total"])
+	assert.Len(t, renewal["lines"], 1, "overage is billed once the period ends")
+
+	res = env.request(http.MethodGet, path, userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	current = res.Body["usage"].(map[string]interface{})
+	assert.Equal(t, 10.0, current["overage_amount"], "renewal does not close the usage period")
+
+	res = env.requestWithHeaders(http.MethodPost, "/api/usage", map[string]string{"X-API-Key": apiKey}, usage)
+	require.Equal(t, http.StatusOK, res.Code, "still a duplicate after renewal")
+
+	res = env.request(http.MethodDelete, fmt.Sprintf("/api/admin/api-keys/%d", keyID), env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.requestWithHeaders(http.MethodPost, "/api/usage", map[string]string{"X-API-Key": apiKey},
+		map[string]interface{}{"subscription_id": subscriptionID, "component": "storage_gb", "quantity": 1})
+	assert.Equal(t, http.StatusUnauthorized, res.Code, "revoked key")
+}
@@ -10,22 +10,38 @@ import (
 )
 
 type UserHandler struct {
-	userService services.UserService
+	userService    *services.UserService
+	accountService *services.AccountService
 }
 
-func NewUserHandler() *UserHandler {
+func NewUserHandler(userService *services.UserService, accountService *services.AccountService) *UserHandler {
 	return &UserHandler{
-		userService: services.UserService{},
+		userService:    userService,
+		accountService: accountService,
 	}
 }
 
+type RegisterRequest struct {
+	Email     string `json:"email" binding:"required,email"`
+	Password  string `json:"password" binding:"required"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
 func (h *UserHandler) Register(c *gin.Context) {
-	var user models.User
-	if err := serializer.MyBindJSON(c, &user); err != nil {
+	var request RegisterRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
 		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	user := models.User{
+		Email:     request.Email,
+		Password:  request.Password,
+		FirstName: request.FirstName,
+		LastName:  request.LastName,
+	}
+
 	if err := h.userService.Register(&user); err != nil {
 		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -81,6 +97,8 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
+	auditAction(c, "", "user", credentials.Email)
+
 	token, err := h.userService.Login(credentials.Email, credentials.Password)
 	if err != nil {
 		serializer.MyJSON(c, http.StatusUnauthorized, gin.H{"error": err.Error()})
@@ -131,3 +149,104 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 
 	serializer.MyJSON(c, http.StatusOK, gin.H{"message": "Profile updated successfully", "user": user})
 }
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (h *UserHandler) RequestEmailChange(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var request ChangeEmailRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.userService.RequestEmailChange(userID.(uint), request.NewEmail, request.Password); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusAccepted, gin.H{"message": "Ссылка для подтверждения отправлена на новый адрес. Email изменится после подтверждения."})
+}
+
+func (h *UserHandler) ConfirmEmailChange(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Токен подтверждения отсутствует"})
+		return
+	}
+
+	if err := h.userService.ConfirmEmailChange(token); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Ошибка смены email: " + err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"message": "Email успешно изменён."})
+}
+
+func (h *UserHandler) ExportProfile(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if c.Query("format") == "zip" {
+		archive, err := h.accountService.ExportUserDataZip(userID.(uint))
+		if err != nil {
+			serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="profile-export.zip"`)
+		c.Data(http.StatusOK, "application/zip", archive)
+		return
+	}
+
+	export, err := h.accountService.ExportUserData(userID.(uint))
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"export": export})
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+func (h *UserHandler) DeleteAccount(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var request DeleteAccountRequest
+	if err := serializer.MyBindJSON(c, &request); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deletion, err := h.accountService.DeleteAccount(userID.(uint), request.Password)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{
+		"message":     "Аккаунт удалён. Вы можете восстановить его по ссылке из письма до окончательного удаления.",
+		"purge_after": deletion.PurgeAfter,
+	})
+}
+
+func (h *UserHandler) RestoreAccount(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Токен восстановления отсутствует"})
+		return
+	}
+
+	if err := h.accountService.RestoreAccount(token); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Ошибка восстановления аккаунта: " + err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"message": "Аккаунт восстановлен. Теперь вы можете войти в систему."})
+}
@@ -0,0 +1,177 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterVerifyAndLogin(t *testing.T) {
+	env := newTestEnv(t)
+
+	res := env.request(http.MethodPost, "/api/register", "", map[string]string{
+		"email":      "new@example.com",
+		"password":   "short",
+		"first_name": "Иван",
+	})
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodPost, "/api/register", "", map[string]string{
+		"email":      "new@example.com",
+		"password":   testPassword,
+		"first_name": "Иван",
+	})
+	require.Equal(t, http.StatusCreated, res.Code)
+	assert.NotContains(t, res.Body["user"], "password")
+
+	res = env.request(http.MethodPost, "/api/register", "", map[string]string{
+		"email":    "new@example.com",
+		"password": testPassword,
+	})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "duplicate email")
+
+	credentials := map[string]string{"email": "new@example.com", "password": testPassword}
+	res = env.request(http.MethodPost, "/api/login", "", credentials)
+	assert.Equal(t, http.StatusUnauthorized, res.Code, "email is not verified yet")
+
+	res = env.request(http.MethodPost, "/api/resend-verification", "", map[string]string{"email": "new@example.com"})
+	require.Equal(t, http.StatusOK, res.Code)
+	user, err := env.store.Users().FindByEmail("new@example.com")
+	require.NoError(t, err)
+	token := user.VerificationToken
+	require.NotEmpty(t, token)
+
+	res = env.request(http.MethodGet, "/api/verify-email?token=wrong", "", nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodGet, "/api/verify-email?token="+token, "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodPost, "/api/resend-verification", "", map[string]string{"email": "new@example.com"})
+	assert.Equal(t, http.StatusBadRequest, res.Code, "already verified")
+
+	res = env.request(http.MethodPost, "/api/login", "", map[string]string{"email": "new@example.com", "password": "wrong-password1"})
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	res = env.request(http.MethodPost, "/api/login", "", credentials)
+	require.Equal(t, http.StatusOK, res.Code)
+	jwtToken := res.Body["token"].(string)
+
+	res = env.request(http.MethodGet, "/api/profile", jwtToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "new@example.com", res.Body["user"].(map[string]interface{})["email"])
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	env := newTestEnv(t)
+
+	res := env.request(http.MethodGet, "/api/profile", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	res = env.request(http.MethodGet, "/api/profile", "not-a-jwt", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	token, err := env.services.Users.GenerateJWT(42)
+	require.NoError(t, err)
+	res = env.request(http.MethodGet, "/api/profile", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Code, "user does not exist")
+}
+
+func TestUpdateProfile(t *testing.T) {
+	env := newTestEnv(t)
+	_, token := env.createUser("user@example.com")
+
+	res := env.request(http.MethodPut, "/api/profile", token, map[string]string{
+		"first_name": "Пётр",
+		"last_name":  "Петров",
+	})
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, "/api/profile", token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	user := res.Body["user"].(map[string]interface{})
+	assert.Equal(t, "Пётр", user["first_name"])
+	assert.Equal(t, "Петров", user["last_name"])
+}
+
+func TestEmailChange(t *testing.T) {
+	env := newTestEnv(t)
+	_, token := env.createUser("old@example.com")
+	env.createUser("taken@example.com")
+
+	res := env.request(http.MethodPost, "/api/profile/email", token, map[string]string{
+		"new_email": "new@example.com",
+		"password":  "wrong-password1",
+	})
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodPost, "/api/profile/email", token, map[string]string{
+		"new_email": "taken@example.com",
+		"password":  testPassword,
+	})
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodPost, "/api/profile/email", token, map[string]string{
+		"new_email": "new@example.com",
+		"password":  testPassword,
+	})
+	require.Equal(t, http.StatusAccepted, res.Code)
+	confirmToken := env.mailbox.waitForToken(t, "new@example.com", "Подтверждение смены email")
+
+	res = env.request(http.MethodGet, "/api/confirm-email-change?token="+confirmToken, "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, "/api/confirm-email-change?token="+confirmToken, "", nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code, "token is single use")
+
+	res = env.request(http.MethodPost, "/api/login", "", map[string]string{"email": "new@example.com", "password": testPassword})
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestExportDeleteAndRestoreAccount(t *testing.T) {
+	env := newTestEnv(t)
+	_, token := env.createUser("user@example.com")
+	plan := env.createPlan("Кинопоиск", 299, 1, "months")
+
+	res := env.request(http.MethodPost, "/api/subscriptions", token, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	res = env.request(http.MethodGet, "/api/profile/export", token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	export := res.Body["export"].(map[string]interface{})
+	assert.Len(t, export["subscriptions"], 1)
+	assert.Len(t, export["invoices"], 1, "billing data is exported")
+	for _, section := range []string{"usage", "gifts", "cost_splits", "split_ledger"} {
+		assert.NotNil(t, export[section], section)
+	}
+
+	res = env.request(http.MethodGet, "/api/profile/export?format=zip", token, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	archive, err := zip.NewReader(bytes.NewReader(res.Raw.Body.Bytes()), int64(res.Raw.Body.Len()))
+	require.NoError(t, err)
+	assert.Len(t, archive.File, 9)
+
+	res = env.request(http.MethodDelete, "/api/profile", token, map[string]string{"password": "wrong-password1"})
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodDelete, "/api/profile", token, map[string]string{"password": testPassword})
+	require.Equal(t, http.StatusOK, res.Code, res.Body)
+	restoreToken := env.mailbox.waitForToken(t, "user@example.com", "Аккаунт удалён")
+
+	res = env.request(http.MethodGet, "/api/profile", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Code, "deleted user cannot authenticate")
+
+	res = env.request(http.MethodGet, "/api/account/restore?token="+restoreToken, "", nil)
+	require.Equal(t, http.StatusOK, res.Code, res.Body)
+
+	res = env.request(http.MethodPost, "/api/login", "", map[string]string{"email": "user@example.com", "password": testPassword})
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = env.request(http.MethodGet, "/api/subscriptions/active", res.Body["token"].(string), nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.list("active_subscriptions"), "subscriptions stay cancelled after restore")
+}
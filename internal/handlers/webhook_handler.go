@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	serializer "github.com/saneechka/serializer/gin"
+)
+
+// WebhookHandler управляет получателями событий пользователя, а для маршрутов администратора
+// (admin) - получателями, которым отправляются события всех подписок
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+	admin          bool
+}
+
+func NewWebhookHandler(webhookService *services.WebhookService, admin bool) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+		admin:          admin,
+	}
+}
+
+func (h *WebhookHandler) GetWebhooks(c *gin.Context) {
+	endpoints, err := h.webhookService.GetEndpoints(h.owner(c))
+	if err != nil {
+		serializer.MyJSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"webhooks": endpoints})
+}
+
+// CreateWebhook добавляет получателя; ключ подписи возвращается только в этом ответе
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	auditAction(c, "webhook.create", "webhook", "")
+
+	var input services.WebhookInput
+	if err := serializer.MyBindJSON(c, &input); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	endpoint, secret, err := h.webhookService.CreateEndpoint(h.owner(c), input)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	auditAction(c, "", "webhook", strconv.FormatUint(uint64(endpoint.ID), 10))
+	auditChanges(c, nil, endpoint)
+
+	serializer.MyJSON(c, http.StatusCreated, gin.H{"webhook": endpoint, "secret": secret})
+}
+
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	auditAction(c, "webhook.update", "webhook", c.Param("id"))
+
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	var input services.WebhookInput
+	if err := serializer.MyBindJSON(c, &input); err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	endpoint, err := h.webhookService.UpdateEndpoint(h.owner(c), id, input)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"webhook": endpoint})
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	auditAction(c, "webhook.delete", "webhook", c.Param("id"))
+
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteEndpoint(h.owner(c), id); err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// GetDeliveries возвращает журнал доставок получателю с кодами ответов
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.webhookService.GetDeliveries(h.owner(c), id)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// SendTestEvent сразу отправляет получателю проверочное событие и возвращает результат доставки
+func (h *WebhookHandler) SendTestEvent(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.SendTestEvent(h.owner(c), id)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializer.MyJSON(c, http.StatusOK, gin.H{"delivery": delivery})
+}
+
+// owner возвращает владельца получателей: пользователя или nil для маршрутов администратора
+func (h *WebhookHandler) owner(c *gin.Context) *uint {
+	if h.admin {
+		return nil
+	}
+	userID := c.MustGet("userID").(uint)
+	return &userID
+}
+
+func webhookID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		serializer.MyJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,196 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookReceiver - локальный получатель событий, отвечающий кодом status
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	Header http.Header
+	Body   []byte
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	receiver := &webhookReceiver{status: status}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		receiver.requests = append(receiver.requests, receivedWebhook{Header: r.Header.Clone(), Body: body})
+		receiver.mu.Unlock()
+		w.WriteHeader(receiver.status)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	env := newTestEnv(t)
+	_, userToken := env.createUser("user@example.com")
+	_, otherToken := env.createUser("other@example.com")
+	plan := env.createPlan("Кинопоиск", 299, 1, "months")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	broken := newWebhookReceiver(t, http.StatusInternalServerError)
+
+	res := env.request(http.MethodPost, "/api/webhooks", userToken, map[string]interface{}{"url": "ftp://example.com"})
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = env.request(http.MethodPost, "/api/webhooks", userToken, map[string]interface{}{"url": receiver.URL, "events": []string{"subscription.deleted"}})
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = env.request(http.MethodPost, "/api/webhooks", userToken, map[string]interface{}{
+		"url": receiver.URL, "events": []string{models.WebhookEventSubscriptionCreated, models.WebhookEventSubscriptionCancelled},
+	})
+	require.Equal(t, http.StatusCreated, res.Code)
+	webhookID := res.id("webhook")
+	secret := res.Body["secret"].(string)
+	assert.NotEmpty(t, secret)
+
+	res = env.request(http.MethodPost, "/api/admin/webhooks", env.adminToken, map[string]interface{}{"url": broken.URL})
+	require.Equal(t, http.StatusCreated, res.Code)
+	adminWebhookID := res.id("webhook")
+
+	res = env.request(http.MethodGet, "/api/webhooks", otherToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.list("webhooks"))
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/webhooks/%d/deliveries", webhookID), otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = env.request(http.MethodPost, "/api/subscriptions", userToken, map[string]interface{}{"plan_id": plan.ID})
+	require.Equal(t, http.StatusCreated, res.Code)
+	subscriptionID := res.id("subscription")
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/auto-renew", subscriptionID), userToken, map[string]bool{"auto_renew": false})
+	require.Equal(t, http.StatusOK, res.Code)
+	res = env.request(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d/cancel", subscriptionID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	attempted, err := env.services.Webhooks.DeliverDue()
+	require.NoError(t, err)
+	assert.Equal(t, 5, attempted, "two filtered events to the user, three events to the admin")
+
+	requests := receiver.received()
+	require.Len(t, requests, 2)
+	created := requests[0]
+	assert.Equal(t, models.WebhookEventSubscriptionCreated, created.Header.Get("X-Webhook-Event"))
+	timestamp, err := strconv.ParseInt(created.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256="+models.SignWebhookPayload(secret, timestamp, created.Body), created.Header.Get("X-Webhook-Signature"))
+
+	var payload struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Subscription models.Subscription `json:"subscription"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(created.Body, &payload))
+	assert.Equal(t, created.Header.Get("X-Webhook-ID"), payload.ID)
+	assert.Equal(t, subscriptionID, payload.Data.Subscription.ID)
+	assert.Equal(t, models.WebhookEventSubscriptionCancelled, requests[1].Header.Get("X-Webhook-Event"))
+	assert.Len(t, broken.received(), 3)
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/admin/webhooks/%d/deliveries", adminWebhookID), env.adminToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	deliveries := res.list("deliveries")
+	require.Len(t, deliveries, 3)
+	failed := deliveries[0].(map[string]interface{})
+	assert.Equal(t, models.WebhookDeliveryPending, failed["status"], "failed delivery is retried later")
+	assert.Equal(t, float64(http.StatusInternalServerError), failed["response_code"])
+	assert.Equal(t, float64(1), failed["attempts"])
+	assert.NotNil(t, failed["next_attempt_at"])
+
+	attempted, err = env.services.Webhooks.DeliverDue()
+	require.NoError(t, err)
+	assert.Zero(t, attempted, "retries wait for the backoff delay")
+
+	res = env.request(http.MethodPost, fmt.Sprintf("/api/webhooks/%d/test", webhookID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	delivery := res.Body["delivery"].(map[string]interface{})
+	assert.Equal(t, models.WebhookEventTest, delivery["event_type"])
+	assert.Equal(t, models.WebhookDeliverySucceeded, delivery["status"])
+	assert.Equal(t, float64(http.StatusOK), delivery["response_code"])
+
+	res = env.request(http.MethodGet, fmt.Sprintf("/api/webhooks/%d/deliveries", webhookID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, res.list("deliveries"), 3)
+
+	res = env.request(http.MethodDelete, fmt.Sprintf("/api/webhooks/%d", adminWebhookID), userToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code, "admin endpoints are managed under /api/admin")
+	res = env.request(http.MethodDelete, fmt.Sprintf("/api/webhooks/%d", webhookID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestWebhookPrivateTargets(t *testing.T) {
+	env := newTestEnv(t)
+	_, userToken := env.createUser("user@example.com")
+
+	for _, target := range []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://127.0.0.1:8080/hooks",
+		"http://10.0.0.5/hooks",
+		"http://[::1]/hooks",
+		"http://localhost/hooks",
+	} {
+		res := env.request(http.MethodPost, "/api/webhooks", userToken, map[string]interface{}{"url": target})
+		assert.Equal(t, http.StatusBadRequest, res.Code, target)
+	}
+
+	// Адрес, полученный разрешением имени или сохранённый раньше, проверяется при подключении
+	var redirected atomic.Bool
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected.Store(true)
+		http.Redirect(w, r, receiver.URL, http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(redirect.Close)
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	res := env.request(http.MethodPost, "/api/webhooks", userToken, map[string]interface{}{"url": redirect.URL})
+	require.Equal(t, http.StatusCreated, res.Code)
+	webhookID := res.id("webhook")
+
+	res = env.request(http.MethodPost, fmt.Sprintf("/api/webhooks/%d/test", webhookID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	delivery := res.Body["delivery"].(map[string]interface{})
+	assert.True(t, redirected.Load())
+	assert.Equal(t, float64(http.StatusTemporaryRedirect), delivery["response_code"], "redirects are not followed")
+	assert.Empty(t, receiver.received())
+
+	// Имя localhost разрешается в loopback: подключение отклоняется после разрешения имени
+	res = env.request(http.MethodPost, "/api/webhooks", userToken,
+		map[string]interface{}{"url": strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)})
+	require.Equal(t, http.StatusCreated, res.Code)
+	localhostID := res.id("webhook")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "false")
+
+	res = env.request(http.MethodPost, fmt.Sprintf("/api/webhooks/%d/test", localhostID), userToken, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	delivery = res.Body["delivery"].(map[string]interface{})
+	assert.Empty(t, receiver.received(), "connection is refused before sending")
+	assert.Equal(t, float64(0), delivery["response_code"])
+	assert.Contains(t, delivery["last_error"], "webhook target address is not allowed")
+}
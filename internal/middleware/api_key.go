@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+)
+
+// APIKeyRequired пропускает запросы внешних систем с действующим ключом в заголовке X-API-Key
+func APIKeyRequired(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.GetHeader("X-API-Key")
+		if raw == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "X-API-Key header is required"})
+			c.Abort()
+			return
+		}
+
+		key, err := apiKeyService.Authenticate(raw)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or revoked API key"})
+			c.Abort()
+			return
+		}
+
+		c.Set("apiKeyID", key.ID)
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+)
+
+// Audit записывает в журнал аудита результат запроса после его обработки, в том числе
+// неудачные и отклонённые попытки. action - название действия маршрута; если оно пустое,
+// записываются только изменяющие запросы, а действием считается метод и шаблон маршрута.
+// Обработчик может уточнить действие, объект и изменения через services.AuditChangeKey
+func Audit(auditService *services.AuditService, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if action == "" && c.Request.Method == http.MethodGet {
+			return
+		}
+
+		var change services.AuditChange
+		if value, ok := c.Get(services.AuditChangeKey); ok {
+			change = value.(services.AuditChange)
+		}
+		if change.Action == "" {
+			change.Action = action
+		}
+		if change.Action == "" {
+			change.Action = c.Request.Method + " " + c.FullPath()
+		}
+		if change.TargetID == "" {
+			change.TargetID = c.Param("id")
+		}
+
+		request := services.AuditRequest{
+			RequestID: c.GetString("requestID"),
+			IP:        c.ClientIP(),
+			Status:    c.Writer.Status(),
+		}
+		if userID, ok := c.Get("userID"); ok {
+			actorID := userID.(uint)
+			request.ActorID = &actorID
+		}
+
+		if _, err := auditService.Record(request, change); err != nil {
+			fmt.Printf("Ошибка записи в журнал аудита: %v\n", err)
+		}
+	}
+}
@@ -1,20 +1,16 @@
 package middleware
 
 import (
-	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
-	"github.com/saneechka/ManageSubscription/internal/app"
-	"github.com/saneechka/ManageSubscription/internal/models"
 	"github.com/saneechka/ManageSubscription/internal/services"
-	"gorm.io/gorm"
 )
 
 
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(userService *services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		authHeader := c.GetHeader("Authorization")
@@ -36,7 +32,6 @@ func AuthMiddleware() gin.HandlerFunc {
 		tokenString := parts[1]
 
 
-		userService := services.UserService{}
 		secretKey := userService.GetSecretKey()
 
 
@@ -52,9 +47,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 
-		var user models.User
-		result := app.DB.First(&user, claims.UserID)
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		if exists, err := userService.UserExists(claims.UserID); err == nil && !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
@@ -67,7 +60,7 @@ func AuthMiddleware() gin.HandlerFunc {
 }
 
 
-func AdminRequired() gin.HandlerFunc {
+func AdminRequired(userService *services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, exists := c.Get("userID")
 		if !exists {
@@ -77,16 +70,14 @@ func AdminRequired() gin.HandlerFunc {
 		}
 
 
-		var user models.User
-		result := app.DB.First(&user, userID)
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		if exists, err := userService.UserExists(userID.(uint)); err == nil && !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
 
 
-		if user.ID != 1 {
+		if userID.(uint) != 1 {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 			c.Abort()
 			return
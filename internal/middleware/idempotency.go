@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saneechka/ManageSubscription/internal/services"
+)
+
+const (
+	// idempotencyKeyMaxLength - максимальная длина заголовка Idempotency-Key
+	idempotencyKeyMaxLength = 255
+	// idempotencyBodyMaxSize - максимальный размер тела запроса с ключом: тело читается в память целиком
+	idempotencyBodyMaxSize = 1 << 20
+)
+
+// Idempotency сохраняет первый ответ на POST и PUT запрос пользователя с заголовком Idempotency-Key
+// и возвращает его на повторы с тем же ключом, не выполняя запрос ещё раз. Подключается после
+// AuthMiddleware: ключи разных пользователей не пересекаются. Ответы 5xx не сохраняются
+func Idempotency(idempotencyService *services.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+		if key == "" || (c.Request.Method != http.MethodPost && c.Request.Method != http.MethodPut) {
+			c.Next()
+			return
+		}
+		if len(key) > idempotencyKeyMaxLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Idempotency-Key must be at most %d characters", idempotencyKeyMaxLength)})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, idempotencyBodyMaxSize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body must be at most %d bytes", idempotencyBodyMaxSize)})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s %s\n", c.Request.Method, c.Request.URL.RequestURI())
+		hash.Write(body)
+
+		record, replay, err := idempotencyService.Begin(c.GetUint("userID"), key, hex.EncodeToString(hash.Sum(nil)))
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, services.ErrIdempotencyInProgress):
+				status = http.StatusConflict
+			case errors.Is(err, services.ErrIdempotencyKeyReused):
+				status = http.StatusUnprocessableEntity
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if replay {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.ResponseCode, record.ContentType, []byte(record.ResponseBody))
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		// Ключ освобождается и при панике обработчика, иначе повторы получали бы 409 до истечения срока
+		defer func() {
+			if completed {
+				return
+			}
+			if err := idempotencyService.Release(record); err != nil {
+				fmt.Printf("Ошибка освобождения ключа идемпотентности: %v\n", err)
+			}
+		}()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		if err := idempotencyService.Complete(record, status, c.Writer.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			fmt.Printf("Ошибка сохранения ответа для ключа идемпотентности: %v\n", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// responseRecorder копирует тело ответа, чтобы сохранить его для повторов
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
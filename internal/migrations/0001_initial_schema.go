@@ -0,0 +1,189 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Схема на момент перехода с AutoMigrate на миграции. Структуры зафиксированы здесь,
+// чтобы последующие изменения моделей не меняли эту миграцию. На существующей базе,
+// созданной AutoMigrate, миграция добавляет недостающее и выравнивает типы внешних
+// ключей подписок (bigint) с первичными ключами (int)
+
+type initialUser struct {
+	ID                uint `gorm:"primarykey;size:32"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
+	Email             string         `gorm:"type:varchar(100);uniqueIndex"`
+	Password          string         `gorm:"type:varchar(100)"`
+	FirstName         string         `gorm:"type:varchar(100)"`
+	LastName          string         `gorm:"type:varchar(100)"`
+	PaymentMethod     string
+	IsEmailVerified   bool   `gorm:"default:false"`
+	VerificationToken string `gorm:"type:varchar(100)"`
+	TokenExpiresAt    *time.Time
+}
+
+func (initialUser) TableName() string { return "users" }
+
+type initialPlan struct {
+	ID          uint    `gorm:"primarykey;size:32"`
+	Name        string  `gorm:"type:varchar(255);not null"`
+	Description string  `gorm:"type:varchar(1000)"`
+	Price       float64 `gorm:"type:decimal(10,2);not null"`
+	Duration    int     `gorm:"not null"`
+	PeriodType  string  `gorm:"type:varchar(20);default:'days'"`
+	Features    string  `gorm:"type:text"`
+	IsPopular   bool    `gorm:"default:false"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	IsActive    bool           `gorm:"default:true"`
+	ServiceIcon string         `gorm:"type:varchar(255)"`
+	ServiceType string         `gorm:"type:varchar(100)"`
+	ServiceURL  string         `gorm:"type:varchar(255)"`
+}
+
+func (initialPlan) TableName() string { return "plans" }
+
+type initialSubscription struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+	UserID         uint           `gorm:"size:32"`
+	PlanID         uint           `gorm:"size:32"`
+	StartDate      time.Time
+	EndDate        time.Time
+	Status         string `gorm:"type:varchar(20)"`
+	RenewalDate    *time.Time
+	CancelledAt    *time.Time
+	PaymentID      string
+	StripeSubID    string
+	AutoRenew      bool  `gorm:"default:true"`
+	OrganizationID *uint `gorm:"size:32;index"`
+}
+
+func (initialSubscription) TableName() string { return "subscriptions" }
+
+type initialEmailChangeRequest struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	UserID         uint   `gorm:"size:32;index;not null"`
+	OldEmail       string `gorm:"type:varchar(100)"`
+	NewEmail       string `gorm:"type:varchar(100);not null"`
+	Token          string `gorm:"type:varchar(100);uniqueIndex"`
+	TokenExpiresAt time.Time
+	ConfirmedAt    *time.Time
+}
+
+func (initialEmailChangeRequest) TableName() string { return "email_change_requests" }
+
+type initialAccountDeletion struct {
+	ID           uint `gorm:"primarykey;size:32"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uint   `gorm:"size:32;index;not null"`
+	Email        string `gorm:"type:varchar(100)"`
+	Password     string `gorm:"type:varchar(100)"`
+	FirstName    string `gorm:"type:varchar(100)"`
+	LastName     string `gorm:"type:varchar(100)"`
+	RestoreToken string `gorm:"type:varchar(100);index"`
+	PurgeAfter   time.Time
+	RestoredAt   *time.Time
+	PurgedAt     *time.Time
+}
+
+func (initialAccountDeletion) TableName() string { return "account_deletions" }
+
+type initialUserIdentity struct {
+	ID        uint `gorm:"primarykey;size:32"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint   `gorm:"size:32;index;not null"`
+	Provider  string `gorm:"type:varchar(50);not null;uniqueIndex:idx_identity_provider_subject"`
+	Subject   string `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_provider_subject"`
+	Email     string `gorm:"type:varchar(100)"`
+}
+
+func (initialUserIdentity) TableName() string { return "user_identities" }
+
+type initialOIDCLoginState struct {
+	ID           uint `gorm:"primarykey;size:32"`
+	CreatedAt    time.Time
+	State        string    `gorm:"type:varchar(100);uniqueIndex;not null"`
+	Provider     string    `gorm:"type:varchar(50);not null"`
+	Nonce        string    `gorm:"type:varchar(100);not null"`
+	CodeVerifier string    `gorm:"type:varchar(128);not null"`
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+func (initialOIDCLoginState) TableName() string { return "oidc_login_states" }
+
+type initialOrganization struct {
+	ID        uint `gorm:"primarykey;size:32"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Name      string         `gorm:"type:varchar(255);not null"`
+	OwnerID   uint           `gorm:"size:32;index;not null"`
+}
+
+func (initialOrganization) TableName() string { return "organizations" }
+
+type initialOrganizationMember struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	OrganizationID uint   `gorm:"size:32;not null;uniqueIndex:idx_org_member"`
+	UserID         uint   `gorm:"size:32;not null;uniqueIndex:idx_org_member"`
+	Role           string `gorm:"type:varchar(20);not null"`
+}
+
+func (initialOrganizationMember) TableName() string { return "organization_members" }
+
+type initialOrganizationInvitation struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	OrganizationID uint   `gorm:"size:32;index;not null"`
+	Email          string `gorm:"type:varchar(100);not null"`
+	Role           string `gorm:"type:varchar(20);not null"`
+	Token          string `gorm:"type:varchar(100);uniqueIndex"`
+	InvitedBy      uint   `gorm:"size:32"`
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+}
+
+func (initialOrganizationInvitation) TableName() string { return "organization_invitations" }
+
+func initialSchemaTables() []interface{} {
+	return []interface{}{
+		&initialUser{}, &initialPlan{}, &initialSubscription{},
+		&initialEmailChangeRequest{}, &initialAccountDeletion{},
+		&initialUserIdentity{}, &initialOIDCLoginState{},
+		&initialOrganization{}, &initialOrganizationMember{}, &initialOrganizationInvitation{},
+	}
+}
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(initialSchemaTables()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			tables := initialSchemaTables()
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(tables[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
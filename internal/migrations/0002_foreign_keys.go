@@ -0,0 +1,183 @@
+package migrations
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Внешние ключи между пользователями, планами, организациями и зависимыми записями.
+// Подписки нельзя удалить вместе с планом или пользователем (RESTRICT): планы
+// удаляются мягко, а пользователи - только через очистку аккаунта, которая сама
+// удаляет подписки. Служебные записи (привязки, запросы смены email, участники
+// и приглашения организаций) удаляются вместе с родителем
+
+type fkUser struct {
+	ID uint `gorm:"primarykey;size:32"`
+}
+
+func (fkUser) TableName() string { return "users" }
+
+type fkPlan struct {
+	ID uint `gorm:"primarykey;size:32"`
+}
+
+func (fkPlan) TableName() string { return "plans" }
+
+type fkOrganization struct {
+	ID uint `gorm:"primarykey;size:32"`
+}
+
+func (fkOrganization) TableName() string { return "organizations" }
+
+type fkSubscription struct {
+	ID             uint            `gorm:"primarykey;size:32"`
+	UserID         uint            `gorm:"size:32"`
+	PlanID         uint            `gorm:"size:32"`
+	OrganizationID *uint           `gorm:"size:32"`
+	User           fkUser          `gorm:"constraint:OnDelete:RESTRICT"`
+	Plan           fkPlan          `gorm:"constraint:OnDelete:RESTRICT"`
+	Organization   *fkOrganization `gorm:"constraint:OnDelete:RESTRICT"`
+}
+
+func (fkSubscription) TableName() string { return "subscriptions" }
+
+type fkOrganizationMember struct {
+	ID             uint           `gorm:"primarykey;size:32"`
+	OrganizationID uint           `gorm:"size:32"`
+	UserID         uint           `gorm:"size:32"`
+	Organization   fkOrganization `gorm:"constraint:OnDelete:CASCADE"`
+	User           fkUser         `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (fkOrganizationMember) TableName() string { return "organization_members" }
+
+type fkOrganizationInvitation struct {
+	ID             uint           `gorm:"primarykey;size:32"`
+	OrganizationID uint           `gorm:"size:32"`
+	Organization   fkOrganization `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (fkOrganizationInvitation) TableName() string { return "organization_invitations" }
+
+type fkUserIdentity struct {
+	ID     uint   `gorm:"primarykey;size:32"`
+	UserID uint   `gorm:"size:32"`
+	User   fkUser `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (fkUserIdentity) TableName() string { return "user_identities" }
+
+type fkEmailChangeRequest struct {
+	ID     uint   `gorm:"primarykey;size:32"`
+	UserID uint   `gorm:"size:32"`
+	User   fkUser `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (fkEmailChangeRequest) TableName() string { return "email_change_requests" }
+
+type foreignKey struct {
+	model    interface{}
+	table    string
+	relation string
+}
+
+var foreignKeys = []foreignKey{
+	{&fkSubscription{}, "subscriptions", "User"},
+	{&fkSubscription{}, "subscriptions", "Plan"},
+	{&fkSubscription{}, "subscriptions", "Organization"},
+	{&fkOrganizationMember{}, "organization_members", "Organization"},
+	{&fkOrganizationMember{}, "organization_members", "User"},
+	{&fkOrganizationInvitation{}, "organization_invitations", "Organization"},
+	{&fkUserIdentity{}, "user_identities", "User"},
+	{&fkEmailChangeRequest{}, "email_change_requests", "User"},
+}
+
+// orphanCleanup удаляет служебные записи, чей родитель уже удалён, иначе ключ не создать
+var orphanCleanup = []string{
+	"DELETE FROM organization_members WHERE user_id NOT IN (SELECT id FROM users) OR organization_id NOT IN (SELECT id FROM organizations)",
+	"DELETE FROM organization_invitations WHERE organization_id NOT IN (SELECT id FROM organizations)",
+	"DELETE FROM user_identities WHERE user_id NOT IN (SELECT id FROM users)",
+	"DELETE FROM email_change_requests WHERE user_id NOT IN (SELECT id FROM users)",
+}
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "foreign_keys",
+		Up: func(tx *gorm.DB) error {
+			// Подписки без плана или владельца не удаляем автоматически: это платёжные данные
+			var broken int64
+			err := tx.Raw("SELECT COUNT(*) FROM subscriptions WHERE plan_id NOT IN (SELECT id FROM plans)" +
+				" OR user_id NOT IN (SELECT id FROM users)" +
+				" OR (organization_id IS NOT NULL AND organization_id NOT IN (SELECT id FROM organizations))").
+				Scan(&broken).Error
+			if err != nil {
+				return err
+			}
+			if broken > 0 {
+				return fmt.Errorf("%d subscriptions reference missing plans, users or organizations; fix or remove them before migrating", broken)
+			}
+
+			for _, query := range orphanCleanup {
+				if err := tx.Exec(query).Error; err != nil {
+					return err
+				}
+			}
+
+			for _, fk := range foreignKeys {
+				if tx.Migrator().HasConstraint(fk.model, fk.relation) {
+					continue
+				}
+				err := keepSQLiteIndexes(tx, fk.table, func() error {
+					return tx.Migrator().CreateConstraint(fk.model, fk.relation)
+				})
+				if err != nil {
+					return fmt.Errorf("error creating foreign key %s.%s: %w", fk.table, fk.relation, err)
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for i := len(foreignKeys) - 1; i >= 0; i-- {
+				fk := foreignKeys[i]
+				if !tx.Migrator().HasConstraint(fk.model, fk.relation) {
+					continue
+				}
+				err := keepSQLiteIndexes(tx, fk.table, func() error {
+					return tx.Migrator().DropConstraint(fk.model, fk.relation)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// keepSQLiteIndexes восстанавливает индексы таблицы после fn. SQLite не умеет менять
+// ограничения таблицы, и GORM пересоздаёт её целиком, теряя индексы
+func keepSQLiteIndexes(tx *gorm.DB, table string, fn func() error) error {
+	if tx.Dialector.Name() != "sqlite" {
+		return fn()
+	}
+
+	var indexes []string
+	err := tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).
+		Scan(&indexes).Error
+	if err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if err := tx.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Версии планов: условия оплаты фиксируются в plan_versions, подписка ссылается
+// на версию, по которой оформлена. Существующие планы получают версию 1 с текущей
+// ценой, и к ней привязываются все их подписки
+
+type versionedPlanVersion struct {
+	ID            uint `gorm:"primarykey;size:32"`
+	CreatedAt     time.Time
+	PlanID        uint    `gorm:"size:32;not null;uniqueIndex:idx_plan_version"`
+	Version       int     `gorm:"not null;uniqueIndex:idx_plan_version"`
+	Price         float64 `gorm:"type:decimal(10,2);not null"`
+	Duration      int     `gorm:"not null"`
+	PeriodType    string  `gorm:"type:varchar(20);not null"`
+	EffectiveFrom time.Time
+	Plan          fkPlan `gorm:"constraint:OnDelete:RESTRICT"`
+}
+
+func (versionedPlanVersion) TableName() string { return "plan_versions" }
+
+type versionedSubscription struct {
+	ID            uint                  `gorm:"primarykey;size:32"`
+	PlanVersionID *uint                 `gorm:"size:32;index"`
+	PlanVersion   *versionedPlanVersion `gorm:"constraint:OnDelete:RESTRICT"`
+}
+
+func (versionedSubscription) TableName() string { return "subscriptions" }
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "plan_versions",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&versionedPlanVersion{}); err != nil {
+				return err
+			}
+
+			err := tx.Exec("INSERT INTO plan_versions (created_at, plan_id, version, price, duration, period_type, effective_from)" +
+				" SELECT created_at, id, 1, price, duration, COALESCE(period_type, 'days'), created_at FROM plans").Error
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Migrator().AddColumn(&versionedSubscription{}, "PlanVersionID"); err != nil {
+				return err
+			}
+			err = tx.Exec("UPDATE subscriptions SET plan_version_id = (SELECT id FROM plan_versions" +
+				" WHERE plan_versions.plan_id = subscriptions.plan_id AND plan_versions.version = 1)").Error
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Migrator().CreateIndex(&versionedSubscription{}, "PlanVersionID"); err != nil {
+				return err
+			}
+			return keepSQLiteIndexes(tx, "subscriptions", func() error {
+				return tx.Migrator().CreateConstraint(&versionedSubscription{}, "PlanVersion")
+			})
+		},
+		Down: func(tx *gorm.DB) error {
+			err := keepSQLiteIndexes(tx, "subscriptions", func() error {
+				return tx.Migrator().DropConstraint(&versionedSubscription{}, "PlanVersion")
+			})
+			if err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropIndex(&versionedSubscription{}, "PlanVersionID"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&versionedSubscription{}, "PlanVersionID"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&versionedPlanVersion{})
+		},
+	})
+}
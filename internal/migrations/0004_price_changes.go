@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Запланированные изменения цен планов и уведомления подписчиков о них. Уведомления
+// удаляются вместе с подпиской или пользователем, изменения цен хранятся как история плана
+
+type priceChangeSubscription struct {
+	ID uint `gorm:"primarykey;size:32"`
+}
+
+func (priceChangeSubscription) TableName() string { return "subscriptions" }
+
+type priceChangePlanVersion struct {
+	ID uint `gorm:"primarykey;size:32"`
+}
+
+func (priceChangePlanVersion) TableName() string { return "plan_versions" }
+
+type priceChange struct {
+	ID            uint `gorm:"primarykey;size:32"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	PlanID        uint      `gorm:"size:32;not null;index"`
+	PlanVersionID uint      `gorm:"size:32;not null"`
+	OldPrice      float64   `gorm:"type:decimal(10,2);not null"`
+	NewPrice      float64   `gorm:"type:decimal(10,2);not null"`
+	EffectiveFrom time.Time `gorm:"index"`
+	NotifiedCount int
+	DeclinedCount int
+	AppliedAt     *time.Time
+	Plan          fkPlan                 `gorm:"constraint:OnDelete:RESTRICT"`
+	PlanVersion   priceChangePlanVersion `gorm:"constraint:OnDelete:RESTRICT"`
+}
+
+func (priceChange) TableName() string { return "price_changes" }
+
+type priceChangeNotice struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	PriceChangeID  uint `gorm:"size:32;not null;uniqueIndex:idx_price_change_notice"`
+	SubscriptionID uint `gorm:"size:32;not null;uniqueIndex:idx_price_change_notice"`
+	UserID         uint `gorm:"size:32;not null;index"`
+	AppliesFrom    time.Time
+	Token          string `gorm:"type:varchar(100);uniqueIndex"`
+	DeclinedAt     *time.Time
+	PriceChange    priceChange             `gorm:"constraint:OnDelete:CASCADE"`
+	Subscription   priceChangeSubscription `gorm:"constraint:OnDelete:CASCADE"`
+	User           fkUser                  `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (priceChangeNotice) TableName() string { return "price_change_notices" }
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "price_changes",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&priceChange{}, &priceChangeNotice{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&priceChangeNotice{}, &priceChange{})
+		},
+	})
+}
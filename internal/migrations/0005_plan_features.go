@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Структурированные функции планов. Текстовое поле plans.features остаётся описанием
+// для витрины, функции заполняются администратором отдельно
+
+type planFeature struct {
+	ID        uint `gorm:"primarykey;size:32"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	PlanID    uint   `gorm:"size:32;not null;uniqueIndex:idx_plan_feature"`
+	Key       string `gorm:"type:varchar(100);not null;uniqueIndex:idx_plan_feature"`
+	Label     string `gorm:"type:varchar(255)"`
+	Type      string `gorm:"type:varchar(20);not null"`
+	Limit     int64  `gorm:"column:feature_limit"`
+	Value     string `gorm:"type:varchar(255)"`
+	Plan      fkPlan `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (planFeature) TableName() string { return "plan_features" }
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "plan_features",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&planFeature{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&planFeature{})
+		},
+	})
+}
@@ -0,0 +1,102 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Оплата по факту использования: составляющие планов, записи использования от внешних
+// систем, ключи API и счета за периоды подписок. Использование и счета удаляются
+// вместе с подпиской
+
+type meteredSubscription struct {
+	ID uint `gorm:"primarykey;size:32"`
+}
+
+func (meteredSubscription) TableName() string { return "subscriptions" }
+
+type meteredComponent struct {
+	ID               uint `gorm:"primarykey;size:32"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	PlanID           uint    `gorm:"size:32;not null;uniqueIndex:idx_plan_component"`
+	Key              string  `gorm:"type:varchar(100);not null;uniqueIndex:idx_plan_component"`
+	Label            string  `gorm:"type:varchar(255)"`
+	Unit             string  `gorm:"type:varchar(50)"`
+	IncludedQuantity float64 `gorm:"type:decimal(14,4);not null"`
+	OverageUnitPrice float64 `gorm:"type:decimal(10,4);not null"`
+	Plan             fkPlan  `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (meteredComponent) TableName() string { return "metered_components" }
+
+type apiKey struct {
+	ID         uint `gorm:"primarykey;size:32"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Name       string `gorm:"type:varchar(255);not null"`
+	Prefix     string `gorm:"type:varchar(16);not null"`
+	KeyHash    string `gorm:"type:varchar(64);uniqueIndex;not null"`
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (apiKey) TableName() string { return "api_keys" }
+
+type usageRecord struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	SubscriptionID uint                `gorm:"size:32;not null;index:idx_usage_period"`
+	ComponentKey   string              `gorm:"type:varchar(100);not null"`
+	Quantity       float64             `gorm:"type:decimal(14,4);not null"`
+	RecordedAt     time.Time           `gorm:"index:idx_usage_period"`
+	EventID        *string             `gorm:"type:varchar(100);uniqueIndex"`
+	APIKeyID       uint                `gorm:"size:32"`
+	Subscription   meteredSubscription `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (usageRecord) TableName() string { return "usage_records" }
+
+type invoice struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	SubscriptionID uint  `gorm:"size:32;not null;index"`
+	UserID         uint  `gorm:"size:32;not null;index"`
+	OrganizationID *uint `gorm:"size:32;index"`
+	PeriodStart    time.Time
+	PeriodEnd      time.Time
+	Total          float64             `gorm:"type:decimal(10,2);not null"`
+	Subscription   meteredSubscription `gorm:"constraint:OnDelete:CASCADE"`
+	User           fkUser              `gorm:"constraint:OnDelete:CASCADE"`
+	Organization   *fkOrganization     `gorm:"constraint:OnDelete:SET NULL"`
+}
+
+func (invoice) TableName() string { return "invoices" }
+
+type invoiceLine struct {
+	ID           uint    `gorm:"primarykey;size:32"`
+	InvoiceID    uint    `gorm:"size:32;not null;index"`
+	Kind         string  `gorm:"type:varchar(20);not null"`
+	Description  string  `gorm:"type:varchar(255)"`
+	ComponentKey string  `gorm:"type:varchar(100)"`
+	Quantity     float64 `gorm:"type:decimal(14,4);not null"`
+	UnitPrice    float64 `gorm:"type:decimal(10,4);not null"`
+	Amount       float64 `gorm:"type:decimal(10,2);not null"`
+	Invoice      invoice `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (invoiceLine) TableName() string { return "invoice_lines" }
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "metered_billing",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&meteredComponent{}, &apiKey{}, &usageRecord{}, &invoice{}, &invoiceLine{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&invoiceLine{}, &invoice{}, &usageRecord{}, &apiKey{}, &meteredComponent{})
+		},
+	})
+}
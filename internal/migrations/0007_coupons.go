@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Купоны и промокоды. Купоны удаляются мягко, поэтому применения ссылаются на них
+// без каскада; применения удаляются вместе с подпиской или пользователем
+
+type coupon struct {
+	ID              uint `gorm:"primarykey;size:32"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       gorm.DeletedAt `gorm:"index"`
+	Code            string         `gorm:"type:varchar(50);not null;uniqueIndex"`
+	Name            string         `gorm:"type:varchar(255)"`
+	DiscountType    string         `gorm:"type:varchar(20);not null"`
+	PercentOff      float64        `gorm:"type:decimal(5,2)"`
+	AmountOff       float64        `gorm:"type:decimal(10,2)"`
+	Duration        string         `gorm:"type:varchar(20);not null"`
+	DurationPeriods int
+	MaxRedemptions  int
+	RedemptionCount int
+	ExpiresAt       *time.Time
+	IsActive        bool `gorm:"default:true"`
+}
+
+func (coupon) TableName() string { return "coupons" }
+
+type couponPlan struct {
+	ID       uint   `gorm:"primarykey;size:32"`
+	CouponID uint   `gorm:"size:32;not null;uniqueIndex:idx_coupon_plan"`
+	PlanID   uint   `gorm:"size:32;not null;uniqueIndex:idx_coupon_plan"`
+	Coupon   coupon `gorm:"constraint:OnDelete:CASCADE"`
+	Plan     fkPlan `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (couponPlan) TableName() string { return "coupon_plans" }
+
+type couponRedemption struct {
+	ID                uint `gorm:"primarykey;size:32"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	CouponID          uint `gorm:"size:32;not null;index"`
+	SubscriptionID    uint `gorm:"size:32;not null;uniqueIndex"`
+	UserID            uint `gorm:"size:32;not null;index"`
+	PeriodsDiscounted int
+	DiscountTotal     float64             `gorm:"type:decimal(10,2);not null"`
+	Coupon            coupon              `gorm:"constraint:OnDelete:RESTRICT"`
+	Subscription      meteredSubscription `gorm:"constraint:OnDelete:CASCADE"`
+	User              fkUser              `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (couponRedemption) TableName() string { return "coupon_redemptions" }
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "coupons",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&coupon{}, &couponPlan{}, &couponRedemption{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&couponRedemption{}, &couponPlan{}, &coupon{})
+		},
+	})
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Подарочные подписки. Подарок удаляется вместе с покупателем; подписка, созданная
+// подарком, остаётся у получателя
+
+type gift struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	PurchaserID    uint    `gorm:"size:32;not null;index"`
+	PlanID         uint    `gorm:"size:32;not null"`
+	PlanVersionID  uint    `gorm:"size:32;not null"`
+	Price          float64 `gorm:"type:decimal(10,2);not null"`
+	PaymentID      string
+	RecipientEmail string    `gorm:"type:varchar(255);not null"`
+	Message        string    `gorm:"type:varchar(1000)"`
+	Code           string    `gorm:"type:varchar(32);not null;uniqueIndex"`
+	Status         string    `gorm:"type:varchar(20);not null"`
+	ExpiresAt      time.Time
+	RedeemedAt     *time.Time
+	RedeemedByID   *uint `gorm:"size:32"`
+	SubscriptionID *uint `gorm:"size:32"`
+	Extended       bool
+	Purchaser      fkUser                 `gorm:"foreignKey:PurchaserID;constraint:OnDelete:CASCADE"`
+	RedeemedBy     *fkUser                `gorm:"foreignKey:RedeemedByID;constraint:OnDelete:SET NULL"`
+	Plan           fkPlan                 `gorm:"constraint:OnDelete:RESTRICT"`
+	PlanVersion    priceChangePlanVersion `gorm:"constraint:OnDelete:RESTRICT"`
+	Subscription   *meteredSubscription   `gorm:"constraint:OnDelete:SET NULL"`
+}
+
+func (gift) TableName() string { return "gifts" }
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "gifts",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&gift{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&gift{})
+		},
+	})
+}
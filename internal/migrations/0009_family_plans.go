@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Семейные планы: число мест плана, участники семейных подписок и приглашения.
+// Существующие планы остаются индивидуальными (одно место)
+
+type familyPlan struct {
+	ID    uint `gorm:"primarykey;size:32"`
+	Seats int  `gorm:"not null;default:1"`
+}
+
+func (familyPlan) TableName() string { return "plans" }
+
+type familyMember struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	SubscriptionID uint                `gorm:"size:32;not null;uniqueIndex:idx_family_member"`
+	UserID         uint                `gorm:"size:32;not null;uniqueIndex:idx_family_member;index"`
+	Subscription   meteredSubscription `gorm:"constraint:OnDelete:CASCADE"`
+	User           fkUser              `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (familyMember) TableName() string { return "family_members" }
+
+type familyInvitation struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	SubscriptionID uint   `gorm:"size:32;not null;index"`
+	Email          string `gorm:"type:varchar(100);not null"`
+	Token          string `gorm:"type:varchar(100);uniqueIndex"`
+	InvitedBy      uint   `gorm:"size:32"`
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+	RevokedAt      *time.Time
+	Subscription   meteredSubscription `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (familyInvitation) TableName() string { return "family_invitations" }
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "family_plans",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&familyPlan{}, "Seats"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&familyMember{}, &familyInvitation{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&familyInvitation{}, &familyMember{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&familyPlan{}, "Seats")
+		},
+	})
+}
@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Разделение стоимости подписок: участники с балансом долга владельцу и журнал
+// начислений и оплат. Разделение удаляется вместе с подпиской, участник-пользователь
+// после удаления аккаунта остаётся в разделении без ссылки на пользователя
+
+type costSplit struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	SubscriptionID uint                `gorm:"size:32;not null;uniqueIndex"`
+	OwnerID        uint                `gorm:"size:32;not null;index"`
+	Mode           string              `gorm:"type:varchar(20);not null"`
+	Subscription   meteredSubscription `gorm:"constraint:OnDelete:CASCADE"`
+	Owner          fkUser              `gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE"`
+}
+
+func (costSplit) TableName() string { return "cost_splits" }
+
+type splitParticipant struct {
+	ID        uint `gorm:"primarykey;size:32"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	SplitID   uint    `gorm:"size:32;not null;index"`
+	UserID    *uint   `gorm:"size:32;index"`
+	Name      string  `gorm:"type:varchar(255);not null"`
+	Share     float64 `gorm:"type:decimal(5,2)"`
+	Active    bool
+	Balance   float64   `gorm:"type:decimal(10,2);not null"`
+	Split     costSplit `gorm:"constraint:OnDelete:CASCADE"`
+	User      *fkUser   `gorm:"constraint:OnDelete:SET NULL"`
+}
+
+func (splitParticipant) TableName() string { return "split_participants" }
+
+type splitLedgerEntry struct {
+	ID            uint `gorm:"primarykey;size:32"`
+	CreatedAt     time.Time
+	SplitID       uint             `gorm:"size:32;not null;index"`
+	ParticipantID uint             `gorm:"size:32;not null;index"`
+	Kind          string           `gorm:"type:varchar(20);not null"`
+	Amount        float64          `gorm:"type:decimal(10,2);not null"`
+	BalanceAfter  float64          `gorm:"type:decimal(10,2);not null"`
+	InvoiceID     *uint            `gorm:"size:32"`
+	RecordedByID  *uint            `gorm:"size:32"`
+	Note          string           `gorm:"type:varchar(255)"`
+	Split         costSplit        `gorm:"constraint:OnDelete:CASCADE"`
+	Participant   splitParticipant `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (splitLedgerEntry) TableName() string { return "split_ledger_entries" }
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "cost_splits",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&costSplit{}, &splitParticipant{}, &splitLedgerEntry{})
+		},
+		Down: func(tx *gorm.DB) error {
+			// Таблицы удаляются по одной: дочерние раньше родительских
+			for _, table := range []interface{}{&splitLedgerEntry{}, &splitParticipant{}, &costSplit{}} {
+				if err := tx.Migrator().DropTable(table); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
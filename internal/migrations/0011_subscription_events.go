@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// История подписок. События удаляются только вместе с подпиской
+
+type subscriptionEvent struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	SubscriptionID uint                `gorm:"size:32;not null;index"`
+	Type           string              `gorm:"type:varchar(30);not null"`
+	ActorID        *uint               `gorm:"size:32"`
+	Before         string              `gorm:"type:text"`
+	After          string              `gorm:"type:text"`
+	Subscription   meteredSubscription `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (subscriptionEvent) TableName() string { return "subscription_events" }
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "subscription_events",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&subscriptionEvent{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&subscriptionEvent{})
+		},
+	})
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Журнал аудита. Внешнего ключа на пользователя нет: записи хранятся и после удаления аккаунта
+
+type auditEntry struct {
+	ID         uint      `gorm:"primarykey;size:32"`
+	CreatedAt  time.Time `gorm:"index"`
+	ActorID    *uint     `gorm:"size:32;index"`
+	Action     string    `gorm:"type:varchar(100);not null;index"`
+	TargetType string    `gorm:"type:varchar(50);index:idx_audit_target"`
+	TargetID   string    `gorm:"type:varchar(255);index:idx_audit_target"`
+	RequestID  string    `gorm:"type:varchar(64);index"`
+	IP         string    `gorm:"type:varchar(45)"`
+	Status     int
+	Changes    string `gorm:"type:text"`
+}
+
+func (auditEntry) TableName() string { return "audit_entries" }
+
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "audit_log",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&auditEntry{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&auditEntry{})
+		},
+	})
+}
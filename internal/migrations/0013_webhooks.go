@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Получатели событий подписок и журнал доставок. Получатель без user_id принадлежит администратору
+
+type webhookEndpoint struct {
+	ID          uint `gorm:"primarykey;size:32"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      *uint   `gorm:"size:32;index"`
+	URL         string  `gorm:"type:varchar(2048);not null"`
+	Description string  `gorm:"type:varchar(255)"`
+	Events      string  `gorm:"type:text"`
+	Secret      string  `gorm:"type:varchar(64);not null"`
+	Active      bool    `gorm:"not null"`
+	User        *fkUser `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (webhookEndpoint) TableName() string { return "webhook_endpoints" }
+
+type webhookDelivery struct {
+	ID            uint `gorm:"primarykey;size:32"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	EndpointID    uint   `gorm:"size:32;not null;index"`
+	EventID       string `gorm:"type:varchar(64);not null"`
+	EventType     string `gorm:"type:varchar(50);not null"`
+	Payload       string `gorm:"type:text"`
+	Status        string `gorm:"type:varchar(20);not null;index:idx_webhook_delivery_due"`
+	Attempts      int
+	ResponseCode  int
+	LastError     string     `gorm:"type:varchar(500)"`
+	NextAttemptAt *time.Time `gorm:"index:idx_webhook_delivery_due"`
+	DeliveredAt   *time.Time
+	Endpoint      webhookEndpoint `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (webhookDelivery) TableName() string { return "webhook_deliveries" }
+
+func init() {
+	register(Migration{
+		Version: 13,
+		Name:    "webhooks",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&webhookEndpoint{}, &webhookDelivery{})
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, table := range []interface{}{&webhookDelivery{}, &webhookEndpoint{}} {
+				if err := tx.Migrator().DropTable(table); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Состояние оплаты счетов и журнал событий платёжного провайдера. Счета, выставленные
+// до миграции, считаются неоплаченными (open), пока провайдер не подтвердит оплату
+
+type paidInvoice struct {
+	ID             uint   `gorm:"primarykey;size:32"`
+	Status         string `gorm:"type:varchar(20);not null;default:open"`
+	PaymentID      string `gorm:"type:varchar(255);index"`
+	PaidAt         *time.Time
+	AmountRefunded float64 `gorm:"type:decimal(10,2);not null;default:0"`
+}
+
+func (paidInvoice) TableName() string { return "invoices" }
+
+type paymentEvent struct {
+	ID             uint `gorm:"primarykey;size:32"`
+	CreatedAt      time.Time
+	EventID        string `gorm:"type:varchar(255);not null;uniqueIndex"`
+	Type           string `gorm:"type:varchar(50);not null"`
+	SubscriptionID *uint  `gorm:"size:32;index"`
+	InvoiceID      *uint  `gorm:"size:32"`
+	Result         string `gorm:"type:varchar(20);not null"`
+	Payload        string `gorm:"type:text"`
+}
+
+func (paymentEvent) TableName() string { return "payment_events" }
+
+// paidInvoiceColumns - новые колонки счёта в порядке добавления
+var paidInvoiceColumns = []string{"Status", "PaymentID", "PaidAt", "AmountRefunded"}
+
+func init() {
+	register(Migration{
+		Version: 14,
+		Name:    "payment_events",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range paidInvoiceColumns {
+				if err := tx.Migrator().AddColumn(&paidInvoice{}, column); err != nil {
+					return err
+				}
+			}
+			if err := tx.Migrator().CreateIndex(&paidInvoice{}, "PaymentID"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&paymentEvent{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&paymentEvent{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropIndex(&paidInvoice{}, "PaymentID"); err != nil {
+				return err
+			}
+			for _, column := range paidInvoiceColumns {
+				if err := tx.Migrator().DropColumn(&paidInvoice{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Сохранённые ответы на запросы с заголовком Idempotency-Key
+
+type idempotencyKey struct {
+	ID           uint `gorm:"primarykey;size:32"`
+	CreatedAt    time.Time
+	UserID       uint   `gorm:"size:32;not null;uniqueIndex:idx_idempotency_key"`
+	Key          string `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_key"`
+	RequestHash  string `gorm:"type:varchar(64);not null"`
+	ResponseCode int
+	ContentType  string    `gorm:"type:varchar(100)"`
+	ResponseBody string    `gorm:"type:text"`
+	ExpiresAt    time.Time `gorm:"index"`
+	User         fkUser    `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (idempotencyKey) TableName() string { return "idempotency_keys" }
+
+func init() {
+	register(Migration{
+		Version: 15,
+		Name:    "idempotency_keys",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&idempotencyKey{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&idempotencyKey{})
+		},
+	})
+}
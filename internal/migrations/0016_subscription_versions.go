@@ -0,0 +1,28 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Версия подписки для оптимистичной блокировки: сохранение изменений, прочитанных
+// до параллельного обновления, отклоняется. Существующие подписки получают версию 0
+
+type lockedSubscription struct {
+	ID      uint `gorm:"primarykey;size:32"`
+	Version uint `gorm:"not null;default:0"`
+}
+
+func (lockedSubscription) TableName() string { return "subscriptions" }
+
+func init() {
+	register(Migration{
+		Version: 16,
+		Name:    "subscription_versions",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&lockedSubscription{}, "Version")
+		},
+		Down: func(tx *gorm.DB) error {
+			return keepSQLiteIndexes(tx, "subscriptions", func() error {
+				return tx.Migrator().DropColumn(&lockedSubscription{}, "Version")
+			})
+		},
+	})
+}
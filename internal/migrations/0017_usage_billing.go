@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Граница закрытых периодов учёта использования: перерасход выставляется после окончания
+// периода, а не при досрочном продлении. Использование подписок, закончившихся до миграции,
+// считается выставленным, чтобы задача не выставила счета за давно прошедшие периоды.
+// EventID использования уникален в пределах подписки, а не среди всех отправителей
+
+type usageBilledSubscription struct {
+	ID                 uint `gorm:"primarykey;size:32"`
+	EndDate            time.Time
+	UsageBilledThrough *time.Time
+}
+
+func (usageBilledSubscription) TableName() string { return "subscriptions" }
+
+type subscriptionUsageEvent struct {
+	ID             uint    `gorm:"primarykey;size:32"`
+	SubscriptionID uint    `gorm:"size:32;not null;uniqueIndex:idx_usage_event"`
+	EventID        *string `gorm:"type:varchar(100);uniqueIndex:idx_usage_event"`
+}
+
+func (subscriptionUsageEvent) TableName() string { return "usage_records" }
+
+func init() {
+	register(Migration{
+		Version: 17,
+		Name:    "usage_billing",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&usageBilledSubscription{}, "UsageBilledThrough"); err != nil {
+				return err
+			}
+			err := tx.Model(&usageBilledSubscription{}).
+				Where("end_date <= ?", time.Now()).
+				Update("usage_billed_through", gorm.Expr("end_date")).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropIndex(&usageRecord{}, "EventID"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&subscriptionUsageEvent{}, "idx_usage_event")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&subscriptionUsageEvent{}, "idx_usage_event"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateIndex(&usageRecord{}, "EventID"); err != nil {
+				return err
+			}
+			return keepSQLiteIndexes(tx, "subscriptions", func() error {
+				return tx.Migrator().DropColumn(&usageBilledSubscription{}, "UsageBilledThrough")
+			})
+		},
+	})
+}
@@ -0,0 +1,305 @@
+// Package migrations описывает версионированные изменения схемы базы данных.
+// Каждая миграция лежит в отдельном файле NNNN_name.go и регистрируется в init().
+// Контрольная сумма миграции - SHA-256 её исходного файла, поэтому изменение
+// уже применённой миграции обнаруживается при следующем запуске
+package migrations
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed *.go
+var sources embed.FS
+
+var (
+	// ErrPending возвращается, если в базе применены не все миграции
+	ErrPending = errors.New("database has pending migrations")
+	// ErrDirty возвращается, если предыдущий запуск миграции не завершился
+	ErrDirty = errors.New("database schema is dirty")
+	// ErrChecksumMismatch возвращается, если применённая миграция была изменена
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+)
+
+// Migration - одно изменение схемы. Down может быть nil, если откат невозможен
+type Migration struct {
+	Version  uint
+	Name     string
+	Checksum string
+	Up       func(tx *gorm.DB) error
+	Down     func(tx *gorm.DB) error
+}
+
+var registered []Migration
+
+// register добавляет миграцию из файла NNNN_name.go
+func register(migration Migration) {
+	file := fmt.Sprintf("%04d_%s.go", migration.Version, migration.Name)
+	source, err := sources.ReadFile(file)
+	if err != nil {
+		panic(fmt.Sprintf("migration %d must be defined in %s", migration.Version, file))
+	}
+	sum := sha256.Sum256(source)
+	migration.Checksum = hex.EncodeToString(sum[:])
+	registered = append(registered, migration)
+}
+
+// All возвращает зарегистрированные миграции по возрастанию версии
+func All() []Migration {
+	all := append([]Migration(nil), registered...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all
+}
+
+// schemaMigration - запись о применённой миграции
+type schemaMigration struct {
+	Version   uint      `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	Checksum  string    `gorm:"type:varchar(64);not null"`
+	Dirty     bool      `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status - состояние одной миграции
+type Status struct {
+	Version   uint       `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	Dirty     bool       `json:"dirty"`
+	Modified  bool       `json:"modified"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Migrator применяет и откатывает миграции
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New создает мигратор для зарегистрированных миграций
+func New(db *gorm.DB) *Migrator {
+	return NewWithMigrations(db, All())
+}
+
+// NewWithMigrations создает мигратор для заданного списка миграций
+func NewWithMigrations(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Up применяет все ожидающие миграции и возвращает их количество
+func (m *Migrator) Up() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	if err := m.verify(applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := m.apply(migration); err != nil {
+			return count, fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// apply выполняет миграцию. Запись помечается как dirty до выполнения: в MySQL
+// DDL не откатывается транзакцией, и незавершённая миграция должна быть видна
+func (m *Migrator) apply(migration Migration) error {
+	record := schemaMigration{
+		Version:   migration.Version,
+		Name:      migration.Name,
+		Checksum:  migration.Checksum,
+		Dirty:     true,
+		AppliedAt: time.Now(),
+	}
+	if err := m.db.Create(&record).Error; err != nil {
+		return err
+	}
+
+	if err := m.db.Transaction(migration.Up); err != nil {
+		return err
+	}
+
+	return m.db.Model(&record).Update("dirty", false).Error
+}
+
+// Down откатывает последние steps применённых миграций и возвращает их количество
+func (m *Migrator) Down(steps int) (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	if err := m.verify(applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		migration := m.migrations[i]
+		record, ok := applied[migration.Version]
+		if !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return count, fmt.Errorf("migration %04d_%s cannot be rolled back", migration.Version, migration.Name)
+		}
+
+		if err := m.db.Model(&record).Update("dirty", true).Error; err != nil {
+			return count, err
+		}
+		if err := m.db.Transaction(migration.Down); err != nil {
+			return count, fmt.Errorf("rollback of %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		if err := m.db.Delete(&record).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Force отмечает миграции до version включительно как успешно применённые,
+// а более поздние - как не применённые. Используется после ручного исправления
+// схемы, если миграция завершилась с ошибкой, и для перевода существующей базы на миграции
+func (m *Migrator) Force(version uint) error {
+	if err := m.ensureTable(); err != nil {
+		return err
+	}
+
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("version > ?", version).Delete(&schemaMigration{}).Error; err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			record := schemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Checksum:  migration.Checksum,
+				AppliedAt: time.Now(),
+			}
+			if err := tx.Save(&record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status возвращает состояние всех миграций
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.Applied = true
+			status.Dirty = record.Dirty
+			status.Modified = record.Checksum != migration.Checksum
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Check проверяет, что схема базы соответствует миграциям этой сборки
+func (m *Migrator) Check() error {
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+	if err := m.verify(applied); err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d not applied", ErrPending, pending)
+	}
+	return nil
+}
+
+// verify проверяет записи о применённых миграциях
+func (m *Migrator) verify(applied map[uint]schemaMigration) error {
+	known := make(map[uint]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	versions := make([]uint, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for _, version := range versions {
+		record := applied[version]
+		if record.Dirty {
+			return fmt.Errorf("%w: migration %04d_%s did not finish, fix the schema and run `migrate force`", ErrDirty, record.Version, record.Name)
+		}
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("database has migration %04d_%s unknown to this build", record.Version, record.Name)
+		}
+		if record.Checksum != migration.Checksum {
+			return fmt.Errorf("%w: %04d_%s was changed after it was applied", ErrChecksumMismatch, migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
+
+// applied возвращает записи о применённых миграциях по версиям
+func (m *Migrator) applied() (map[uint]schemaMigration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var records []schemaMigration
+	if err := m.db.Order("version asc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[uint]schemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	if m.db.Migrator().HasTable(&schemaMigration{}) {
+		return nil
+	}
+	return m.db.Migrator().CreateTable(&schemaMigration{})
+}
@@ -0,0 +1,145 @@
+package migrations_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/saneechka/ManageSubscription/internal/app"
+	"github.com/saneechka/ManageSubscription/internal/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	config := app.DBConfig{Driver: app.DriverSQLite, Path: filepath.Join(t.TempDir(), "test.db")}
+	db, err := app.OpenDB(config, logger.Default.LogMode(logger.Silent))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func createTable(name string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Exec("CREATE TABLE " + name + " (id INTEGER PRIMARY KEY)").Error
+	}
+}
+
+func dropTable(name string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(name)
+	}
+}
+
+func testMigrations() []migrations.Migration {
+	return []migrations.Migration{
+		{Version: 1, Name: "first", Checksum: "a", Up: createTable("first"), Down: dropTable("first")},
+		{Version: 2, Name: "second", Checksum: "b", Up: createTable("second"), Down: dropTable("second")},
+	}
+}
+
+func TestRegisteredMigrationsApplyAndRollBack(t *testing.T) {
+	db := openTestDB(t)
+	migrator := migrations.New(db)
+
+	assert.ErrorIs(t, migrator.Check(), migrations.ErrPending)
+
+	applied, err := migrator.Up()
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations.All()), applied)
+	require.NoError(t, migrator.Check())
+	assert.True(t, db.Migrator().HasTable("subscriptions"))
+
+	applied, err = migrator.Up()
+	require.NoError(t, err)
+	assert.Zero(t, applied, "applied migrations are skipped")
+
+	reverted, err := migrator.Down(len(migrations.All()))
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations.All()), reverted)
+	assert.False(t, db.Migrator().HasTable("users"))
+}
+
+func TestRegisteredMigrationsHaveChecksums(t *testing.T) {
+	for _, migration := range migrations.All() {
+		assert.Len(t, migration.Checksum, 64, "%04d_%s", migration.Version, migration.Name)
+	}
+}
+
+func TestDownRevertsLatestMigration(t *testing.T) {
+	db := openTestDB(t)
+	migrator := migrations.NewWithMigrations(db, testMigrations())
+
+	_, err := migrator.Up()
+	require.NoError(t, err)
+
+	reverted, err := migrator.Down(1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reverted)
+	assert.True(t, db.Migrator().HasTable("first"))
+	assert.False(t, db.Migrator().HasTable("second"))
+	assert.ErrorIs(t, migrator.Check(), migrations.ErrPending)
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+}
+
+func TestChangedMigrationIsDetected(t *testing.T) {
+	db := openTestDB(t)
+	_, err := migrations.NewWithMigrations(db, testMigrations()).Up()
+	require.NoError(t, err)
+
+	changed := testMigrations()
+	changed[0].Checksum = "changed"
+	migrator := migrations.NewWithMigrations(db, changed)
+
+	assert.ErrorIs(t, migrator.Check(), migrations.ErrChecksumMismatch)
+	_, err = migrator.Up()
+	assert.ErrorIs(t, err, migrations.ErrChecksumMismatch)
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+	assert.True(t, statuses[0].Modified)
+}
+
+func TestUnknownAppliedMigrationIsRejected(t *testing.T) {
+	db := openTestDB(t)
+	_, err := migrations.NewWithMigrations(db, testMigrations()).Up()
+	require.NoError(t, err)
+
+	older := migrations.NewWithMigrations(db, testMigrations()[:1])
+	assert.Error(t, older.Check(), "database is newer than the build")
+}
+
+func TestFailedMigrationLeavesSchemaDirty(t *testing.T) {
+	db := openTestDB(t)
+	list := testMigrations()
+	list[1].Up = func(tx *gorm.DB) error { return errors.New("boom") }
+	migrator := migrations.NewWithMigrations(db, list)
+
+	applied, err := migrator.Up()
+	require.Error(t, err)
+	assert.Equal(t, 1, applied)
+	assert.ErrorIs(t, migrator.Check(), migrations.ErrDirty)
+	_, err = migrator.Up()
+	assert.ErrorIs(t, err, migrations.ErrDirty, "dirty schema blocks further migrations")
+
+	require.NoError(t, migrator.Force(1))
+	assert.ErrorIs(t, migrator.Check(), migrations.ErrPending)
+
+	list[1].Up = createTable("second")
+	_, err = migrations.NewWithMigrations(db, list).Up()
+	require.NoError(t, err)
+	require.NoError(t, migrator.Check())
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// AccountDeletion хранит данные удалённого аккаунта на период, в течение которого его можно восстановить.
+// После PurgeAfter аккаунт удаляется окончательно, а персональные данные из записи стираются
+type AccountDeletion struct {
+	ID           uint       `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	UserID       uint       `gorm:"size:32;index;not null" json:"user_id"`
+	Email        string     `gorm:"type:varchar(100)" json:"-"`
+	Password     string     `gorm:"type:varchar(100)" json:"-"`
+	FirstName    string     `gorm:"type:varchar(100)" json:"-"`
+	LastName     string     `gorm:"type:varchar(100)" json:"-"`
+	RestoreToken string     `gorm:"type:varchar(100);index" json:"-"`
+	PurgeAfter   time.Time  `json:"purge_after"`
+	RestoredAt   *time.Time `json:"restored_at,omitempty"`
+	PurgedAt     *time.Time `json:"purged_at,omitempty"`
+}
+
+// CanRestore сообщает, можно ли ещё восстановить аккаунт
+func (d *AccountDeletion) CanRestore() bool {
+	return d.RestoredAt == nil && d.PurgedAt == nil && time.Now().Before(d.PurgeAfter)
+}
+
+// AnonymizedEmail возвращает адрес-заглушку для анонимизированной записи пользователя
+func AnonymizedEmail(userID uint) string {
+	return fmt.Sprintf("deleted-%d@deleted.invalid", userID)
+}
+
+// Anonymize стирает персональные данные пользователя
+func (u *User) Anonymize() {
+	u.Email = AnonymizedEmail(u.ID)
+	u.Password = ""
+	u.FirstName = ""
+	u.LastName = ""
+	u.PaymentMethod = ""
+	u.IsEmailVerified = false
+	u.VerificationToken = ""
+	u.TokenExpiresAt = nil
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountDeletionCanRestore(t *testing.T) {
+	now := time.Now()
+
+	pending := AccountDeletion{PurgeAfter: now.Add(24 * time.Hour)}
+	assert.True(t, pending.CanRestore(), "Account should be restorable during cooling-off window")
+
+	overdue := AccountDeletion{PurgeAfter: now.Add(-time.Hour)}
+	assert.False(t, overdue.CanRestore(), "Account should not be restorable after cooling-off window")
+
+	restored := AccountDeletion{PurgeAfter: now.Add(24 * time.Hour), RestoredAt: &now}
+	assert.False(t, restored.CanRestore(), "Restored account should not be restorable twice")
+
+	purged := AccountDeletion{PurgeAfter: now.Add(24 * time.Hour), PurgedAt: &now}
+	assert.False(t, purged.CanRestore(), "Purged account should not be restorable")
+}
+
+func TestUserAnonymize(t *testing.T) {
+	expires := time.Now()
+	u := User{
+		ID:                42,
+		Email:             "user@example.com",
+		Password:          "hash",
+		FirstName:         "Иван",
+		LastName:          "Иванов",
+		PaymentMethod:     "card",
+		IsEmailVerified:   true,
+		VerificationToken: "token",
+		TokenExpiresAt:    &expires,
+	}
+	u.Anonymize()
+
+	assert.Equal(t, uint(42), u.ID)
+	assert.Equal(t, "deleted-42@deleted.invalid", u.Email)
+	assert.Empty(t, u.Password)
+	assert.Empty(t, u.FirstName)
+	assert.Empty(t, u.LastName)
+	assert.Empty(t, u.PaymentMethod)
+	assert.False(t, u.IsEmailVerified)
+	assert.Empty(t, u.VerificationToken)
+	assert.Nil(t, u.TokenExpiresAt)
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// APIKey - ключ доступа внешней системы к служебному API (передача использования).
+// Хранится только хеш ключа, сам ключ показывается один раз при создании
+type APIKey struct {
+	ID         uint       `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Name       string     `gorm:"type:varchar(255);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"`
+	KeyHash    string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HashAPIKey возвращает хеш ключа для хранения и поиска
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry - запись журнала аудита: действие администратора или действие,
+// важное для безопасности (вход, смена роли, удаление аккаунта)
+type AuditEntry struct {
+	ID        uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	// ActorID - пользователь, выполнивший действие; не задан для анонимных запросов, например входа
+	ActorID    *uint  `gorm:"size:32;index" json:"actor_id,omitempty"`
+	Action     string `gorm:"type:varchar(100);not null;index" json:"action"`
+	TargetType string `gorm:"type:varchar(50);index:idx_audit_target" json:"target_type,omitempty"`
+	TargetID   string `gorm:"type:varchar(255);index:idx_audit_target" json:"target_id,omitempty"`
+	RequestID  string `gorm:"type:varchar(64);index" json:"request_id"`
+	IP         string `gorm:"type:varchar(45)" json:"ip"`
+	// Status - HTTP-статус ответа: неудачные попытки тоже попадают в журнал
+	Status int `json:"status"`
+	// Changes - изменившиеся поля в виде {"поле": {"before": ..., "after": ...}}
+	Changes json.RawMessage `gorm:"type:text" json:"changes,omitempty"`
+}
+
+// auditIgnoredFields - служебные поля, изменение которых не попадает в журнал
+var auditIgnoredFields = map[string]bool{"created_at": true, "updated_at": true}
+
+// FieldChange - значение поля до и после действия
+type FieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// AuditDiff сравнивает JSON-представления объекта до и после действия и возвращает изменившиеся поля.
+// before равен nil при создании, after - при удалении. Результат nil, если поля не изменились
+func AuditDiff(before, after interface{}) (json.RawMessage, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]FieldChange{}
+	for key, value := range afterFields {
+		if !auditIgnoredFields[key] && !bytes.Equal(beforeFields[key], value) {
+			changes[key] = FieldChange{Before: orNull(beforeFields[key]), After: value}
+		}
+	}
+	for key, value := range beforeFields {
+		if _, ok := afterFields[key]; !ok && !auditIgnoredFields[key] {
+			changes[key] = FieldChange{Before: value, After: orNull(nil)}
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(changes)
+}
+
+// jsonFields возвращает поля JSON-объекта. Значение, которое не является объектом, хранится в поле value
+func jsonFields(value interface{}) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if value == nil {
+		return fields, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(encoded, []byte("null")) {
+		return fields, nil
+	}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		fields = map[string]json.RawMessage{"value": encoded}
+	}
+	return fields, nil
+}
+
+func orNull(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return value
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := Coupon{ID: 3, Code: "SPRING", Name: "Весна", MaxRedemptions: 10}
+	after := before
+	after.Name = "Весенняя скидка"
+
+	changes, err := AuditDiff(before, after)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name": {"before": "Весна", "after": "Весенняя скидка"}}`, string(changes))
+
+	changes, err = AuditDiff(before, before)
+	require.NoError(t, err)
+	assert.Nil(t, changes, "nothing changed")
+
+	var deleted *Coupon
+	changes, err = AuditDiff(map[string]string{"role": "admin"}, deleted)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"role": {"before": "admin", "after": null}}`, string(changes))
+
+	changes, err = AuditDiff(nil, []string{"sso"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value": {"before": null, "after": ["sso"]}}`, string(changes))
+}
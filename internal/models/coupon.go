@@ -0,0 +1,183 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Типы скидки купона
+const (
+	// CouponTypePercent - скидка в процентах от цены плана
+	CouponTypePercent = "percent"
+	// CouponTypeFixed - скидка фиксированной суммой, не больше цены плана
+	CouponTypeFixed = "fixed"
+)
+
+// Срок действия скидки по купону
+const (
+	// CouponDurationOnce - скидка только на первый период
+	CouponDurationOnce = "once"
+	// CouponDurationRepeating - скидка на первые DurationPeriods периодов
+	CouponDurationRepeating = "repeating"
+	// CouponDurationForever - скидка на все периоды подписки
+	CouponDurationForever = "forever"
+)
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]*$`)
+
+// Coupon - скидка, которую пользователь получает, указав промокод при оформлении подписки.
+// Условия скидки не меняются после создания: подписки, уже получившие скидку, продлеваются на тех же условиях
+type Coupon struct {
+	ID              uint           `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+	Code            string         `gorm:"type:varchar(50);not null;uniqueIndex" json:"code"`
+	Name            string         `gorm:"type:varchar(255)" json:"name"`
+	DiscountType    string         `gorm:"type:varchar(20);not null" json:"discount_type"`
+	PercentOff      float64        `gorm:"type:decimal(5,2)" json:"percent_off,omitempty"`
+	AmountOff       float64        `gorm:"type:decimal(10,2)" json:"amount_off,omitempty"`
+	Duration        string         `gorm:"type:varchar(20);not null" json:"duration"`
+	DurationPeriods int            `json:"duration_periods,omitempty"`
+	// MaxRedemptions - сколько раз можно применить купон, 0 - без ограничения
+	MaxRedemptions  int        `json:"max_redemptions"`
+	RedemptionCount int        `json:"redemption_count"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	IsActive        bool       `gorm:"default:true" json:"is_active"`
+	// PlanIDs - планы, на которые действует купон; пустой список - на все планы
+	PlanIDs []uint `gorm:"-" json:"plan_ids"`
+}
+
+// NormalizeCouponCode приводит промокод к виду, в котором он хранится
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate проверяет промокод и условия скидки
+func (c *Coupon) Validate() error {
+	if !couponCodePattern.MatchString(c.Code) {
+		return fmt.Errorf("invalid coupon code %q: use letters, digits, '_' and '-'", c.Code)
+	}
+
+	switch c.DiscountType {
+	case CouponTypePercent:
+		if c.PercentOff <= 0 || c.PercentOff > 100 {
+			return errors.New("percent_off must be between 0 and 100")
+		}
+	case CouponTypeFixed:
+		if c.AmountOff <= 0 {
+			return errors.New("amount_off must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown discount type %q", c.DiscountType)
+	}
+
+	switch c.Duration {
+	case CouponDurationOnce, CouponDurationForever:
+		c.DurationPeriods = 0
+	case CouponDurationRepeating:
+		if c.DurationPeriods <= 0 {
+			return errors.New("duration_periods must be positive for a repeating coupon")
+		}
+	default:
+		return fmt.Errorf("unknown coupon duration %q", c.Duration)
+	}
+
+	if c.MaxRedemptions < 0 {
+		return errors.New("max_redemptions must not be negative")
+	}
+	return nil
+}
+
+// CheckRedeemable проверяет, что купон можно применить к новой подписке на план в момент now
+func (c *Coupon) CheckRedeemable(planID uint, now time.Time) error {
+	if !c.IsActive {
+		return errors.New("promo code is no longer active")
+	}
+	if c.ExpiresAt != nil && !now.Before(*c.ExpiresAt) {
+		return errors.New("promo code has expired")
+	}
+	if c.MaxRedemptions > 0 && c.RedemptionCount >= c.MaxRedemptions {
+		return errors.New("promo code redemption limit reached")
+	}
+	if !c.AppliesToPlan(planID) {
+		return errors.New("promo code does not apply to this plan")
+	}
+	return nil
+}
+
+// AppliesToPlan сообщает, действует ли купон на план
+func (c *Coupon) AppliesToPlan(planID uint) bool {
+	if len(c.PlanIDs) == 0 {
+		return true
+	}
+	for _, id := range c.PlanIDs {
+		if id == planID {
+			return true
+		}
+	}
+	return false
+}
+
+// CoversPeriod сообщает, получает ли скидку period-й оплаченный период подписки (с 1)
+func (c *Coupon) CoversPeriod(period int) bool {
+	switch c.Duration {
+	case CouponDurationOnce:
+		return period == 1
+	case CouponDurationRepeating:
+		return period <= c.DurationPeriods
+	default:
+		return true
+	}
+}
+
+// Discount возвращает скидку с цены price
+func (c *Coupon) Discount(price float64) float64 {
+	if c.DiscountType == CouponTypePercent {
+		return RoundMoney(price * c.PercentOff / 100)
+	}
+	return RoundMoney(math.Min(c.AmountOff, price))
+}
+
+// CouponPlan - план, на который ограничено действие купона
+type CouponPlan struct {
+	ID       uint `gorm:"primarykey;size:32" json:"-"`
+	CouponID uint `gorm:"size:32;not null;uniqueIndex:idx_coupon_plan" json:"coupon_id"`
+	PlanID   uint `gorm:"size:32;not null;uniqueIndex:idx_coupon_plan" json:"plan_id"`
+}
+
+// CouponRedemption - применение купона к подписке. PeriodsDiscounted считает периоды,
+// уже оплаченные со скидкой, и определяет, получит ли скидку следующее продление
+type CouponRedemption struct {
+	ID                uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	CouponID          uint      `gorm:"size:32;not null;index" json:"coupon_id"`
+	Coupon            *Coupon   `json:"coupon,omitempty"`
+	SubscriptionID    uint      `gorm:"size:32;not null;uniqueIndex" json:"subscription_id"`
+	UserID            uint      `gorm:"size:32;not null;index" json:"user_id"`
+	PeriodsDiscounted int       `json:"periods_discounted"`
+	DiscountTotal     float64   `gorm:"type:decimal(10,2);not null" json:"discount_total"`
+}
+
+// Apply добавляет в счёт скидку очередного периода, если купон на него распространяется
+func (r *CouponRedemption) Apply(invoice *Invoice, price float64) bool {
+	if r.Coupon == nil || !r.Coupon.CoversPeriod(r.PeriodsDiscounted+1) {
+		return false
+	}
+	amount := r.Coupon.Discount(price)
+	if amount <= 0 {
+		return false
+	}
+
+	invoice.AddDiscount(r.Coupon.Code, amount)
+	r.PeriodsDiscounted++
+	r.DiscountTotal = RoundMoney(r.DiscountTotal + amount)
+	return true
+}
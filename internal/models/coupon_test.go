@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCouponValidate(t *testing.T) {
+	assert.NoError(t, (&Coupon{Code: "SPRING25", DiscountType: CouponTypePercent, PercentOff: 25, Duration: CouponDurationOnce}).Validate())
+	assert.NoError(t, (&Coupon{Code: "MINUS100", DiscountType: CouponTypeFixed, AmountOff: 100, Duration: CouponDurationRepeating, DurationPeriods: 3}).Validate())
+	assert.Error(t, (&Coupon{Code: "spring", DiscountType: CouponTypePercent, PercentOff: 25, Duration: CouponDurationOnce}).Validate(), "code is not normalized")
+	assert.Error(t, (&Coupon{Code: "ALL", DiscountType: CouponTypePercent, PercentOff: 120, Duration: CouponDurationOnce}).Validate())
+	assert.Error(t, (&Coupon{Code: "FREE", DiscountType: CouponTypeFixed, Duration: CouponDurationForever}).Validate())
+	assert.Error(t, (&Coupon{Code: "REP", DiscountType: CouponTypeFixed, AmountOff: 10, Duration: CouponDurationRepeating}).Validate())
+}
+
+func TestCouponCheckRedeemable(t *testing.T) {
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	coupon := Coupon{IsActive: true, ExpiresAt: &expires, MaxRedemptions: 2, RedemptionCount: 1, PlanIDs: []uint{3}}
+
+	assert.NoError(t, coupon.CheckRedeemable(3, now))
+	assert.Error(t, coupon.CheckRedeemable(4, now), "other plan")
+	assert.Error(t, coupon.CheckRedeemable(3, expires), "expired")
+
+	coupon.RedemptionCount = 2
+	assert.Error(t, coupon.CheckRedeemable(3, now), "limit reached")
+}
+
+func TestCouponRedemptionPeriods(t *testing.T) {
+	coupon := &Coupon{Code: "HALF", DiscountType: CouponTypePercent, PercentOff: 50, Duration: CouponDurationRepeating, DurationPeriods: 2}
+	redemption := CouponRedemption{Coupon: coupon}
+
+	for period := 1; period <= 3; period++ {
+		invoice := NewSubscriptionInvoice(&Subscription{}, Plan{Name: "Кинопоиск", Price: 299})
+		applied := redemption.Apply(&invoice, 299)
+		if period <= 2 {
+			assert.True(t, applied)
+			assert.Equal(t, 149.5, invoice.Total)
+		} else {
+			assert.False(t, applied, "discount ends after two periods")
+			assert.Equal(t, 299.0, invoice.Total)
+		}
+	}
+	assert.Equal(t, 2, redemption.PeriodsDiscounted)
+	assert.Equal(t, 299.0, redemption.DiscountTotal)
+
+	fixed := Coupon{DiscountType: CouponTypeFixed, AmountOff: 500}
+	assert.Equal(t, 299.0, fixed.Discount(299), "discount never exceeds the price")
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// EmailChangeRequest хранит запрос на смену email до его подтверждения с нового адреса
+type EmailChangeRequest struct {
+	ID             uint       `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	UserID         uint       `gorm:"size:32;index;not null" json:"user_id"`
+	OldEmail       string     `gorm:"type:varchar(100)" json:"old_email"`
+	NewEmail       string     `gorm:"type:varchar(100);not null" json:"new_email"`
+	Token          string     `gorm:"type:varchar(100);uniqueIndex" json:"-"`
+	TokenExpiresAt time.Time  `json:"token_expires_at"`
+	ConfirmedAt    *time.Time `json:"confirmed_at,omitempty"`
+}
+
+// IsExpired сообщает, истёк ли срок действия ссылки подтверждения
+func (r *EmailChangeRequest) IsExpired() bool {
+	return time.Now().After(r.TokenExpiresAt)
+}
+
+// IsPending сообщает, ожидает ли запрос подтверждения
+func (r *EmailChangeRequest) IsPending() bool {
+	return r.ConfirmedAt == nil && !r.IsExpired()
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailChangeRequestState(t *testing.T) {
+	now := time.Now()
+
+	pending := EmailChangeRequest{TokenExpiresAt: now.Add(time.Hour)}
+	assert.False(t, pending.IsExpired(), "Request should not be expired before TokenExpiresAt")
+	assert.True(t, pending.IsPending(), "Unconfirmed request with valid token should be pending")
+
+	expired := EmailChangeRequest{TokenExpiresAt: now.Add(-time.Hour)}
+	assert.True(t, expired.IsExpired(), "Request should be expired after TokenExpiresAt")
+	assert.False(t, expired.IsPending(), "Expired request should not be pending")
+
+	confirmed := EmailChangeRequest{TokenExpiresAt: now.Add(time.Hour), ConfirmedAt: &now}
+	assert.False(t, confirmed.IsPending(), "Confirmed request should not be pending")
+}
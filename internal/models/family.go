@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// FamilyMember - пользователь, занимающий место в семейной подписке. Владелец подписки
+// занимает одно место и в списке участников не хранится
+type FamilyMember struct {
+	ID             uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	SubscriptionID uint      `gorm:"size:32;not null;uniqueIndex:idx_family_member" json:"subscription_id"`
+	UserID         uint      `gorm:"size:32;not null;uniqueIndex:idx_family_member;index" json:"user_id"`
+	User           User      `gorm:"foreignKey:UserID" json:"user"`
+}
+
+// FamilyInvitation - приглашение занять место в семейной подписке. Неистёкшее
+// приглашение резервирует место до принятия
+type FamilyInvitation struct {
+	ID             uint       `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	SubscriptionID uint       `gorm:"size:32;not null;index" json:"subscription_id"`
+	Email          string     `gorm:"type:varchar(100);not null" json:"email"`
+	Token          string     `gorm:"type:varchar(100);uniqueIndex" json:"-"`
+	InvitedBy      uint       `gorm:"size:32" json:"invited_by"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsPendingAt сообщает, резервирует ли приглашение место в момент now
+func (i *FamilyInvitation) IsPendingAt(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// SeatShare делит цену подписки поровну между занятыми местами
+func SeatShare(price float64, occupiedSeats int) float64 {
+	if occupiedSeats <= 1 {
+		return price
+	}
+	return RoundMoney(price / float64(occupiedSeats))
+}
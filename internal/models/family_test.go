@@ -0,0 +1,36 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeatShare(t *testing.T) {
+	assert.Equal(t, 300.0, SeatShare(300, 1))
+	assert.Equal(t, 300.0, SeatShare(300, 0))
+	assert.Equal(t, 100.0, SeatShare(300, 3))
+	assert.Equal(t, 33.33, SeatShare(100, 3))
+}
+
+func TestFamilyInvitationIsPendingAt(t *testing.T) {
+	expires := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	invitation := FamilyInvitation{ExpiresAt: expires}
+
+	assert.True(t, invitation.IsPendingAt(expires.Add(-time.Minute)))
+	assert.False(t, invitation.IsPendingAt(expires))
+
+	accepted := expires.Add(-time.Hour)
+	invitation.AcceptedAt = &accepted
+	assert.False(t, invitation.IsPendingAt(accepted))
+
+	revoked := FamilyInvitation{ExpiresAt: expires, RevokedAt: &accepted}
+	assert.False(t, revoked.IsPendingAt(accepted))
+}
+
+func TestPlanIsFamily(t *testing.T) {
+	assert.False(t, (&Plan{Seats: 1}).IsFamily())
+	assert.False(t, (&Plan{}).IsFamily())
+	assert.True(t, (&Plan{Seats: 4}).IsFamily())
+}
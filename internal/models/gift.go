@@ -0,0 +1,68 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Статусы подарка
+const (
+	// GiftStatusAwaitingPayment - подарок оформлен, но провайдер ещё не подтвердил оплату; код не отправлен
+	GiftStatusAwaitingPayment = "awaiting_payment"
+	GiftStatusPending         = "pending"
+	GiftStatusRedeemed        = "redeemed"
+	GiftStatusExpired         = "expired"
+)
+
+// Gift - подписка на план для другого человека. После подтверждения оплаты получатель получает код
+// на email и активирует его в своём аккаунте; условия плана фиксируются версией на момент покупки
+type Gift struct {
+	ID             uint         `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	PurchaserID    uint         `gorm:"size:32;not null;index" json:"purchaser_id"`
+	PlanID         uint         `gorm:"size:32;not null" json:"plan_id"`
+	Plan           Plan         `json:"plan"`
+	PlanVersionID  uint         `gorm:"size:32;not null" json:"plan_version_id"`
+	PlanVersion    *PlanVersion `json:"plan_version,omitempty"`
+	Price          float64      `gorm:"type:decimal(10,2);not null" json:"price"`
+	PaymentID      string       `json:"payment_id,omitempty"`
+	RecipientEmail string       `gorm:"type:varchar(255);not null" json:"recipient_email"`
+	Message        string       `gorm:"type:varchar(1000)" json:"message,omitempty"`
+	Code           string       `gorm:"type:varchar(32);not null;uniqueIndex" json:"-"`
+	Status         string       `gorm:"type:varchar(20);not null" json:"status"`
+	ExpiresAt      time.Time    `json:"expires_at"`
+	RedeemedAt     *time.Time   `json:"redeemed_at,omitempty"`
+	RedeemedByID   *uint        `gorm:"size:32" json:"redeemed_by_id,omitempty"`
+	SubscriptionID *uint        `gorm:"size:32" json:"subscription_id,omitempty"`
+	// Extended - подарок продлил уже действующую подписку получателя, а не создал новую
+	Extended bool `json:"extended"`
+}
+
+// NormalizeGiftCode приводит введённый код подарка к виду XXXXX-XXXXX-XXXXX, в котором он хранится.
+// Регистр, пробелы и дефисы при вводе не важны
+func NormalizeGiftCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(code))
+	if len(code) != 15 {
+		return code
+	}
+	return code[:5] + "-" + code[5:10] + "-" + code[10:]
+}
+
+// RefreshStatus помечает неактивированный подарок просроченным после ExpiresAt.
+// Возвращает true, если статус изменился
+func (g *Gift) RefreshStatus(now time.Time) bool {
+	if g.Status == GiftStatusPending && !now.Before(g.ExpiresAt) {
+		g.Status = GiftStatusExpired
+		return true
+	}
+	return false
+}
+
+// BilledPlan возвращает план с условиями, оплаченными покупателем
+func (g *Gift) BilledPlan() Plan {
+	if g.PlanVersion == nil {
+		return g.Plan
+	}
+	return g.PlanVersion.ApplyTo(g.Plan)
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeGiftCode(t *testing.T) {
+	assert.Equal(t, "ABCDE-FGH23-4567Q", NormalizeGiftCode(" abcde fgh23-4567q "))
+	assert.Equal(t, "ABCDE-FGH23-4567Q", NormalizeGiftCode("ABCDEFGH234567Q"))
+	assert.Equal(t, "SHORT", NormalizeGiftCode("short"))
+}
+
+func TestGiftRefreshStatus(t *testing.T) {
+	expires := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	gift := Gift{Status: GiftStatusPending, ExpiresAt: expires}
+
+	assert.False(t, gift.RefreshStatus(expires.Add(-time.Second)))
+	assert.True(t, gift.RefreshStatus(expires))
+	assert.Equal(t, GiftStatusExpired, gift.Status)
+
+	redeemed := Gift{Status: GiftStatusRedeemed, ExpiresAt: expires}
+	assert.False(t, redeemed.RefreshStatus(expires.Add(time.Hour)), "redeemed gifts never expire")
+}
+
+func TestPlanSameService(t *testing.T) {
+	monthly := Plan{ID: 1, ServiceURL: "https://music.yandex.ru/"}
+	yearly := Plan{ID: 2, ServiceURL: "https://music.yandex.ru"}
+	other := Plan{ID: 3}
+
+	assert.True(t, monthly.SameService(&monthly))
+	assert.True(t, monthly.SameService(&yearly))
+	assert.False(t, monthly.SameService(&other))
+	assert.False(t, other.SameService(&Plan{ID: 4}), "plans without a name or service URL match only themselves")
+
+	kinopoisk := Plan{ID: 5, Name: "Кинопоиск"}
+	assert.True(t, kinopoisk.SameService(&Plan{ID: 6, Name: " кинопоиск "}), "variants with the same name")
+	assert.False(t, kinopoisk.SameService(&Plan{ID: 7, Name: "Okko"}))
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// IdempotencyKey - первый ответ на изменяющий запрос пользователя с заголовком Idempotency-Key.
+// Повтор запроса с тем же ключом получает сохранённый ответ вместо повторного выполнения
+type IdempotencyKey struct {
+	ID        uint `gorm:"primarykey;size:32"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"size:32;not null;uniqueIndex:idx_idempotency_key"`
+	Key       string `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_key"`
+	// RequestHash - SHA-256 метода, адреса и тела запроса: ключ нельзя использовать для другого запроса
+	RequestHash string `gorm:"type:varchar(64);not null"`
+	// ResponseCode - HTTP-статус сохранённого ответа, 0 - запрос ещё выполняется
+	ResponseCode int
+	ContentType  string    `gorm:"type:varchar(100)"`
+	ResponseBody string    `gorm:"type:text"`
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+// InProgress проверяет, что запрос с этим ключом ещё выполняется
+func (k *IdempotencyKey) InProgress() bool {
+	return k.ResponseCode == 0
+}
+
+// Abandoned проверяет, что запрос выполняется дольше lease: обработчик, скорее всего, завершился
+// аварийно и не сохранил ответ, ключ можно занять заново
+func (k *IdempotencyKey) Abandoned(now time.Time, lease time.Duration) bool {
+	return k.InProgress() && !k.CreatedAt.Add(lease).After(now)
+}
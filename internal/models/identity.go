@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity связывает пользователя с аккаунтом внешнего провайдера входа
+type UserIdentity struct {
+	ID        uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"size:32;index;not null" json:"user_id"`
+	Provider  string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject   string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_provider_subject" json:"-"`
+	Email     string    `gorm:"type:varchar(100)" json:"email"`
+}
+
+// OIDCLoginState хранит state, nonce и PKCE code_verifier между редиректом к провайдеру и callback
+type OIDCLoginState struct {
+	ID           uint `gorm:"primarykey;size:32"`
+	CreatedAt    time.Time
+	State        string    `gorm:"type:varchar(100);uniqueIndex;not null"`
+	Provider     string    `gorm:"type:varchar(50);not null"`
+	Nonce        string    `gorm:"type:varchar(100);not null"`
+	CodeVerifier string    `gorm:"type:varchar(128);not null"`
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+// IsExpired сообщает, истекло ли время на завершение входа
+func (s *OIDCLoginState) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
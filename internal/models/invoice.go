@@ -0,0 +1,174 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Виды строк счёта
+const (
+	// InvoiceLineSubscription - оплата периода подписки по цене плана
+	InvoiceLineSubscription = "subscription"
+	// InvoiceLineOverage - перерасход составляющей плана за прошедший период
+	InvoiceLineOverage = "overage"
+	// InvoiceLineDiscount - скидка по промокоду, сумма строки отрицательная
+	InvoiceLineDiscount = "discount"
+)
+
+// Состояния оплаты счёта. Оплату подтверждает платёжный провайдер через входящий webhook
+const (
+	InvoiceStatusOpen          = "open"
+	InvoiceStatusPaid          = "paid"
+	InvoiceStatusPaymentFailed = "payment_failed"
+	InvoiceStatusRefunded      = "refunded"
+)
+
+// Invoice - счёт за период подписки. Выставляется при оформлении и каждом продлении;
+// перерасход после окончания периода учёта добавляется в неоплаченный счёт продления,
+// а если его нет или он уже оплачен, выставляется отдельным счётом
+type Invoice struct {
+	ID             uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	SubscriptionID uint      `gorm:"size:32;not null;index" json:"subscription_id"`
+	UserID         uint      `gorm:"size:32;not null;index" json:"user_id"`
+	OrganizationID *uint     `gorm:"size:32;index" json:"organization_id,omitempty"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	Total          float64   `gorm:"type:decimal(10,2);not null" json:"total"`
+	Status         string    `gorm:"type:varchar(20);not null;default:open" json:"status"`
+	// PaymentID - идентификатор платежа у провайдера, по нему находится счёт при возврате
+	PaymentID      string        `gorm:"type:varchar(255);index" json:"payment_id,omitempty"`
+	PaidAt         *time.Time    `json:"paid_at,omitempty"`
+	AmountRefunded float64       `gorm:"type:decimal(10,2);not null;default:0" json:"amount_refunded"`
+	Lines          []InvoiceLine `gorm:"foreignKey:InvoiceID" json:"lines"`
+}
+
+// InvoiceLine - строка счёта
+type InvoiceLine struct {
+	ID           uint    `gorm:"primarykey;size:32" json:"id"`
+	InvoiceID    uint    `gorm:"size:32;not null;index" json:"invoice_id"`
+	Kind         string  `gorm:"type:varchar(20);not null" json:"kind"`
+	Description  string  `gorm:"type:varchar(255)" json:"description"`
+	ComponentKey string  `gorm:"type:varchar(100)" json:"component,omitempty"`
+	Quantity     float64 `gorm:"type:decimal(14,4);not null" json:"quantity"`
+	UnitPrice    float64 `gorm:"type:decimal(10,4);not null" json:"unit_price"`
+	Amount       float64 `gorm:"type:decimal(10,2);not null" json:"amount"`
+}
+
+// NewSubscriptionInvoice создает счёт за период подписки с оплатой плана
+func NewSubscriptionInvoice(subscription *Subscription, plan Plan) Invoice {
+	invoice := Invoice{
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		OrganizationID: subscription.OrganizationID,
+		PeriodStart:    subscription.StartDate,
+		PeriodEnd:      subscription.EndDate,
+		Status:         InvoiceStatusOpen,
+	}
+	invoice.AddLine(InvoiceLine{
+		Kind:        InvoiceLineSubscription,
+		Description: plan.Name,
+		Quantity:    1,
+		UnitPrice:   plan.Price,
+		Amount:      plan.Price,
+	})
+	return invoice
+}
+
+// NewOverageInvoice создает счёт за перерасход составляющих подписки в периоде [from, to).
+// Если перерасхода нет, в счёте нет строк
+func NewOverageInvoice(subscription *Subscription, from, to time.Time, usage []ComponentUsage) Invoice {
+	invoice := Invoice{
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		OrganizationID: subscription.OrganizationID,
+		PeriodStart:    from,
+		PeriodEnd:      to,
+		Status:         InvoiceStatusOpen,
+	}
+	invoice.AddOverage(usage)
+	return invoice
+}
+
+// AddOverage добавляет строки перерасхода по составляющим с ненулевой суммой
+func (i *Invoice) AddOverage(usage []ComponentUsage) {
+	for _, component := range usage {
+		if component.OverageAmount <= 0 {
+			continue
+		}
+		description := component.Label
+		if description == "" {
+			description = component.Key
+		}
+		i.AddLine(InvoiceLine{
+			Kind:         InvoiceLineOverage,
+			Description:  description,
+			ComponentKey: component.Key,
+			Quantity:     component.OverageQuantity,
+			UnitPrice:    component.OverageUnitPrice,
+			Amount:       component.OverageAmount,
+		})
+	}
+}
+
+// AddDiscount добавляет строку скидки по промокоду code
+func (i *Invoice) AddDiscount(code string, amount float64) {
+	i.AddLine(InvoiceLine{
+		Kind:        InvoiceLineDiscount,
+		Description: "Промокод " + code,
+		Quantity:    1,
+		UnitPrice:   -amount,
+		Amount:      -amount,
+	})
+}
+
+// AddLine добавляет строку и пересчитывает итог
+func (i *Invoice) AddLine(line InvoiceLine) {
+	i.Lines = append(i.Lines, line)
+	i.Total = RoundMoney(i.Total + line.Amount)
+}
+
+// MarkPaid отмечает счёт оплаченным платежом paymentID. Возвращённый счёт повторно не оплачивается
+func (i *Invoice) MarkPaid(paymentID string, at time.Time) error {
+	if i.Status == InvoiceStatusRefunded {
+		return errors.New("a refunded invoice cannot be paid")
+	}
+	i.Status = InvoiceStatusPaid
+	i.PaidAt = &at
+	if paymentID != "" {
+		i.PaymentID = paymentID
+	}
+	return nil
+}
+
+// MarkPaymentFailed отмечает неудачную попытку оплаты; оплаченный счёт не меняется
+func (i *Invoice) MarkPaymentFailed(paymentID string) {
+	if i.Status == InvoiceStatusPaid || i.Status == InvoiceStatusRefunded {
+		return
+	}
+	i.Status = InvoiceStatusPaymentFailed
+	if paymentID != "" {
+		i.PaymentID = paymentID
+	}
+}
+
+// Refund учитывает возврат суммы amount; amount 0 возвращает весь остаток.
+// После возврата всей суммы счёт получает состояние refunded
+func (i *Invoice) Refund(amount float64) error {
+	if i.Status != InvoiceStatusPaid && i.Status != InvoiceStatusRefunded {
+		return errors.New("only a paid invoice can be refunded")
+	}
+	remaining := RoundMoney(i.Total - i.AmountRefunded)
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount < 0 || RoundMoney(amount) > remaining {
+		return errors.New("refund exceeds the paid amount")
+	}
+
+	i.AmountRefunded = RoundMoney(i.AmountRefunded + amount)
+	if i.AmountRefunded >= i.Total {
+		i.Status = InvoiceStatusRefunded
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Роли участников организации
+const (
+	RoleOwner          = "owner"
+	RoleBillingManager = "billing_manager"
+	RoleMember         = "member"
+)
+
+// Organization - команда, которая может совместно владеть подписками
+type Organization struct {
+	ID        uint           `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Name      string         `gorm:"type:varchar(255);not null" json:"name"`
+	OwnerID   uint           `gorm:"size:32;index;not null" json:"owner_id"`
+}
+
+// OrganizationMember - участник организации с ролью
+type OrganizationMember struct {
+	ID             uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	OrganizationID uint      `gorm:"size:32;not null;uniqueIndex:idx_org_member" json:"organization_id"`
+	UserID         uint      `gorm:"size:32;not null;uniqueIndex:idx_org_member" json:"user_id"`
+	User           User      `gorm:"foreignKey:UserID" json:"user"`
+	Role           string    `gorm:"type:varchar(20);not null" json:"role"`
+}
+
+// OrganizationInvitation - приглашение в организацию, отправленное на email
+type OrganizationInvitation struct {
+	ID             uint       `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	OrganizationID uint       `gorm:"size:32;index;not null" json:"organization_id"`
+	Email          string     `gorm:"type:varchar(100);not null" json:"email"`
+	Role           string     `gorm:"type:varchar(20);not null" json:"role"`
+	Token          string     `gorm:"type:varchar(100);uniqueIndex" json:"-"`
+	InvitedBy      uint       `gorm:"size:32" json:"invited_by"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+}
+
+// IsValidRole проверяет, что роль существует
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleOwner, RoleBillingManager, RoleMember:
+		return true
+	}
+	return false
+}
+
+// CanManageSubscriptions сообщает, может ли роль оформлять, отменять и продлевать подписки организации
+func CanManageSubscriptions(role string) bool {
+	return role == RoleOwner || role == RoleBillingManager
+}
+
+// CanManageMembers сообщает, может ли роль приглашать и исключать участников
+func CanManageMembers(role string) bool {
+	return role == RoleOwner
+}
+
+// IsPending сообщает, можно ли ещё принять приглашение
+func (i *OrganizationInvitation) IsPending() bool {
+	return i.AcceptedAt == nil && time.Now().Before(i.ExpiresAt)
+}
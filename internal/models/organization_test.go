@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrganizationRolePermissions(t *testing.T) {
+	cases := []struct {
+		role                string
+		valid               bool
+		manageSubscriptions bool
+		manageMembers       bool
+	}{
+		{RoleOwner, true, true, true},
+		{RoleBillingManager, true, true, false},
+		{RoleMember, true, false, false},
+		{"admin", false, false, false},
+		{"", false, false, false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.valid, IsValidRole(c.role), "Role: %s", c.role)
+		assert.Equal(t, c.manageSubscriptions, CanManageSubscriptions(c.role), "Role: %s", c.role)
+		assert.Equal(t, c.manageMembers, CanManageMembers(c.role), "Role: %s", c.role)
+	}
+}
+
+func TestOrganizationInvitationIsPending(t *testing.T) {
+	now := time.Now()
+
+	assert.True(t, (&OrganizationInvitation{ExpiresAt: now.Add(time.Hour)}).IsPending())
+	assert.False(t, (&OrganizationInvitation{ExpiresAt: now.Add(-time.Hour)}).IsPending())
+	assert.False(t, (&OrganizationInvitation{ExpiresAt: now.Add(time.Hour), AcceptedAt: &now}).IsPending())
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Типы событий платёжного провайдера
+const (
+	PaymentEventPaymentSucceeded      = "payment.succeeded"
+	PaymentEventPaymentFailed         = "payment.failed"
+	PaymentEventSubscriptionCancelled = "subscription.cancelled"
+	PaymentEventPaymentRefunded       = "payment.refunded"
+)
+
+// Результаты обработки события провайдера
+const (
+	PaymentEventProcessed = "processed"
+	// PaymentEventIgnored - событие неизвестного типа или не меняющее состояние подписки
+	PaymentEventIgnored = "ignored"
+)
+
+// PaymentEvent - обработанное событие платёжного провайдера. Уникальный EventID не даёт
+// применить повторно доставленное событие ещё раз
+type PaymentEvent struct {
+	ID             uint            `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	EventID        string          `gorm:"type:varchar(255);not null;uniqueIndex" json:"event_id"`
+	Type           string          `gorm:"type:varchar(50);not null" json:"type"`
+	SubscriptionID *uint           `gorm:"size:32;index" json:"subscription_id,omitempty"`
+	InvoiceID      *uint           `gorm:"size:32" json:"invoice_id,omitempty"`
+	Result         string          `gorm:"type:varchar(20);not null" json:"result"`
+	Payload        json.RawMessage `gorm:"type:text" json:"payload"`
+}
@@ -2,13 +2,14 @@ package models
 
 import (
 	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type Plan struct {
-	ID          uint           `json:"id" gorm:"primarykey;type:int unsigned"`
+	ID          uint           `json:"id" gorm:"primarykey;size:32"`
 	Name        string         `json:"name" gorm:"type:varchar(255);not null"`
 	Description string         `json:"description" gorm:"type:varchar(1000)"`
 	Price       float64        `json:"price" gorm:"type:decimal(10,2);not null"`
@@ -23,6 +24,8 @@ type Plan struct {
 	ServiceIcon string         `json:"service_icon" gorm:"type:varchar(255)"`
 	ServiceType string         `json:"service_type" gorm:"type:varchar(100)"`
 	ServiceURL  string         `json:"service_url" gorm:"type:varchar(255)"`
+	// Seats - число мест в семейном плане, включая владельца; 1 - индивидуальный план
+	Seats int `json:"seats" gorm:"not null;default:1"`
 }
 
 func (p *Plan) GetMonthlyPrice() float64 {
@@ -106,3 +109,21 @@ func (p *Plan) CalculateEndDate(startDate time.Time) time.Time {
 		}
 	}
 }
+
+// IsFamily сообщает, можно ли делить подписку на план с другими пользователями
+func (p *Plan) IsFamily() bool {
+	return p.Seats > 1
+}
+
+// SameService сообщает, относятся ли планы к одному сервису: это один план или планы
+// с одинаковым названием или адресом сервиса (например, месячный и годовой тарифы).
+// Названия и адреса сравниваются без учёта регистра
+func (p *Plan) SameService(other *Plan) bool {
+	if p.ID == other.ID {
+		return true
+	}
+	if name := strings.TrimSpace(p.Name); name != "" && strings.EqualFold(name, strings.TrimSpace(other.Name)) {
+		return true
+	}
+	return p.ServiceURL != "" && strings.EqualFold(strings.TrimSuffix(p.ServiceURL, "/"), strings.TrimSuffix(other.ServiceURL, "/"))
+}
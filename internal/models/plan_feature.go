@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Типы функций плана
+const (
+	// FeatureTypeBoolean - функция либо доступна, либо нет
+	FeatureTypeBoolean = "boolean"
+	// FeatureTypeLimit - функция с числовым лимитом (устройства, профили, гигабайты)
+	FeatureTypeLimit = "limit"
+	// FeatureTypeText - функция со строковым значением (например, качество видео)
+	FeatureTypeText = "text"
+)
+
+// UnlimitedFeature - значение Limit для функции без ограничения
+const UnlimitedFeature int64 = -1
+
+var featureKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// PlanFeature - функция, которую даёт подписка на план
+type PlanFeature struct {
+	ID        uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	PlanID    uint      `gorm:"size:32;not null;uniqueIndex:idx_plan_feature" json:"plan_id"`
+	Key       string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_plan_feature" json:"key"`
+	Label     string    `gorm:"type:varchar(255)" json:"label"`
+	Type      string    `gorm:"type:varchar(20);not null" json:"type"`
+	Limit     int64     `gorm:"column:feature_limit" json:"limit,omitempty"`
+	Value     string    `gorm:"type:varchar(255)" json:"value,omitempty"`
+}
+
+// Validate проверяет ключ, тип и значение функции
+func (f *PlanFeature) Validate() error {
+	if !featureKeyPattern.MatchString(f.Key) {
+		return fmt.Errorf("invalid feature key %q: use lowercase letters, digits, '_', '.' and '-'", f.Key)
+	}
+	switch f.Type {
+	case FeatureTypeBoolean, FeatureTypeText:
+		return nil
+	case FeatureTypeLimit:
+		if f.Limit < UnlimitedFeature {
+			return errors.New("feature limit must be non-negative or -1 for unlimited")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown feature type %q", f.Type)
+	}
+}
+
+// Entitlement - функция, доступная пользователю по его активным подпискам
+type Entitlement struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Limit int64  `json:"limit,omitempty"`
+	Value string `json:"value,omitempty"`
+	// SubscriptionIDs - подписки, которые дают функцию
+	SubscriptionIDs []uint `json:"subscription_ids"`
+}
+
+// Unlimited сообщает, что лимит функции не ограничен
+func (e *Entitlement) Unlimited() bool {
+	return e.Type == FeatureTypeLimit && e.Limit == UnlimitedFeature
+}
+
+// merge объединяет функцию ещё одной подписки: лимиты берутся наибольшие,
+// строковое значение - первой подписки
+func (e *Entitlement) merge(feature PlanFeature, subscriptionID uint) {
+	e.SubscriptionIDs = append(e.SubscriptionIDs, subscriptionID)
+	if e.Type != FeatureTypeLimit || feature.Type != FeatureTypeLimit || e.Unlimited() {
+		return
+	}
+	if feature.Limit == UnlimitedFeature || feature.Limit > e.Limit {
+		e.Limit = feature.Limit
+	}
+}
+
+// Entitlements - функции пользователя по ключу
+type Entitlements map[string]*Entitlement
+
+// Add добавляет функции плана, полученные по подписке
+func (e Entitlements) Add(features []PlanFeature, subscriptionID uint) {
+	for _, feature := range features {
+		if existing, ok := e[feature.Key]; ok {
+			existing.merge(feature, subscriptionID)
+			continue
+		}
+		e[feature.Key] = &Entitlement{
+			Key:             feature.Key,
+			Label:           feature.Label,
+			Type:            feature.Type,
+			Limit:           feature.Limit,
+			Value:           feature.Value,
+			SubscriptionIDs: []uint{subscriptionID},
+		}
+	}
+}
+
+// Has сообщает, доступна ли функция
+func (e Entitlements) Has(key string) bool {
+	_, ok := e[key]
+	return ok
+}
+
+// Allows сообщает, доступна ли функция с лимитом не меньше n. Для функций без лимита
+// достаточно наличия функции
+func (e Entitlements) Allows(key string, n int64) bool {
+	entitlement, ok := e[key]
+	if !ok {
+		return false
+	}
+	if entitlement.Type != FeatureTypeLimit || entitlement.Unlimited() {
+		return true
+	}
+	return entitlement.Limit >= n
+}
+
+// List возвращает функции, упорядоченные по ключу
+func (e Entitlements) List() []Entitlement {
+	list := make([]Entitlement, 0, len(e))
+	for _, entitlement := range e {
+		list = append(list, *entitlement)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanFeatureValidate(t *testing.T) {
+	assert.NoError(t, (&PlanFeature{Key: "hd", Type: FeatureTypeBoolean}).Validate())
+	assert.NoError(t, (&PlanFeature{Key: "devices", Type: FeatureTypeLimit, Limit: UnlimitedFeature}).Validate())
+	assert.Error(t, (&PlanFeature{Key: "Devices", Type: FeatureTypeLimit}).Validate(), "uppercase key")
+	assert.Error(t, (&PlanFeature{Key: "", Type: FeatureTypeBoolean}).Validate())
+	assert.Error(t, (&PlanFeature{Key: "devices", Type: FeatureTypeLimit, Limit: -5}).Validate())
+	assert.Error(t, (&PlanFeature{Key: "devices", Type: "number"}).Validate())
+}
+
+func TestEntitlementsTakeHighestLimit(t *testing.T) {
+	entitlements := Entitlements{}
+	entitlements.Add([]PlanFeature{
+		{Key: "devices", Type: FeatureTypeLimit, Limit: 2},
+		{Key: "quality", Type: FeatureTypeText, Value: "1080p"},
+	}, 1)
+	entitlements.Add([]PlanFeature{
+		{Key: "devices", Type: FeatureTypeLimit, Limit: 5},
+		{Key: "offline", Type: FeatureTypeBoolean},
+	}, 2)
+
+	assert.True(t, entitlements.Allows("devices", 5))
+	assert.False(t, entitlements.Allows("devices", 6))
+	assert.True(t, entitlements.Allows("offline", 100), "boolean features ignore the limit")
+	assert.False(t, entitlements.Has("family"))
+	assert.Equal(t, []uint{1, 2}, entitlements["devices"].SubscriptionIDs)
+
+	entitlements.Add([]PlanFeature{{Key: "devices", Type: FeatureTypeLimit, Limit: UnlimitedFeature}}, 3)
+	entitlements.Add([]PlanFeature{{Key: "devices", Type: FeatureTypeLimit, Limit: 10}}, 4)
+	assert.True(t, entitlements["devices"].Unlimited())
+	assert.True(t, entitlements.Allows("devices", 1000))
+
+	list := entitlements.List()
+	assert.Equal(t, []string{"devices", "offline", "quality"}, []string{list[0].Key, list[1].Key, list[2].Key})
+}
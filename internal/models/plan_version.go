@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// PlanVersion - условия оплаты плана, действующие с EffectiveFrom.
+// Изменение цены или периода создаёт новую версию, а подписка остаётся
+// закреплённой за версией, по которой оформлена
+type PlanVersion struct {
+	ID            uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	PlanID        uint      `gorm:"size:32;not null;uniqueIndex:idx_plan_version" json:"plan_id"`
+	Version       int       `gorm:"not null;uniqueIndex:idx_plan_version" json:"version"`
+	Price         float64   `gorm:"type:decimal(10,2);not null" json:"price"`
+	Duration      int       `gorm:"not null" json:"duration"`
+	PeriodType    string    `gorm:"type:varchar(20);not null" json:"period_type"`
+	EffectiveFrom time.Time `json:"effective_from"`
+}
+
+// NewPlanVersion фиксирует текущие условия плана как версию с номером number
+func NewPlanVersion(plan *Plan, number int, effectiveFrom time.Time) PlanVersion {
+	return PlanVersion{
+		PlanID:        plan.ID,
+		Version:       number,
+		Price:         plan.Price,
+		Duration:      plan.Duration,
+		PeriodType:    plan.PeriodType,
+		EffectiveFrom: effectiveFrom,
+	}
+}
+
+// HasTermsOf сообщает, совпадают ли условия версии с текущими условиями плана
+func (v *PlanVersion) HasTermsOf(plan *Plan) bool {
+	return v.Price == plan.Price && v.Duration == plan.Duration && v.PeriodType == plan.PeriodType
+}
+
+// ApplyTo возвращает копию плана с условиями этой версии
+func (v *PlanVersion) ApplyTo(plan Plan) Plan {
+	plan.Price = v.Price
+	plan.Duration = v.Duration
+	plan.PeriodType = v.PeriodType
+	return plan
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// PriceChange - запланированное изменение цены плана. Новая версия плана действует
+// с EffectiveFrom, подписчики заранее получают уведомление и могут отказаться от продления
+type PriceChange struct {
+	ID            uint       `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	PlanID        uint       `gorm:"size:32;not null;index" json:"plan_id"`
+	PlanVersionID uint       `gorm:"size:32;not null" json:"plan_version_id"`
+	OldPrice      float64    `gorm:"type:decimal(10,2);not null" json:"old_price"`
+	NewPrice      float64    `gorm:"type:decimal(10,2);not null" json:"new_price"`
+	EffectiveFrom time.Time  `gorm:"index" json:"effective_from"`
+	NotifiedCount int        `json:"notified_count"`
+	DeclinedCount int        `json:"declined_count"`
+	AppliedAt     *time.Time `json:"applied_at,omitempty"`
+}
+
+// IsPending сообщает, что новая цена ещё не перенесена в каталог
+func (c *PriceChange) IsPending() bool {
+	return c.AppliedAt == nil
+}
+
+// PriceChangeNotice - уведомление подписчика об изменении цены. AppliesFrom - первое
+// продление подписки по новой цене, Token позволяет отказаться от продления из письма
+type PriceChangeNotice struct {
+	ID             uint       `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	PriceChangeID  uint       `gorm:"size:32;not null;uniqueIndex:idx_price_change_notice" json:"price_change_id"`
+	SubscriptionID uint       `gorm:"size:32;not null;uniqueIndex:idx_price_change_notice" json:"subscription_id"`
+	UserID         uint       `gorm:"size:32;not null;index" json:"user_id"`
+	AppliesFrom    time.Time  `json:"applies_from"`
+	Token          string     `gorm:"type:varchar(100);uniqueIndex" json:"-"`
+	DeclinedAt     *time.Time `json:"declined_at,omitempty"`
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Способы разделения стоимости подписки
+const (
+	// SplitModeEqual - стоимость делится поровну между владельцем и активными участниками
+	SplitModeEqual = "equal"
+	// SplitModeCustom - участники платят заданный процент, остаток приходится на владельца
+	SplitModeCustom = "custom"
+)
+
+// Виды записей журнала разделения
+const (
+	// SplitEntryCharge - начисление доли участника при продлении подписки
+	SplitEntryCharge = "charge"
+	// SplitEntryPayment - оплата участником своего долга владельцу
+	SplitEntryPayment = "payment"
+)
+
+// CostSplit - разделение стоимости личной подписки. Подписку оплачивает владелец, и в список
+// участников он не входит: при каждом продлении доли участников добавляются к их долгу владельцу
+type CostSplit struct {
+	ID             uint               `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	SubscriptionID uint               `gorm:"size:32;not null;uniqueIndex" json:"subscription_id"`
+	OwnerID        uint               `gorm:"size:32;not null;index" json:"owner_id"`
+	Mode           string             `gorm:"type:varchar(20);not null" json:"mode"`
+	Participants   []SplitParticipant `gorm:"foreignKey:SplitID" json:"participants"`
+}
+
+// SplitParticipant - участник разделения: зарегистрированный пользователь (UserID) или
+// человек без аккаунта, указанный по имени. Balance - сколько участник должен владельцу
+type SplitParticipant struct {
+	ID        uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	SplitID   uint      `gorm:"size:32;not null;index" json:"split_id"`
+	UserID    *uint     `gorm:"size:32;index" json:"user_id,omitempty"`
+	Name      string    `gorm:"type:varchar(255);not null" json:"name"`
+	// Share - доля участника в процентах при разделении custom
+	Share float64 `gorm:"type:decimal(5,2)" json:"share,omitempty"`
+	// Active - участник получает начисления. Исключённый участник остаётся в разделении,
+	// чтобы можно было погасить накопленный долг
+	Active  bool    `json:"active"`
+	Balance float64 `gorm:"type:decimal(10,2);not null" json:"balance"`
+}
+
+// SplitLedgerEntry - начисление или оплата в журнале участника разделения
+type SplitLedgerEntry struct {
+	ID            uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	SplitID       uint      `gorm:"size:32;not null;index" json:"split_id"`
+	ParticipantID uint      `gorm:"size:32;not null;index" json:"participant_id"`
+	Kind          string    `gorm:"type:varchar(20);not null" json:"kind"`
+	Amount        float64   `gorm:"type:decimal(10,2);not null" json:"amount"`
+	BalanceAfter  float64   `gorm:"type:decimal(10,2);not null" json:"balance_after"`
+	// InvoiceID - счёт продления, по которому сделано начисление
+	InvoiceID    *uint  `gorm:"size:32" json:"invoice_id,omitempty"`
+	RecordedByID *uint  `gorm:"size:32" json:"recorded_by_id,omitempty"`
+	Note         string `gorm:"type:varchar(255)" json:"note,omitempty"`
+}
+
+// Validate проверяет способ разделения и доли активных участников
+func (s *CostSplit) Validate() error {
+	switch s.Mode {
+	case SplitModeEqual, SplitModeCustom:
+	default:
+		return fmt.Errorf("unknown split mode %q", s.Mode)
+	}
+
+	var total float64
+	for i := range s.Participants {
+		participant := &s.Participants[i]
+		if strings.TrimSpace(participant.Name) == "" {
+			return errors.New("participant name is required")
+		}
+		if !participant.Active {
+			continue
+		}
+		if s.Mode == SplitModeEqual {
+			participant.Share = 0
+			continue
+		}
+		if participant.Share <= 0 || participant.Share > 100 {
+			return fmt.Errorf("share of %s must be between 0 and 100 percent", participant.Name)
+		}
+		total += participant.Share
+	}
+	if RoundMoney(total) > 100 {
+		return errors.New("participant shares exceed 100 percent")
+	}
+	return nil
+}
+
+// ActiveParticipants возвращает число участников, получающих начисления
+func (s *CostSplit) ActiveParticipants() int {
+	count := 0
+	for _, participant := range s.Participants {
+		if participant.Active {
+			count++
+		}
+	}
+	return count
+}
+
+// ParticipantAmount возвращает долю участника в сумме total
+func (s *CostSplit) ParticipantAmount(total float64, participant *SplitParticipant) float64 {
+	if !participant.Active {
+		return 0
+	}
+	if s.Mode == SplitModeEqual {
+		return SeatShare(total, s.ActiveParticipants()+1)
+	}
+	return RoundMoney(total * participant.Share / 100)
+}
+
+// OwnerAmount возвращает часть суммы total, которая остаётся на владельце
+func (s *CostSplit) OwnerAmount(total float64) float64 {
+	owner := total
+	for i := range s.Participants {
+		owner -= s.ParticipantAmount(total, &s.Participants[i])
+	}
+	return RoundMoney(owner)
+}
+
+// OutstandingBalance возвращает общий долг участников владельцу
+func (s *CostSplit) OutstandingBalance() float64 {
+	var total float64
+	for _, participant := range s.Participants {
+		total += participant.Balance
+	}
+	return RoundMoney(total)
+}
+
+// ParticipantByUser находит участника - зарегистрированного пользователя
+func (s *CostSplit) ParticipantByUser(userID uint) *SplitParticipant {
+	for i := range s.Participants {
+		if s.Participants[i].UserID != nil && *s.Participants[i].UserID == userID {
+			return &s.Participants[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCostSplitAmounts(t *testing.T) {
+	equal := CostSplit{Mode: SplitModeEqual, Participants: []SplitParticipant{
+		{Name: "Аня", Active: true}, {Name: "Борис", Active: true}, {Name: "Вера"},
+	}}
+	assert.NoError(t, equal.Validate())
+	assert.Equal(t, 33.33, equal.ParticipantAmount(100, &equal.Participants[0]))
+	assert.Equal(t, 0.0, equal.ParticipantAmount(100, &equal.Participants[2]), "inactive participants are not charged")
+	assert.Equal(t, 33.34, equal.OwnerAmount(100))
+
+	custom := CostSplit{Mode: SplitModeCustom, Participants: []SplitParticipant{
+		{Name: "Аня", Share: 25, Active: true}, {Name: "Борис", Share: 50, Active: true},
+	}}
+	assert.NoError(t, custom.Validate())
+	assert.Equal(t, 75.0, custom.ParticipantAmount(300, &custom.Participants[0]))
+	assert.Equal(t, 75.0, custom.OwnerAmount(300))
+
+	custom.Participants[1].Share = 80
+	assert.Error(t, custom.Validate(), "shares exceed 100 percent")
+	custom.Participants[1].Share = 0
+	assert.Error(t, custom.Validate())
+
+	assert.Error(t, (&CostSplit{Mode: "weighted"}).Validate())
+	assert.Error(t, (&CostSplit{Mode: SplitModeEqual, Participants: []SplitParticipant{{Active: true}}}).Validate())
+}
+
+func TestCostSplitBalances(t *testing.T) {
+	userID := uint(7)
+	split := CostSplit{Participants: []SplitParticipant{
+		{Name: "Аня", UserID: &userID, Balance: 120.5}, {Name: "Борис", Balance: 30},
+	}}
+	assert.Equal(t, 150.5, split.OutstandingBalance())
+	assert.Equal(t, "Аня", split.ParticipantByUser(7).Name)
+	assert.Nil(t, split.ParticipantByUser(8))
+}
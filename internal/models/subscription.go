@@ -6,50 +6,113 @@ import (
 	"gorm.io/gorm"
 )
 
-
 type Subscription struct {
-	ID          uint           `json:"id" gorm:"primarykey;type:int unsigned;auto_increment"`
+	ID          uint           `json:"id" gorm:"primarykey;size:32"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
-	UserID      uint           `json:"user_id" gorm:"column:user_id;type:bigint unsigned"`
-	PlanID      uint           `json:"plan_id" gorm:"column:plan_id;type:bigint unsigned"`
+	UserID      uint           `json:"user_id" gorm:"column:user_id;size:32"`
+	PlanID      uint           `json:"plan_id" gorm:"column:plan_id;size:32"`
 	Plan        Plan           `json:"plan"`
 	StartDate   time.Time      `json:"start_date"`
 	EndDate     time.Time      `json:"end_date"`
-	Status      string         `gorm:"type:varchar(20)" json:"status"` 
+	Status      string         `gorm:"type:varchar(20)" json:"status"`
 	RenewalDate *time.Time     `json:"renewal_date,omitempty"`
 	CancelledAt *time.Time     `json:"cancelled_at,omitempty"`
-	PaymentID   string         `json:"payment_id,omitempty" gorm:"type:longtext"`
-	StripeSubID string         `json:"stripe_sub_id,omitempty" gorm:"type:longtext"`
+	PaymentID   string         `json:"payment_id,omitempty"`
+	StripeSubID string         `json:"stripe_sub_id,omitempty"`
 	AutoRenew   bool           `gorm:"default:true" json:"auto_renew"`
+	// Задан, если подпиской владеет организация, а не пользователь
+	OrganizationID *uint `json:"organization_id,omitempty" gorm:"size:32;index"`
+	// Версия плана, по условиям которой оплачена подписка
+	PlanVersionID *uint        `json:"plan_version_id,omitempty" gorm:"size:32;index"`
+	PlanVersion   *PlanVersion `json:"plan_version,omitempty"`
+	// Version увеличивается при каждом сохранении: изменения, прочитанные до параллельного
+	// обновления, не перезапишут его
+	Version uint `json:"version" gorm:"not null;default:0"`
+	// UsageBilledThrough - граница закрытых периодов учёта использования: использование до неё
+	// выставлено в счетах и больше не принимается. Не задана, пока ни один период не закрыт
+	UsageBilledThrough *time.Time `json:"-"`
+	// Shared - подписка принадлежит другому пользователю, а пользователь занимает в ней место
+	Shared bool `json:"shared,omitempty" gorm:"-"`
 }
 
+// BilledPlan возвращает план с условиями версии, за которой закреплена подписка.
+// Для подписок без версии используются текущие условия плана
+func (s *Subscription) BilledPlan() Plan {
+	if s.PlanVersion == nil {
+		return s.Plan
+	}
+	return s.PlanVersion.ApplyTo(s.Plan)
+}
+
+// UsagePeriod возвращает открытый период учёта использования. После досрочного продления
+// он заканчивается с началом оплаченного периода, а не вместе с ним
+func (s *Subscription) UsagePeriod() (start, end time.Time) {
+	start = s.StartDate
+	if s.UsageBilledThrough != nil {
+		start = *s.UsageBilledThrough
+	}
+	if s.StartDate.After(start) {
+		return start, s.StartDate
+	}
+	return start, s.EndDate
+}
 
 func (s *Subscription) IsActive() bool {
 	now := time.Now()
 	return s.Status == "active" && now.After(s.StartDate) && now.Before(s.EndDate)
 }
 
-
 func (s *Subscription) IsExpired() bool {
 	return time.Now().After(s.EndDate)
 }
 
-
 func (s *Subscription) DaysRemaining() int {
 	now := time.Now()
 	if !s.IsActive() {
 		return 0
 	}
 
-	
 	remainingHours := s.EndDate.Sub(now).Hours()
 	if remainingHours <= 0 {
 		return 0
 	}
 
-
 	remainingDays := int((remainingHours + 23) / 24)
 	return remainingDays
 }
+
+// UpcomingRenewals возвращает даты автопродлений подписки в интервале [from, to)
+func (s *Subscription) UpcomingRenewals(from, to time.Time) []time.Time {
+	if s.Status != "active" || !s.AutoRenew {
+		return nil
+	}
+
+	plan := s.BilledPlan()
+	var renewals []time.Time
+	next := s.EndDate
+	for next.Before(to) {
+		if !next.Before(from) {
+			renewals = append(renewals, next)
+		}
+
+		following := plan.CalculateEndDate(next)
+		// Защита от бесконечного цикла для планов с нулевой длительностью
+		if !following.After(next) {
+			break
+		}
+		next = following
+	}
+
+	return renewals
+}
+
+// ForecastSpending прогнозирует сумму автопродлений подписок в интервале [from, to)
+func ForecastSpending(subscriptions []Subscription, from, to time.Time) float64 {
+	var total float64
+	for i := range subscriptions {
+		total += float64(len(subscriptions[i].UpcomingRenewals(from, to))) * subscriptions[i].BilledPlan().Price
+	}
+	return total
+}
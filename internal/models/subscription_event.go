@@ -0,0 +1,102 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Типы событий истории подписки
+const (
+	SubscriptionEventCreated          = "created"
+	SubscriptionEventRenewed          = "renewed"
+	SubscriptionEventAutoRenewChanged = "auto_renew_changed"
+	SubscriptionEventCancelled        = "cancelled"
+	SubscriptionEventExpired          = "expired"
+	SubscriptionEventPlanChanged      = "plan_changed"
+	// SubscriptionEventPaymentFailed - провайдер не смог списать оплату, подписка ждёт оплаты (past_due)
+	SubscriptionEventPaymentFailed = "payment_failed"
+	// SubscriptionEventPaymentRecovered - оплата прошла, подписка снова активна
+	SubscriptionEventPaymentRecovered = "payment_recovered"
+)
+
+// SubscriptionEvent - запись истории подписки. События только добавляются: Before и After
+// содержат значения изменившихся полей до и после события
+type SubscriptionEvent struct {
+	ID             uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	SubscriptionID uint      `gorm:"size:32;not null;index" json:"subscription_id"`
+	Type           string    `gorm:"type:varchar(30);not null" json:"type"`
+	// ActorID - пользователь, выполнивший действие; не задан для фоновых задач
+	ActorID *uint           `gorm:"size:32" json:"actor_id,omitempty"`
+	Before  json.RawMessage `gorm:"type:text" json:"before,omitempty"`
+	After   json.RawMessage `gorm:"type:text" json:"after,omitempty"`
+}
+
+// NewSubscriptionEvent создает событие подписки. Для новой подписки before равен nil,
+// и в After попадают все отслеживаемые поля. actorID 0 означает фоновую задачу
+func NewSubscriptionEvent(eventType string, before, after *Subscription, actorID uint, at time.Time) (SubscriptionEvent, error) {
+	event := SubscriptionEvent{
+		CreatedAt:      at,
+		SubscriptionID: after.ID,
+		Type:           eventType,
+	}
+	if actorID != 0 {
+		event.ActorID = &actorID
+	}
+
+	afterState, err := subscriptionState(after)
+	if err != nil {
+		return event, err
+	}
+	if before == nil {
+		event.After, err = json.Marshal(afterState)
+		return event, err
+	}
+
+	beforeState, err := subscriptionState(before)
+	if err != nil {
+		return event, err
+	}
+	changedBefore := map[string]json.RawMessage{}
+	changedAfter := map[string]json.RawMessage{}
+	for key, value := range afterState {
+		if !bytes.Equal(beforeState[key], value) {
+			changedBefore[key] = beforeState[key]
+			changedAfter[key] = value
+		}
+	}
+	if event.Before, err = json.Marshal(changedBefore); err != nil {
+		return event, err
+	}
+	event.After, err = json.Marshal(changedAfter)
+	return event, err
+}
+
+// subscriptionState возвращает поля подписки, изменения которых попадают в историю
+func subscriptionState(subscription *Subscription) (map[string]json.RawMessage, error) {
+	var cancelledAt *time.Time
+	if subscription.CancelledAt != nil {
+		utc := subscription.CancelledAt.UTC()
+		cancelledAt = &utc
+	}
+	fields := map[string]interface{}{
+		"status":          subscription.Status,
+		"auto_renew":      subscription.AutoRenew,
+		"plan_id":         subscription.PlanID,
+		"plan_version_id": subscription.PlanVersionID,
+		"start_date":      subscription.StartDate.UTC(),
+		"end_date":        subscription.EndDate.UTC(),
+		"cancelled_at":    cancelledAt,
+	}
+
+	state := make(map[string]json.RawMessage, len(fields))
+	for key, value := range fields {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		state[key] = encoded
+	}
+	return state, nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSubscriptionEvent(t *testing.T) {
+	start := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+	before := Subscription{ID: 5, PlanID: 2, Status: "active", AutoRenew: true, StartDate: start, EndDate: start.AddDate(0, 1, 0)}
+
+	created, err := NewSubscriptionEvent(SubscriptionEventCreated, nil, &before, 3, start)
+	require.NoError(t, err)
+	assert.Equal(t, uint(5), created.SubscriptionID)
+	assert.Nil(t, created.Before)
+	assert.JSONEq(t, `{"status": "active", "auto_renew": true, "plan_id": 2, "plan_version_id": null,
+		"start_date": "2025-01-10T09:00:00Z", "end_date": "2025-02-10T09:00:00Z", "cancelled_at": null}`, string(created.After))
+
+	after := before
+	after.Status = "expired"
+	// Часовой пояс не считается изменением
+	after.EndDate = before.EndDate.In(time.FixedZone("MSK", 3*60*60))
+	expired, err := NewSubscriptionEvent(SubscriptionEventExpired, &before, &after, 0, start)
+	require.NoError(t, err)
+	assert.Nil(t, expired.ActorID, "background jobs have no actor")
+	assert.JSONEq(t, `{"status": "active"}`, string(expired.Before))
+	assert.JSONEq(t, `{"status": "expired"}`, string(expired.After))
+}
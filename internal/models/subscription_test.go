@@ -29,3 +29,45 @@ func TestSubscriptionActiveExpiredDays(t *testing.T) {
 	assert.True(t, expiredSub.IsExpired(), "Subscription should be expired when end date in past")
 	assert.Equal(t, 0, expiredSub.DaysRemaining(), "DaysRemaining should be 0 for expired subscription")
 }
+
+func TestUpcomingRenewalsAndForecast(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	monthly := Subscription{
+		Status:    "active",
+		AutoRenew: true,
+		EndDate:   from.AddDate(0, 0, 14),
+		Plan:      Plan{PeriodType: "months", Duration: 1, Price: 300},
+	}
+	renewals := monthly.UpcomingRenewals(from, to)
+	assert.Len(t, renewals, 12, "Monthly subscription should renew 12 times a year")
+	assert.Equal(t, from.AddDate(0, 0, 14), renewals[0])
+
+	yearly := Subscription{
+		Status:    "active",
+		AutoRenew: true,
+		EndDate:   from.AddDate(0, 6, 0),
+		Plan:      Plan{PeriodType: "years", Duration: 1, Price: 2990},
+	}
+	assert.Len(t, yearly.UpcomingRenewals(from, to), 1)
+
+	manual := monthly
+	manual.AutoRenew = false
+	assert.Empty(t, manual.UpcomingRenewals(from, to), "Subscription without auto-renew has no renewals")
+
+	cancelled := monthly
+	cancelled.Status = "cancelled"
+	assert.Empty(t, cancelled.UpcomingRenewals(from, to), "Cancelled subscription has no renewals")
+
+	zeroDuration := Subscription{
+		Status:    "active",
+		AutoRenew: true,
+		EndDate:   from.AddDate(0, 0, 1),
+		Plan:      Plan{PeriodType: "months", Duration: 0, Price: 100},
+	}
+	assert.Len(t, zeroDuration.UpcomingRenewals(from, to), 1, "Zero-duration plan must not loop forever")
+
+	total := ForecastSpending([]Subscription{monthly, yearly, manual}, from, to)
+	assert.Equal(t, float64(12*300+2990), total)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// MeteredComponent - оплачиваемая по факту составляющая плана (гигабайты хранилища,
+// вызовы API). IncludedQuantity входит в цену плана, сверх неё каждая единица
+// оплачивается по OverageUnitPrice
+type MeteredComponent struct {
+	ID               uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	PlanID           uint      `gorm:"size:32;not null;uniqueIndex:idx_plan_component" json:"plan_id"`
+	Key              string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_plan_component" json:"key"`
+	Label            string    `gorm:"type:varchar(255)" json:"label"`
+	Unit             string    `gorm:"type:varchar(50)" json:"unit"`
+	IncludedQuantity float64   `gorm:"type:decimal(14,4);not null" json:"included_quantity"`
+	OverageUnitPrice float64   `gorm:"type:decimal(10,4);not null" json:"overage_unit_price"`
+}
+
+// Validate проверяет ключ и тарифы составляющей
+func (m *MeteredComponent) Validate() error {
+	if !featureKeyPattern.MatchString(m.Key) {
+		return fmt.Errorf("invalid component key %q: use lowercase letters, digits, '_', '.' and '-'", m.Key)
+	}
+	if m.IncludedQuantity < 0 || m.OverageUnitPrice < 0 {
+		return errors.New("included quantity and overage price must not be negative")
+	}
+	return nil
+}
+
+// UsageRecord - объём использования составляющей подписки, переданный внешней системой.
+// EventID задаётся отправителем и защищает от повторного учёта при повторной отправке;
+// он уникален в пределах подписки
+type UsageRecord struct {
+	ID             uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	SubscriptionID uint      `gorm:"size:32;not null;index:idx_usage_period;uniqueIndex:idx_usage_event" json:"subscription_id"`
+	ComponentKey   string    `gorm:"type:varchar(100);not null" json:"component"`
+	Quantity       float64   `gorm:"type:decimal(14,4);not null" json:"quantity"`
+	RecordedAt     time.Time `gorm:"index:idx_usage_period" json:"recorded_at"`
+	EventID        *string   `gorm:"type:varchar(100);uniqueIndex:idx_usage_event" json:"event_id,omitempty"`
+	APIKeyID       uint      `gorm:"size:32" json:"api_key_id"`
+}
+
+// ComponentUsage - использование составляющей за расчётный период
+type ComponentUsage struct {
+	Key              string  `json:"key"`
+	Label            string  `json:"label"`
+	Unit             string  `json:"unit"`
+	Quantity         float64 `json:"quantity"`
+	IncludedQuantity float64 `json:"included_quantity"`
+	OverageQuantity  float64 `json:"overage_quantity"`
+	OverageUnitPrice float64 `json:"overage_unit_price"`
+	OverageAmount    float64 `json:"overage_amount"`
+}
+
+// NewComponentUsage рассчитывает перерасход составляющей при использовании quantity
+func NewComponentUsage(component MeteredComponent, quantity float64) ComponentUsage {
+	overage := math.Max(0, quantity-component.IncludedQuantity)
+	return ComponentUsage{
+		Key:              component.Key,
+		Label:            component.Label,
+		Unit:             component.Unit,
+		Quantity:         quantity,
+		IncludedQuantity: component.IncludedQuantity,
+		OverageQuantity:  overage,
+		OverageUnitPrice: component.OverageUnitPrice,
+		OverageAmount:    RoundMoney(overage * component.OverageUnitPrice),
+	}
+}
+
+// RoundMoney округляет сумму до копеек
+func RoundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
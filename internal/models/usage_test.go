@@ -0,0 +1,63 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComponentUsageOverage(t *testing.T) {
+	storage := MeteredComponent{Key: "storage_gb", IncludedQuantity: 10, OverageUnitPrice: 1.99}
+
+	within := NewComponentUsage(storage, 8)
+	assert.Zero(t, within.OverageQuantity)
+	assert.Zero(t, within.OverageAmount)
+
+	over := NewComponentUsage(storage, 13.5)
+	assert.Equal(t, 3.5, over.OverageQuantity)
+	assert.Equal(t, 6.97, over.OverageAmount, "rounded to cents")
+}
+
+func TestInvoiceOverageLines(t *testing.T) {
+	subscription := &Subscription{ID: 1, UserID: 2}
+	invoice := NewSubscriptionInvoice(subscription, Plan{Name: "Облако", Price: 100})
+	invoice.AddOverage([]ComponentUsage{
+		NewComponentUsage(MeteredComponent{Key: "storage_gb", Label: "Хранилище", IncludedQuantity: 10, OverageUnitPrice: 2}, 12),
+		NewComponentUsage(MeteredComponent{Key: "api_calls", IncludedQuantity: 1000, OverageUnitPrice: 0.01}, 500),
+	})
+
+	assert.Len(t, invoice.Lines, 2, "components without overage are skipped")
+	assert.Equal(t, InvoiceLineOverage, invoice.Lines[1].Kind)
+	assert.Equal(t, "Хранилище", invoice.Lines[1].Description)
+	assert.Equal(t, 104.0, invoice.Total)
+}
+
+func TestInvoicePaymentAndRefund(t *testing.T) {
+	invoice := NewSubscriptionInvoice(&Subscription{ID: 1, UserID: 2}, Plan{Name: "Облако", Price: 100})
+	assert.Equal(t, InvoiceStatusOpen, invoice.Status)
+	assert.Error(t, invoice.Refund(10), "unpaid invoice")
+
+	invoice.MarkPaymentFailed("pay_1")
+	assert.Equal(t, InvoiceStatusPaymentFailed, invoice.Status)
+	assert.NoError(t, invoice.MarkPaid("pay_2", time.Now()))
+	assert.Equal(t, InvoiceStatusPaid, invoice.Status)
+	assert.Equal(t, "pay_2", invoice.PaymentID)
+	invoice.MarkPaymentFailed("pay_3")
+	assert.Equal(t, InvoiceStatusPaid, invoice.Status, "paid invoice is not reopened")
+
+	assert.NoError(t, invoice.Refund(30.5))
+	assert.Equal(t, InvoiceStatusPaid, invoice.Status, "partial refund")
+	assert.Error(t, invoice.Refund(70))
+	assert.NoError(t, invoice.Refund(0))
+	assert.Equal(t, 100.0, invoice.AmountRefunded)
+	assert.Equal(t, InvoiceStatusRefunded, invoice.Status)
+	assert.Error(t, invoice.MarkPaid("pay_4", time.Now()), "refunded invoice")
+	assert.Equal(t, InvoiceStatusRefunded, invoice.Status)
+}
+
+func TestMeteredComponentValidate(t *testing.T) {
+	assert.NoError(t, (&MeteredComponent{Key: "storage_gb", IncludedQuantity: 5}).Validate())
+	assert.Error(t, (&MeteredComponent{Key: "Storage"}).Validate())
+	assert.Error(t, (&MeteredComponent{Key: "storage_gb", OverageUnitPrice: -1}).Validate())
+}
@@ -1,19 +1,25 @@
 package models
 
 import (
+	"errors"
+	"strings"
 	"time"
+	"unicode"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// MinPasswordLength минимальная длина пароля при регистрации
+const MinPasswordLength = 8
+
 type User struct {
-	ID                uint           `gorm:"primarykey;type:int unsigned" json:"id"`
+	ID                uint           `gorm:"primarykey;size:32" json:"id"`
 	CreatedAt         time.Time      `json:"created_at"`
 	UpdatedAt         time.Time      `json:"updated_at"`
 	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
 	Email             string         `gorm:"type:varchar(100);uniqueIndex" json:"email"`
-	Password          string         `gorm:"type:varchar(100)" json:"password"`
+	Password          string         `gorm:"type:varchar(100)" json:"-"`
 	FirstName         string         `gorm:"type:varchar(100)" json:"first_name"`
 	LastName          string         `gorm:"type:varchar(100)" json:"last_name"`
 	ActivePlan        *Subscription  `gorm:"foreignkey:UserID;references:ID" json:"active_plan,omitempty"`
@@ -24,7 +30,12 @@ type User struct {
 }
 
 func (u *User) HashPassword() error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	return u.HashPasswordWithCost(bcrypt.DefaultCost)
+}
+
+// HashPasswordWithCost хеширует пароль с указанной стоимостью bcrypt
+func (u *User) HashPasswordWithCost(cost int) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), cost)
 	if err != nil {
 		return err
 	}
@@ -35,3 +46,48 @@ func (u *User) HashPassword() error {
 func (u *User) CheckPassword(password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 }
+
+// IsPasswordHashed сообщает, хранится ли пароль в виде bcrypt-хеша
+func (u *User) IsPasswordHashed() bool {
+	_, err := bcrypt.Cost([]byte(u.Password))
+	return err == nil
+}
+
+// NeedsRehash сообщает, что хеш пароля создан с другой стоимостью и его нужно пересчитать
+func (u *User) NeedsRehash(cost int) bool {
+	current, err := bcrypt.Cost([]byte(u.Password))
+	if err != nil {
+		return true
+	}
+	return current != cost
+}
+
+// ValidatePasswordStrength проверяет пароль на соответствие правилам сложности
+func ValidatePasswordStrength(password, email string) error {
+	if len([]rune(password)) < MinPasswordLength {
+		return errors.New("password must be at least 8 characters long")
+	}
+	if len(password) > 72 {
+		// bcrypt учитывает только первые 72 байта
+		return errors.New("password must be at most 72 bytes long")
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("password must contain both letters and digits")
+	}
+
+	if email != "" && strings.EqualFold(password, email) {
+		return errors.New("password must not be the same as email")
+	}
+
+	return nil
+}
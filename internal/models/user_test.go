@@ -1,9 +1,11 @@
 package models
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHashAndCheckPassword(t *testing.T) {
@@ -20,3 +22,41 @@ func TestHashAndCheckPassword(t *testing.T) {
 	err = u.CheckPassword("wrongpassword")
 	assert.Error(t, err, "CheckPassword should fail for incorrect password")
 }
+
+func TestPasswordRehashPolicy(t *testing.T) {
+	u := User{Password: "password123"}
+	assert.False(t, u.IsPasswordHashed(), "Plain password should not be reported as hashed")
+	assert.True(t, u.NeedsRehash(bcrypt.MinCost), "Plain password always needs rehash")
+
+	err := u.HashPasswordWithCost(bcrypt.MinCost)
+	assert.NoError(t, err, "HashPasswordWithCost should not return error")
+	assert.True(t, u.IsPasswordHashed(), "Hashed password should be reported as hashed")
+	assert.False(t, u.NeedsRehash(bcrypt.MinCost), "Hash with the same cost does not need rehash")
+	assert.True(t, u.NeedsRehash(bcrypt.MinCost+1), "Hash with another cost needs rehash")
+	assert.NoError(t, u.CheckPassword("password123"))
+}
+
+func TestValidatePasswordStrength(t *testing.T) {
+	cases := []struct {
+		password string
+		email    string
+		valid    bool
+	}{
+		{"password123", "user@example.com", true},
+		{"пароль2024", "user@example.com", true},
+		{"short1", "user@example.com", false},
+		{"onlyletters", "user@example.com", false},
+		{"1234567890", "user@example.com", false},
+		{"user1@example.com", "USER1@example.com", false},
+		{strings.Repeat("a1", 40), "user@example.com", false},
+	}
+
+	for _, c := range cases {
+		err := ValidatePasswordStrength(c.password, c.email)
+		if c.valid {
+			assert.NoError(t, err, "Password: %s", c.password)
+		} else {
+			assert.Error(t, err, "Password: %s", c.password)
+		}
+	}
+}
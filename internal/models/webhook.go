@@ -0,0 +1,170 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Типы событий, которые отправляются во внешние системы
+const (
+	WebhookEventSubscriptionCreated          = "subscription.created"
+	WebhookEventSubscriptionRenewed          = "subscription.renewed"
+	WebhookEventSubscriptionAutoRenewChanged = "subscription.auto_renew_changed"
+	WebhookEventSubscriptionCancelled        = "subscription.cancelled"
+	WebhookEventSubscriptionExpired          = "subscription.expired"
+	WebhookEventSubscriptionPlanChanged      = "subscription.plan_changed"
+	WebhookEventSubscriptionPaymentFailed    = "subscription.payment_failed"
+	WebhookEventSubscriptionPaymentRecovered = "subscription.payment_recovered"
+	// WebhookEventTest - проверочное событие, отправляется только по запросу владельца получателя
+	WebhookEventTest = "webhook.test"
+)
+
+// WebhookEventTypes - события, на которые можно подписать получателя
+var WebhookEventTypes = []string{
+	WebhookEventSubscriptionCreated,
+	WebhookEventSubscriptionRenewed,
+	WebhookEventSubscriptionAutoRenewChanged,
+	WebhookEventSubscriptionCancelled,
+	WebhookEventSubscriptionExpired,
+	WebhookEventSubscriptionPlanChanged,
+	WebhookEventSubscriptionPaymentFailed,
+	WebhookEventSubscriptionPaymentRecovered,
+}
+
+// Состояния доставки события
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// webhookRetryDelays - паузы перед повторными попытками доставки. После последней паузы
+// доставка считается неудачной
+var webhookRetryDelays = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	12 * time.Hour,
+}
+
+// WebhookEndpoint - адрес внешней системы, на который отправляются события подписок.
+// Получатель пользователя получает события его подписок, получатель администратора (без UserID) - все события
+type WebhookEndpoint struct {
+	ID          uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      *uint     `gorm:"size:32;index" json:"user_id,omitempty"`
+	URL         string    `gorm:"type:varchar(2048);not null" json:"url"`
+	Description string    `gorm:"type:varchar(255)" json:"description,omitempty"`
+	// Events - JSON-массив типов событий; пустой массив означает все события
+	Events json.RawMessage `gorm:"type:text" json:"events"`
+	// Secret - ключ подписи HMAC, показывается один раз при создании
+	Secret string `gorm:"type:varchar(64);not null" json:"-"`
+	Active bool   `json:"active"`
+}
+
+// WebhookDelivery - доставка одного события получателю. Payload сохраняется при создании события,
+// поэтому повторные попытки отправляют те же данные
+type WebhookDelivery struct {
+	ID         uint      `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	EndpointID uint      `gorm:"size:32;not null;index" json:"endpoint_id"`
+	// EventID одинаков у всех доставок события и позволяет получателю отбросить повтор
+	EventID   string          `gorm:"type:varchar(64);not null" json:"event_id"`
+	EventType string          `gorm:"type:varchar(50);not null" json:"event_type"`
+	Payload   json.RawMessage `gorm:"type:text" json:"payload"`
+	Status    string          `gorm:"type:varchar(20);not null;index:idx_webhook_delivery_due" json:"status"`
+	Attempts  int             `json:"attempts"`
+	// ResponseCode - HTTP-статус ответа на последнюю попытку, 0 - ответа не было
+	ResponseCode  int        `json:"response_code"`
+	LastError     string     `gorm:"type:varchar(500)" json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `gorm:"index:idx_webhook_delivery_due" json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// IsValidWebhookEvent проверяет, что на событие можно подписать получателя
+func IsValidWebhookEvent(eventType string) bool {
+	for _, known := range WebhookEventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// EventList возвращает типы событий получателя; пустой список означает все события
+func (e *WebhookEndpoint) EventList() []string {
+	var events []string
+	if len(e.Events) > 0 {
+		_ = json.Unmarshal(e.Events, &events)
+	}
+	return events
+}
+
+// Accepts проверяет, подписан ли получатель на событие
+func (e *WebhookEndpoint) Accepts(eventType string) bool {
+	if !e.Active {
+		return false
+	}
+	events := e.EventList()
+	if len(events) == 0 {
+		return true
+	}
+	for _, event := range events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordAttempt учитывает результат попытки доставки и назначает следующую попытку.
+// Успехом считается ответ 2xx
+func (d *WebhookDelivery) RecordAttempt(responseCode int, attemptErr error, at time.Time) {
+	d.Attempts++
+	d.ResponseCode = responseCode
+	d.LastError = ""
+	if attemptErr != nil {
+		d.LastError = truncate(attemptErr.Error(), 500)
+	} else if responseCode < 200 || responseCode > 299 {
+		d.LastError = fmt.Sprintf("unexpected response status %d", responseCode)
+	}
+
+	if d.LastError == "" {
+		d.Status = WebhookDeliverySucceeded
+		d.DeliveredAt = &at
+		d.NextAttemptAt = nil
+		return
+	}
+	if d.Attempts > len(webhookRetryDelays) {
+		d.Status = WebhookDeliveryFailed
+		d.NextAttemptAt = nil
+		return
+	}
+	next := at.Add(webhookRetryDelays[d.Attempts-1])
+	d.Status = WebhookDeliveryPending
+	d.NextAttemptAt = &next
+}
+
+// SignWebhookPayload возвращает подпись тела запроса: HMAC-SHA256 от строки "timestamp.payload"
+// в шестнадцатеричном виде. Метка времени в подписи защищает от повторной отправки перехваченного запроса
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func truncate(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit])
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookEndpointAccepts(t *testing.T) {
+	all := WebhookEndpoint{Active: true, Events: json.RawMessage(`[]`)}
+	assert.True(t, all.Accepts(WebhookEventSubscriptionExpired), "empty filter accepts every event")
+
+	filtered := WebhookEndpoint{Active: true, Events: json.RawMessage(`["subscription.created"]`)}
+	assert.True(t, filtered.Accepts(WebhookEventSubscriptionCreated))
+	assert.False(t, filtered.Accepts(WebhookEventSubscriptionRenewed))
+
+	filtered.Active = false
+	assert.False(t, filtered.Accepts(WebhookEventSubscriptionCreated))
+}
+
+func TestWebhookDeliveryBackoff(t *testing.T) {
+	at := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	delivery := WebhookDelivery{Status: WebhookDeliveryPending}
+
+	delivery.RecordAttempt(503, nil, at)
+	assert.Equal(t, WebhookDeliveryPending, delivery.Status)
+	assert.Equal(t, "unexpected response status 503", delivery.LastError)
+	assert.Equal(t, at.Add(time.Minute), *delivery.NextAttemptAt)
+
+	delivery.RecordAttempt(0, errors.New("connection refused"), at)
+	assert.Equal(t, 0, delivery.ResponseCode)
+	assert.Equal(t, at.Add(5*time.Minute), *delivery.NextAttemptAt, "delay grows with each attempt")
+
+	for delivery.Status == WebhookDeliveryPending {
+		delivery.RecordAttempt(500, nil, at)
+	}
+	assert.Equal(t, WebhookDeliveryFailed, delivery.Status)
+	assert.Equal(t, 6, delivery.Attempts)
+	assert.Nil(t, delivery.NextAttemptAt)
+
+	retried := WebhookDelivery{Status: WebhookDeliveryPending, Attempts: 2, LastError: "timeout"}
+	retried.RecordAttempt(204, nil, at)
+	assert.Equal(t, WebhookDeliverySucceeded, retried.Status)
+	assert.Empty(t, retried.LastError)
+	assert.Equal(t, at, *retried.DeliveredAt)
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	signature := SignWebhookPayload("whsec_test", 1700000000, []byte(`{"id":"evt_1"}`))
+	assert.Len(t, signature, 64)
+	assert.Equal(t, signature, SignWebhookPayload("whsec_test", 1700000000, []byte(`{"id":"evt_1"}`)))
+	assert.NotEqual(t, signature, SignWebhookPayload("whsec_test", 1700000001, []byte(`{"id":"evt_1"}`)), "timestamp is signed")
+	assert.NotEqual(t, signature, SignWebhookPayload("whsec_other", 1700000000, []byte(`{"id":"evt_1"}`)))
+}
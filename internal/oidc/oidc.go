@@ -0,0 +1,159 @@
+// Package oidc реализует вход через внешних провайдеров OpenID Connect
+// (authorization code + PKCE)
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Identity описывает пользователя, подтверждённого внешним провайдером
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// IdentityProvider - внешний провайдер, через которого можно войти в систему
+type IdentityProvider interface {
+	Name() string
+	DisplayName() string
+	// AuthCodeURL возвращает адрес страницы входа провайдера
+	AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+	// Exchange обменивает код авторизации на подтверждённую личность пользователя
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+// ProviderConfig содержит настройки OIDC-провайдера
+type ProviderConfig struct {
+	Name         string
+	DisplayName  string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Provider - OIDC-провайдер, настройки которого загружаются через discovery при первом обращении
+type Provider struct {
+	config ProviderConfig
+
+	mu       sync.Mutex
+	ready    bool
+	oauth2   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// NewProvider создает провайдера по конфигурации
+func NewProvider(config ProviderConfig) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{gooidc.ScopeOpenID, "email", "profile"}
+	}
+	if config.DisplayName == "" {
+		config.DisplayName = config.Name
+	}
+	return &Provider{config: config}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+func (p *Provider) DisplayName() string {
+	return p.config.DisplayName
+}
+
+// init выполняет discovery. Если провайдер был недоступен, попытка повторится при следующем обращении
+func (p *Provider) init(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ready {
+		return nil
+	}
+
+	// Ключи провайдера загружаются позже в рамках того же контекста, поэтому он не должен отменяться вместе с запросом
+	discovered, err := gooidc.NewProvider(context.WithoutCancel(ctx), p.config.IssuerURL)
+	if err != nil {
+		return fmt.Errorf("oidc discovery for %s failed: %w", p.config.Name, err)
+	}
+
+	p.oauth2 = oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Endpoint:     discovered.Endpoint(),
+		Scopes:       p.config.Scopes,
+	}
+	p.verifier = discovered.Verifier(&gooidc.Config{ClientID: p.config.ClientID})
+	p.ready = true
+
+	return nil
+}
+
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	if err := p.init(ctx); err != nil {
+		return "", err
+	}
+	return p.oauth2.AuthCodeURL(state,
+		gooidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(codeVerifier),
+	), nil
+}
+
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("provider response does not contain id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid id_token claims: %w", err)
+	}
+
+	return &Identity{
+		Provider:      p.config.Name,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+	}, nil
+}
+
+// GenerateCodeVerifier создает PKCE code_verifier
+func GenerateCodeVerifier() string {
+	return oauth2.GenerateVerifier()
+}
@@ -0,0 +1,94 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/saneechka/ManageSubscription/internal/oidc"
+	"github.com/saneechka/ManageSubscription/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "http://localhost:8080/api/auth/mock/callback"
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	server := oidctest.NewServer("client-id", "client-secret")
+	defer server.Close()
+
+	server.SetUser(oidctest.User{
+		Subject:       "user-42",
+		Email:         "user@example.com",
+		EmailVerified: true,
+		GivenName:     "Иван",
+		FamilyName:    "Иванов",
+	})
+
+	provider := oidc.NewProvider(server.ProviderConfig("mock", redirectURL))
+	ctx := context.Background()
+	verifier := oidc.GenerateCodeVerifier()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+	assert.NotEmpty(t, parsed.Query().Get("code_challenge"))
+	assert.Equal(t, "nonce-1", parsed.Query().Get("nonce"))
+
+	code, state, err := server.Authorize(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "state-1", state)
+
+	identity, err := provider.Exchange(ctx, code, verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, "mock", identity.Provider)
+	assert.Equal(t, "user-42", identity.Subject)
+	assert.Equal(t, "user@example.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+	assert.Equal(t, "Иван", identity.FirstName)
+	assert.Equal(t, "Иванов", identity.LastName)
+}
+
+func TestExchangeRejectsWrongVerifierAndNonce(t *testing.T) {
+	server := oidctest.NewServer("client-id", "client-secret")
+	defer server.Close()
+
+	provider := oidc.NewProvider(server.ProviderConfig("mock", redirectURL))
+	ctx := context.Background()
+	verifier := oidc.GenerateCodeVerifier()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", verifier)
+	require.NoError(t, err)
+	code, _, err := server.Authorize(authURL)
+	require.NoError(t, err)
+
+	_, err = provider.Exchange(ctx, code, oidc.GenerateCodeVerifier(), "nonce")
+	assert.Error(t, err, "Exchange should fail when PKCE verifier does not match the challenge")
+
+	authURL, err = provider.AuthCodeURL(ctx, "state", "nonce", verifier)
+	require.NoError(t, err)
+	code, _, err = server.Authorize(authURL)
+	require.NoError(t, err)
+
+	_, err = provider.Exchange(ctx, code, verifier, "another-nonce")
+	assert.Error(t, err, "Exchange should fail when id_token nonce does not match")
+}
+
+func TestRegistry(t *testing.T) {
+	registry := oidc.NewRegistry(
+		oidc.NewProvider(oidc.ProviderConfig{Name: "yandex", DisplayName: "Яндекс"}),
+		oidc.NewProvider(oidc.ProviderConfig{Name: "google"}),
+	)
+
+	providers := registry.List()
+	require.Len(t, providers, 2)
+	assert.Equal(t, "google", providers[0].Name())
+	assert.Equal(t, "google", providers[0].DisplayName(), "DisplayName should default to Name")
+	assert.Equal(t, "Яндекс", providers[1].DisplayName())
+
+	_, err := registry.Get("github")
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package oidc
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Registry хранит настроенных провайдеров по имени
+type Registry struct {
+	providers map[string]IdentityProvider
+}
+
+// NewRegistry создает реестр из переданных провайдеров
+func NewRegistry(providers ...IdentityProvider) *Registry {
+	registry := &Registry{providers: make(map[string]IdentityProvider)}
+	for _, provider := range providers {
+		registry.Register(provider)
+	}
+	return registry
+}
+
+// Register добавляет провайдера, заменяя провайдера с тем же именем
+func (r *Registry) Register(provider IdentityProvider) {
+	r.providers[provider.Name()] = provider
+}
+
+// Get возвращает провайдера по имени
+func (r *Registry) Get(name string) (IdentityProvider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown identity provider %q", name)
+	}
+	return provider, nil
+}
+
+// List возвращает провайдеров, отсортированных по имени
+func (r *Registry) List() []IdentityProvider {
+	providers := make([]IdentityProvider, 0, len(r.providers))
+	for _, provider := range r.providers {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name() < providers[j].Name()
+	})
+	return providers
+}
+
+// LoadRegistryFromEnv создает реестр по переменным окружения.
+// OIDC_PROVIDERS перечисляет имена провайдеров через запятую, для каждого имени NAME
+// читаются OIDC_NAME_ISSUER, OIDC_NAME_CLIENT_ID, OIDC_NAME_CLIENT_SECRET и OIDC_NAME_DISPLAY_NAME
+func LoadRegistryFromEnv() *Registry {
+	registry := NewRegistry()
+	appURL := getEnvOrDefault("APP_URL", "http://localhost:8080")
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := ProviderConfig{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			IssuerURL:    os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  fmt.Sprintf("%s/api/auth/%s/callback", appURL, name),
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			config.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+
+		if config.IssuerURL == "" || config.ClientID == "" {
+			fmt.Printf("OIDC provider %s skipped: issuer and client id are required\n", name)
+			continue
+		}
+
+		registry.Register(NewProvider(config))
+	}
+
+	return registry
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
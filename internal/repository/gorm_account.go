@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormEmailChangeRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormEmailChangeRepository) FindByToken(token string) (*models.EmailChangeRequest, error) {
+	return first[models.EmailChangeRequest](r.db.Where("token = ?", token))
+}
+
+func (r *gormEmailChangeRepository) FindByUser(userID uint) ([]models.EmailChangeRequest, error) {
+	return find[models.EmailChangeRequest](r.db.Where("user_id = ?", userID).Order("created_at asc"))
+}
+
+func (r *gormEmailChangeRepository) Create(request *models.EmailChangeRequest) error {
+	return r.db.Create(request).Error
+}
+
+func (r *gormEmailChangeRepository) Save(request *models.EmailChangeRequest) error {
+	return r.db.Save(request).Error
+}
+
+func (r *gormEmailChangeRepository) DeletePendingByUser(userID uint) error {
+	return r.db.Where("user_id = ? AND confirmed_at IS NULL", userID).Delete(&models.EmailChangeRequest{}).Error
+}
+
+func (r *gormEmailChangeRepository) DeleteByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.EmailChangeRequest{}).Error
+}
+
+type gormAccountDeletionRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAccountDeletionRepository) FindByRestoreToken(token string) (*models.AccountDeletion, error) {
+	return first[models.AccountDeletion](r.db.Where("restore_token = ?", token))
+}
+
+func (r *gormAccountDeletionRepository) FindDueForPurge(now time.Time) ([]models.AccountDeletion, error) {
+	return find[models.AccountDeletion](r.db.Where("restored_at IS NULL AND purged_at IS NULL AND purge_after < ?", now))
+}
+
+func (r *gormAccountDeletionRepository) Create(deletion *models.AccountDeletion) error {
+	return r.db.Create(deletion).Error
+}
+
+func (r *gormAccountDeletionRepository) Save(deletion *models.AccountDeletion) error {
+	return r.db.Save(deletion).Error
+}
+
+type gormIdentityRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormIdentityRepository) FindByProviderSubject(provider, subject string) (*models.UserIdentity, error) {
+	return first[models.UserIdentity](r.db.Where("provider = ? AND subject = ?", provider, subject))
+}
+
+func (r *gormIdentityRepository) FindByUser(userID uint) ([]models.UserIdentity, error) {
+	return find[models.UserIdentity](r.db.Where("user_id = ?", userID))
+}
+
+func (r *gormIdentityRepository) Create(identity *models.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *gormIdentityRepository) DeleteByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error
+}
+
+func (r *gormIdentityRepository) CreateLoginState(state *models.OIDCLoginState) error {
+	return r.db.Create(state).Error
+}
+
+func (r *gormIdentityRepository) FindLoginState(state, provider string) (*models.OIDCLoginState, error) {
+	return first[models.OIDCLoginState](r.db.Where("state = ? AND provider = ?", state, provider))
+}
+
+func (r *gormIdentityRepository) DeleteLoginState(id uint) error {
+	return r.db.Delete(&models.OIDCLoginState{}, id).Error
+}
+
+func (r *gormIdentityRepository) DeleteExpiredLoginStates(now time.Time) error {
+	return r.db.Where("expires_at < ?", now).Delete(&models.OIDCLoginState{}).Error
+}
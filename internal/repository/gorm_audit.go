@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormAuditRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAuditRepository) Create(entry *models.AuditEntry) error {
+	return r.db.Create(entry).Error
+}
+
+func (r *gormAuditRepository) Find(filter AuditFilter) ([]models.AuditEntry, error) {
+	query := r.db.Model(&models.AuditEntry{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+	return find[models.AuditEntry](query.Order("created_at desc, id desc"))
+}
+
+func (r *gormAuditRepository) DeleteBefore(before time.Time) (int64, error) {
+	result := r.db.Where("created_at < ?", before).Delete(&models.AuditEntry{})
+	return result.RowsAffected, result.Error
+}
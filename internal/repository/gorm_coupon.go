@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormCouponRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormCouponRepository) FindAll() ([]models.Coupon, error) {
+	coupons, err := find[models.Coupon](r.db.Order("id asc"))
+	if err != nil {
+		return nil, err
+	}
+	for i := range coupons {
+		if err := r.loadPlanIDs(&coupons[i]); err != nil {
+			return nil, err
+		}
+	}
+	return coupons, nil
+}
+
+func (r *gormCouponRepository) FindByID(id uint) (*models.Coupon, error) {
+	return r.findOne(r.db.Where("id = ?", id))
+}
+
+func (r *gormCouponRepository) FindByCode(code string) (*models.Coupon, error) {
+	return r.findOne(r.db.Where("code = ?", code))
+}
+
+func (r *gormCouponRepository) findOne(query *gorm.DB) (*models.Coupon, error) {
+	coupon, err := first[models.Coupon](query)
+	if err != nil {
+		return nil, err
+	}
+	return coupon, r.loadPlanIDs(coupon)
+}
+
+func (r *gormCouponRepository) loadPlanIDs(coupon *models.Coupon) error {
+	coupon.PlanIDs = []uint{}
+	return r.db.Model(&models.CouponPlan{}).Where("coupon_id = ?", coupon.ID).
+		Order("plan_id asc").Pluck("plan_id", &coupon.PlanIDs).Error
+}
+
+func (r *gormCouponRepository) Create(coupon *models.Coupon) error {
+	if err := r.db.Create(coupon).Error; err != nil {
+		return err
+	}
+	return r.replacePlans(coupon)
+}
+
+func (r *gormCouponRepository) Save(coupon *models.Coupon) error {
+	// Счётчик меняет только IncrementRedemptions: прочитанное раньше значение затёрло бы новые применения
+	if err := r.db.Omit("redemption_count").Save(coupon).Error; err != nil {
+		return err
+	}
+	return r.replacePlans(coupon)
+}
+
+func (r *gormCouponRepository) IncrementRedemptions(id uint) (bool, error) {
+	result := r.db.Model(&models.Coupon{}).
+		Where("id = ? AND (max_redemptions = 0 OR redemption_count < max_redemptions)", id).
+		Update("redemption_count", gorm.Expr("redemption_count + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormCouponRepository) replacePlans(coupon *models.Coupon) error {
+	if err := r.db.Where("coupon_id = ?", coupon.ID).Delete(&models.CouponPlan{}).Error; err != nil {
+		return err
+	}
+	if len(coupon.PlanIDs) == 0 {
+		return nil
+	}
+	links := make([]models.CouponPlan, 0, len(coupon.PlanIDs))
+	for _, planID := range coupon.PlanIDs {
+		links = append(links, models.CouponPlan{CouponID: coupon.ID, PlanID: planID})
+	}
+	return r.db.Create(&links).Error
+}
+
+func (r *gormCouponRepository) Delete(id uint) error {
+	return r.db.Delete(&models.Coupon{}, id).Error
+}
+
+func (r *gormCouponRepository) FindRedemptions(couponID uint) ([]models.CouponRedemption, error) {
+	return find[models.CouponRedemption](r.db.Where("coupon_id = ?", couponID).Order("created_at asc, id asc"))
+}
+
+func (r *gormCouponRepository) FindRedemptionBySubscription(subscriptionID uint) (*models.CouponRedemption, error) {
+	return first[models.CouponRedemption](r.db.
+		Preload("Coupon", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("subscription_id = ?", subscriptionID))
+}
+
+func (r *gormCouponRepository) CreateRedemption(redemption *models.CouponRedemption) error {
+	return r.db.Omit("Coupon").Create(redemption).Error
+}
+
+func (r *gormCouponRepository) SaveRedemption(redemption *models.CouponRedemption) error {
+	return r.db.Omit("Coupon").Save(redemption).Error
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormFamilyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormFamilyRepository) FindMember(subscriptionID, userID uint) (*models.FamilyMember, error) {
+	return first[models.FamilyMember](r.db.Where("subscription_id = ? AND user_id = ?", subscriptionID, userID))
+}
+
+func (r *gormFamilyRepository) FindMembers(subscriptionID uint) ([]models.FamilyMember, error) {
+	return find[models.FamilyMember](r.db.Where("subscription_id = ?", subscriptionID).
+		Preload("User").
+		Order("created_at asc, id asc"))
+}
+
+func (r *gormFamilyRepository) FindMembershipsByUser(userID uint) ([]models.FamilyMember, error) {
+	return find[models.FamilyMember](r.db.Where("user_id = ?", userID).Order("created_at asc, id asc"))
+}
+
+func (r *gormFamilyRepository) CreateMember(member *models.FamilyMember) error {
+	return r.db.Omit("User").Create(member).Error
+}
+
+func (r *gormFamilyRepository) DeleteMember(subscriptionID, userID uint) error {
+	return r.db.Where("subscription_id = ? AND user_id = ?", subscriptionID, userID).Delete(&models.FamilyMember{}).Error
+}
+
+func (r *gormFamilyRepository) DeleteMembershipsByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.FamilyMember{}).Error
+}
+
+func (r *gormFamilyRepository) FindInvitations(subscriptionID uint) ([]models.FamilyInvitation, error) {
+	return find[models.FamilyInvitation](r.db.Where("subscription_id = ?", subscriptionID).Order("created_at asc, id asc"))
+}
+
+func (r *gormFamilyRepository) FindInvitationByToken(token string) (*models.FamilyInvitation, error) {
+	return first[models.FamilyInvitation](r.db.Where("token = ?", token))
+}
+
+func (r *gormFamilyRepository) CreateInvitation(invitation *models.FamilyInvitation) error {
+	return r.db.Create(invitation).Error
+}
+
+func (r *gormFamilyRepository) SaveInvitation(invitation *models.FamilyInvitation) error {
+	return r.db.Save(invitation).Error
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormGiftRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormGiftRepository) withPlan() *gorm.DB {
+	return r.db.Preload("Plan", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).Preload("PlanVersion")
+}
+
+func (r *gormGiftRepository) FindByID(id uint) (*models.Gift, error) {
+	return first[models.Gift](r.withPlan().Where("id = ?", id))
+}
+
+func (r *gormGiftRepository) FindByCode(code string) (*models.Gift, error) {
+	return first[models.Gift](r.withPlan().Where("code = ?", code))
+}
+
+func (r *gormGiftRepository) FindByCodeForUpdate(code string) (*models.Gift, error) {
+	return first[models.Gift](r.withPlan().Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code))
+}
+
+func (r *gormGiftRepository) FindByPurchaser(purchaserID uint) ([]models.Gift, error) {
+	return find[models.Gift](r.withPlan().Where("purchaser_id = ?", purchaserID).Order("created_at desc, id desc"))
+}
+
+func (r *gormGiftRepository) FindByRedeemer(userID uint) ([]models.Gift, error) {
+	return find[models.Gift](r.withPlan().Where("redeemed_by_id = ?", userID).Order("created_at desc, id desc"))
+}
+
+func (r *gormGiftRepository) Create(gift *models.Gift) error {
+	return r.db.Omit("Plan", "PlanVersion").Create(gift).Error
+}
+
+func (r *gormGiftRepository) Save(gift *models.Gift) error {
+	return r.db.Omit("Plan", "PlanVersion").Save(gift).Error
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormIdempotencyKeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormIdempotencyKeyRepository) Find(userID uint, key string) (*models.IdempotencyKey, error) {
+	return first[models.IdempotencyKey](r.db.Where(map[string]interface{}{"user_id": userID, "key": key}))
+}
+
+func (r *gormIdempotencyKeyRepository) Create(record *models.IdempotencyKey) error {
+	return r.db.Create(record).Error
+}
+
+func (r *gormIdempotencyKeyRepository) Save(record *models.IdempotencyKey) error {
+	return r.db.Save(record).Error
+}
+
+func (r *gormIdempotencyKeyRepository) Delete(id uint) error {
+	return r.db.Delete(&models.IdempotencyKey{}, id).Error
+}
+
+func (r *gormIdempotencyKeyRepository) DeleteByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.IdempotencyKey{}).Error
+}
+
+func (r *gormIdempotencyKeyRepository) DeleteExpired(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ?", now).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
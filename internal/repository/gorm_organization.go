@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormOrganizationRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormOrganizationRepository) FindByID(id uint) (*models.Organization, error) {
+	return first[models.Organization](r.db.Where("id = ?", id))
+}
+
+func (r *gormOrganizationRepository) FindByIDForUpdate(id uint) (*models.Organization, error) {
+	return first[models.Organization](r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id))
+}
+
+func (r *gormOrganizationRepository) FindByMember(userID uint) ([]models.Organization, error) {
+	return find[models.Organization](r.db.
+		Joins("JOIN organization_members ON organization_members.organization_id = organizations.id").
+		Where("organization_members.user_id = ?", userID).
+		Order("organizations.name asc"))
+}
+
+func (r *gormOrganizationRepository) Create(organization *models.Organization) error {
+	return r.db.Create(organization).Error
+}
+
+func (r *gormOrganizationRepository) FindMember(orgID, userID uint) (*models.OrganizationMember, error) {
+	return first[models.OrganizationMember](r.db.Where("organization_id = ? AND user_id = ?", orgID, userID))
+}
+
+func (r *gormOrganizationRepository) FindMembers(orgID uint) ([]models.OrganizationMember, error) {
+	return find[models.OrganizationMember](r.db.Where("organization_id = ?", orgID).
+		Preload("User").
+		Order("created_at asc"))
+}
+
+func (r *gormOrganizationRepository) CountMembers(orgID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.OrganizationMember{}).Where("organization_id = ?", orgID).Count(&count).Error
+	return count, err
+}
+
+func (r *gormOrganizationRepository) CreateMember(member *models.OrganizationMember) error {
+	return r.db.Omit("User").Create(member).Error
+}
+
+func (r *gormOrganizationRepository) SaveMember(member *models.OrganizationMember) error {
+	return r.db.Omit("User").Save(member).Error
+}
+
+func (r *gormOrganizationRepository) DeleteMember(orgID, userID uint) error {
+	return r.db.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&models.OrganizationMember{}).Error
+}
+
+func (r *gormOrganizationRepository) DeleteMembershipsByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.OrganizationMember{}).Error
+}
+
+func (r *gormOrganizationRepository) FindInvitationByToken(token string) (*models.OrganizationInvitation, error) {
+	return first[models.OrganizationInvitation](r.db.Where("token = ?", token))
+}
+
+func (r *gormOrganizationRepository) CreateInvitation(invitation *models.OrganizationInvitation) error {
+	return r.db.Create(invitation).Error
+}
+
+func (r *gormOrganizationRepository) SaveInvitation(invitation *models.OrganizationInvitation) error {
+	return r.db.Save(invitation).Error
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormPaymentEventRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPaymentEventRepository) FindByEventID(eventID string) (*models.PaymentEvent, error) {
+	return first[models.PaymentEvent](r.db.Where("event_id = ?", eventID))
+}
+
+func (r *gormPaymentEventRepository) Create(event *models.PaymentEvent) error {
+	return translateDuplicate(r.db, r.db.Create(event).Error)
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormPlanRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPlanRepository) FindAll() ([]models.Plan, error) {
+	return find[models.Plan](r.db)
+}
+
+func (r *gormPlanRepository) FindByID(id uint) (*models.Plan, error) {
+	return first[models.Plan](r.db.Where("id = ?", id))
+}
+
+func (r *gormPlanRepository) FindByIDForUpdate(id uint) (*models.Plan, error) {
+	return first[models.Plan](r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id))
+}
+
+func (r *gormPlanRepository) FindByIDForShare(id uint) (*models.Plan, error) {
+	return first[models.Plan](r.db.Clauses(clause.Locking{Strength: "SHARE"}).Where("id = ?", id))
+}
+
+func (r *gormPlanRepository) FindByPriceRange(minPrice, maxPrice float64) ([]models.Plan, error) {
+	return find[models.Plan](r.db.Where("price >= ? AND price <= ?", minPrice, maxPrice))
+}
+
+func (r *gormPlanRepository) FindActiveByName(name string) ([]models.Plan, error) {
+	return find[models.Plan](r.db.Where("name = ? AND is_active = ?", name, true).Order("duration asc"))
+}
+
+func (r *gormPlanRepository) FindByNameAndPeriod(name string, duration int, periodType string) (*models.Plan, error) {
+	return first[models.Plan](r.db.Where("name = ? AND duration = ? AND period_type = ?", name, duration, periodType))
+}
+
+func (r *gormPlanRepository) Create(plan *models.Plan) error {
+	return r.db.Create(plan).Error
+}
+
+func (r *gormPlanRepository) Save(plan *models.Plan) error {
+	return r.db.Save(plan).Error
+}
+
+func (r *gormPlanRepository) Delete(id uint) error {
+	return r.db.Delete(&models.Plan{}, id).Error
+}
+
+func (r *gormPlanRepository) FindVersions(planID uint) ([]models.PlanVersion, error) {
+	return find[models.PlanVersion](r.db.Where("plan_id = ?", planID).Order("version asc"))
+}
+
+func (r *gormPlanRepository) FindLatestVersion(planID uint) (*models.PlanVersion, error) {
+	return first[models.PlanVersion](r.db.Where("plan_id = ?", planID).Order("version desc"))
+}
+
+func (r *gormPlanRepository) FindEffectiveVersion(planID uint, at time.Time) (*models.PlanVersion, error) {
+	return first[models.PlanVersion](r.db.Where("plan_id = ? AND effective_from <= ?", planID, at).Order("version desc"))
+}
+
+func (r *gormPlanRepository) CreateVersion(version *models.PlanVersion) error {
+	return r.db.Create(version).Error
+}
+
+func (r *gormPlanRepository) FindFeatures(planID uint) ([]models.PlanFeature, error) {
+	return find[models.PlanFeature](r.db.Where("plan_id = ?", planID).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "key"}}))
+}
+
+func (r *gormPlanRepository) ReplaceFeatures(planID uint, features []models.PlanFeature) error {
+	if err := r.db.Where("plan_id = ?", planID).Delete(&models.PlanFeature{}).Error; err != nil {
+		return err
+	}
+	if len(features) == 0 {
+		return nil
+	}
+	for i := range features {
+		features[i].PlanID = planID
+	}
+	return r.db.Create(&features).Error
+}
+
+func (r *gormPlanRepository) FindMeteredComponents(planID uint) ([]models.MeteredComponent, error) {
+	return find[models.MeteredComponent](r.db.Where("plan_id = ?", planID).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "key"}}))
+}
+
+func (r *gormPlanRepository) ReplaceMeteredComponents(planID uint, components []models.MeteredComponent) error {
+	if err := r.db.Where("plan_id = ?", planID).Delete(&models.MeteredComponent{}).Error; err != nil {
+		return err
+	}
+	if len(components) == 0 {
+		return nil
+	}
+	for i := range components {
+		components[i].PlanID = planID
+	}
+	return r.db.Create(&components).Error
+}
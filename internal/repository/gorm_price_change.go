@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormPriceChangeRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPriceChangeRepository) FindByID(id uint) (*models.PriceChange, error) {
+	return first[models.PriceChange](r.db.Where("id = ?", id))
+}
+
+func (r *gormPriceChangeRepository) FindByIDForUpdate(id uint) (*models.PriceChange, error) {
+	return first[models.PriceChange](r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id))
+}
+
+func (r *gormPriceChangeRepository) FindByPlan(planID uint) ([]models.PriceChange, error) {
+	return find[models.PriceChange](r.db.Where("plan_id = ?", planID).Order("created_at desc, id desc"))
+}
+
+func (r *gormPriceChangeRepository) FindPendingByPlan(planID uint) (*models.PriceChange, error) {
+	return first[models.PriceChange](r.db.Where("plan_id = ? AND applied_at IS NULL", planID))
+}
+
+func (r *gormPriceChangeRepository) FindDue(now time.Time) ([]models.PriceChange, error) {
+	return find[models.PriceChange](r.db.Where("applied_at IS NULL AND effective_from <= ?", now).Order("effective_from asc"))
+}
+
+func (r *gormPriceChangeRepository) Create(change *models.PriceChange) error {
+	return r.db.Create(change).Error
+}
+
+func (r *gormPriceChangeRepository) Save(change *models.PriceChange) error {
+	return r.db.Save(change).Error
+}
+
+func (r *gormPriceChangeRepository) FindNoticeByToken(token string) (*models.PriceChangeNotice, error) {
+	return first[models.PriceChangeNotice](r.db.Where("token = ?", token))
+}
+
+func (r *gormPriceChangeRepository) FindNoticeByTokenForUpdate(token string) (*models.PriceChangeNotice, error) {
+	return first[models.PriceChangeNotice](r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token = ?", token))
+}
+
+func (r *gormPriceChangeRepository) FindNoticesByChange(changeID uint) ([]models.PriceChangeNotice, error) {
+	return find[models.PriceChangeNotice](r.db.Where("price_change_id = ?", changeID).Order("id asc"))
+}
+
+func (r *gormPriceChangeRepository) CreateNotice(notice *models.PriceChangeNotice) error {
+	return r.db.Create(notice).Error
+}
+
+func (r *gormPriceChangeRepository) SaveNotice(notice *models.PriceChangeNotice) error {
+	return r.db.Save(notice).Error
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormSplitRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormSplitRepository) withParticipants() *gorm.DB {
+	return r.db.Preload("Participants", func(db *gorm.DB) *gorm.DB { return db.Order("id asc") })
+}
+
+func (r *gormSplitRepository) FindBySubscription(subscriptionID uint) (*models.CostSplit, error) {
+	return first[models.CostSplit](r.withParticipants().Where("subscription_id = ?", subscriptionID))
+}
+
+func (r *gormSplitRepository) FindByOwner(ownerID uint) ([]models.CostSplit, error) {
+	return find[models.CostSplit](r.withParticipants().Where("owner_id = ?", ownerID).Order("id asc"))
+}
+
+func (r *gormSplitRepository) FindByParticipant(userID uint) ([]models.CostSplit, error) {
+	return find[models.CostSplit](r.withParticipants().
+		Where("id IN (?)", r.db.Model(&models.SplitParticipant{}).Select("split_id").Where("user_id = ?", userID)).
+		Order("id asc"))
+}
+
+func (r *gormSplitRepository) Save(split *models.CostSplit) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Participants").Save(split).Error; err != nil {
+			return err
+		}
+		for i := range split.Participants {
+			split.Participants[i].SplitID = split.ID
+			if err := tx.Save(&split.Participants[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *gormSplitRepository) FindEntries(splitID uint) ([]models.SplitLedgerEntry, error) {
+	return find[models.SplitLedgerEntry](r.db.Where("split_id = ?", splitID).Order("created_at desc, id desc"))
+}
+
+func (r *gormSplitRepository) CreateEntry(entry *models.SplitLedgerEntry) error {
+	return r.db.Create(entry).Error
+}
+
+func (r *gormSplitRepository) DetachUser(userID uint, name string) error {
+	return r.db.Model(&models.SplitParticipant{}).Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"user_id": nil, "name": name}).Error
+}
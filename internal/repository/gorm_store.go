@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// GormStore - хранилище поверх GORM
+type GormStore struct {
+	db *gorm.DB
+	// afterCommit - действия, ожидающие фиксации транзакции; nil вне транзакции
+	afterCommit *[]func()
+}
+
+// NewGormStore создает хранилище для переданного подключения
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Users() UserRepository {
+	return &gormUserRepository{db: s.db}
+}
+
+func (s *GormStore) Plans() PlanRepository {
+	return &gormPlanRepository{db: s.db}
+}
+
+func (s *GormStore) Subscriptions() SubscriptionRepository {
+	return &gormSubscriptionRepository{db: s.db}
+}
+
+func (s *GormStore) EmailChanges() EmailChangeRepository {
+	return &gormEmailChangeRepository{db: s.db}
+}
+
+func (s *GormStore) AccountDeletions() AccountDeletionRepository {
+	return &gormAccountDeletionRepository{db: s.db}
+}
+
+func (s *GormStore) Identities() IdentityRepository {
+	return &gormIdentityRepository{db: s.db}
+}
+
+func (s *GormStore) Organizations() OrganizationRepository {
+	return &gormOrganizationRepository{db: s.db}
+}
+
+func (s *GormStore) PriceChanges() PriceChangeRepository {
+	return &gormPriceChangeRepository{db: s.db}
+}
+
+func (s *GormStore) Usage() UsageRepository {
+	return &gormUsageRepository{db: s.db}
+}
+
+func (s *GormStore) APIKeys() APIKeyRepository {
+	return &gormAPIKeyRepository{db: s.db}
+}
+
+func (s *GormStore) Invoices() InvoiceRepository {
+	return &gormInvoiceRepository{db: s.db}
+}
+
+func (s *GormStore) Coupons() CouponRepository {
+	return &gormCouponRepository{db: s.db}
+}
+
+func (s *GormStore) Gifts() GiftRepository {
+	return &gormGiftRepository{db: s.db}
+}
+
+func (s *GormStore) Family() FamilyRepository {
+	return &gormFamilyRepository{db: s.db}
+}
+
+func (s *GormStore) Splits() SplitRepository {
+	return &gormSplitRepository{db: s.db}
+}
+
+func (s *GormStore) SubscriptionEvents() SubscriptionEventRepository {
+	return &gormSubscriptionEventRepository{db: s.db}
+}
+
+func (s *GormStore) Audit() AuditRepository {
+	return &gormAuditRepository{db: s.db}
+}
+
+func (s *GormStore) Webhooks() WebhookRepository {
+	return &gormWebhookRepository{db: s.db}
+}
+
+func (s *GormStore) PaymentEvents() PaymentEventRepository {
+	return &gormPaymentEventRepository{db: s.db}
+}
+
+func (s *GormStore) IdempotencyKeys() IdempotencyKeyRepository {
+	return &gormIdempotencyKeyRepository{db: s.db}
+}
+
+func (s *GormStore) Transaction(fn func(tx Store) error) error {
+	if s.afterCommit != nil {
+		// Вложенная транзакция выполняется через точку сохранения, и её действия
+		// ждут фиксации внешней транзакции
+		queued := len(*s.afterCommit)
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			return fn(&GormStore{db: tx, afterCommit: s.afterCommit})
+		})
+		if err != nil {
+			*s.afterCommit = (*s.afterCommit)[:queued]
+		}
+		return err
+	}
+
+	var afterCommit []func()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&GormStore{db: tx, afterCommit: &afterCommit})
+	})
+	if err != nil {
+		return err
+	}
+	for _, action := range afterCommit {
+		action()
+	}
+	return nil
+}
+
+func (s *GormStore) AfterCommit(fn func()) {
+	if s.afterCommit == nil {
+		fn()
+		return
+	}
+	*s.afterCommit = append(*s.afterCommit, fn)
+}
+
+// first выполняет запрос одной записи и заменяет gorm.ErrRecordNotFound на ErrNotFound
+func first[T any](query *gorm.DB) (*T, error) {
+	var record T
+	if err := query.First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// find выполняет запрос списка записей
+func find[T any](query *gorm.DB) ([]T, error) {
+	var records []T
+	if err := query.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// translateDuplicate заменяет нарушение уникального индекса на ErrDuplicate
+func translateDuplicate(db *gorm.DB, err error) error {
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok && err != nil {
+		if errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey) {
+			return ErrDuplicate
+		}
+	}
+	return err
+}
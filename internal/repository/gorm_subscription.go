@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormSubscriptionRepository struct {
+	db *gorm.DB
+}
+
+// withPlan подгружает план подписки, в том числе удалённый: история подписок
+// должна показывать план, даже если его уже сняли с продажи
+func (r *gormSubscriptionRepository) withPlan() *gorm.DB {
+	return r.db.Preload("Plan", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).Preload("PlanVersion")
+}
+
+// personal возвращает запрос по личным подпискам пользователя
+func (r *gormSubscriptionRepository) personal(userID uint) *gorm.DB {
+	return r.withPlan().
+		Where("subscriptions.user_id = ? AND subscriptions.organization_id IS NULL", userID)
+}
+
+func (r *gormSubscriptionRepository) FindByID(id uint) (*models.Subscription, error) {
+	return first[models.Subscription](r.withPlan().Where("id = ?", id))
+}
+
+func (r *gormSubscriptionRepository) FindByIDForUpdate(id uint) (*models.Subscription, error) {
+	return first[models.Subscription](r.withPlan().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id))
+}
+
+func (r *gormSubscriptionRepository) FindByUser(userID uint) ([]models.Subscription, error) {
+	return find[models.Subscription](r.personal(userID).Order("subscriptions.created_at desc"))
+}
+
+func (r *gormSubscriptionRepository) FindActiveByUser(userID uint) ([]models.Subscription, error) {
+	return find[models.Subscription](r.personal(userID).
+		Where("subscriptions.status = ?", "active").
+		Order("subscriptions.end_date asc"))
+}
+
+func (r *gormSubscriptionRepository) FindByOrganization(orgID uint) ([]models.Subscription, error) {
+	return find[models.Subscription](r.withPlan().
+		Where("organization_id = ?", orgID).
+		Order("created_at desc"))
+}
+
+func (r *gormSubscriptionRepository) FindActiveByOrganization(orgID uint) ([]models.Subscription, error) {
+	return find[models.Subscription](r.withPlan().
+		Where("organization_id = ? AND status = ?", orgID, "active").
+		Order("end_date asc"))
+}
+
+func (r *gormSubscriptionRepository) FindByUserAndPlanName(userID uint, name string) ([]models.Subscription, error) {
+	return find[models.Subscription](r.personal(userID).
+		Joins("JOIN plans ON subscriptions.plan_id = plans.id").
+		Where("LOWER(plans.name) LIKE ?", "%"+strings.ToLower(name)+"%"))
+}
+
+func (r *gormSubscriptionRepository) Search(userID uint, filter SubscriptionFilter) ([]models.Subscription, error) {
+	query := r.personal(userID).Joins("JOIN plans ON subscriptions.plan_id = plans.id")
+
+	if filter.Status != "" {
+		query = query.Where("subscriptions.status = ?", filter.Status)
+	}
+
+	if filter.Query != "" {
+		query = query.Where("LOWER(plans.name) LIKE ?", "%"+strings.ToLower(filter.Query)+"%")
+	}
+
+	switch filter.SortBy {
+	case "price_asc":
+		query = query.Order("plans.price ASC")
+	case "price_desc":
+		query = query.Order("plans.price DESC")
+	case "date_asc":
+		query = query.Order("subscriptions.created_at ASC")
+	default:
+		query = query.Order("subscriptions.created_at DESC")
+	}
+
+	return find[models.Subscription](query)
+}
+
+func (r *gormSubscriptionRepository) FindDueForRenewal(from, to time.Time) ([]models.Subscription, error) {
+	return find[models.Subscription](r.withPlan().
+		Where("status = ? AND auto_renew = ? AND end_date BETWEEN ? AND ?", "active", true, from, to))
+}
+
+func (r *gormSubscriptionRepository) FindExpired(now time.Time) ([]models.Subscription, error) {
+	return find[models.Subscription](r.withPlan().
+		Where("status = ? AND end_date < ?", "active", now))
+}
+
+func (r *gormSubscriptionRepository) FindUsageBillingDue(now time.Time) ([]models.Subscription, error) {
+	// Открытый период заканчивается с началом оплаченного периода, если подписку продлили
+	// досрочно, иначе вместе с ним
+	return find[models.Subscription](r.withPlan().
+		Where("(usage_billed_through < start_date AND start_date <= ?) OR "+
+			"(end_date <= ? AND (usage_billed_through IS NULL OR usage_billed_through < end_date))", now, now).
+		Order("id asc"))
+}
+
+func (r *gormSubscriptionRepository) Create(subscription *models.Subscription) error {
+	// GORM не записывает нулевое значение поля со значением по умолчанию и подставляет
+	// в структуру default: без отдельного обновления auto_renew получил бы true
+	autoRenew := subscription.AutoRenew
+	if err := r.db.Omit("Plan", "PlanVersion").Create(subscription).Error; err != nil {
+		return err
+	}
+	if !autoRenew {
+		subscription.AutoRenew = false
+		return r.db.Model(subscription).Update("auto_renew", false).Error
+	}
+	return nil
+}
+
+func (r *gormSubscriptionRepository) Save(subscription *models.Subscription) error {
+	if subscription.ID == 0 {
+		return r.Create(subscription)
+	}
+	version := subscription.Version
+	subscription.Version++
+	result := r.db.Model(subscription).Select("*").Omit("Plan", "PlanVersion").
+		Where("version = ?", version).
+		Updates(subscription)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = ErrConflict
+	}
+	if result.Error != nil {
+		subscription.Version = version
+	}
+	return result.Error
+}
+
+func (r *gormSubscriptionRepository) HardDeleteByUser(userID uint) error {
+	return r.db.Unscoped().Where("user_id = ?", userID).Delete(&models.Subscription{}).Error
+}
+
+func (r *gormSubscriptionRepository) FindActiveByPlan(planID uint) ([]models.Subscription, error) {
+	return find[models.Subscription](r.withPlan().
+		Where("plan_id = ? AND status = ?", planID, "active").
+		Order("id asc"))
+}
+
+func (r *gormSubscriptionRepository) FindActive() ([]models.Subscription, error) {
+	return find[models.Subscription](r.withPlan().
+		Where("status = ?", "active").
+		Order("id asc"))
+}
+
+func (r *gormSubscriptionRepository) CountActiveByPlan(planID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Subscription{}).
+		Where("plan_id = ? AND status = ?", planID, "active").
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormSubscriptionRepository) MoveActiveToPlan(fromPlanID uint, to *models.PlanVersion) (int64, error) {
+	result := r.db.Model(&models.Subscription{}).
+		Where("plan_id = ? AND status = ?", fromPlanID, "active").
+		Updates(map[string]interface{}{"plan_id": to.PlanID, "plan_version_id": to.ID, "version": gorm.Expr("version + 1")})
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormSubscriptionRepository) FindOrphaned() ([]models.Subscription, error) {
+	return find[models.Subscription](r.withPlan().
+		Joins("LEFT JOIN plans ON plans.id = subscriptions.plan_id").
+		Joins("LEFT JOIN users ON users.id = subscriptions.user_id").
+		Joins("LEFT JOIN organizations ON organizations.id = subscriptions.organization_id").
+		Where("subscriptions.status = ?", "active").
+		Where("(plans.id IS NULL OR plans.deleted_at IS NOT NULL" +
+			" OR (subscriptions.organization_id IS NULL AND (users.id IS NULL OR users.deleted_at IS NOT NULL))" +
+			" OR (subscriptions.organization_id IS NOT NULL AND (organizations.id IS NULL OR organizations.deleted_at IS NOT NULL)))").
+		Order("subscriptions.id asc"))
+}
+
+func (r *gormSubscriptionRepository) FindByProviderSubscriptionID(providerSubscriptionID string) (*models.Subscription, error) {
+	return first[models.Subscription](r.withPlan().Where("stripe_sub_id = ?", providerSubscriptionID).Order("id desc"))
+}
+
+type gormSubscriptionEventRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormSubscriptionEventRepository) FindBySubscription(subscriptionID uint) ([]models.SubscriptionEvent, error) {
+	return find[models.SubscriptionEvent](r.db.Where("subscription_id = ?", subscriptionID).Order("created_at desc, id desc"))
+}
+
+func (r *gormSubscriptionEventRepository) Create(event *models.SubscriptionEvent) error {
+	return r.db.Create(event).Error
+}
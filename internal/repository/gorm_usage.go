@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormUsageRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUsageRepository) Create(record *models.UsageRecord) error {
+	return r.db.Create(record).Error
+}
+
+func (r *gormUsageRepository) FindByEventID(subscriptionID uint, eventID string) (*models.UsageRecord, error) {
+	return first[models.UsageRecord](r.db.Where("subscription_id = ? AND event_id = ?", subscriptionID, eventID))
+}
+
+func (r *gormUsageRepository) SumByComponent(subscriptionID uint, from, to time.Time) (map[string]float64, error) {
+	var rows []struct {
+		ComponentKey string
+		Total        float64
+	}
+	err := r.db.Model(&models.UsageRecord{}).
+		Select("component_key, SUM(quantity) AS total").
+		Where("subscription_id = ? AND recorded_at >= ? AND recorded_at < ?", subscriptionID, from, to).
+		Group("component_key").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		totals[row.ComponentKey] = row.Total
+	}
+	return totals, nil
+}
+
+func (r *gormUsageRepository) FindBySubscription(subscriptionID uint) ([]models.UsageRecord, error) {
+	return find[models.UsageRecord](r.db.Where("subscription_id = ?", subscriptionID).Order("recorded_at desc, id desc"))
+}
+
+type gormAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAPIKeyRepository) FindAll() ([]models.APIKey, error) {
+	return find[models.APIKey](r.db.Order("id asc"))
+}
+
+func (r *gormAPIKeyRepository) FindByID(id uint) (*models.APIKey, error) {
+	return first[models.APIKey](r.db.Where("id = ?", id))
+}
+
+func (r *gormAPIKeyRepository) FindByHash(hash string) (*models.APIKey, error) {
+	return first[models.APIKey](r.db.Where("key_hash = ?", hash))
+}
+
+func (r *gormAPIKeyRepository) Create(key *models.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *gormAPIKeyRepository) Save(key *models.APIKey) error {
+	return r.db.Save(key).Error
+}
+
+type gormInvoiceRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormInvoiceRepository) FindByID(id uint) (*models.Invoice, error) {
+	return first[models.Invoice](r.db.Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id asc") }).Where("id = ?", id))
+}
+
+func (r *gormInvoiceRepository) FindBySubscription(subscriptionID uint) ([]models.Invoice, error) {
+	return find[models.Invoice](r.db.Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id asc") }).
+		Where("subscription_id = ?", subscriptionID).
+		Order("period_start desc, id desc"))
+}
+
+func (r *gormInvoiceRepository) FindByPaymentID(paymentID string) (*models.Invoice, error) {
+	return first[models.Invoice](r.db.Where("payment_id = ?", paymentID).Order("id desc"))
+}
+
+func (r *gormInvoiceRepository) Create(invoice *models.Invoice) error {
+	return r.db.Create(invoice).Error
+}
+
+func (r *gormInvoiceRepository) Save(invoice *models.Invoice) error {
+	return r.db.Omit("Lines").Save(invoice).Error
+}
+
+func (r *gormInvoiceRepository) AddLines(invoice *models.Invoice, lines []models.InvoiceLine) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	for i := range lines {
+		lines[i].InvoiceID = invoice.ID
+	}
+	if err := r.db.Create(&lines).Error; err != nil {
+		return err
+	}
+	for _, line := range lines {
+		invoice.AddLine(line)
+	}
+	return r.db.Model(&models.Invoice{}).Where("id = ?", invoice.ID).Update("total", invoice.Total).Error
+}
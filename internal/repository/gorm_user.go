@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUserRepository) FindByID(id uint) (*models.User, error) {
+	return first[models.User](r.db.Where("id = ?", id))
+}
+
+func (r *gormUserRepository) FindByIDForUpdate(id uint) (*models.User, error) {
+	return first[models.User](r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id))
+}
+
+func (r *gormUserRepository) FindByIDUnscoped(id uint) (*models.User, error) {
+	return first[models.User](r.db.Unscoped().Where("id = ?", id))
+}
+
+func (r *gormUserRepository) FindByEmail(email string) (*models.User, error) {
+	return first[models.User](r.db.Where("LOWER(email) = ?", strings.ToLower(email)))
+}
+
+func (r *gormUserRepository) FindByVerificationToken(token string) (*models.User, error) {
+	return first[models.User](r.db.Where("verification_token = ?", token))
+}
+
+func (r *gormUserRepository) FindAllUnscoped() ([]models.User, error) {
+	return find[models.User](r.db.Unscoped().Order("id asc"))
+}
+
+func (r *gormUserRepository) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *gormUserRepository) Save(user *models.User) error {
+	return r.db.Save(user).Error
+}
+
+func (r *gormUserRepository) UpdatePassword(id uint, password string) error {
+	return r.db.Unscoped().Model(&models.User{}).Where("id = ?", id).Update("password", password).Error
+}
+
+func (r *gormUserRepository) Delete(id uint) error {
+	return r.db.Delete(&models.User{}, id).Error
+}
+
+func (r *gormUserRepository) Restore(user *models.User) error {
+	user.DeletedAt = gorm.DeletedAt{}
+	return r.db.Unscoped().Save(user).Error
+}
+
+func (r *gormUserRepository) HardDelete(id uint) error {
+	return r.db.Unscoped().Delete(&models.User{}, id).Error
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormWebhookRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormWebhookRepository) FindEndpoints(userID *uint) ([]models.WebhookEndpoint, error) {
+	query := r.db.Where("user_id IS NULL")
+	if userID != nil {
+		query = r.db.Where("user_id = ?", *userID)
+	}
+	return find[models.WebhookEndpoint](query.Order("id asc"))
+}
+
+func (r *gormWebhookRepository) FindEndpointByID(id uint) (*models.WebhookEndpoint, error) {
+	return first[models.WebhookEndpoint](r.db.Where("id = ?", id))
+}
+
+func (r *gormWebhookRepository) FindEndpointsForUser(userID uint) ([]models.WebhookEndpoint, error) {
+	return find[models.WebhookEndpoint](r.db.Where("user_id = ? OR user_id IS NULL", userID).Order("id asc"))
+}
+
+func (r *gormWebhookRepository) CreateEndpoint(endpoint *models.WebhookEndpoint) error {
+	return r.db.Create(endpoint).Error
+}
+
+func (r *gormWebhookRepository) SaveEndpoint(endpoint *models.WebhookEndpoint) error {
+	return r.db.Save(endpoint).Error
+}
+
+func (r *gormWebhookRepository) DeleteEndpoint(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("endpoint_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.WebhookEndpoint{}, id).Error
+	})
+}
+
+func (r *gormWebhookRepository) DeleteEndpointsByUser(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		endpointIDs := tx.Model(&models.WebhookEndpoint{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("endpoint_id IN (?)", endpointIDs).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.WebhookEndpoint{}).Error
+	})
+}
+
+func (r *gormWebhookRepository) FindDeliveries(endpointID uint, limit int) ([]models.WebhookDelivery, error) {
+	return find[models.WebhookDelivery](r.db.Where("endpoint_id = ?", endpointID).
+		Order("created_at desc, id desc").Limit(limit))
+}
+
+func (r *gormWebhookRepository) FindDueDeliveries(now time.Time) ([]models.WebhookDelivery, error) {
+	return find[models.WebhookDelivery](r.db.
+		Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+		Order("id asc"))
+}
+
+func (r *gormWebhookRepository) ClaimDelivery(id uint, now, until time.Time) (bool, error) {
+	result := r.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, models.WebhookDeliveryPending, now).
+		Update("next_attempt_at", until)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormWebhookRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Create(delivery).Error
+}
+
+func (r *gormWebhookRepository) SaveDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Save(delivery).Error
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryEmailChangeRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryEmailChangeRepository) FindByToken(token string) (*models.EmailChangeRequest, error) {
+	var request *models.EmailChangeRequest
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		request, err = d.emailChanges.first(func(e *models.EmailChangeRequest) bool { return e.Token == token })
+		return err
+	})
+	return request, err
+}
+
+func (r *memoryEmailChangeRepository) FindByUser(userID uint) ([]models.EmailChangeRequest, error) {
+	var requests []models.EmailChangeRequest
+	err := r.s.withLock(func(d *memoryData) error {
+		requests = d.emailChanges.filter(func(e *models.EmailChangeRequest) bool { return e.UserID == userID }, false)
+		return nil
+	})
+	return requests, err
+}
+
+func (r *memoryEmailChangeRepository) Create(request *models.EmailChangeRequest) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.emailChanges.insert(request)
+		return nil
+	})
+}
+
+func (r *memoryEmailChangeRepository) Save(request *models.EmailChangeRequest) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.emailChanges.save(request)
+		return nil
+	})
+}
+
+func (r *memoryEmailChangeRepository) DeletePendingByUser(userID uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.emailChanges.remove(func(e *models.EmailChangeRequest) bool {
+			return e.UserID == userID && e.ConfirmedAt == nil
+		})
+		return nil
+	})
+}
+
+func (r *memoryEmailChangeRepository) DeleteByUser(userID uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.emailChanges.remove(func(e *models.EmailChangeRequest) bool { return e.UserID == userID })
+		return nil
+	})
+}
+
+type memoryAccountDeletionRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryAccountDeletionRepository) FindByRestoreToken(token string) (*models.AccountDeletion, error) {
+	var deletion *models.AccountDeletion
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		deletion, err = d.accountDeletions.first(func(a *models.AccountDeletion) bool { return a.RestoreToken == token })
+		return err
+	})
+	return deletion, err
+}
+
+func (r *memoryAccountDeletionRepository) FindDueForPurge(now time.Time) ([]models.AccountDeletion, error) {
+	var deletions []models.AccountDeletion
+	err := r.s.withLock(func(d *memoryData) error {
+		deletions = d.accountDeletions.filter(func(a *models.AccountDeletion) bool {
+			return a.RestoredAt == nil && a.PurgedAt == nil && a.PurgeAfter.Before(now)
+		}, false)
+		return nil
+	})
+	return deletions, err
+}
+
+func (r *memoryAccountDeletionRepository) Create(deletion *models.AccountDeletion) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.accountDeletions.insert(deletion)
+		return nil
+	})
+}
+
+func (r *memoryAccountDeletionRepository) Save(deletion *models.AccountDeletion) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.accountDeletions.save(deletion)
+		return nil
+	})
+}
+
+type memoryIdentityRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryIdentityRepository) FindByProviderSubject(provider, subject string) (*models.UserIdentity, error) {
+	var identity *models.UserIdentity
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		identity, err = d.identities.first(func(i *models.UserIdentity) bool {
+			return i.Provider == provider && i.Subject == subject
+		})
+		return err
+	})
+	return identity, err
+}
+
+func (r *memoryIdentityRepository) FindByUser(userID uint) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	err := r.s.withLock(func(d *memoryData) error {
+		identities = d.identities.filter(func(i *models.UserIdentity) bool { return i.UserID == userID }, false)
+		return nil
+	})
+	return identities, err
+}
+
+func (r *memoryIdentityRepository) Create(identity *models.UserIdentity) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.identities.insert(identity)
+		return nil
+	})
+}
+
+func (r *memoryIdentityRepository) DeleteByUser(userID uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.identities.remove(func(i *models.UserIdentity) bool { return i.UserID == userID })
+		return nil
+	})
+}
+
+func (r *memoryIdentityRepository) CreateLoginState(state *models.OIDCLoginState) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.loginStates.insert(state)
+		return nil
+	})
+}
+
+func (r *memoryIdentityRepository) FindLoginState(state, provider string) (*models.OIDCLoginState, error) {
+	var loginState *models.OIDCLoginState
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		loginState, err = d.loginStates.first(func(l *models.OIDCLoginState) bool {
+			return l.State == state && l.Provider == provider
+		})
+		return err
+	})
+	return loginState, err
+}
+
+func (r *memoryIdentityRepository) DeleteLoginState(id uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.loginStates.remove(func(l *models.OIDCLoginState) bool { return l.ID == id })
+		return nil
+	})
+}
+
+func (r *memoryIdentityRepository) DeleteExpiredLoginStates(now time.Time) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.loginStates.remove(func(l *models.OIDCLoginState) bool { return l.ExpiresAt.Before(now) })
+		return nil
+	})
+}
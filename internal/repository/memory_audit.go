@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryAuditRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryAuditRepository) Create(entry *models.AuditEntry) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.auditEntries.insert(entry)
+		return nil
+	})
+}
+
+func (r *memoryAuditRepository) Find(filter AuditFilter) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := r.s.withLock(func(d *memoryData) error {
+		entries = d.auditEntries.filter(func(e *models.AuditEntry) bool {
+			return (filter.ActorID == nil || (e.ActorID != nil && *e.ActorID == *filter.ActorID)) &&
+				(filter.Action == "" || e.Action == filter.Action) &&
+				(filter.TargetType == "" || e.TargetType == filter.TargetType) &&
+				(filter.TargetID == "" || e.TargetID == filter.TargetID) &&
+				(filter.RequestID == "" || e.RequestID == filter.RequestID) &&
+				(filter.From == nil || !e.CreatedAt.Before(*filter.From)) &&
+				(filter.To == nil || e.CreatedAt.Before(*filter.To))
+		}, false)
+		return nil
+	})
+	byCreatedAt(entries, true)
+
+	if filter.Offset > 0 {
+		if filter.Offset >= len(entries) {
+			return []models.AuditEntry{}, err
+		}
+		entries = entries[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(entries) {
+		entries = entries[:filter.Limit]
+	}
+	return entries, err
+}
+
+func (r *memoryAuditRepository) DeleteBefore(before time.Time) (int64, error) {
+	var deleted int64
+	err := r.s.withLock(func(d *memoryData) error {
+		d.auditEntries.remove(func(e *models.AuditEntry) bool {
+			if e.CreatedAt.Before(before) {
+				deleted++
+				return true
+			}
+			return false
+		})
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryCouponRepository struct {
+	s *MemoryStore
+}
+
+// withPlanIDs заполняет список планов купона
+func (d *memoryData) withPlanIDs(coupon *models.Coupon) {
+	coupon.PlanIDs = []uint{}
+	for _, link := range d.couponPlans.filter(func(l *models.CouponPlan) bool { return l.CouponID == coupon.ID }, false) {
+		coupon.PlanIDs = append(coupon.PlanIDs, link.PlanID)
+	}
+	sort.Slice(coupon.PlanIDs, func(i, j int) bool { return coupon.PlanIDs[i] < coupon.PlanIDs[j] })
+}
+
+func (r *memoryCouponRepository) FindAll() ([]models.Coupon, error) {
+	var coupons []models.Coupon
+	err := r.s.withLock(func(d *memoryData) error {
+		coupons = d.coupons.filter(nil, false)
+		for i := range coupons {
+			d.withPlanIDs(&coupons[i])
+		}
+		return nil
+	})
+	return coupons, err
+}
+
+func (r *memoryCouponRepository) FindByID(id uint) (*models.Coupon, error) {
+	var coupon *models.Coupon
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		coupon, err = d.coupons.get(id, false)
+		if err == nil {
+			d.withPlanIDs(coupon)
+		}
+		return err
+	})
+	return coupon, err
+}
+
+func (r *memoryCouponRepository) FindByCode(code string) (*models.Coupon, error) {
+	var coupon *models.Coupon
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		coupon, err = d.coupons.first(func(c *models.Coupon) bool { return c.Code == code })
+		if err == nil {
+			d.withPlanIDs(coupon)
+		}
+		return err
+	})
+	return coupon, err
+}
+
+func (r *memoryCouponRepository) Create(coupon *models.Coupon) error {
+	return r.s.withLock(func(d *memoryData) error {
+		// Уникальность кода проверяется и среди удалённых купонов, как в индексе базы
+		if len(d.coupons.filter(func(c *models.Coupon) bool { return c.Code == coupon.Code }, true)) > 0 {
+			return errors.New("duplicate coupon code")
+		}
+		d.coupons.insert(coupon)
+		d.replaceCouponPlans(coupon)
+		return nil
+	})
+}
+
+func (r *memoryCouponRepository) Save(coupon *models.Coupon) error {
+	return r.s.withLock(func(d *memoryData) error {
+		if stored, err := d.coupons.get(coupon.ID, false); err == nil {
+			coupon.RedemptionCount = stored.RedemptionCount
+		}
+		d.coupons.save(coupon)
+		d.replaceCouponPlans(coupon)
+		return nil
+	})
+}
+
+func (r *memoryCouponRepository) IncrementRedemptions(id uint) (bool, error) {
+	incremented := false
+	err := r.s.withLock(func(d *memoryData) error {
+		coupon, err := d.coupons.get(id, false)
+		if err != nil {
+			return err
+		}
+		if coupon.MaxRedemptions > 0 && coupon.RedemptionCount >= coupon.MaxRedemptions {
+			return nil
+		}
+		coupon.RedemptionCount++
+		d.coupons.save(coupon)
+		incremented = true
+		return nil
+	})
+	return incremented, err
+}
+
+func (d *memoryData) replaceCouponPlans(coupon *models.Coupon) {
+	d.couponPlans.remove(func(l *models.CouponPlan) bool { return l.CouponID == coupon.ID })
+	for _, planID := range coupon.PlanIDs {
+		d.couponPlans.insert(&models.CouponPlan{CouponID: coupon.ID, PlanID: planID})
+	}
+}
+
+func (r *memoryCouponRepository) Delete(id uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.coupons.softDelete(id)
+		return nil
+	})
+}
+
+func (r *memoryCouponRepository) FindRedemptions(couponID uint) ([]models.CouponRedemption, error) {
+	var redemptions []models.CouponRedemption
+	err := r.s.withLock(func(d *memoryData) error {
+		redemptions = d.couponRedemptions.filter(func(cr *models.CouponRedemption) bool { return cr.CouponID == couponID }, false)
+		byCreatedAt(redemptions, false)
+		return nil
+	})
+	return redemptions, err
+}
+
+func (r *memoryCouponRepository) FindRedemptionBySubscription(subscriptionID uint) (*models.CouponRedemption, error) {
+	var redemption *models.CouponRedemption
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		redemption, err = d.couponRedemptions.first(func(cr *models.CouponRedemption) bool { return cr.SubscriptionID == subscriptionID })
+		if err != nil {
+			return err
+		}
+		if coupon, err := d.coupons.get(redemption.CouponID, true); err == nil {
+			redemption.Coupon = coupon
+		}
+		return nil
+	})
+	return redemption, err
+}
+
+func (r *memoryCouponRepository) CreateRedemption(redemption *models.CouponRedemption) error {
+	return r.s.withLock(func(d *memoryData) error {
+		if _, err := d.couponRedemptions.first(func(cr *models.CouponRedemption) bool {
+			return cr.SubscriptionID == redemption.SubscriptionID
+		}); err == nil {
+			return errors.New("subscription already has a coupon")
+		}
+		row := *redemption
+		row.Coupon = nil
+		d.couponRedemptions.insert(&row)
+		redemption.ID, redemption.CreatedAt, redemption.UpdatedAt = row.ID, row.CreatedAt, row.UpdatedAt
+		return nil
+	})
+}
+
+func (r *memoryCouponRepository) SaveRedemption(redemption *models.CouponRedemption) error {
+	return r.s.withLock(func(d *memoryData) error {
+		row := *redemption
+		row.Coupon = nil
+		d.couponRedemptions.save(&row)
+		redemption.ID, redemption.UpdatedAt = row.ID, row.UpdatedAt
+		return nil
+	})
+}
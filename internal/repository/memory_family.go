@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryFamilyRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryFamilyRepository) FindMember(subscriptionID, userID uint) (*models.FamilyMember, error) {
+	var member *models.FamilyMember
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		member, err = d.familyMembers.first(func(m *models.FamilyMember) bool {
+			return m.SubscriptionID == subscriptionID && m.UserID == userID
+		})
+		return err
+	})
+	return member, err
+}
+
+func (r *memoryFamilyRepository) FindMembers(subscriptionID uint) ([]models.FamilyMember, error) {
+	var members []models.FamilyMember
+	err := r.s.withLock(func(d *memoryData) error {
+		members = d.familyMembers.filter(func(m *models.FamilyMember) bool { return m.SubscriptionID == subscriptionID }, false)
+		for i := range members {
+			if user, err := d.users.get(members[i].UserID, false); err == nil {
+				members[i].User = *user
+			}
+		}
+		return nil
+	})
+	byCreatedAt(members, false)
+	return members, err
+}
+
+func (r *memoryFamilyRepository) FindMembershipsByUser(userID uint) ([]models.FamilyMember, error) {
+	var members []models.FamilyMember
+	err := r.s.withLock(func(d *memoryData) error {
+		members = d.familyMembers.filter(func(m *models.FamilyMember) bool { return m.UserID == userID }, false)
+		return nil
+	})
+	byCreatedAt(members, false)
+	return members, err
+}
+
+func (r *memoryFamilyRepository) CreateMember(member *models.FamilyMember) error {
+	return r.s.withLock(func(d *memoryData) error {
+		if _, err := d.familyMembers.first(func(m *models.FamilyMember) bool {
+			return m.SubscriptionID == member.SubscriptionID && m.UserID == member.UserID
+		}); err == nil {
+			return errors.New("duplicate family member")
+		}
+		d.familyMembers.insert(member)
+		return nil
+	})
+}
+
+func (r *memoryFamilyRepository) DeleteMember(subscriptionID, userID uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.familyMembers.remove(func(m *models.FamilyMember) bool {
+			return m.SubscriptionID == subscriptionID && m.UserID == userID
+		})
+		return nil
+	})
+}
+
+func (r *memoryFamilyRepository) DeleteMembershipsByUser(userID uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.familyMembers.remove(func(m *models.FamilyMember) bool { return m.UserID == userID })
+		return nil
+	})
+}
+
+func (r *memoryFamilyRepository) FindInvitations(subscriptionID uint) ([]models.FamilyInvitation, error) {
+	var invitations []models.FamilyInvitation
+	err := r.s.withLock(func(d *memoryData) error {
+		invitations = d.familyInvitations.filter(func(i *models.FamilyInvitation) bool { return i.SubscriptionID == subscriptionID }, false)
+		return nil
+	})
+	byCreatedAt(invitations, false)
+	return invitations, err
+}
+
+func (r *memoryFamilyRepository) FindInvitationByToken(token string) (*models.FamilyInvitation, error) {
+	var invitation *models.FamilyInvitation
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		invitation, err = d.familyInvitations.first(func(i *models.FamilyInvitation) bool { return i.Token == token })
+		return err
+	})
+	return invitation, err
+}
+
+func (r *memoryFamilyRepository) CreateInvitation(invitation *models.FamilyInvitation) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.familyInvitations.insert(invitation)
+		return nil
+	})
+}
+
+func (r *memoryFamilyRepository) SaveInvitation(invitation *models.FamilyInvitation) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.familyInvitations.save(invitation)
+		return nil
+	})
+}
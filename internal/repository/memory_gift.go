@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryGiftRepository struct {
+	s *MemoryStore
+}
+
+func preloadGiftPlan(d *memoryData, gift *models.Gift) {
+	gift.Plan = models.Plan{}
+	if plan, err := d.plans.get(gift.PlanID, true); err == nil {
+		gift.Plan = *plan
+	}
+	gift.PlanVersion = nil
+	if version, err := d.planVersions.get(gift.PlanVersionID, false); err == nil {
+		gift.PlanVersion = version
+	}
+}
+
+func (r *memoryGiftRepository) first(match func(*models.Gift) bool) (*models.Gift, error) {
+	var gift *models.Gift
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		gift, err = d.gifts.first(match)
+		if err == nil {
+			preloadGiftPlan(d, gift)
+		}
+		return err
+	})
+	return gift, err
+}
+
+func (r *memoryGiftRepository) FindByID(id uint) (*models.Gift, error) {
+	return r.first(func(g *models.Gift) bool { return g.ID == id })
+}
+
+func (r *memoryGiftRepository) FindByCode(code string) (*models.Gift, error) {
+	return r.first(func(g *models.Gift) bool { return g.Code == code })
+}
+
+// FindByCodeForUpdate не блокирует запись отдельно: транзакции хранилища в памяти выполняются по очереди
+func (r *memoryGiftRepository) FindByCodeForUpdate(code string) (*models.Gift, error) {
+	return r.FindByCode(code)
+}
+
+func (r *memoryGiftRepository) FindByPurchaser(purchaserID uint) ([]models.Gift, error) {
+	var gifts []models.Gift
+	err := r.s.withLock(func(d *memoryData) error {
+		gifts = d.gifts.filter(func(g *models.Gift) bool { return g.PurchaserID == purchaserID }, false)
+		for i := range gifts {
+			preloadGiftPlan(d, &gifts[i])
+		}
+		return nil
+	})
+	byCreatedAt(gifts, true)
+	return gifts, err
+}
+
+func (r *memoryGiftRepository) FindByRedeemer(userID uint) ([]models.Gift, error) {
+	var gifts []models.Gift
+	err := r.s.withLock(func(d *memoryData) error {
+		gifts = d.gifts.filter(func(g *models.Gift) bool { return g.RedeemedByID != nil && *g.RedeemedByID == userID }, false)
+		for i := range gifts {
+			preloadGiftPlan(d, &gifts[i])
+		}
+		return nil
+	})
+	byCreatedAt(gifts, true)
+	return gifts, err
+}
+
+func (r *memoryGiftRepository) Create(gift *models.Gift) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.gifts.insert(gift)
+		return nil
+	})
+}
+
+func (r *memoryGiftRepository) Save(gift *models.Gift) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.gifts.save(gift)
+		return nil
+	})
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryIdempotencyKeyRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryIdempotencyKeyRepository) Find(userID uint, key string) (*models.IdempotencyKey, error) {
+	var record *models.IdempotencyKey
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		record, err = d.idempotencyKeys.first(func(k *models.IdempotencyKey) bool {
+			return k.UserID == userID && k.Key == key
+		})
+		return err
+	})
+	return record, err
+}
+
+func (r *memoryIdempotencyKeyRepository) Create(record *models.IdempotencyKey) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.idempotencyKeys.insert(record)
+		return nil
+	})
+}
+
+func (r *memoryIdempotencyKeyRepository) Save(record *models.IdempotencyKey) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.idempotencyKeys.save(record)
+		return nil
+	})
+}
+
+func (r *memoryIdempotencyKeyRepository) Delete(id uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.idempotencyKeys.remove(func(k *models.IdempotencyKey) bool { return k.ID == id })
+		return nil
+	})
+}
+
+func (r *memoryIdempotencyKeyRepository) DeleteByUser(userID uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.idempotencyKeys.remove(func(k *models.IdempotencyKey) bool { return k.UserID == userID })
+		return nil
+	})
+}
+
+func (r *memoryIdempotencyKeyRepository) DeleteExpired(now time.Time) (int64, error) {
+	var deleted int64
+	err := r.s.withLock(func(d *memoryData) error {
+		d.idempotencyKeys.remove(func(k *models.IdempotencyKey) bool {
+			if k.ExpiresAt.Before(now) {
+				deleted++
+				return true
+			}
+			return false
+		})
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"sort"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryOrganizationRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryOrganizationRepository) FindByID(id uint) (*models.Organization, error) {
+	var organization *models.Organization
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		organization, err = d.organizations.get(id, false)
+		return err
+	})
+	return organization, err
+}
+
+// FindByIDForUpdate не блокирует запись отдельно: транзакции хранилища в памяти выполняются по очереди
+func (r *memoryOrganizationRepository) FindByIDForUpdate(id uint) (*models.Organization, error) {
+	return r.FindByID(id)
+}
+
+func (r *memoryOrganizationRepository) FindByMember(userID uint) ([]models.Organization, error) {
+	organizations := []models.Organization{}
+	err := r.s.withLock(func(d *memoryData) error {
+		members := d.organizationMembers.filter(func(m *models.OrganizationMember) bool { return m.UserID == userID }, false)
+		for _, member := range members {
+			if organization, err := d.organizations.get(member.OrganizationID, false); err == nil {
+				organizations = append(organizations, *organization)
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(organizations, func(i, j int) bool { return organizations[i].Name < organizations[j].Name })
+	return organizations, err
+}
+
+func (r *memoryOrganizationRepository) Create(organization *models.Organization) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.organizations.insert(organization)
+		return nil
+	})
+}
+
+func (r *memoryOrganizationRepository) FindMember(orgID, userID uint) (*models.OrganizationMember, error) {
+	var member *models.OrganizationMember
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		member, err = d.organizationMembers.first(func(m *models.OrganizationMember) bool {
+			return m.OrganizationID == orgID && m.UserID == userID
+		})
+		return err
+	})
+	if member != nil {
+		member.User = models.User{}
+	}
+	return member, err
+}
+
+func (r *memoryOrganizationRepository) FindMembers(orgID uint) ([]models.OrganizationMember, error) {
+	var members []models.OrganizationMember
+	err := r.s.withLock(func(d *memoryData) error {
+		members = d.organizationMembers.filter(func(m *models.OrganizationMember) bool { return m.OrganizationID == orgID }, false)
+		for i := range members {
+			if user, err := d.users.get(members[i].UserID, false); err == nil {
+				members[i].User = *user
+			}
+		}
+		return nil
+	})
+	byCreatedAt(members, false)
+	return members, err
+}
+
+func (r *memoryOrganizationRepository) CountMembers(orgID uint) (int64, error) {
+	members, err := r.FindMembers(orgID)
+	return int64(len(members)), err
+}
+
+func (r *memoryOrganizationRepository) CreateMember(member *models.OrganizationMember) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.organizationMembers.insert(member)
+		return nil
+	})
+}
+
+func (r *memoryOrganizationRepository) SaveMember(member *models.OrganizationMember) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.organizationMembers.save(member)
+		return nil
+	})
+}
+
+func (r *memoryOrganizationRepository) DeleteMember(orgID, userID uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.organizationMembers.remove(func(m *models.OrganizationMember) bool {
+			return m.OrganizationID == orgID && m.UserID == userID
+		})
+		return nil
+	})
+}
+
+func (r *memoryOrganizationRepository) DeleteMembershipsByUser(userID uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.organizationMembers.remove(func(m *models.OrganizationMember) bool { return m.UserID == userID })
+		return nil
+	})
+}
+
+func (r *memoryOrganizationRepository) FindInvitationByToken(token string) (*models.OrganizationInvitation, error) {
+	var invitation *models.OrganizationInvitation
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		invitation, err = d.invitations.first(func(i *models.OrganizationInvitation) bool { return i.Token == token })
+		return err
+	})
+	return invitation, err
+}
+
+func (r *memoryOrganizationRepository) CreateInvitation(invitation *models.OrganizationInvitation) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.invitations.insert(invitation)
+		return nil
+	})
+}
+
+func (r *memoryOrganizationRepository) SaveInvitation(invitation *models.OrganizationInvitation) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.invitations.save(invitation)
+		return nil
+	})
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryPaymentEventRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryPaymentEventRepository) FindByEventID(eventID string) (*models.PaymentEvent, error) {
+	var event *models.PaymentEvent
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		event, err = d.paymentEvents.first(func(e *models.PaymentEvent) bool { return e.EventID == eventID })
+		return err
+	})
+	return event, err
+}
+
+func (r *memoryPaymentEventRepository) Create(event *models.PaymentEvent) error {
+	return r.s.withLock(func(d *memoryData) error {
+		if _, err := d.paymentEvents.first(func(e *models.PaymentEvent) bool { return e.EventID == event.EventID }); err == nil {
+			return ErrDuplicate
+		}
+		d.paymentEvents.insert(event)
+		return nil
+	})
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryPlanRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryPlanRepository) FindAll() ([]models.Plan, error) {
+	var plans []models.Plan
+	err := r.s.withLock(func(d *memoryData) error {
+		plans = d.plans.filter(nil, false)
+		return nil
+	})
+	return plans, err
+}
+
+func (r *memoryPlanRepository) FindByID(id uint) (*models.Plan, error) {
+	var plan *models.Plan
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		plan, err = d.plans.get(id, false)
+		return err
+	})
+	return plan, err
+}
+
+// FindByIDForUpdate не блокирует запись отдельно: транзакции хранилища в памяти выполняются по очереди
+func (r *memoryPlanRepository) FindByIDForUpdate(id uint) (*models.Plan, error) {
+	return r.FindByID(id)
+}
+
+// FindByIDForShare не блокирует запись отдельно: транзакции хранилища в памяти выполняются по очереди
+func (r *memoryPlanRepository) FindByIDForShare(id uint) (*models.Plan, error) {
+	return r.FindByID(id)
+}
+
+func (r *memoryPlanRepository) FindByPriceRange(minPrice, maxPrice float64) ([]models.Plan, error) {
+	var plans []models.Plan
+	err := r.s.withLock(func(d *memoryData) error {
+		plans = d.plans.filter(func(p *models.Plan) bool {
+			return p.Price >= minPrice && p.Price <= maxPrice
+		}, false)
+		return nil
+	})
+	return plans, err
+}
+
+func (r *memoryPlanRepository) FindActiveByName(name string) ([]models.Plan, error) {
+	var plans []models.Plan
+	err := r.s.withLock(func(d *memoryData) error {
+		plans = d.plans.filter(func(p *models.Plan) bool { return p.Name == name && p.IsActive }, false)
+		return nil
+	})
+	sort.SliceStable(plans, func(i, j int) bool { return plans[i].Duration < plans[j].Duration })
+	return plans, err
+}
+
+func (r *memoryPlanRepository) FindByNameAndPeriod(name string, duration int, periodType string) (*models.Plan, error) {
+	var plan *models.Plan
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		plan, err = d.plans.first(func(p *models.Plan) bool {
+			return p.Name == name && p.Duration == duration && p.PeriodType == periodType
+		})
+		return err
+	})
+	return plan, err
+}
+
+func (r *memoryPlanRepository) Create(plan *models.Plan) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.plans.insert(plan)
+		return nil
+	})
+}
+
+func (r *memoryPlanRepository) Save(plan *models.Plan) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.plans.save(plan)
+		return nil
+	})
+}
+
+func (r *memoryPlanRepository) Delete(id uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.plans.softDelete(id)
+		return nil
+	})
+}
+
+func (r *memoryPlanRepository) FindVersions(planID uint) ([]models.PlanVersion, error) {
+	var versions []models.PlanVersion
+	err := r.s.withLock(func(d *memoryData) error {
+		versions = d.planVersions.filter(func(v *models.PlanVersion) bool { return v.PlanID == planID }, false)
+		return nil
+	})
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, err
+}
+
+func (r *memoryPlanRepository) FindLatestVersion(planID uint) (*models.PlanVersion, error) {
+	versions, err := r.FindVersions(planID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	return &versions[len(versions)-1], nil
+}
+
+func (r *memoryPlanRepository) FindEffectiveVersion(planID uint, at time.Time) (*models.PlanVersion, error) {
+	versions, err := r.FindVersions(planID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !versions[i].EffectiveFrom.After(at) {
+			return &versions[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPlanRepository) CreateVersion(version *models.PlanVersion) error {
+	return r.s.withLock(func(d *memoryData) error {
+		for _, existing := range d.planVersions.filter(nil, false) {
+			if existing.PlanID == version.PlanID && existing.Version == version.Version {
+				return errors.New("duplicate plan version")
+			}
+		}
+		d.planVersions.insert(version)
+		return nil
+	})
+}
+
+func (r *memoryPlanRepository) FindFeatures(planID uint) ([]models.PlanFeature, error) {
+	var features []models.PlanFeature
+	err := r.s.withLock(func(d *memoryData) error {
+		features = d.planFeatures.filter(func(f *models.PlanFeature) bool { return f.PlanID == planID }, false)
+		return nil
+	})
+	sort.SliceStable(features, func(i, j int) bool { return features[i].Key < features[j].Key })
+	return features, err
+}
+
+func (r *memoryPlanRepository) ReplaceFeatures(planID uint, features []models.PlanFeature) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.planFeatures.remove(func(f *models.PlanFeature) bool { return f.PlanID == planID })
+		for i := range features {
+			features[i].PlanID = planID
+			d.planFeatures.insert(&features[i])
+		}
+		return nil
+	})
+}
+
+func (r *memoryPlanRepository) FindMeteredComponents(planID uint) ([]models.MeteredComponent, error) {
+	var components []models.MeteredComponent
+	err := r.s.withLock(func(d *memoryData) error {
+		components = d.meteredComponents.filter(func(m *models.MeteredComponent) bool { return m.PlanID == planID }, false)
+		return nil
+	})
+	sort.SliceStable(components, func(i, j int) bool { return components[i].Key < components[j].Key })
+	return components, err
+}
+
+func (r *memoryPlanRepository) ReplaceMeteredComponents(planID uint, components []models.MeteredComponent) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.meteredComponents.remove(func(m *models.MeteredComponent) bool { return m.PlanID == planID })
+		for i := range components {
+			components[i].PlanID = planID
+			d.meteredComponents.insert(&components[i])
+		}
+		return nil
+	})
+}
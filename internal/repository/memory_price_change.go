@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"sort"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryPriceChangeRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryPriceChangeRepository) FindByID(id uint) (*models.PriceChange, error) {
+	var change *models.PriceChange
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		change, err = d.priceChanges.get(id, false)
+		return err
+	})
+	return change, err
+}
+
+// FindByIDForUpdate не блокирует запись отдельно: транзакции хранилища в памяти выполняются по очереди
+func (r *memoryPriceChangeRepository) FindByIDForUpdate(id uint) (*models.PriceChange, error) {
+	return r.FindByID(id)
+}
+
+func (r *memoryPriceChangeRepository) FindByPlan(planID uint) ([]models.PriceChange, error) {
+	var changes []models.PriceChange
+	err := r.s.withLock(func(d *memoryData) error {
+		changes = d.priceChanges.filter(func(c *models.PriceChange) bool { return c.PlanID == planID }, false)
+		return nil
+	})
+	byCreatedAt(changes, true)
+	return changes, err
+}
+
+func (r *memoryPriceChangeRepository) FindPendingByPlan(planID uint) (*models.PriceChange, error) {
+	var change *models.PriceChange
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		change, err = d.priceChanges.first(func(c *models.PriceChange) bool { return c.PlanID == planID && c.IsPending() })
+		return err
+	})
+	return change, err
+}
+
+func (r *memoryPriceChangeRepository) FindDue(now time.Time) ([]models.PriceChange, error) {
+	var changes []models.PriceChange
+	err := r.s.withLock(func(d *memoryData) error {
+		changes = d.priceChanges.filter(func(c *models.PriceChange) bool {
+			return c.IsPending() && !c.EffectiveFrom.After(now)
+		}, false)
+		return nil
+	})
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].EffectiveFrom.Before(changes[j].EffectiveFrom) })
+	return changes, err
+}
+
+func (r *memoryPriceChangeRepository) Create(change *models.PriceChange) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.priceChanges.insert(change)
+		return nil
+	})
+}
+
+func (r *memoryPriceChangeRepository) Save(change *models.PriceChange) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.priceChanges.save(change)
+		return nil
+	})
+}
+
+func (r *memoryPriceChangeRepository) FindNoticeByToken(token string) (*models.PriceChangeNotice, error) {
+	var notice *models.PriceChangeNotice
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		notice, err = d.priceChangeNotices.first(func(n *models.PriceChangeNotice) bool { return n.Token == token })
+		return err
+	})
+	return notice, err
+}
+
+// FindNoticeByTokenForUpdate не блокирует запись отдельно: транзакции хранилища в памяти выполняются по очереди
+func (r *memoryPriceChangeRepository) FindNoticeByTokenForUpdate(token string) (*models.PriceChangeNotice, error) {
+	return r.FindNoticeByToken(token)
+}
+
+func (r *memoryPriceChangeRepository) FindNoticesByChange(changeID uint) ([]models.PriceChangeNotice, error) {
+	var notices []models.PriceChangeNotice
+	err := r.s.withLock(func(d *memoryData) error {
+		notices = d.priceChangeNotices.filter(func(n *models.PriceChangeNotice) bool { return n.PriceChangeID == changeID }, false)
+		return nil
+	})
+	return notices, err
+}
+
+func (r *memoryPriceChangeRepository) CreateNotice(notice *models.PriceChangeNotice) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.priceChangeNotices.insert(notice)
+		return nil
+	})
+}
+
+func (r *memoryPriceChangeRepository) SaveNotice(notice *models.PriceChangeNotice) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.priceChangeNotices.save(notice)
+		return nil
+	})
+}
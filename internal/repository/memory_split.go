@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memorySplitRepository struct {
+	s *MemoryStore
+}
+
+// withParticipants подставляет участников в разделения; вызывается под блокировкой
+func (d *memoryData) withParticipants(splits []models.CostSplit) []models.CostSplit {
+	for i := range splits {
+		splits[i].Participants = d.splitParticipants.filter(func(p *models.SplitParticipant) bool {
+			return p.SplitID == splits[i].ID
+		}, false)
+	}
+	return splits
+}
+
+func (r *memorySplitRepository) FindBySubscription(subscriptionID uint) (*models.CostSplit, error) {
+	var split *models.CostSplit
+	err := r.s.withLock(func(d *memoryData) error {
+		splits := d.withParticipants(d.costSplits.filter(func(s *models.CostSplit) bool { return s.SubscriptionID == subscriptionID }, false))
+		if len(splits) == 0 {
+			return ErrNotFound
+		}
+		split = &splits[0]
+		return nil
+	})
+	return split, err
+}
+
+func (r *memorySplitRepository) FindByOwner(ownerID uint) ([]models.CostSplit, error) {
+	var splits []models.CostSplit
+	err := r.s.withLock(func(d *memoryData) error {
+		splits = d.withParticipants(d.costSplits.filter(func(s *models.CostSplit) bool { return s.OwnerID == ownerID }, false))
+		return nil
+	})
+	return splits, err
+}
+
+func (r *memorySplitRepository) FindByParticipant(userID uint) ([]models.CostSplit, error) {
+	var splits []models.CostSplit
+	err := r.s.withLock(func(d *memoryData) error {
+		splitIDs := map[uint]bool{}
+		for _, participant := range d.splitParticipants.filter(func(p *models.SplitParticipant) bool {
+			return p.UserID != nil && *p.UserID == userID
+		}, false) {
+			splitIDs[participant.SplitID] = true
+		}
+		splits = d.withParticipants(d.costSplits.filter(func(s *models.CostSplit) bool { return splitIDs[s.ID] }, false))
+		return nil
+	})
+	return splits, err
+}
+
+func (r *memorySplitRepository) Save(split *models.CostSplit) error {
+	return r.s.withLock(func(d *memoryData) error {
+		participants := split.Participants
+		split.Participants = nil
+		d.costSplits.save(split)
+		for i := range participants {
+			participants[i].SplitID = split.ID
+			d.splitParticipants.save(&participants[i])
+		}
+		split.Participants = participants
+		return nil
+	})
+}
+
+func (r *memorySplitRepository) FindEntries(splitID uint) ([]models.SplitLedgerEntry, error) {
+	var entries []models.SplitLedgerEntry
+	err := r.s.withLock(func(d *memoryData) error {
+		entries = d.splitEntries.filter(func(e *models.SplitLedgerEntry) bool { return e.SplitID == splitID }, false)
+		return nil
+	})
+	byCreatedAt(entries, true)
+	return entries, err
+}
+
+func (r *memorySplitRepository) CreateEntry(entry *models.SplitLedgerEntry) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.splitEntries.insert(entry)
+		return nil
+	})
+}
+
+func (r *memorySplitRepository) DetachUser(userID uint, name string) error {
+	return r.s.withLock(func(d *memoryData) error {
+		for _, participant := range d.splitParticipants.filter(func(p *models.SplitParticipant) bool {
+			return p.UserID != nil && *p.UserID == userID
+		}, false) {
+			participant.UserID = nil
+			participant.Name = name
+			d.splitParticipants.save(&participant)
+		}
+		return nil
+	})
+}
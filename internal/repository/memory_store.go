@@ -0,0 +1,419 @@
+package repository
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+// MemoryStore - хранилище в памяти для тестов.
+// Транзакции выполняются по очереди; при ошибке данные откатываются к снимку,
+// сделанному перед началом транзакции
+type MemoryStore struct {
+	mu   *sync.Mutex
+	txMu *sync.Mutex
+	data *memoryData
+	inTx bool
+	// afterCommit - действия, ожидающие фиксации транзакции
+	afterCommit *[]func()
+}
+
+type memoryData struct {
+	users               *table[models.User]
+	plans               *table[models.Plan]
+	planVersions        *table[models.PlanVersion]
+	planFeatures        *table[models.PlanFeature]
+	meteredComponents   *table[models.MeteredComponent]
+	subscriptions       *table[models.Subscription]
+	emailChanges        *table[models.EmailChangeRequest]
+	accountDeletions    *table[models.AccountDeletion]
+	identities          *table[models.UserIdentity]
+	loginStates         *table[models.OIDCLoginState]
+	organizations       *table[models.Organization]
+	organizationMembers *table[models.OrganizationMember]
+	invitations         *table[models.OrganizationInvitation]
+	priceChanges        *table[models.PriceChange]
+	priceChangeNotices  *table[models.PriceChangeNotice]
+	usageRecords        *table[models.UsageRecord]
+	apiKeys             *table[models.APIKey]
+	invoices            *table[models.Invoice]
+	invoiceLines        *table[models.InvoiceLine]
+	coupons             *table[models.Coupon]
+	couponPlans         *table[models.CouponPlan]
+	couponRedemptions   *table[models.CouponRedemption]
+	gifts               *table[models.Gift]
+	familyMembers       *table[models.FamilyMember]
+	familyInvitations   *table[models.FamilyInvitation]
+	costSplits          *table[models.CostSplit]
+	splitParticipants   *table[models.SplitParticipant]
+	splitEntries        *table[models.SplitLedgerEntry]
+	subscriptionEvents  *table[models.SubscriptionEvent]
+	auditEntries        *table[models.AuditEntry]
+	webhookEndpoints    *table[models.WebhookEndpoint]
+	webhookDeliveries   *table[models.WebhookDelivery]
+	paymentEvents       *table[models.PaymentEvent]
+	idempotencyKeys     *table[models.IdempotencyKey]
+}
+
+// NewMemoryStore создает пустое хранилище в памяти
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu:   &sync.Mutex{},
+		txMu: &sync.Mutex{},
+		data: &memoryData{
+			users:               newTable[models.User](),
+			plans:               newTable[models.Plan](),
+			planVersions:        newTable[models.PlanVersion](),
+			planFeatures:        newTable[models.PlanFeature](),
+			meteredComponents:   newTable[models.MeteredComponent](),
+			subscriptions:       newTable[models.Subscription](),
+			emailChanges:        newTable[models.EmailChangeRequest](),
+			accountDeletions:    newTable[models.AccountDeletion](),
+			identities:          newTable[models.UserIdentity](),
+			loginStates:         newTable[models.OIDCLoginState](),
+			organizations:       newTable[models.Organization](),
+			organizationMembers: newTable[models.OrganizationMember](),
+			invitations:         newTable[models.OrganizationInvitation](),
+			priceChanges:        newTable[models.PriceChange](),
+			priceChangeNotices:  newTable[models.PriceChangeNotice](),
+			usageRecords:        newTable[models.UsageRecord](),
+			apiKeys:             newTable[models.APIKey](),
+			invoices:            newTable[models.Invoice](),
+			invoiceLines:        newTable[models.InvoiceLine](),
+			coupons:             newTable[models.Coupon](),
+			couponPlans:         newTable[models.CouponPlan](),
+			couponRedemptions:   newTable[models.CouponRedemption](),
+			gifts:               newTable[models.Gift](),
+			familyMembers:       newTable[models.FamilyMember](),
+			familyInvitations:   newTable[models.FamilyInvitation](),
+			costSplits:          newTable[models.CostSplit](),
+			splitParticipants:   newTable[models.SplitParticipant](),
+			splitEntries:        newTable[models.SplitLedgerEntry](),
+			subscriptionEvents:  newTable[models.SubscriptionEvent](),
+			auditEntries:        newTable[models.AuditEntry](),
+			webhookEndpoints:    newTable[models.WebhookEndpoint](),
+			webhookDeliveries:   newTable[models.WebhookDelivery](),
+			paymentEvents:       newTable[models.PaymentEvent](),
+			idempotencyKeys:     newTable[models.IdempotencyKey](),
+		},
+	}
+}
+
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		users:               d.users.clone(),
+		plans:               d.plans.clone(),
+		planVersions:        d.planVersions.clone(),
+		planFeatures:        d.planFeatures.clone(),
+		meteredComponents:   d.meteredComponents.clone(),
+		subscriptions:       d.subscriptions.clone(),
+		emailChanges:        d.emailChanges.clone(),
+		accountDeletions:    d.accountDeletions.clone(),
+		identities:          d.identities.clone(),
+		loginStates:         d.loginStates.clone(),
+		organizations:       d.organizations.clone(),
+		organizationMembers: d.organizationMembers.clone(),
+		invitations:         d.invitations.clone(),
+		priceChanges:        d.priceChanges.clone(),
+		priceChangeNotices:  d.priceChangeNotices.clone(),
+		usageRecords:        d.usageRecords.clone(),
+		apiKeys:             d.apiKeys.clone(),
+		invoices:            d.invoices.clone(),
+		invoiceLines:        d.invoiceLines.clone(),
+		coupons:             d.coupons.clone(),
+		couponPlans:         d.couponPlans.clone(),
+		couponRedemptions:   d.couponRedemptions.clone(),
+		gifts:               d.gifts.clone(),
+		familyMembers:       d.familyMembers.clone(),
+		familyInvitations:   d.familyInvitations.clone(),
+		costSplits:          d.costSplits.clone(),
+		splitParticipants:   d.splitParticipants.clone(),
+		splitEntries:        d.splitEntries.clone(),
+		subscriptionEvents:  d.subscriptionEvents.clone(),
+		auditEntries:        d.auditEntries.clone(),
+		webhookEndpoints:    d.webhookEndpoints.clone(),
+		webhookDeliveries:   d.webhookDeliveries.clone(),
+		paymentEvents:       d.paymentEvents.clone(),
+		idempotencyKeys:     d.idempotencyKeys.clone(),
+	}
+}
+
+func (s *MemoryStore) Users() UserRepository {
+	return &memoryUserRepository{s: s}
+}
+
+func (s *MemoryStore) Plans() PlanRepository {
+	return &memoryPlanRepository{s: s}
+}
+
+func (s *MemoryStore) Subscriptions() SubscriptionRepository {
+	return &memorySubscriptionRepository{s: s}
+}
+
+func (s *MemoryStore) EmailChanges() EmailChangeRepository {
+	return &memoryEmailChangeRepository{s: s}
+}
+
+func (s *MemoryStore) AccountDeletions() AccountDeletionRepository {
+	return &memoryAccountDeletionRepository{s: s}
+}
+
+func (s *MemoryStore) Identities() IdentityRepository {
+	return &memoryIdentityRepository{s: s}
+}
+
+func (s *MemoryStore) Organizations() OrganizationRepository {
+	return &memoryOrganizationRepository{s: s}
+}
+
+func (s *MemoryStore) PriceChanges() PriceChangeRepository {
+	return &memoryPriceChangeRepository{s: s}
+}
+
+func (s *MemoryStore) Usage() UsageRepository {
+	return &memoryUsageRepository{s: s}
+}
+
+func (s *MemoryStore) APIKeys() APIKeyRepository {
+	return &memoryAPIKeyRepository{s: s}
+}
+
+func (s *MemoryStore) Invoices() InvoiceRepository {
+	return &memoryInvoiceRepository{s: s}
+}
+
+func (s *MemoryStore) Coupons() CouponRepository {
+	return &memoryCouponRepository{s: s}
+}
+
+func (s *MemoryStore) Gifts() GiftRepository {
+	return &memoryGiftRepository{s: s}
+}
+
+func (s *MemoryStore) Family() FamilyRepository {
+	return &memoryFamilyRepository{s: s}
+}
+
+func (s *MemoryStore) Splits() SplitRepository {
+	return &memorySplitRepository{s: s}
+}
+
+func (s *MemoryStore) SubscriptionEvents() SubscriptionEventRepository {
+	return &memorySubscriptionEventRepository{s: s}
+}
+
+func (s *MemoryStore) Audit() AuditRepository {
+	return &memoryAuditRepository{s: s}
+}
+
+func (s *MemoryStore) Webhooks() WebhookRepository {
+	return &memoryWebhookRepository{s: s}
+}
+
+func (s *MemoryStore) PaymentEvents() PaymentEventRepository {
+	return &memoryPaymentEventRepository{s: s}
+}
+
+func (s *MemoryStore) IdempotencyKeys() IdempotencyKeyRepository {
+	return &memoryIdempotencyKeyRepository{s: s}
+}
+
+func (s *MemoryStore) Transaction(fn func(tx Store) error) error {
+	if s.inTx {
+		queued := len(*s.afterCommit)
+		err := fn(s)
+		if err != nil {
+			*s.afterCommit = (*s.afterCommit)[:queued]
+		}
+		return err
+	}
+
+	var afterCommit []func()
+	if err := s.transaction(fn, &afterCommit); err != nil {
+		return err
+	}
+	// Действия выполняются после снятия блокировки транзакции, чтобы они могли начать новую
+	for _, action := range afterCommit {
+		action()
+	}
+	return nil
+}
+
+func (s *MemoryStore) transaction(fn func(tx Store) error, afterCommit *[]func()) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	snapshot := s.data.clone()
+	s.mu.Unlock()
+
+	tx := &MemoryStore{mu: s.mu, txMu: s.txMu, data: s.data, inTx: true, afterCommit: afterCommit}
+	if err := fn(tx); err != nil {
+		s.mu.Lock()
+		*s.data = *snapshot
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) AfterCommit(fn func()) {
+	if !s.inTx {
+		fn()
+		return
+	}
+	*s.afterCommit = append(*s.afterCommit, fn)
+}
+
+// withLock выполняет fn под блокировкой данных хранилища
+func (s *MemoryStore) withLock(fn func(d *memoryData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.data)
+}
+
+// table - таблица в памяти. Поля ID, CreatedAt, UpdatedAt и DeletedAt
+// моделей заполняются так же, как это делает GORM
+type table[T any] struct {
+	rows   map[uint]T
+	nextID uint
+}
+
+func newTable[T any]() *table[T] {
+	return &table[T]{rows: make(map[uint]T), nextID: 1}
+}
+
+func (t *table[T]) clone() *table[T] {
+	rows := make(map[uint]T, len(t.rows))
+	for id, row := range t.rows {
+		rows[id] = row
+	}
+	return &table[T]{rows: rows, nextID: t.nextID}
+}
+
+func (t *table[T]) insert(row *T) {
+	v := reflect.ValueOf(row).Elem()
+	id := v.FieldByName("ID")
+	if id.Uint() == 0 {
+		id.SetUint(uint64(t.nextID))
+	}
+	if uint(id.Uint()) >= t.nextID {
+		t.nextID = uint(id.Uint()) + 1
+	}
+
+	now := time.Now()
+	setTimeIfZero(v, "CreatedAt", now)
+	setTimeIfZero(v, "UpdatedAt", now)
+	t.rows[uint(id.Uint())] = *row
+}
+
+// save обновляет запись или вставляет новую, если ID не задан
+func (t *table[T]) save(row *T) {
+	v := reflect.ValueOf(row).Elem()
+	if v.FieldByName("ID").Uint() == 0 {
+		t.insert(row)
+		return
+	}
+
+	if field := v.FieldByName("UpdatedAt"); field.IsValid() {
+		field.Set(reflect.ValueOf(time.Now()))
+	}
+	setTimeIfZero(v, "CreatedAt", time.Now())
+	t.rows[uint(v.FieldByName("ID").Uint())] = *row
+}
+
+func (t *table[T]) get(id uint, unscoped bool) (*T, error) {
+	row, ok := t.rows[id]
+	if !ok || (!unscoped && isDeleted(&row)) {
+		return nil, ErrNotFound
+	}
+	return &row, nil
+}
+
+// filter возвращает записи, удовлетворяющие условию, упорядоченные по ID
+func (t *table[T]) filter(match func(*T) bool, unscoped bool) []T {
+	ids := make([]uint, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	result := []T{}
+	for _, id := range ids {
+		row := t.rows[id]
+		if !unscoped && isDeleted(&row) {
+			continue
+		}
+		if match == nil || match(&row) {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+func (t *table[T]) first(match func(*T) bool) (*T, error) {
+	rows := t.filter(match, false)
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rows[0], nil
+}
+
+// softDelete помечает запись удалённой, а для моделей без DeletedAt удаляет её
+func (t *table[T]) softDelete(id uint) {
+	row, ok := t.rows[id]
+	if !ok {
+		return
+	}
+	field := reflect.ValueOf(&row).Elem().FieldByName("DeletedAt")
+	if !field.IsValid() {
+		delete(t.rows, id)
+		return
+	}
+	field.Set(reflect.ValueOf(gorm.DeletedAt{Time: time.Now(), Valid: true}))
+	t.rows[id] = row
+}
+
+// remove окончательно удаляет записи, удовлетворяющие условию
+func (t *table[T]) remove(match func(*T) bool) {
+	for id, row := range t.rows {
+		if match(&row) {
+			delete(t.rows, id)
+		}
+	}
+}
+
+func setTimeIfZero(v reflect.Value, name string, now time.Time) {
+	field := v.FieldByName(name)
+	if field.IsValid() && field.Type() == reflect.TypeOf(time.Time{}) && field.Interface().(time.Time).IsZero() {
+		field.Set(reflect.ValueOf(now))
+	}
+}
+
+func isDeleted[T any](row *T) bool {
+	field := reflect.ValueOf(row).Elem().FieldByName("DeletedAt")
+	if !field.IsValid() {
+		return false
+	}
+	deletedAt, ok := field.Interface().(gorm.DeletedAt)
+	return ok && deletedAt.Valid
+}
+
+// byCreatedAt упорядочивает записи по времени создания, при равенстве - по ID
+func byCreatedAt[T any](rows []T, desc bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a := reflect.ValueOf(&rows[i]).Elem()
+		b := reflect.ValueOf(&rows[j]).Elem()
+		at := a.FieldByName("CreatedAt").Interface().(time.Time)
+		bt := b.FieldByName("CreatedAt").Interface().(time.Time)
+		if !at.Equal(bt) {
+			return at.Before(bt) != desc
+		}
+		return (a.FieldByName("ID").Uint() < b.FieldByName("ID").Uint()) != desc
+	})
+}
@@ -0,0 +1,113 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreTransactionRollback(t *testing.T) {
+	store := repository.NewMemoryStore()
+	require.NoError(t, store.Users().Create(&models.User{Email: "kept@example.com"}))
+
+	failure := errors.New("fail")
+	err := store.Transaction(func(tx repository.Store) error {
+		require.NoError(t, tx.Users().Create(&models.User{Email: "rolled-back@example.com"}))
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	_, err = store.Users().FindByEmail("rolled-back@example.com")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = store.Users().FindByEmail("kept@example.com")
+	assert.NoError(t, err)
+}
+
+func TestMemoryStoreAfterCommit(t *testing.T) {
+	store := repository.NewMemoryStore()
+	var actions []string
+
+	store.AfterCommit(func() { actions = append(actions, "outside") })
+	assert.Equal(t, []string{"outside"}, actions, "runs immediately outside a transaction")
+
+	err := store.Transaction(func(tx repository.Store) error {
+		tx.AfterCommit(func() { actions = append(actions, "committed") })
+		assert.Len(t, actions, 1, "waits for the commit")
+
+		nested := tx.Transaction(func(tx repository.Store) error {
+			tx.AfterCommit(func() { actions = append(actions, "nested rollback") })
+			return errors.New("fail")
+		})
+		assert.Error(t, nested)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outside", "committed"}, actions)
+
+	err = store.Transaction(func(tx repository.Store) error {
+		tx.AfterCommit(func() { actions = append(actions, "rolled back") })
+		return errors.New("fail")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"outside", "committed"}, actions)
+}
+
+func TestMemoryStoreSoftDelete(t *testing.T) {
+	store := repository.NewMemoryStore()
+	user := &models.User{Email: "user@example.com"}
+	require.NoError(t, store.Users().Create(user))
+	require.NoError(t, store.Users().Delete(user.ID))
+
+	_, err := store.Users().FindByID(user.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	deleted, err := store.Users().FindByIDUnscoped(user.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted.DeletedAt.Valid)
+
+	require.NoError(t, store.Users().Restore(deleted))
+	_, err = store.Users().FindByID(user.ID)
+	assert.NoError(t, err)
+}
+
+func TestMemoryStoreReturnsCopies(t *testing.T) {
+	store := repository.NewMemoryStore()
+	plan := &models.Plan{Name: "Okko", Price: 199}
+	require.NoError(t, store.Plans().Create(plan))
+
+	found, err := store.Plans().FindByID(plan.ID)
+	require.NoError(t, err)
+	found.Price = 1
+
+	again, err := store.Plans().FindByID(plan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, float64(199), again.Price, "changes are visible only after Save")
+}
+
+func TestMemoryStoreSubscriptionVersion(t *testing.T) {
+	store := repository.NewMemoryStore()
+	subscription := &models.Subscription{UserID: 1, PlanID: 1, Status: "active"}
+	require.NoError(t, store.Subscriptions().Create(subscription))
+
+	first, err := store.Subscriptions().FindByID(subscription.ID)
+	require.NoError(t, err)
+	second, err := store.Subscriptions().FindByID(subscription.ID)
+	require.NoError(t, err)
+
+	first.AutoRenew = true
+	require.NoError(t, store.Subscriptions().Save(first))
+	assert.Equal(t, uint(1), first.Version)
+
+	second.Status = "cancelled"
+	assert.ErrorIs(t, store.Subscriptions().Save(second), repository.ErrConflict, "stale copy")
+	assert.Equal(t, uint(0), second.Version)
+
+	stored, err := store.Subscriptions().FindByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "active", stored.Status)
+	assert.Equal(t, uint(1), stored.Version)
+}
@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memorySubscriptionRepository struct {
+	s *MemoryStore
+}
+
+// query выбирает подписки по условию и подставляет в них планы
+func (r *memorySubscriptionRepository) query(match func(*models.Subscription) bool) []models.Subscription {
+	var subscriptions []models.Subscription
+	r.s.withLock(func(d *memoryData) error {
+		subscriptions = d.subscriptions.filter(match, false)
+		for i := range subscriptions {
+			preloadPlan(d, &subscriptions[i])
+		}
+		return nil
+	})
+	return subscriptions
+}
+
+func preloadPlan(d *memoryData, subscription *models.Subscription) {
+	subscription.Plan = models.Plan{}
+	if plan, err := d.plans.get(subscription.PlanID, true); err == nil {
+		subscription.Plan = *plan
+	}
+	subscription.PlanVersion = nil
+	if subscription.PlanVersionID != nil {
+		if version, err := d.planVersions.get(*subscription.PlanVersionID, false); err == nil {
+			subscription.PlanVersion = version
+		}
+	}
+}
+
+func isPersonal(userID uint) func(*models.Subscription) bool {
+	return func(s *models.Subscription) bool {
+		return s.UserID == userID && s.OrganizationID == nil
+	}
+}
+
+func (r *memorySubscriptionRepository) FindByID(id uint) (*models.Subscription, error) {
+	subscriptions := r.query(func(s *models.Subscription) bool { return s.ID == id })
+	if len(subscriptions) == 0 {
+		return nil, ErrNotFound
+	}
+	return &subscriptions[0], nil
+}
+
+// FindByIDForUpdate не блокирует запись отдельно: транзакции хранилища в памяти выполняются по очереди
+func (r *memorySubscriptionRepository) FindByIDForUpdate(id uint) (*models.Subscription, error) {
+	return r.FindByID(id)
+}
+
+func (r *memorySubscriptionRepository) FindByUser(userID uint) ([]models.Subscription, error) {
+	subscriptions := r.query(isPersonal(userID))
+	byCreatedAt(subscriptions, true)
+	return subscriptions, nil
+}
+
+func (r *memorySubscriptionRepository) FindActiveByUser(userID uint) ([]models.Subscription, error) {
+	personal := isPersonal(userID)
+	subscriptions := r.query(func(s *models.Subscription) bool {
+		return personal(s) && s.Status == "active"
+	})
+	byEndDate(subscriptions)
+	return subscriptions, nil
+}
+
+func (r *memorySubscriptionRepository) FindByOrganization(orgID uint) ([]models.Subscription, error) {
+	subscriptions := r.query(func(s *models.Subscription) bool {
+		return s.OrganizationID != nil && *s.OrganizationID == orgID
+	})
+	byCreatedAt(subscriptions, true)
+	return subscriptions, nil
+}
+
+func (r *memorySubscriptionRepository) FindActiveByOrganization(orgID uint) ([]models.Subscription, error) {
+	subscriptions := r.query(func(s *models.Subscription) bool {
+		return s.OrganizationID != nil && *s.OrganizationID == orgID && s.Status == "active"
+	})
+	byEndDate(subscriptions)
+	return subscriptions, nil
+}
+
+func (r *memorySubscriptionRepository) FindByUserAndPlanName(userID uint, name string) ([]models.Subscription, error) {
+	subscriptions := r.query(isPersonal(userID))
+	return filterByPlanName(subscriptions, name), nil
+}
+
+func (r *memorySubscriptionRepository) Search(userID uint, filter SubscriptionFilter) ([]models.Subscription, error) {
+	personal := isPersonal(userID)
+	subscriptions := r.query(func(s *models.Subscription) bool {
+		return personal(s) && (filter.Status == "" || s.Status == filter.Status)
+	})
+	if filter.Query != "" {
+		subscriptions = filterByPlanName(subscriptions, filter.Query)
+	}
+
+	switch filter.SortBy {
+	case "price_asc":
+		sort.SliceStable(subscriptions, func(i, j int) bool {
+			return subscriptions[i].Plan.Price < subscriptions[j].Plan.Price
+		})
+	case "price_desc":
+		sort.SliceStable(subscriptions, func(i, j int) bool {
+			return subscriptions[i].Plan.Price > subscriptions[j].Plan.Price
+		})
+	case "date_asc":
+		byCreatedAt(subscriptions, false)
+	default:
+		byCreatedAt(subscriptions, true)
+	}
+
+	return subscriptions, nil
+}
+
+func (r *memorySubscriptionRepository) FindDueForRenewal(from, to time.Time) ([]models.Subscription, error) {
+	return r.query(func(s *models.Subscription) bool {
+		return s.Status == "active" && s.AutoRenew && !s.EndDate.Before(from) && !s.EndDate.After(to)
+	}), nil
+}
+
+func (r *memorySubscriptionRepository) FindExpired(now time.Time) ([]models.Subscription, error) {
+	return r.query(func(s *models.Subscription) bool {
+		return s.Status == "active" && s.EndDate.Before(now)
+	}), nil
+}
+
+func (r *memorySubscriptionRepository) FindUsageBillingDue(now time.Time) ([]models.Subscription, error) {
+	return r.query(func(s *models.Subscription) bool {
+		start, end := s.UsagePeriod()
+		return end.After(start) && !end.After(now)
+	}), nil
+}
+
+func (r *memorySubscriptionRepository) Create(subscription *models.Subscription) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.subscriptions.insert(subscription)
+		return nil
+	})
+}
+
+func (r *memorySubscriptionRepository) Save(subscription *models.Subscription) error {
+	if subscription.ID == 0 {
+		return r.Create(subscription)
+	}
+	return r.s.withLock(func(d *memoryData) error {
+		stored, err := d.subscriptions.get(subscription.ID, true)
+		if err != nil {
+			return err
+		}
+		if stored.Version != subscription.Version {
+			return ErrConflict
+		}
+		subscription.Version++
+		d.subscriptions.save(subscription)
+		return nil
+	})
+}
+
+func (r *memorySubscriptionRepository) HardDeleteByUser(userID uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.subscriptions.remove(func(s *models.Subscription) bool { return s.UserID == userID })
+		return nil
+	})
+}
+
+func (r *memorySubscriptionRepository) FindActiveByPlan(planID uint) ([]models.Subscription, error) {
+	return r.query(func(s *models.Subscription) bool { return s.PlanID == planID && s.Status == "active" }), nil
+}
+
+func (r *memorySubscriptionRepository) FindActive() ([]models.Subscription, error) {
+	return r.query(func(s *models.Subscription) bool { return s.Status == "active" }), nil
+}
+
+func (r *memorySubscriptionRepository) CountActiveByPlan(planID uint) (int64, error) {
+	subscriptions := r.query(func(s *models.Subscription) bool { return s.PlanID == planID && s.Status == "active" })
+	return int64(len(subscriptions)), nil
+}
+
+func (r *memorySubscriptionRepository) MoveActiveToPlan(fromPlanID uint, to *models.PlanVersion) (int64, error) {
+	var moved int64
+	err := r.s.withLock(func(d *memoryData) error {
+		for _, s := range d.subscriptions.filter(func(s *models.Subscription) bool {
+			return s.PlanID == fromPlanID && s.Status == "active"
+		}, false) {
+			versionID := to.ID
+			s.PlanID = to.PlanID
+			s.PlanVersionID = &versionID
+			s.Version++
+			d.subscriptions.save(&s)
+			moved++
+		}
+		return nil
+	})
+	return moved, err
+}
+
+func (r *memorySubscriptionRepository) FindOrphaned() ([]models.Subscription, error) {
+	var subscriptions []models.Subscription
+	err := r.s.withLock(func(d *memoryData) error {
+		subscriptions = d.subscriptions.filter(func(s *models.Subscription) bool {
+			if s.Status != "active" {
+				return false
+			}
+			if _, err := d.plans.get(s.PlanID, false); err != nil {
+				return true
+			}
+			if s.OrganizationID != nil {
+				_, err := d.organizations.get(*s.OrganizationID, false)
+				return err != nil
+			}
+			_, err := d.users.get(s.UserID, false)
+			return err != nil
+		}, false)
+		for i := range subscriptions {
+			preloadPlan(d, &subscriptions[i])
+		}
+		return nil
+	})
+	return subscriptions, err
+}
+
+func (r *memorySubscriptionRepository) FindByProviderSubscriptionID(providerSubscriptionID string) (*models.Subscription, error) {
+	subscriptions := r.query(func(s *models.Subscription) bool { return s.StripeSubID == providerSubscriptionID })
+	if len(subscriptions) == 0 {
+		return nil, ErrNotFound
+	}
+	return &subscriptions[len(subscriptions)-1], nil
+}
+
+// filterByPlanName повторяет поиск LIKE '%name%' без учёта регистра
+func filterByPlanName(subscriptions []models.Subscription, name string) []models.Subscription {
+	name = strings.ToLower(name)
+	result := []models.Subscription{}
+	for _, s := range subscriptions {
+		if strings.Contains(strings.ToLower(s.Plan.Name), name) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func byEndDate(subscriptions []models.Subscription) {
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		return subscriptions[i].EndDate.Before(subscriptions[j].EndDate)
+	})
+}
+
+type memorySubscriptionEventRepository struct {
+	s *MemoryStore
+}
+
+func (r *memorySubscriptionEventRepository) FindBySubscription(subscriptionID uint) ([]models.SubscriptionEvent, error) {
+	var events []models.SubscriptionEvent
+	err := r.s.withLock(func(d *memoryData) error {
+		events = d.subscriptionEvents.filter(func(e *models.SubscriptionEvent) bool { return e.SubscriptionID == subscriptionID }, false)
+		return nil
+	})
+	byCreatedAt(events, true)
+	return events, err
+}
+
+func (r *memorySubscriptionEventRepository) Create(event *models.SubscriptionEvent) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.subscriptionEvents.insert(event)
+		return nil
+	})
+}
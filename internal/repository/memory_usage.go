@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryUsageRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryUsageRepository) Create(record *models.UsageRecord) error {
+	return r.s.withLock(func(d *memoryData) error {
+		if record.EventID != nil {
+			if _, err := d.usageRecords.first(func(u *models.UsageRecord) bool {
+				return u.SubscriptionID == record.SubscriptionID && u.EventID != nil && *u.EventID == *record.EventID
+			}); err == nil {
+				return errors.New("duplicate usage event")
+			}
+		}
+		d.usageRecords.insert(record)
+		return nil
+	})
+}
+
+func (r *memoryUsageRepository) FindByEventID(subscriptionID uint, eventID string) (*models.UsageRecord, error) {
+	var record *models.UsageRecord
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		record, err = d.usageRecords.first(func(u *models.UsageRecord) bool {
+			return u.SubscriptionID == subscriptionID && u.EventID != nil && *u.EventID == eventID
+		})
+		return err
+	})
+	return record, err
+}
+
+func (r *memoryUsageRepository) SumByComponent(subscriptionID uint, from, to time.Time) (map[string]float64, error) {
+	totals := make(map[string]float64)
+	err := r.s.withLock(func(d *memoryData) error {
+		for _, record := range d.usageRecords.filter(func(u *models.UsageRecord) bool {
+			return u.SubscriptionID == subscriptionID && !u.RecordedAt.Before(from) && u.RecordedAt.Before(to)
+		}, false) {
+			totals[record.ComponentKey] += record.Quantity
+		}
+		return nil
+	})
+	return totals, err
+}
+
+func (r *memoryUsageRepository) FindBySubscription(subscriptionID uint) ([]models.UsageRecord, error) {
+	var records []models.UsageRecord
+	err := r.s.withLock(func(d *memoryData) error {
+		records = d.usageRecords.filter(func(u *models.UsageRecord) bool { return u.SubscriptionID == subscriptionID }, false)
+		return nil
+	})
+	sort.SliceStable(records, func(i, j int) bool {
+		if !records[i].RecordedAt.Equal(records[j].RecordedAt) {
+			return records[i].RecordedAt.After(records[j].RecordedAt)
+		}
+		return records[i].ID > records[j].ID
+	})
+	return records, err
+}
+
+type memoryAPIKeyRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryAPIKeyRepository) FindAll() ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.s.withLock(func(d *memoryData) error {
+		keys = d.apiKeys.filter(nil, false)
+		return nil
+	})
+	return keys, err
+}
+
+func (r *memoryAPIKeyRepository) FindByID(id uint) (*models.APIKey, error) {
+	var key *models.APIKey
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		key, err = d.apiKeys.get(id, false)
+		return err
+	})
+	return key, err
+}
+
+func (r *memoryAPIKeyRepository) FindByHash(hash string) (*models.APIKey, error) {
+	var key *models.APIKey
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		key, err = d.apiKeys.first(func(k *models.APIKey) bool { return k.KeyHash == hash })
+		return err
+	})
+	return key, err
+}
+
+func (r *memoryAPIKeyRepository) Create(key *models.APIKey) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.apiKeys.insert(key)
+		return nil
+	})
+}
+
+func (r *memoryAPIKeyRepository) Save(key *models.APIKey) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.apiKeys.save(key)
+		return nil
+	})
+}
+
+type memoryInvoiceRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryInvoiceRepository) FindByID(id uint) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		invoice, err = d.invoices.get(id, false)
+		if err == nil {
+			invoice.Lines = d.invoiceLines.filter(func(l *models.InvoiceLine) bool { return l.InvoiceID == id }, false)
+		}
+		return err
+	})
+	return invoice, err
+}
+
+func (r *memoryInvoiceRepository) FindBySubscription(subscriptionID uint) ([]models.Invoice, error) {
+	var invoices []models.Invoice
+	err := r.s.withLock(func(d *memoryData) error {
+		invoices = d.invoices.filter(func(i *models.Invoice) bool { return i.SubscriptionID == subscriptionID }, false)
+		for i := range invoices {
+			invoices[i].Lines = d.invoiceLines.filter(func(l *models.InvoiceLine) bool { return l.InvoiceID == invoices[i].ID }, false)
+		}
+		return nil
+	})
+	sort.SliceStable(invoices, func(i, j int) bool {
+		if !invoices[i].PeriodStart.Equal(invoices[j].PeriodStart) {
+			return invoices[i].PeriodStart.After(invoices[j].PeriodStart)
+		}
+		return invoices[i].ID > invoices[j].ID
+	})
+	return invoices, err
+}
+
+func (r *memoryInvoiceRepository) Create(invoice *models.Invoice) error {
+	return r.s.withLock(func(d *memoryData) error {
+		lines := invoice.Lines
+		invoice.Lines = nil
+		d.invoices.insert(invoice)
+		for i := range lines {
+			lines[i].InvoiceID = invoice.ID
+			d.invoiceLines.insert(&lines[i])
+		}
+		invoice.Lines = lines
+		return nil
+	})
+}
+
+func (r *memoryInvoiceRepository) FindByPaymentID(paymentID string) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	err := r.s.withLock(func(d *memoryData) error {
+		invoices := d.invoices.filter(func(i *models.Invoice) bool { return i.PaymentID == paymentID }, false)
+		if len(invoices) == 0 {
+			return ErrNotFound
+		}
+		invoice = &invoices[len(invoices)-1]
+		return nil
+	})
+	return invoice, err
+}
+
+func (r *memoryInvoiceRepository) Save(invoice *models.Invoice) error {
+	return r.s.withLock(func(d *memoryData) error {
+		row := *invoice
+		row.Lines = nil
+		d.invoices.save(&row)
+		return nil
+	})
+}
+
+func (r *memoryInvoiceRepository) AddLines(invoice *models.Invoice, lines []models.InvoiceLine) error {
+	return r.s.withLock(func(d *memoryData) error {
+		stored, err := d.invoices.get(invoice.ID, false)
+		if err != nil {
+			return err
+		}
+		for i := range lines {
+			lines[i].InvoiceID = invoice.ID
+			d.invoiceLines.insert(&lines[i])
+			invoice.AddLine(lines[i])
+		}
+		stored.Total = invoice.Total
+		d.invoices.save(stored)
+		return nil
+	})
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"gorm.io/gorm"
+)
+
+type memoryUserRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryUserRepository) FindByID(id uint) (*models.User, error) {
+	var user *models.User
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		user, err = d.users.get(id, false)
+		return err
+	})
+	return user, err
+}
+
+// FindByIDForUpdate не блокирует запись отдельно: транзакции хранилища в памяти выполняются по очереди
+func (r *memoryUserRepository) FindByIDForUpdate(id uint) (*models.User, error) {
+	return r.FindByID(id)
+}
+
+func (r *memoryUserRepository) FindByIDUnscoped(id uint) (*models.User, error) {
+	var user *models.User
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		user, err = d.users.get(id, true)
+		return err
+	})
+	return user, err
+}
+
+func (r *memoryUserRepository) FindByEmail(email string) (*models.User, error) {
+	var user *models.User
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		user, err = d.users.first(func(u *models.User) bool { return strings.EqualFold(u.Email, email) })
+		return err
+	})
+	return user, err
+}
+
+func (r *memoryUserRepository) FindByVerificationToken(token string) (*models.User, error) {
+	var user *models.User
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		user, err = d.users.first(func(u *models.User) bool { return u.VerificationToken == token })
+		return err
+	})
+	return user, err
+}
+
+func (r *memoryUserRepository) FindAllUnscoped() ([]models.User, error) {
+	var users []models.User
+	err := r.s.withLock(func(d *memoryData) error {
+		users = d.users.filter(nil, true)
+		return nil
+	})
+	return users, err
+}
+
+func (r *memoryUserRepository) Create(user *models.User) error {
+	return r.s.withLock(func(d *memoryData) error {
+		if err := checkUniqueEmail(d, user); err != nil {
+			return err
+		}
+		d.users.insert(user)
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) Save(user *models.User) error {
+	return r.s.withLock(func(d *memoryData) error {
+		if err := checkUniqueEmail(d, user); err != nil {
+			return err
+		}
+		d.users.save(user)
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) UpdatePassword(id uint, password string) error {
+	return r.s.withLock(func(d *memoryData) error {
+		user, err := d.users.get(id, true)
+		if err != nil {
+			return nil
+		}
+		user.Password = password
+		d.users.save(user)
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) Delete(id uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.users.softDelete(id)
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) Restore(user *models.User) error {
+	return r.s.withLock(func(d *memoryData) error {
+		user.DeletedAt = gorm.DeletedAt{}
+		d.users.save(user)
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) HardDelete(id uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.users.remove(func(u *models.User) bool { return u.ID == id })
+		return nil
+	})
+}
+
+// checkUniqueEmail повторяет уникальный индекс по email, в том числе среди удалённых пользователей
+func checkUniqueEmail(d *memoryData, user *models.User) error {
+	duplicates := d.users.filter(func(u *models.User) bool {
+		return u.ID != user.ID && strings.EqualFold(u.Email, user.Email)
+	}, true)
+	if len(duplicates) > 0 {
+		return errors.New("duplicate entry for users.email")
+	}
+	return nil
+}
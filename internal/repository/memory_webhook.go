@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+type memoryWebhookRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryWebhookRepository) FindEndpoints(userID *uint) ([]models.WebhookEndpoint, error) {
+	var endpoints []models.WebhookEndpoint
+	err := r.s.withLock(func(d *memoryData) error {
+		endpoints = d.webhookEndpoints.filter(func(e *models.WebhookEndpoint) bool {
+			if userID == nil {
+				return e.UserID == nil
+			}
+			return e.UserID != nil && *e.UserID == *userID
+		}, false)
+		return nil
+	})
+	return endpoints, err
+}
+
+func (r *memoryWebhookRepository) FindEndpointByID(id uint) (*models.WebhookEndpoint, error) {
+	var endpoint *models.WebhookEndpoint
+	err := r.s.withLock(func(d *memoryData) (err error) {
+		endpoint, err = d.webhookEndpoints.get(id, false)
+		return err
+	})
+	return endpoint, err
+}
+
+func (r *memoryWebhookRepository) FindEndpointsForUser(userID uint) ([]models.WebhookEndpoint, error) {
+	var endpoints []models.WebhookEndpoint
+	err := r.s.withLock(func(d *memoryData) error {
+		endpoints = d.webhookEndpoints.filter(func(e *models.WebhookEndpoint) bool {
+			return e.UserID == nil || *e.UserID == userID
+		}, false)
+		return nil
+	})
+	return endpoints, err
+}
+
+func (r *memoryWebhookRepository) CreateEndpoint(endpoint *models.WebhookEndpoint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.webhookEndpoints.insert(endpoint)
+		return nil
+	})
+}
+
+func (r *memoryWebhookRepository) SaveEndpoint(endpoint *models.WebhookEndpoint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.webhookEndpoints.save(endpoint)
+		return nil
+	})
+}
+
+func (r *memoryWebhookRepository) DeleteEndpoint(id uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.webhookDeliveries.remove(func(delivery *models.WebhookDelivery) bool { return delivery.EndpointID == id })
+		d.webhookEndpoints.remove(func(e *models.WebhookEndpoint) bool { return e.ID == id })
+		return nil
+	})
+}
+
+func (r *memoryWebhookRepository) DeleteEndpointsByUser(userID uint) error {
+	return r.s.withLock(func(d *memoryData) error {
+		endpointIDs := map[uint]bool{}
+		d.webhookEndpoints.remove(func(e *models.WebhookEndpoint) bool {
+			if e.UserID != nil && *e.UserID == userID {
+				endpointIDs[e.ID] = true
+				return true
+			}
+			return false
+		})
+		d.webhookDeliveries.remove(func(delivery *models.WebhookDelivery) bool { return endpointIDs[delivery.EndpointID] })
+		return nil
+	})
+}
+
+func (r *memoryWebhookRepository) FindDeliveries(endpointID uint, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.s.withLock(func(d *memoryData) error {
+		deliveries = d.webhookDeliveries.filter(func(delivery *models.WebhookDelivery) bool {
+			return delivery.EndpointID == endpointID
+		}, false)
+		return nil
+	})
+	byCreatedAt(deliveries, true)
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, err
+}
+
+func (r *memoryWebhookRepository) FindDueDeliveries(now time.Time) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.s.withLock(func(d *memoryData) error {
+		deliveries = d.webhookDeliveries.filter(func(delivery *models.WebhookDelivery) bool {
+			return delivery.Status == models.WebhookDeliveryPending &&
+				delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now)
+		}, false)
+		return nil
+	})
+	return deliveries, err
+}
+
+func (r *memoryWebhookRepository) ClaimDelivery(id uint, now, until time.Time) (bool, error) {
+	claimed := false
+	err := r.s.withLock(func(d *memoryData) error {
+		delivery, err := d.webhookDeliveries.get(id, false)
+		if err != nil {
+			return err
+		}
+		if delivery.Status != models.WebhookDeliveryPending || delivery.NextAttemptAt == nil || delivery.NextAttemptAt.After(now) {
+			return nil
+		}
+		delivery.NextAttemptAt = &until
+		d.webhookDeliveries.save(delivery)
+		claimed = true
+		return nil
+	})
+	return claimed, err
+}
+
+func (r *memoryWebhookRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.webhookDeliveries.insert(delivery)
+		return nil
+	})
+}
+
+func (r *memoryWebhookRepository) SaveDelivery(delivery *models.WebhookDelivery) error {
+	return r.s.withLock(func(d *memoryData) error {
+		d.webhookDeliveries.save(delivery)
+		return nil
+	})
+}
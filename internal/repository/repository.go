@@ -0,0 +1,400 @@
+// Package repository описывает доступ к хранилищу данных.
+// Сервисы работают только с интерфейсами из этого пакета, реализации есть для GORM
+// (рабочая база) и для памяти (тесты)
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+// ErrNotFound возвращается, если запись не найдена
+var ErrNotFound = errors.New("record not found")
+
+// ErrConflict возвращается, если запись изменили после того, как её прочитали
+var ErrConflict = errors.New("record was modified concurrently")
+
+// ErrDuplicate возвращается, если запись нарушает уникальный индекс, например её одновременно
+// создал другой запрос
+var ErrDuplicate = errors.New("duplicate record")
+
+// Store объединяет репозитории одного хранилища
+type Store interface {
+	Users() UserRepository
+	Plans() PlanRepository
+	Subscriptions() SubscriptionRepository
+	EmailChanges() EmailChangeRepository
+	AccountDeletions() AccountDeletionRepository
+	Identities() IdentityRepository
+	Organizations() OrganizationRepository
+	PriceChanges() PriceChangeRepository
+	Usage() UsageRepository
+	APIKeys() APIKeyRepository
+	Invoices() InvoiceRepository
+	Coupons() CouponRepository
+	Gifts() GiftRepository
+	Family() FamilyRepository
+	Splits() SplitRepository
+	SubscriptionEvents() SubscriptionEventRepository
+	Audit() AuditRepository
+	Webhooks() WebhookRepository
+	PaymentEvents() PaymentEventRepository
+	IdempotencyKeys() IdempotencyKeyRepository
+
+	// Transaction выполняет fn атомарно: изменения, сделанные через tx,
+	// применяются, только если fn не вернула ошибку
+	Transaction(fn func(tx Store) error) error
+	// AfterCommit выполняет fn после фиксации транзакции хранилища, а вне транзакции - сразу.
+	// Если транзакция откатывается, fn не выполняется
+	AfterCommit(fn func())
+}
+
+type UserRepository interface {
+	FindByID(id uint) (*models.User, error)
+	// FindByIDForUpdate находит пользователя и блокирует его строку до конца транзакции
+	FindByIDForUpdate(id uint) (*models.User, error)
+	// FindByIDUnscoped находит пользователя, в том числе удалённого
+	FindByIDUnscoped(id uint) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	FindByVerificationToken(token string) (*models.User, error)
+	// FindAllUnscoped возвращает всех пользователей, в том числе удалённых
+	FindAllUnscoped() ([]models.User, error)
+	Create(user *models.User) error
+	Save(user *models.User) error
+	// UpdatePassword обновляет только хеш пароля, в том числе у удалённых пользователей
+	UpdatePassword(id uint, password string) error
+	// Delete помечает пользователя удалённым
+	Delete(id uint) error
+	// Restore сохраняет удалённого пользователя и снимает пометку об удалении
+	Restore(user *models.User) error
+	// HardDelete окончательно удаляет пользователя
+	HardDelete(id uint) error
+}
+
+type PlanRepository interface {
+	FindAll() ([]models.Plan, error)
+	FindByID(id uint) (*models.Plan, error)
+	// FindByIDForUpdate находит план и блокирует его строку до конца транзакции
+	FindByIDForUpdate(id uint) (*models.Plan, error)
+	// FindByIDForShare находит план и до конца транзакции запрещает другим транзакциям изменять
+	// и удалять его строку, не мешая читать её (SELECT ... FOR SHARE)
+	FindByIDForShare(id uint) (*models.Plan, error)
+	FindByPriceRange(minPrice, maxPrice float64) ([]models.Plan, error)
+	// FindActiveByName возвращает активные планы сервиса, отсортированные по длительности
+	FindActiveByName(name string) ([]models.Plan, error)
+	FindByNameAndPeriod(name string, duration int, periodType string) (*models.Plan, error)
+	Create(plan *models.Plan) error
+	Save(plan *models.Plan) error
+	Delete(id uint) error
+
+	// FindVersions возвращает версии плана по возрастанию номера
+	FindVersions(planID uint) ([]models.PlanVersion, error)
+	// FindLatestVersion возвращает версию с наибольшим номером, в том числе запланированную
+	FindLatestVersion(planID uint) (*models.PlanVersion, error)
+	// FindEffectiveVersion возвращает версию, действующую в момент at
+	FindEffectiveVersion(planID uint, at time.Time) (*models.PlanVersion, error)
+	CreateVersion(version *models.PlanVersion) error
+
+	// FindFeatures возвращает функции плана, упорядоченные по ключу
+	FindFeatures(planID uint) ([]models.PlanFeature, error)
+	// ReplaceFeatures заменяет набор функций плана
+	ReplaceFeatures(planID uint, features []models.PlanFeature) error
+
+	// FindMeteredComponents возвращает оплачиваемые по факту составляющие плана, упорядоченные по ключу
+	FindMeteredComponents(planID uint) ([]models.MeteredComponent, error)
+	// ReplaceMeteredComponents заменяет набор составляющих плана
+	ReplaceMeteredComponents(planID uint, components []models.MeteredComponent) error
+}
+
+// SubscriptionFilter - параметры поиска подписок пользователя
+type SubscriptionFilter struct {
+	Query  string
+	Status string
+	// SortBy: price_asc, price_desc, date_asc, date_desc (по умолчанию)
+	SortBy string
+}
+
+// SubscriptionRepository возвращает подписки вместе с планом, в том числе удалённым, и его версией.
+// Методы ...ByUser работают только с личными подписками, без подписок организаций
+type SubscriptionRepository interface {
+	FindByID(id uint) (*models.Subscription, error)
+	// FindByIDForUpdate находит подписку и блокирует её строку до конца транзакции (SELECT ... FOR UPDATE)
+	FindByIDForUpdate(id uint) (*models.Subscription, error)
+	FindByUser(userID uint) ([]models.Subscription, error)
+	FindActiveByUser(userID uint) ([]models.Subscription, error)
+	FindByOrganization(orgID uint) ([]models.Subscription, error)
+	FindActiveByOrganization(orgID uint) ([]models.Subscription, error)
+	FindByUserAndPlanName(userID uint, name string) ([]models.Subscription, error)
+	Search(userID uint, filter SubscriptionFilter) ([]models.Subscription, error)
+	// FindDueForRenewal возвращает активные подписки с автопродлением, истекающие в интервале [from, to]
+	FindDueForRenewal(from, to time.Time) ([]models.Subscription, error)
+	// FindExpired возвращает активные подписки, истёкшие до now
+	FindExpired(now time.Time) ([]models.Subscription, error)
+	// FindUsageBillingDue возвращает подписки, открытый период учёта использования которых
+	// закончился до now
+	FindUsageBillingDue(now time.Time) ([]models.Subscription, error)
+	Create(subscription *models.Subscription) error
+	// Save сохраняет подписку, если её версия не изменилась с момента чтения, и увеличивает версию.
+	// Иначе возвращает ErrConflict
+	Save(subscription *models.Subscription) error
+	// HardDeleteByUser окончательно удаляет все подписки пользователя
+	HardDeleteByUser(userID uint) error
+	FindActiveByPlan(planID uint) ([]models.Subscription, error)
+	// FindActive возвращает все активные подписки, личные и организаций, по возрастанию id
+	FindActive() ([]models.Subscription, error)
+	CountActiveByPlan(planID uint) (int64, error)
+	// MoveActiveToPlan переводит активные подписки на версию другого плана и возвращает их количество
+	MoveActiveToPlan(fromPlanID uint, to *models.PlanVersion) (int64, error)
+	// FindOrphaned возвращает активные подписки, у которых удалён план, владелец-пользователь
+	// или организация
+	FindOrphaned() ([]models.Subscription, error)
+	// FindByProviderSubscriptionID находит подписку по её идентификатору у платёжного провайдера
+	FindByProviderSubscriptionID(providerSubscriptionID string) (*models.Subscription, error)
+}
+
+type EmailChangeRepository interface {
+	FindByToken(token string) (*models.EmailChangeRequest, error)
+	FindByUser(userID uint) ([]models.EmailChangeRequest, error)
+	Create(request *models.EmailChangeRequest) error
+	Save(request *models.EmailChangeRequest) error
+	// DeletePendingByUser удаляет неподтверждённые запросы пользователя
+	DeletePendingByUser(userID uint) error
+	DeleteByUser(userID uint) error
+}
+
+type AccountDeletionRepository interface {
+	FindByRestoreToken(token string) (*models.AccountDeletion, error)
+	// FindDueForPurge возвращает удаления, у которых истёк период ожидания
+	FindDueForPurge(now time.Time) ([]models.AccountDeletion, error)
+	Create(deletion *models.AccountDeletion) error
+	Save(deletion *models.AccountDeletion) error
+}
+
+type IdentityRepository interface {
+	FindByProviderSubject(provider, subject string) (*models.UserIdentity, error)
+	FindByUser(userID uint) ([]models.UserIdentity, error)
+	Create(identity *models.UserIdentity) error
+	DeleteByUser(userID uint) error
+
+	CreateLoginState(state *models.OIDCLoginState) error
+	FindLoginState(state, provider string) (*models.OIDCLoginState, error)
+	DeleteLoginState(id uint) error
+	DeleteExpiredLoginStates(now time.Time) error
+}
+
+type OrganizationRepository interface {
+	FindByID(id uint) (*models.Organization, error)
+	// FindByIDForUpdate находит организацию и блокирует её строку до конца транзакции
+	FindByIDForUpdate(id uint) (*models.Organization, error)
+	FindByMember(userID uint) ([]models.Organization, error)
+	Create(organization *models.Organization) error
+
+	FindMember(orgID, userID uint) (*models.OrganizationMember, error)
+	// FindMembers возвращает участников вместе с пользователями
+	FindMembers(orgID uint) ([]models.OrganizationMember, error)
+	CountMembers(orgID uint) (int64, error)
+	CreateMember(member *models.OrganizationMember) error
+	SaveMember(member *models.OrganizationMember) error
+	DeleteMember(orgID, userID uint) error
+	// DeleteMembershipsByUser удаляет пользователя из всех организаций
+	DeleteMembershipsByUser(userID uint) error
+
+	FindInvitationByToken(token string) (*models.OrganizationInvitation, error)
+	CreateInvitation(invitation *models.OrganizationInvitation) error
+	SaveInvitation(invitation *models.OrganizationInvitation) error
+}
+
+type PriceChangeRepository interface {
+	FindByID(id uint) (*models.PriceChange, error)
+	// FindByIDForUpdate находит изменение цены и блокирует его строку до конца транзакции
+	FindByIDForUpdate(id uint) (*models.PriceChange, error)
+	// FindByPlan возвращает изменения цены плана, последние первыми
+	FindByPlan(planID uint) ([]models.PriceChange, error)
+	// FindPendingByPlan возвращает изменение цены плана, ещё не перенесённое в каталог
+	FindPendingByPlan(planID uint) (*models.PriceChange, error)
+	// FindDue возвращает неприменённые изменения, вступившие в силу до now
+	FindDue(now time.Time) ([]models.PriceChange, error)
+	Create(change *models.PriceChange) error
+	Save(change *models.PriceChange) error
+
+	FindNoticeByToken(token string) (*models.PriceChangeNotice, error)
+	// FindNoticeByTokenForUpdate находит уведомление по токену и блокирует его строку до конца транзакции
+	FindNoticeByTokenForUpdate(token string) (*models.PriceChangeNotice, error)
+	FindNoticesByChange(changeID uint) ([]models.PriceChangeNotice, error)
+	CreateNotice(notice *models.PriceChangeNotice) error
+	SaveNotice(notice *models.PriceChangeNotice) error
+}
+
+type UsageRepository interface {
+	Create(record *models.UsageRecord) error
+	// FindByEventID ищет использование подписки по идентификатору события отправителя
+	FindByEventID(subscriptionID uint, eventID string) (*models.UsageRecord, error)
+	// SumByComponent суммирует использование подписки в интервале [from, to) по составляющим
+	SumByComponent(subscriptionID uint, from, to time.Time) (map[string]float64, error)
+	// FindBySubscription возвращает использование подписки, последние записи первыми
+	FindBySubscription(subscriptionID uint) ([]models.UsageRecord, error)
+}
+
+type APIKeyRepository interface {
+	FindAll() ([]models.APIKey, error)
+	FindByID(id uint) (*models.APIKey, error)
+	FindByHash(hash string) (*models.APIKey, error)
+	Create(key *models.APIKey) error
+	Save(key *models.APIKey) error
+}
+
+type InvoiceRepository interface {
+	FindByID(id uint) (*models.Invoice, error)
+	// FindBySubscription возвращает счета подписки со строками, последние первыми
+	FindBySubscription(subscriptionID uint) ([]models.Invoice, error)
+	FindByPaymentID(paymentID string) (*models.Invoice, error)
+	// Create сохраняет счёт вместе со строками
+	Create(invoice *models.Invoice) error
+	// Save сохраняет состояние оплаты счёта; строки счёта не меняются
+	Save(invoice *models.Invoice) error
+	// AddLines добавляет строки к сохранённому счёту и сохраняет его новый итог
+	AddLines(invoice *models.Invoice, lines []models.InvoiceLine) error
+}
+
+// CouponRepository хранит купоны вместе со списком планов, на которые они действуют
+type CouponRepository interface {
+	FindAll() ([]models.Coupon, error)
+	FindByID(id uint) (*models.Coupon, error)
+	FindByCode(code string) (*models.Coupon, error)
+	Create(coupon *models.Coupon) error
+	// Save сохраняет купон и заменяет список его планов на coupon.PlanIDs.
+	// Счётчик применений не сохраняется: его меняет только IncrementRedemptions
+	Save(coupon *models.Coupon) error
+	// IncrementRedemptions увеличивает счётчик применений купона одним условным обновлением.
+	// false - лимит применений уже исчерпан
+	IncrementRedemptions(id uint) (bool, error)
+	Delete(id uint) error
+	FindRedemptions(couponID uint) ([]models.CouponRedemption, error)
+	// FindRedemptionBySubscription возвращает применение купона к подписке вместе с купоном,
+	// даже если купон уже удалён
+	FindRedemptionBySubscription(subscriptionID uint) (*models.CouponRedemption, error)
+	CreateRedemption(redemption *models.CouponRedemption) error
+	SaveRedemption(redemption *models.CouponRedemption) error
+}
+
+// GiftRepository хранит подарочные подписки; подарки возвращаются с планом и версией плана
+type GiftRepository interface {
+	FindByID(id uint) (*models.Gift, error)
+	FindByCode(code string) (*models.Gift, error)
+	// FindByCodeForUpdate находит подарок по коду и блокирует его строку до конца транзакции
+	FindByCodeForUpdate(code string) (*models.Gift, error)
+	// FindByPurchaser возвращает подарки покупателя, последние первыми
+	FindByPurchaser(purchaserID uint) ([]models.Gift, error)
+	// FindByRedeemer возвращает подарки, активированные пользователем, последние первыми
+	FindByRedeemer(userID uint) ([]models.Gift, error)
+	Create(gift *models.Gift) error
+	Save(gift *models.Gift) error
+}
+
+// FamilyRepository хранит участников семейных подписок и приглашения в них
+type FamilyRepository interface {
+	FindMember(subscriptionID, userID uint) (*models.FamilyMember, error)
+	// FindMembers возвращает участников подписки вместе с пользователями
+	FindMembers(subscriptionID uint) ([]models.FamilyMember, error)
+	// FindMembershipsByUser возвращает места пользователя в чужих подписках
+	FindMembershipsByUser(userID uint) ([]models.FamilyMember, error)
+	CreateMember(member *models.FamilyMember) error
+	DeleteMember(subscriptionID, userID uint) error
+	DeleteMembershipsByUser(userID uint) error
+	FindInvitations(subscriptionID uint) ([]models.FamilyInvitation, error)
+	FindInvitationByToken(token string) (*models.FamilyInvitation, error)
+	CreateInvitation(invitation *models.FamilyInvitation) error
+	SaveInvitation(invitation *models.FamilyInvitation) error
+}
+
+// SplitRepository хранит разделения стоимости подписок; разделения возвращаются вместе с участниками
+type SplitRepository interface {
+	FindBySubscription(subscriptionID uint) (*models.CostSplit, error)
+	FindByOwner(ownerID uint) ([]models.CostSplit, error)
+	// FindByParticipant возвращает разделения, в которых участвует пользователь
+	FindByParticipant(userID uint) ([]models.CostSplit, error)
+	// Save сохраняет разделение и его участников, новых участников добавляет
+	Save(split *models.CostSplit) error
+	// FindEntries возвращает журнал начислений и оплат разделения, последние записи первыми
+	FindEntries(splitID uint) ([]models.SplitLedgerEntry, error)
+	CreateEntry(entry *models.SplitLedgerEntry) error
+	// DetachUser отвязывает удаляемого пользователя от разделений: участник остаётся с долгом
+	// под именем name
+	DetachUser(userID uint, name string) error
+}
+
+// SubscriptionEventRepository хранит историю подписок. События только добавляются
+type SubscriptionEventRepository interface {
+	// FindBySubscription возвращает события подписки, последние первыми
+	FindBySubscription(subscriptionID uint) ([]models.SubscriptionEvent, error)
+	Create(event *models.SubscriptionEvent) error
+}
+
+// AuditFilter - параметры поиска в журнале аудита. Пустые поля не ограничивают выборку
+type AuditFilter struct {
+	ActorID    *uint
+	Action     string
+	TargetType string
+	TargetID   string
+	RequestID  string
+	// From и To ограничивают время записи интервалом [From, To)
+	From  *time.Time
+	To    *time.Time
+	Limit int
+	// Offset - число пропускаемых записей для постраничного просмотра
+	Offset int
+}
+
+// AuditRepository хранит журнал аудита. Записи только добавляются и удаляются по сроку хранения
+type AuditRepository interface {
+	Create(entry *models.AuditEntry) error
+	// Find возвращает записи, последние первыми
+	Find(filter AuditFilter) ([]models.AuditEntry, error)
+	// DeleteBefore удаляет записи, созданные до before, и возвращает их количество
+	DeleteBefore(before time.Time) (int64, error)
+}
+
+// WebhookRepository хранит получателей событий и доставки событий им
+type WebhookRepository interface {
+	// FindEndpoints возвращает получателей пользователя, а при userID nil - получателей администратора
+	FindEndpoints(userID *uint) ([]models.WebhookEndpoint, error)
+	FindEndpointByID(id uint) (*models.WebhookEndpoint, error)
+	// FindEndpointsForUser возвращает получателей, которым отправляются события подписок пользователя:
+	// его собственных и получателей администратора
+	FindEndpointsForUser(userID uint) ([]models.WebhookEndpoint, error)
+	CreateEndpoint(endpoint *models.WebhookEndpoint) error
+	SaveEndpoint(endpoint *models.WebhookEndpoint) error
+	// DeleteEndpoint удаляет получателя вместе с журналом доставок
+	DeleteEndpoint(id uint) error
+	DeleteEndpointsByUser(userID uint) error
+
+	// FindDeliveries возвращает последние limit доставок получателя, последние первыми
+	FindDeliveries(endpointID uint, limit int) ([]models.WebhookDelivery, error)
+	// FindDueDeliveries возвращает ожидающие доставки, время попытки которых наступило к now
+	FindDueDeliveries(now time.Time) ([]models.WebhookDelivery, error)
+	// ClaimDelivery занимает ожидающую доставку до until, переводя на until время следующей попытки,
+	// если оно наступило к now. false - доставку уже занял или отправил другой обработчик
+	ClaimDelivery(id uint, now, until time.Time) (bool, error)
+	CreateDelivery(delivery *models.WebhookDelivery) error
+	SaveDelivery(delivery *models.WebhookDelivery) error
+}
+
+// PaymentEventRepository хранит обработанные события платёжного провайдера
+type PaymentEventRepository interface {
+	FindByEventID(eventID string) (*models.PaymentEvent, error)
+	// Create сохраняет событие; событие с уже сохранённым EventID возвращает ErrDuplicate
+	Create(event *models.PaymentEvent) error
+}
+
+// IdempotencyKeyRepository хранит ответы на запросы с заголовком Idempotency-Key
+type IdempotencyKeyRepository interface {
+	Find(userID uint, key string) (*models.IdempotencyKey, error)
+	Create(record *models.IdempotencyKey) error
+	Save(record *models.IdempotencyKey) error
+	Delete(id uint) error
+	DeleteByUser(userID uint) error
+	// DeleteExpired удаляет ключи, срок хранения которых истёк до now, и возвращает их число
+	DeleteExpired(now time.Time) (int64, error)
+}
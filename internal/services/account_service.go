@@ -0,0 +1,395 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/pkg/email"
+)
+
+// UserDataExport содержит все персональные данные пользователя для выгрузки
+type UserDataExport struct {
+	ExportedAt    time.Time                   `json:"exported_at"`
+	Profile       models.User                 `json:"profile"`
+	Subscriptions []models.Subscription       `json:"subscriptions"`
+	EmailChanges  []models.EmailChangeRequest `json:"email_changes"`
+	Identities    []models.UserIdentity       `json:"identities"`
+	// Invoices и Usage относятся к подпискам из Subscriptions
+	Invoices []models.Invoice     `json:"invoices"`
+	Usage    []models.UsageRecord `json:"usage"`
+	// Gifts - подарки, купленные или активированные пользователем
+	Gifts []models.Gift `json:"gifts"`
+	// CostSplits - разделения подписок пользователя и разделения, в которых он участвует, SplitLedger - их журнал
+	CostSplits  []models.CostSplit        `json:"cost_splits"`
+	SplitLedger []models.SplitLedgerEntry `json:"split_ledger"`
+}
+
+type AccountService struct {
+	store               repository.Store
+	clock               Clock
+	subscriptionService *SubscriptionService
+	userService         *UserService
+}
+
+// NewAccountService создает новый экземпляр сервиса управления аккаунтом
+func NewAccountService(store repository.Store, clock Clock, subscriptionService *SubscriptionService, userService *UserService) *AccountService {
+	return &AccountService{
+		store:               store,
+		clock:               clock,
+		subscriptionService: subscriptionService,
+		userService:         userService,
+	}
+}
+
+// GetDeletionGracePeriod возвращает срок, в течение которого удалённый аккаунт можно восстановить
+func (s *AccountService) GetDeletionGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ExportUserData собирает профиль пользователя и все связанные с ним данные
+func (s *AccountService) ExportUserData(userID uint) (*UserDataExport, error) {
+	user, err := s.store.Users().FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	subscriptions, err := s.subscriptionService.GetUserSubscriptions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	emailChanges, err := s.store.EmailChanges().FindByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := s.store.Identities().FindByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &UserDataExport{
+		ExportedAt:    s.clock.Now(),
+		Profile:       *user,
+		Subscriptions: subscriptions,
+		EmailChanges:  emailChanges,
+		Identities:    identities,
+		Invoices:      []models.Invoice{},
+		Usage:         []models.UsageRecord{},
+		SplitLedger:   []models.SplitLedgerEntry{},
+	}
+	for _, subscription := range subscriptions {
+		invoices, err := s.store.Invoices().FindBySubscription(subscription.ID)
+		if err != nil {
+			return nil, err
+		}
+		export.Invoices = append(export.Invoices, invoices...)
+		usage, err := s.store.Usage().FindBySubscription(subscription.ID)
+		if err != nil {
+			return nil, err
+		}
+		export.Usage = append(export.Usage, usage...)
+	}
+
+	if export.Gifts, err = s.exportGifts(userID); err != nil {
+		return nil, err
+	}
+
+	owned, err := s.store.Splits().FindByOwner(userID)
+	if err != nil {
+		return nil, err
+	}
+	participating, err := s.store.Splits().FindByParticipant(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.CostSplits = append(append([]models.CostSplit{}, owned...), participating...)
+	for _, split := range export.CostSplits {
+		entries, err := s.store.Splits().FindEntries(split.ID)
+		if err != nil {
+			return nil, err
+		}
+		export.SplitLedger = append(export.SplitLedger, entries...)
+	}
+
+	return export, nil
+}
+
+// exportGifts возвращает подарки, купленные или активированные пользователем, без повторов
+func (s *AccountService) exportGifts(userID uint) ([]models.Gift, error) {
+	purchased, err := s.store.Gifts().FindByPurchaser(userID)
+	if err != nil {
+		return nil, err
+	}
+	redeemed, err := s.store.Gifts().FindByRedeemer(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	gifts := append([]models.Gift{}, purchased...)
+	for _, gift := range redeemed {
+		if gift.PurchaserID != userID {
+			gifts = append(gifts, gift)
+		}
+	}
+	return gifts, nil
+}
+
+// ExportUserDataZip упаковывает выгрузку данных пользователя в ZIP-архив по файлу на раздел
+func (s *AccountService) ExportUserDataZip(userID uint) ([]byte, error) {
+	export, err := s.ExportUserData(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]interface{}{
+		"profile.json":       export.Profile,
+		"subscriptions.json": export.Subscriptions,
+		"email_changes.json": export.EmailChanges,
+		"identities.json":    export.Identities,
+		"invoices.json":      export.Invoices,
+		"usage.json":         export.Usage,
+		"gifts.json":         export.Gifts,
+		"cost_splits.json":   export.CostSplits,
+		"split_ledger.json":  export.SplitLedger,
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, name := range []string{
+		"profile.json", "subscriptions.json", "email_changes.json", "identities.json",
+		"invoices.json", "usage.json", "gifts.json", "cost_splits.json", "split_ledger.json",
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(files[name], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DeleteAccount отменяет активные подписки, анонимизирует пользователя и планирует окончательное удаление
+func (s *AccountService) DeleteAccount(userID uint, password string) (*models.AccountDeletion, error) {
+	if userID == 1 {
+		return nil, errors.New("admin account cannot be deleted")
+	}
+
+	user, err := s.store.Users().FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	// У пользователей, вошедших только через внешнего провайдера, пароля нет
+	if user.Password != "" {
+		if err := user.CheckPassword(password); err != nil {
+			return nil, errors.New("invalid password")
+		}
+	}
+
+	token, err := s.userService.generateVerificationToken()
+	if err != nil {
+		return nil, fmt.Errorf("error generating restore token: %w", err)
+	}
+
+	deletion := models.AccountDeletion{
+		UserID:       user.ID,
+		Email:        user.Email,
+		Password:     user.Password,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		RestoreToken: token,
+		PurgeAfter:   s.clock.Now().Add(s.GetDeletionGracePeriod()),
+	}
+
+	originalEmail, userName := user.Email, user.FirstName
+	if userName == "" {
+		userName = "пользователь"
+	}
+
+	// Подписки отменяются в той же транзакции: при ошибке аккаунт и подписки остаются как были
+	err = s.store.Transaction(func(tx repository.Store) error {
+		if err := s.releaseSubscriptions(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.AccountDeletions().Create(&deletion); err != nil {
+			return err
+		}
+
+		user.Anonymize()
+		if err := tx.Users().Save(user); err != nil {
+			return err
+		}
+		return tx.Users().Delete(user.ID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error deleting account: %w", err)
+	}
+
+	if err := email.SendAccountDeletionScheduled(originalEmail, userName, token, deletion.PurgeAfter); err != nil {
+		fmt.Printf("Ошибка отправки письма об удалении аккаунта: %v\n", err)
+	}
+
+	return &deletion, nil
+}
+
+// releaseSubscriptions отменяет активные подписки пользователя и освобождает его места в семейных подписках
+func (s *AccountService) releaseSubscriptions(tx repository.Store, userID uint) error {
+	subscriptions, err := tx.Subscriptions().FindActiveByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subscriptions {
+		if err := s.subscriptionService.cancel(tx, sub.ID, userID); err != nil {
+			return fmt.Errorf("error cancelling subscription %d: %w", sub.ID, err)
+		}
+	}
+
+	// Семейную подписку оплачивает владелец: удаляемый участник только освобождает место
+	shared, err := findSharedSubscriptions(tx, userID)
+	if err != nil {
+		return err
+	}
+	for _, sub := range shared {
+		if err := tx.Family().DeleteMember(sub.ID, userID); err != nil {
+			return fmt.Errorf("error leaving shared subscription %d: %w", sub.ID, err)
+		}
+	}
+	return nil
+}
+
+// RestoreAccount восстанавливает удалённый аккаунт по токену из письма, пока не истёк период ожидания
+func (s *AccountService) RestoreAccount(token string) error {
+	if token == "" {
+		return errors.New("restore token is required")
+	}
+
+	deletion, err := s.store.AccountDeletions().FindByRestoreToken(token)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("invalid restore token")
+		}
+		return err
+	}
+
+	if deletion.RestoredAt != nil || deletion.PurgedAt != nil || !s.clock.Now().Before(deletion.PurgeAfter) {
+		return errors.New("account can no longer be restored")
+	}
+
+	return s.store.Transaction(func(tx repository.Store) error {
+		if _, err := tx.Users().FindByEmail(deletion.Email); err == nil {
+			return errors.New("email is already used by another account")
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		user, err := tx.Users().FindByIDUnscoped(deletion.UserID)
+		if err != nil {
+			return err
+		}
+		user.Email = deletion.Email
+		user.Password = deletion.Password
+		user.FirstName = deletion.FirstName
+		user.LastName = deletion.LastName
+		user.IsEmailVerified = true
+		if err := tx.Users().Restore(user); err != nil {
+			return err
+		}
+
+		now := s.clock.Now()
+		deletion.RestoredAt = &now
+		clearDeletionData(deletion)
+		return tx.AccountDeletions().Save(deletion)
+	})
+}
+
+// PurgeDeletedAccounts окончательно удаляет аккаунты, у которых истёк период ожидания.
+// Возвращает количество удалённых аккаунтов
+func (s *AccountService) PurgeDeletedAccounts() (int, error) {
+	deletions, err := s.store.AccountDeletions().FindDueForPurge(s.clock.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, deletion := range deletions {
+		err := s.store.Transaction(func(tx repository.Store) error {
+			if err := tx.Subscriptions().HardDeleteByUser(deletion.UserID); err != nil {
+				return err
+			}
+			if err := tx.EmailChanges().DeleteByUser(deletion.UserID); err != nil {
+				return err
+			}
+			if err := tx.Identities().DeleteByUser(deletion.UserID); err != nil {
+				return err
+			}
+			if err := tx.Organizations().DeleteMembershipsByUser(deletion.UserID); err != nil {
+				return err
+			}
+			if err := tx.Family().DeleteMembershipsByUser(deletion.UserID); err != nil {
+				return err
+			}
+			if err := tx.Splits().DetachUser(deletion.UserID, "Удалённый пользователь"); err != nil {
+				return err
+			}
+			if err := tx.Webhooks().DeleteEndpointsByUser(deletion.UserID); err != nil {
+				return err
+			}
+			// Сохранённые ответы могут содержать персональные данные
+			if err := tx.IdempotencyKeys().DeleteByUser(deletion.UserID); err != nil {
+				return err
+			}
+			if err := tx.Users().HardDelete(deletion.UserID); err != nil {
+				return err
+			}
+
+			now := s.clock.Now()
+			deletion.PurgedAt = &now
+			clearDeletionData(&deletion)
+			return tx.AccountDeletions().Save(&deletion)
+		})
+		if err != nil {
+			return purged, fmt.Errorf("error purging user %d: %w", deletion.UserID, err)
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// clearDeletionData стирает сохранённые персональные данные и токен восстановления
+func clearDeletionData(deletion *models.AccountDeletion) {
+	deletion.RestoreToken = ""
+	deletion.Email = ""
+	deletion.Password = ""
+	deletion.FirstName = ""
+	deletion.LastName = ""
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+// ErrInvalidAPIKey возвращается для неизвестного или отозванного ключа
+var ErrInvalidAPIKey = errors.New("invalid or revoked API key")
+
+// apiKeyPrefix отличает ключи API от других токенов сервиса
+const apiKeyPrefix = "smk_"
+
+// APIKeyService выдаёт и проверяет ключи внешних систем
+type APIKeyService struct {
+	store       repository.Store
+	clock       Clock
+	userService *UserService
+}
+
+// NewAPIKeyService создает новый экземпляр сервиса ключей API
+func NewAPIKeyService(store repository.Store, clock Clock, userService *UserService) *APIKeyService {
+	return &APIKeyService{store: store, clock: clock, userService: userService}
+}
+
+// CreateAPIKey создает ключ и возвращает его значение. Значение больше нигде не хранится
+func (s *APIKeyService) CreateAPIKey(name string) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.New("name is required")
+	}
+
+	token, err := s.userService.generateVerificationToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating API key: %w", err)
+	}
+	raw := apiKeyPrefix + token
+
+	key := models.APIKey{
+		Name:    name,
+		Prefix:  raw[:len(apiKeyPrefix)+6],
+		KeyHash: models.HashAPIKey(raw),
+	}
+	if err := s.store.APIKeys().Create(&key); err != nil {
+		return nil, "", err
+	}
+	return &key, raw, nil
+}
+
+func (s *APIKeyService) GetAPIKeys() ([]models.APIKey, error) {
+	return s.store.APIKeys().FindAll()
+}
+
+// RevokeAPIKey отзывает ключ, запросы с ним перестают приниматься
+func (s *APIKeyService) RevokeAPIKey(id uint) (*models.APIKey, error) {
+	key, err := s.store.APIKeys().FindByID(id)
+	if err != nil {
+		return nil, errors.New("API key not found")
+	}
+	if key.RevokedAt == nil {
+		now := s.clock.Now()
+		key.RevokedAt = &now
+		if err := s.store.APIKeys().Save(key); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Authenticate находит действующий ключ по значению и отмечает время его использования
+func (s *APIKeyService) Authenticate(raw string) (*models.APIKey, error) {
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	key, err := s.store.APIKeys().FindByHash(models.HashAPIKey(raw))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := s.clock.Now()
+	key.LastUsedAt = &now
+	if err := s.store.APIKeys().Save(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
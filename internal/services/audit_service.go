@@ -0,0 +1,117 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+// AuditChangeKey - ключ контекста запроса, под которым обработчик передаёт в журнал аудита
+// описание своего действия
+const AuditChangeKey = "auditChange"
+
+// AuditChange - действие, которое записывается в журнал аудита. Before и After - состояние
+// объекта до и после действия, в журнал попадают только изменившиеся поля
+type AuditChange struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     interface{}
+	After      interface{}
+}
+
+// AuditRequest - сведения о запросе, в котором выполнено действие
+type AuditRequest struct {
+	ActorID   *uint
+	RequestID string
+	IP        string
+	Status    int
+}
+
+type AuditService struct {
+	store repository.Store
+	clock Clock
+}
+
+func NewAuditService(store repository.Store, clock Clock) *AuditService {
+	return &AuditService{store: store, clock: clock}
+}
+
+// GetRetention возвращает срок хранения записей журнала аудита
+func (s *AuditService) GetRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("AUDIT_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = 365
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Record добавляет запись в журнал аудита
+func (s *AuditService) Record(request AuditRequest, change AuditChange) (*models.AuditEntry, error) {
+	changes, err := models.AuditDiff(change.Before, change.After)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &models.AuditEntry{
+		CreatedAt:  s.clock.Now(),
+		ActorID:    request.ActorID,
+		Action:     change.Action,
+		TargetType: change.TargetType,
+		TargetID:   change.TargetID,
+		RequestID:  request.RequestID,
+		IP:         request.IP,
+		Status:     request.Status,
+		Changes:    changes,
+	}
+	if err := s.store.Audit().Create(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// RecordSubscriptionEvent - подписчик шины событий: записывает в журнал изменения подписок,
+// выполненные фоновыми задачами и платёжным провайдером. Действия пользователей и администраторов
+// записываются по запросу middleware.Audit и в историю подписки
+func (s *AuditService) RecordSubscriptionEvent(event SubscriptionEvent) error {
+	change := event.Change()
+	if change.ActorID != 0 {
+		return nil
+	}
+	var before interface{}
+	if change.Before != nil {
+		before = change.Before
+	}
+	_, err := s.Record(AuditRequest{}, AuditChange{
+		Action:     event.EventName(),
+		TargetType: "subscription",
+		TargetID:   strconv.FormatUint(uint64(change.Subscription.ID), 10),
+		Before:     before,
+		After:      change.Subscription,
+	})
+	return err
+}
+
+// RecordEmailVerified - подписчик EmailVerified: записывает подтверждение email пользователем
+func (s *AuditService) RecordEmailVerified(event EmailVerified) error {
+	actorID := event.User.ID
+	_, err := s.Record(AuditRequest{ActorID: &actorID}, AuditChange{
+		Action:     event.EventName(),
+		TargetType: "user",
+		TargetID:   strconv.FormatUint(uint64(event.User.ID), 10),
+	})
+	return err
+}
+
+// GetEntries возвращает записи журнала аудита, последние первыми
+func (s *AuditService) GetEntries(filter repository.AuditFilter) ([]models.AuditEntry, error) {
+	return s.store.Audit().Find(filter)
+}
+
+// PurgeExpired удаляет записи старше срока хранения и возвращает их количество
+func (s *AuditService) PurgeExpired() (int64, error) {
+	return s.store.Audit().DeleteBefore(s.clock.Now().Add(-s.GetRetention()))
+}
@@ -0,0 +1,19 @@
+package services
+
+import "time"
+
+// Clock - источник текущего времени. В тестах подменяется фиксированным
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock возвращает часы, использующие системное время
+func SystemClock() Clock {
+	return systemClock{}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+// ErrInvalidPromoCode возвращается, если промокод нельзя применить к оформляемой подписке
+var ErrInvalidPromoCode = errors.New("invalid promo code")
+
+type CouponService struct {
+	store repository.Store
+	clock Clock
+}
+
+func NewCouponService(store repository.Store, clock Clock) *CouponService {
+	return &CouponService{store: store, clock: clock}
+}
+
+func (s *CouponService) GetCoupons() ([]models.Coupon, error) {
+	return s.store.Coupons().FindAll()
+}
+
+func (s *CouponService) GetCoupon(id uint) (*models.Coupon, error) {
+	coupon, err := s.store.Coupons().FindByID(id)
+	if err != nil {
+		return nil, errors.New("coupon not found")
+	}
+	return coupon, nil
+}
+
+// CreateCoupon создает активный купон. Код приводится к верхнему регистру
+func (s *CouponService) CreateCoupon(coupon *models.Coupon) error {
+	coupon.ID = 0
+	coupon.Code = models.NormalizeCouponCode(coupon.Code)
+	coupon.RedemptionCount = 0
+	coupon.IsActive = true
+	if err := coupon.Validate(); err != nil {
+		return err
+	}
+	if err := s.checkPlans(coupon.PlanIDs); err != nil {
+		return err
+	}
+
+	if _, err := s.store.Coupons().FindByCode(coupon.Code); err == nil {
+		return fmt.Errorf("coupon with code %s already exists", coupon.Code)
+	}
+	return s.store.Coupons().Create(coupon)
+}
+
+// CouponUpdate - изменяемые поля купона. Условия скидки после создания не меняются
+type CouponUpdate struct {
+	Name           *string    `json:"name"`
+	MaxRedemptions *int       `json:"max_redemptions"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	IsActive       *bool      `json:"is_active"`
+	PlanIDs        *[]uint    `json:"plan_ids"`
+}
+
+func (s *CouponService) UpdateCoupon(id uint, update CouponUpdate) (*models.Coupon, error) {
+	if update.MaxRedemptions != nil && *update.MaxRedemptions < 0 {
+		return nil, errors.New("max_redemptions must not be negative")
+	}
+	if update.PlanIDs != nil {
+		if err := s.checkPlans(*update.PlanIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	var coupon *models.Coupon
+	// Купон и список его планов сохраняются вместе
+	err := s.store.Transaction(func(tx repository.Store) (err error) {
+		coupon, err = tx.Coupons().FindByID(id)
+		if err != nil {
+			return errors.New("coupon not found")
+		}
+
+		if update.Name != nil {
+			coupon.Name = *update.Name
+		}
+		if update.MaxRedemptions != nil {
+			coupon.MaxRedemptions = *update.MaxRedemptions
+		}
+		if update.ExpiresAt != nil {
+			coupon.ExpiresAt = update.ExpiresAt
+		}
+		if update.IsActive != nil {
+			coupon.IsActive = *update.IsActive
+		}
+		if update.PlanIDs != nil {
+			coupon.PlanIDs = *update.PlanIDs
+		}
+		return tx.Coupons().Save(coupon)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// DeleteCoupon удаляет купон. Подписки, уже получившие скидку, сохраняют её до конца срока купона
+func (s *CouponService) DeleteCoupon(id uint) error {
+	if _, err := s.GetCoupon(id); err != nil {
+		return err
+	}
+	return s.store.Coupons().Delete(id)
+}
+
+func (s *CouponService) checkPlans(planIDs []uint) error {
+	for _, planID := range planIDs {
+		if _, err := s.store.Plans().FindByID(planID); err != nil {
+			return fmt.Errorf("plan %d not found", planID)
+		}
+	}
+	return nil
+}
+
+// CouponStats - статистика применений купона
+type CouponStats struct {
+	Coupon      *models.Coupon `json:"coupon"`
+	Redemptions int            `json:"redemptions"`
+	// RemainingRedemptions не задан для купона без ограничения
+	RemainingRedemptions *int    `json:"remaining_redemptions,omitempty"`
+	TotalDiscount        float64 `json:"total_discount"`
+	// ActiveSubscriptions - активные подписки, оформленные с купоном
+	ActiveSubscriptions int                       `json:"active_subscriptions"`
+	RecentRedemptions   []models.CouponRedemption `json:"recent_redemptions"`
+}
+
+// recentRedemptionsLimit - сколько последних применений показывать в статистике
+const recentRedemptionsLimit = 20
+
+func (s *CouponService) GetCouponStats(id uint) (*CouponStats, error) {
+	coupon, err := s.GetCoupon(id)
+	if err != nil {
+		return nil, err
+	}
+	redemptions, err := s.store.Coupons().FindRedemptions(id)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &CouponStats{
+		Coupon:            coupon,
+		Redemptions:       len(redemptions),
+		RecentRedemptions: []models.CouponRedemption{},
+	}
+	if coupon.MaxRedemptions > 0 {
+		remaining := coupon.MaxRedemptions - coupon.RedemptionCount
+		if remaining < 0 {
+			remaining = 0
+		}
+		stats.RemainingRedemptions = &remaining
+	}
+	for _, redemption := range redemptions {
+		stats.TotalDiscount = models.RoundMoney(stats.TotalDiscount + redemption.DiscountTotal)
+		subscription, err := s.store.Subscriptions().FindByID(redemption.SubscriptionID)
+		if err == nil && subscription.Status == "active" {
+			stats.ActiveSubscriptions++
+		}
+	}
+	if len(redemptions) > recentRedemptionsLimit {
+		redemptions = redemptions[len(redemptions)-recentRedemptionsLimit:]
+	}
+	for i := len(redemptions) - 1; i >= 0; i-- {
+		stats.RecentRedemptions = append(stats.RecentRedemptions, redemptions[i])
+	}
+	return stats, nil
+}
+
+// redeemCoupon применяет промокод к новой подписке и добавляет скидку первого периода в счёт
+func redeemCoupon(tx repository.Store, code string, subscription *models.Subscription, invoice *models.Invoice, price float64, now time.Time) error {
+	coupon, err := tx.Coupons().FindByCode(models.NormalizeCouponCode(code))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("%w: promo code not found", ErrInvalidPromoCode)
+		}
+		return err
+	}
+	if err := coupon.CheckRedeemable(subscription.PlanID, now); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPromoCode, err)
+	}
+
+	// Счётчик проверяется и увеличивается одним обновлением: параллельные применения
+	// не превысят лимит
+	incremented, err := tx.Coupons().IncrementRedemptions(coupon.ID)
+	if err != nil {
+		return err
+	}
+	if !incremented {
+		return fmt.Errorf("%w: promo code redemption limit reached", ErrInvalidPromoCode)
+	}
+	coupon.RedemptionCount++
+
+	redemption := models.CouponRedemption{
+		CouponID:       coupon.ID,
+		Coupon:         coupon,
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+	}
+	redemption.Apply(invoice, price)
+	return tx.Coupons().CreateRedemption(&redemption)
+}
+
+// applyRenewalDiscount добавляет в счёт продления скидку по купону подписки, если её срок не закончился
+func applyRenewalDiscount(tx repository.Store, subscription *models.Subscription, invoice *models.Invoice, price float64) error {
+	redemption, err := tx.Coupons().FindRedemptionBySubscription(subscription.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !redemption.Apply(invoice, price) {
+		return nil
+	}
+	return tx.Coupons().SaveRedemption(redemption)
+}
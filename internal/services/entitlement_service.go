@@ -0,0 +1,75 @@
+package services
+
+import (
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+// EntitlementService определяет, какие функции доступны пользователю по его подпискам
+type EntitlementService struct {
+	store repository.Store
+	clock Clock
+}
+
+// NewEntitlementService создает новый экземпляр сервиса доступа к функциям
+func NewEntitlementService(store repository.Store, clock Clock) *EntitlementService {
+	return &EntitlementService{store: store, clock: clock}
+}
+
+// Entitlements собирает функции планов всех действующих подписок пользователя: личных
+// и подписок организаций, в которых он состоит. Лимиты одной функции из разных подписок
+// не складываются, берётся наибольший
+func (s *EntitlementService) Entitlements(userID uint) (models.Entitlements, error) {
+	subscriptions, err := s.store.Subscriptions().FindActiveByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	organizations, err := s.store.Organizations().FindByMember(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, organization := range organizations {
+		orgSubscriptions, err := s.store.Subscriptions().FindActiveByOrganization(organization.ID)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, orgSubscriptions...)
+	}
+
+	shared, err := findSharedSubscriptions(s.store, userID)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions = append(subscriptions, shared...)
+
+	now := s.clock.Now()
+	features := make(map[uint][]models.PlanFeature)
+	entitlements := models.Entitlements{}
+	for _, subscription := range subscriptions {
+		// Истёкшие подписки могут ещё не быть помечены фоновой проверкой
+		if !subscription.EndDate.After(now) {
+			continue
+		}
+
+		planFeatures, ok := features[subscription.PlanID]
+		if !ok {
+			planFeatures, err = s.store.Plans().FindFeatures(subscription.PlanID)
+			if err != nil {
+				return nil, err
+			}
+			features[subscription.PlanID] = planFeatures
+		}
+		entitlements.Add(planFeatures, subscription.ID)
+	}
+	return entitlements, nil
+}
+
+// HasFeature сообщает, доступна ли пользователю функция с лимитом не меньше minLimit
+func (s *EntitlementService) HasFeature(userID uint, key string, minLimit int64) (bool, error) {
+	entitlements, err := s.Entitlements(userID)
+	if err != nil {
+		return false, err
+	}
+	return entitlements.Allows(key, minLimit), nil
+}
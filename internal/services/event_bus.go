@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+// Event - доменное событие сервисов. Подписчики получают событие по его типу
+type Event interface {
+	EventName() string
+}
+
+type eventHandler func(event Event) error
+
+// EventBus рассылает доменные события подписчикам. Событие, опубликованное в транзакции,
+// доставляется только после её фиксации: при откате подписчики его не получают
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers map[reflect.Type][]eventSubscriber
+	// running - выполняющиеся асинхронные подписчики
+	running sync.WaitGroup
+}
+
+type eventSubscriber struct {
+	handle eventHandler
+	async  bool
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: map[reflect.Type][]eventSubscriber{}}
+}
+
+// Subscribe добавляет синхронного подписчика на события типа T. Синхронные подписчики выполняются
+// по порядку подписки до возврата из метода сервиса; их ошибки записываются в лог и не отменяют
+// уже зафиксированное действие
+func Subscribe[T Event](bus *EventBus, handler func(event T) error) {
+	bus.add(eventTypeOf[T](), func(event Event) error { return handler(event.(T)) }, false)
+}
+
+// SubscribeAsync добавляет подписчика на события типа T, который выполняется в отдельной горутине,
+// например для отправки писем или запросов во внешние системы
+func SubscribeAsync[T Event](bus *EventBus, handler func(event T) error) {
+	bus.add(eventTypeOf[T](), func(event Event) error { return handler(event.(T)) }, true)
+}
+
+func (b *EventBus) add(eventType reflect.Type, handle eventHandler, async bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], eventSubscriber{handle: handle, async: async})
+}
+
+func eventTypeOf[T Event]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Publish доставляет событие после фиксации транзакции tx, а вне транзакции - сразу
+func (b *EventBus) Publish(tx repository.Store, event Event) {
+	tx.AfterCommit(func() {
+		b.dispatch(event)
+	})
+}
+
+// Wait ждёт завершения запущенных асинхронных подписчиков, например перед выходом служебной команды
+func (b *EventBus) Wait() {
+	b.running.Wait()
+}
+
+func (b *EventBus) dispatch(event Event) {
+	b.mu.RLock()
+	subscribers := append([]eventSubscriber(nil), b.handlers[reflect.TypeOf(event)]...)
+	b.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		if !subscriber.async {
+			b.run(subscriber.handle, event)
+			continue
+		}
+		b.running.Add(1)
+		go func(handle eventHandler) {
+			defer b.running.Done()
+			b.run(handle, event)
+		}(subscriber.handle)
+	}
+}
+
+// run выполняет подписчика; ошибка или паника подписчика не мешает остальным
+func (b *EventBus) run(handle eventHandler, event Event) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			fmt.Printf("Паника в обработчике события %s: %v\n", event.EventName(), recovered)
+		}
+	}()
+	if err := handle(event); err != nil {
+		fmt.Printf("Ошибка обработки события %s: %v\n", event.EventName(), err)
+	}
+}
@@ -0,0 +1,88 @@
+package services_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBusDeliversAfterCommit(t *testing.T) {
+	store := repository.NewMemoryStore()
+	bus := services.NewEventBus()
+
+	var received []string
+	services.Subscribe(bus, func(event services.UserRegistered) error {
+		received = append(received, event.User.Email)
+		return errors.New("subscriber errors do not stop other subscribers")
+	})
+	services.Subscribe(bus, func(event services.UserRegistered) error {
+		received = append(received, "second")
+		return nil
+	})
+
+	err := store.Transaction(func(tx repository.Store) error {
+		bus.Publish(tx, services.UserRegistered{User: models.User{Email: "rolled-back@example.com"}})
+		return errors.New("fail")
+	})
+	assert.Error(t, err)
+	assert.Empty(t, received, "rolled back transaction publishes nothing")
+
+	err = store.Transaction(func(tx repository.Store) error {
+		bus.Publish(tx, services.UserRegistered{User: models.User{Email: "user@example.com"}})
+		assert.Empty(t, received, "delivered only after commit")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user@example.com", "second"}, received)
+}
+
+func TestSubscriptionServicePublishesEvents(t *testing.T) {
+	_, store, clock, plan := newSubscriptionFixture(t)
+	bus := services.NewEventBus()
+	service := services.NewSubscriptionService(store, clock, bus)
+
+	var mu sync.Mutex
+	var created []services.SubscriptionCreated
+	var cancelled []services.SubscriptionCancelled
+	services.Subscribe(bus, func(event services.SubscriptionCreated) error {
+		created = append(created, event)
+		return nil
+	})
+	services.SubscribeAsync(bus, func(event services.SubscriptionCancelled) error {
+		mu.Lock()
+		defer mu.Unlock()
+		cancelled = append(cancelled, event)
+		return nil
+	})
+	services.SubscribeAsync(bus, func(event services.SubscriptionCancelled) error {
+		panic("a panicking subscriber is recovered")
+	})
+
+	subscription, err := service.Subscribe(7, plan.ID, "payment-1", "")
+	require.NoError(t, err)
+	require.Len(t, created, 1, "synchronous subscribers run before Subscribe returns")
+	assert.Equal(t, subscription.ID, created[0].Subscription.ID)
+	assert.Nil(t, created[0].Before)
+	assert.Equal(t, uint(7), created[0].ActorID)
+	assert.Equal(t, clock.now, created[0].At)
+
+	// Неизвестный промокод откатывает транзакцию уже после записи события created
+	_, err = service.Subscribe(7, plan.ID, "payment-2", "UNKNOWN")
+	assert.Error(t, err)
+	assert.Len(t, created, 1, "rolled back subscription is not published")
+
+	require.NoError(t, service.CancelSubscription(subscription.ID, 7))
+	bus.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, cancelled, 1)
+	assert.Equal(t, "active", cancelled[0].Before.Status)
+	assert.Equal(t, "cancelled", cancelled[0].Subscription.Status)
+	assert.Equal(t, "subscription.cancelled", cancelled[0].EventName())
+}
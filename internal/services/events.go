@@ -0,0 +1,110 @@
+package services
+
+import (
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+)
+
+// SubscriptionChange - общие поля событий подписки
+type SubscriptionChange struct {
+	Subscription models.Subscription
+	// Before - подписка до изменения; nil для новой подписки
+	Before *models.Subscription
+	// ActorID - пользователь, выполнивший действие; 0 - фоновая задача или платёжный провайдер
+	ActorID uint
+	At      time.Time
+}
+
+// Change возвращает общие поля события; через него подписчики получают любое событие подписки
+func (c SubscriptionChange) Change() SubscriptionChange {
+	return c
+}
+
+// SubscriptionEvent - любое из событий изменения подписки
+type SubscriptionEvent interface {
+	Event
+	Change() SubscriptionChange
+}
+
+type SubscriptionCreated struct{ SubscriptionChange }
+
+type SubscriptionRenewed struct{ SubscriptionChange }
+
+type SubscriptionAutoRenewChanged struct{ SubscriptionChange }
+
+type SubscriptionCancelled struct{ SubscriptionChange }
+
+type SubscriptionExpired struct{ SubscriptionChange }
+
+type SubscriptionPlanChanged struct{ SubscriptionChange }
+
+type SubscriptionPaymentFailed struct{ SubscriptionChange }
+
+type SubscriptionPaymentRecovered struct{ SubscriptionChange }
+
+func (SubscriptionCreated) EventName() string          { return "subscription.created" }
+func (SubscriptionRenewed) EventName() string          { return "subscription.renewed" }
+func (SubscriptionAutoRenewChanged) EventName() string { return "subscription.auto_renew_changed" }
+func (SubscriptionCancelled) EventName() string        { return "subscription.cancelled" }
+func (SubscriptionExpired) EventName() string          { return "subscription.expired" }
+func (SubscriptionPlanChanged) EventName() string      { return "subscription.plan_changed" }
+func (SubscriptionPaymentFailed) EventName() string    { return "subscription.payment_failed" }
+func (SubscriptionPaymentRecovered) EventName() string { return "subscription.payment_recovered" }
+
+// SubscribeSubscriptionEvents добавляет синхронного подписчика на все события изменения подписки
+func SubscribeSubscriptionEvents(bus *EventBus, handler func(event SubscriptionEvent) error) {
+	Subscribe(bus, func(event SubscriptionCreated) error { return handler(event) })
+	Subscribe(bus, func(event SubscriptionRenewed) error { return handler(event) })
+	Subscribe(bus, func(event SubscriptionAutoRenewChanged) error { return handler(event) })
+	Subscribe(bus, func(event SubscriptionCancelled) error { return handler(event) })
+	Subscribe(bus, func(event SubscriptionExpired) error { return handler(event) })
+	Subscribe(bus, func(event SubscriptionPlanChanged) error { return handler(event) })
+	Subscribe(bus, func(event SubscriptionPaymentFailed) error { return handler(event) })
+	Subscribe(bus, func(event SubscriptionPaymentRecovered) error { return handler(event) })
+}
+
+// UserRegistered - пользователь зарегистрировался по email и паролю
+type UserRegistered struct {
+	User models.User
+	At   time.Time
+}
+
+// EmailVerified - пользователь подтвердил email по ссылке из письма
+type EmailVerified struct {
+	User models.User
+	At   time.Time
+}
+
+// GiftPaid - провайдер подтвердил оплату подарка, код можно отправить получателю
+type GiftPaid struct {
+	Gift models.Gift
+	At   time.Time
+}
+
+func (UserRegistered) EventName() string { return "user.registered" }
+func (EmailVerified) EventName() string  { return "user.email_verified" }
+func (GiftPaid) EventName() string       { return "gift.paid" }
+
+// newSubscriptionEvent возвращает доменное событие для типа события истории подписки
+func newSubscriptionEvent(eventType string, change SubscriptionChange) Event {
+	switch eventType {
+	case models.SubscriptionEventCreated:
+		return SubscriptionCreated{change}
+	case models.SubscriptionEventRenewed:
+		return SubscriptionRenewed{change}
+	case models.SubscriptionEventAutoRenewChanged:
+		return SubscriptionAutoRenewChanged{change}
+	case models.SubscriptionEventCancelled:
+		return SubscriptionCancelled{change}
+	case models.SubscriptionEventExpired:
+		return SubscriptionExpired{change}
+	case models.SubscriptionEventPlanChanged:
+		return SubscriptionPlanChanged{change}
+	case models.SubscriptionEventPaymentFailed:
+		return SubscriptionPaymentFailed{change}
+	case models.SubscriptionEventPaymentRecovered:
+		return SubscriptionPaymentRecovered{change}
+	}
+	return nil
+}
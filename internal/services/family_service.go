@@ -0,0 +1,365 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/pkg/email"
+)
+
+// ErrNoFreeSeats возвращается, если все места семейной подписки заняты или зарезервированы приглашениями
+var ErrNoFreeSeats = errors.New("no free seats left in this subscription")
+
+// familyInvitationTTL - срок действия приглашения в семейную подписку
+const familyInvitationTTL = 7 * 24 * time.Hour
+
+type FamilyService struct {
+	store       repository.Store
+	clock       Clock
+	userService *UserService
+}
+
+func NewFamilyService(store repository.Store, clock Clock, userService *UserService) *FamilyService {
+	return &FamilyService{
+		store:       store,
+		clock:       clock,
+		userService: userService,
+	}
+}
+
+// FamilySeat - занятое место семейной подписки и доля участника в её стоимости
+type FamilySeat struct {
+	UserID       uint      `json:"user_id"`
+	Email        string    `json:"email"`
+	Name         string    `json:"name"`
+	Owner        bool      `json:"owner"`
+	JoinedAt     time.Time `json:"joined_at"`
+	MonthlyShare float64   `json:"monthly_share"`
+}
+
+// FamilyOverview - места семейной подписки. Приглашения видит только владелец
+type FamilyOverview struct {
+	SubscriptionID uint                      `json:"subscription_id"`
+	Seats          int                       `json:"seats"`
+	OccupiedSeats  int                       `json:"occupied_seats"`
+	AvailableSeats int                       `json:"available_seats"`
+	MonthlyPrice   float64                   `json:"monthly_price"`
+	Members        []FamilySeat              `json:"members"`
+	Invitations    []models.FamilyInvitation `json:"invitations,omitempty"`
+}
+
+// GetFamily возвращает участников семейной подписки владельцу или участнику
+func (s *FamilyService) GetFamily(userID, subscriptionID uint) (*FamilyOverview, error) {
+	subscription, err := s.familySubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	isOwner := subscription.UserID == userID
+	if !isOwner {
+		if _, err := s.store.Family().FindMember(subscriptionID, userID); err != nil {
+			return nil, errors.New("подписка не найдена или не принадлежит пользователю")
+		}
+	}
+
+	members, err := s.store.Family().FindMembers(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := s.userService.GetUserByID(subscription.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := subscription.BilledPlan()
+	occupied := len(members) + 1
+	share := models.SeatShare(plan.GetMonthlyPrice(), occupied)
+	overview := &FamilyOverview{
+		SubscriptionID: subscription.ID,
+		Seats:          subscription.Plan.Seats,
+		OccupiedSeats:  occupied,
+		MonthlyPrice:   plan.GetMonthlyPrice(),
+		Members: []FamilySeat{{
+			UserID:       owner.ID,
+			Email:        owner.Email,
+			Name:         displayName(owner),
+			Owner:        true,
+			JoinedAt:     subscription.StartDate,
+			MonthlyShare: share,
+		}},
+	}
+	for _, member := range members {
+		overview.Members = append(overview.Members, FamilySeat{
+			UserID:       member.UserID,
+			Email:        member.User.Email,
+			Name:         displayName(&member.User),
+			JoinedAt:     member.CreatedAt,
+			MonthlyShare: share,
+		})
+	}
+
+	pending, err := s.pendingInvitations(s.store, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	overview.AvailableSeats = subscription.Plan.Seats - occupied - len(pending)
+	if overview.AvailableSeats < 0 {
+		overview.AvailableSeats = 0
+	}
+	if isOwner {
+		overview.Invitations = pending
+	}
+	return overview, nil
+}
+
+// InviteMember приглашает пользователя по email занять место в семейной подписке владельца
+func (s *FamilyService) InviteMember(ownerID, subscriptionID uint, inviteeEmail string) (*models.FamilyInvitation, error) {
+	inviteeEmail = strings.ToLower(strings.TrimSpace(inviteeEmail))
+	if inviteeEmail == "" {
+		return nil, errors.New("email is required")
+	}
+
+	subscription, err := s.ownedFamilySubscription(ownerID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if subscription.Status != "active" {
+		return nil, errors.New("subscription is not active")
+	}
+
+	owner, err := s.userService.GetUserByID(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(owner.Email, inviteeEmail) {
+		return nil, errors.New("owner already has a seat")
+	}
+	if invitee, err := s.store.Users().FindByEmail(inviteeEmail); err == nil {
+		if _, err := s.store.Family().FindMember(subscriptionID, invitee.ID); err == nil {
+			return nil, errors.New("user is already a member of this subscription")
+		}
+	}
+
+	token, err := s.userService.generateVerificationToken()
+	if err != nil {
+		return nil, fmt.Errorf("error generating invitation token: %w", err)
+	}
+
+	invitation := models.FamilyInvitation{
+		SubscriptionID: subscriptionID,
+		Email:          inviteeEmail,
+		Token:          token,
+		InvitedBy:      ownerID,
+		ExpiresAt:      s.clock.Now().Add(familyInvitationTTL),
+	}
+	err = s.store.Transaction(func(tx repository.Store) error {
+		members, err := tx.Family().FindMembers(subscriptionID)
+		if err != nil {
+			return err
+		}
+		pending, err := s.pendingInvitations(tx, subscriptionID)
+		if err != nil {
+			return err
+		}
+		for _, existing := range pending {
+			if existing.Email == inviteeEmail {
+				return errors.New("invitation to this email is already pending")
+			}
+		}
+		if len(members)+1+len(pending) >= subscription.Plan.Seats {
+			return ErrNoFreeSeats
+		}
+		return tx.Family().CreateInvitation(&invitation)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := email.SendFamilyInvitation(inviteeEmail, displayName(owner), subscription.Plan.Name, token); err != nil {
+		fmt.Printf("Ошибка отправки приглашения в семейную подписку: %v\n", err)
+	}
+
+	return &invitation, nil
+}
+
+// AcceptInvitation занимает место в семейной подписке по приглашению, отправленному на email пользователя
+func (s *FamilyService) AcceptInvitation(userID uint, token string) (*models.Subscription, error) {
+	if token == "" {
+		return nil, errors.New("invitation token is required")
+	}
+
+	invitation, err := s.store.Family().FindInvitationByToken(token)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("invalid invitation token")
+		}
+		return nil, err
+	}
+	now := s.clock.Now()
+	if !invitation.IsPendingAt(now) {
+		return nil, errors.New("invitation has expired, was revoked or already accepted")
+	}
+
+	user, err := s.userService.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return nil, errors.New("invitation was sent to another email")
+	}
+
+	subscription, err := s.familySubscription(invitation.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if subscription.Status != "active" {
+		return nil, errors.New("subscription is not active")
+	}
+	if subscription.UserID == userID {
+		return nil, errors.New("owner already has a seat")
+	}
+
+	err = s.store.Transaction(func(tx repository.Store) error {
+		_, err := tx.Family().FindMember(subscription.ID, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			members, err := tx.Family().FindMembers(subscription.ID)
+			if err != nil {
+				return err
+			}
+			// Число мест плана могли уменьшить после отправки приглашения
+			if len(members)+1 >= subscription.Plan.Seats {
+				return ErrNoFreeSeats
+			}
+			if err := tx.Family().CreateMember(&models.FamilyMember{SubscriptionID: subscription.ID, UserID: userID}); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		invitation.AcceptedAt = &now
+		return tx.Family().SaveInvitation(invitation)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+// RemoveMember освобождает место: владелец исключает участника, участник может выйти сам
+func (s *FamilyService) RemoveMember(actorID, subscriptionID, memberID uint) error {
+	subscription, err := s.familySubscription(subscriptionID)
+	if err != nil {
+		return err
+	}
+	if actorID != memberID && subscription.UserID != actorID {
+		return errors.New("only the subscription owner can remove members")
+	}
+	if _, err := s.store.Family().FindMember(subscriptionID, memberID); err != nil {
+		return errors.New("user is not a member of this subscription")
+	}
+	return s.store.Family().DeleteMember(subscriptionID, memberID)
+}
+
+// RevokeInvitation отзывает приглашение и освобождает зарезервированное место
+func (s *FamilyService) RevokeInvitation(ownerID, subscriptionID, invitationID uint) error {
+	if _, err := s.ownedFamilySubscription(ownerID, subscriptionID); err != nil {
+		return err
+	}
+
+	pending, err := s.pendingInvitations(s.store, subscriptionID)
+	if err != nil {
+		return err
+	}
+	for _, invitation := range pending {
+		if invitation.ID == invitationID {
+			now := s.clock.Now()
+			invitation.RevokedAt = &now
+			return s.store.Family().SaveInvitation(&invitation)
+		}
+	}
+	return errors.New("pending invitation not found")
+}
+
+// familySubscription находит личную подписку на семейный план
+func (s *FamilyService) familySubscription(subscriptionID uint) (*models.Subscription, error) {
+	subscription, err := s.store.Subscriptions().FindByID(subscriptionID)
+	if err != nil {
+		return nil, errors.New("подписка не найдена")
+	}
+	if subscription.OrganizationID != nil || !subscription.Plan.IsFamily() {
+		return nil, errors.New("subscription plan has no shared seats")
+	}
+	return subscription, nil
+}
+
+func (s *FamilyService) ownedFamilySubscription(ownerID, subscriptionID uint) (*models.Subscription, error) {
+	subscription, err := s.familySubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if subscription.UserID != ownerID {
+		return nil, errors.New("only the subscription owner can manage seats")
+	}
+	return subscription, nil
+}
+
+// pendingInvitations возвращает приглашения, которые ещё резервируют места
+func (s *FamilyService) pendingInvitations(tx repository.Store, subscriptionID uint) ([]models.FamilyInvitation, error) {
+	invitations, err := tx.Family().FindInvitations(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	pending := []models.FamilyInvitation{}
+	for _, invitation := range invitations {
+		if invitation.IsPendingAt(now) {
+			pending = append(pending, invitation)
+		}
+	}
+	return pending, nil
+}
+
+// findSharedSubscriptions возвращает активные семейные подписки, в которых пользователь занимает место
+func findSharedSubscriptions(tx repository.Store, userID uint) ([]models.Subscription, error) {
+	memberships, err := tx.Family().FindMembershipsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []models.Subscription
+	for _, membership := range memberships {
+		subscription, err := tx.Subscriptions().FindByID(membership.SubscriptionID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if subscription.Status == "active" {
+			subscription.Shared = true
+			shared = append(shared, *subscription)
+		}
+	}
+	return shared, nil
+}
+
+// occupiedSeats возвращает число занятых мест подписки вместе с владельцем
+func occupiedSeats(tx repository.Store, subscription *models.Subscription) (int, error) {
+	if !subscription.Plan.IsFamily() {
+		return 1, nil
+	}
+	members, err := tx.Family().FindMembers(subscription.ID)
+	if err != nil {
+		return 0, err
+	}
+	return len(members) + 1, nil
+}
+
+func displayName(user *models.User) string {
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/pkg/email"
+)
+
+// ErrInvalidGiftCode возвращается, если код подарка не найден, уже активирован или просрочен
+var ErrInvalidGiftCode = errors.New("invalid gift code")
+
+type GiftService struct {
+	store       repository.Store
+	clock       Clock
+	events      *EventBus
+	userService *UserService
+}
+
+func NewGiftService(store repository.Store, clock Clock, events *EventBus, userService *UserService) *GiftService {
+	return &GiftService{
+		store:       store,
+		clock:       clock,
+		events:      events,
+		userService: userService,
+	}
+}
+
+// GetGiftValidity возвращает, сколько действует код подарка (GIFT_VALID_DAYS, по умолчанию 365 дней)
+func (s *GiftService) GetGiftValidity() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("GIFT_VALID_DAYS"))
+	if err != nil || days <= 0 {
+		days = 365
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GiftPurchase - данные покупки подарка
+type GiftPurchase struct {
+	PlanID         uint   `json:"plan_id" binding:"required"`
+	RecipientEmail string `json:"recipient_email" binding:"required"`
+	Message        string `json:"message"`
+}
+
+// PurchaseGift оформляет подарок по текущей цене плана. Код отправляется получателю только после того,
+// как платёжный провайдер подтвердит оплату событием payment.succeeded с gift_id подарка
+func (s *GiftService) PurchaseGift(purchaserID uint, purchase GiftPurchase) (*models.Gift, error) {
+	recipient := strings.ToLower(strings.TrimSpace(purchase.RecipientEmail))
+	if !strings.Contains(recipient, "@") {
+		return nil, errors.New("valid recipient email is required")
+	}
+	message := strings.TrimSpace(purchase.Message)
+	if len([]rune(message)) > 1000 {
+		return nil, errors.New("gift message is too long")
+	}
+
+	plan, err := s.store.Plans().FindByID(purchase.PlanID)
+	if err != nil {
+		return nil, errors.New("план подписки не найден")
+	}
+	if !plan.IsActive {
+		return nil, errors.New("план подписки снят с продажи")
+	}
+
+	code, err := generateGiftCode()
+	if err != nil {
+		return nil, fmt.Errorf("error generating gift code: %w", err)
+	}
+
+	now := s.clock.Now()
+	gift := models.Gift{
+		PurchaserID:    purchaserID,
+		PlanID:         plan.ID,
+		RecipientEmail: recipient,
+		Message:        message,
+		Code:           code,
+		Status:         models.GiftStatusAwaitingPayment,
+		ExpiresAt:      now.Add(s.GetGiftValidity()),
+	}
+	err = s.store.Transaction(func(tx repository.Store) error {
+		version, err := currentPlanVersion(tx, plan.ID, now)
+		if err != nil {
+			return err
+		}
+		gift.PlanVersionID = version.ID
+		gift.PlanVersion = version
+		gift.Price = version.Price
+		return tx.Gifts().Create(&gift)
+	})
+	if err != nil {
+		return nil, err
+	}
+	gift.Plan = *plan
+	return &gift, nil
+}
+
+// SendGiftCode отправляет код оплаченного подарка получателю. Подписчик события GiftPaid
+func (s *GiftService) SendGiftCode(event GiftPaid) error {
+	gift := event.Gift
+	purchaserName := "Пользователь Subscription Manager"
+	if purchaser, err := s.userService.GetUserByID(gift.PurchaserID); err == nil && purchaser.FirstName != "" {
+		purchaserName = strings.TrimSpace(purchaser.FirstName + " " + purchaser.LastName)
+	}
+	if err := email.SendGiftCode(gift.RecipientEmail, purchaserName, gift.Plan.Name, gift.Message, gift.Code, gift.ExpiresAt); err != nil {
+		log.Printf("Ошибка отправки подарочного кода: %v", err)
+	}
+	return nil
+}
+
+// GetPurchasedGifts возвращает подарки покупателя с актуальным статусом
+func (s *GiftService) GetPurchasedGifts(purchaserID uint) ([]models.Gift, error) {
+	gifts, err := s.store.Gifts().FindByPurchaser(purchaserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	for i := range gifts {
+		if gifts[i].RefreshStatus(now) {
+			if err := s.store.Gifts().Save(&gifts[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return gifts, nil
+}
+
+// RedeemGift активирует подарок. Если у пользователя есть действующая подписка на тот же сервис,
+// она продлевается на срок подарка, иначе создается подписка без автопродления
+func (s *GiftService) RedeemGift(userID uint, code string) (*models.Gift, *models.Subscription, error) {
+	code = models.NormalizeGiftCode(code)
+	if code == "" {
+		return nil, nil, fmt.Errorf("%w: code is required", ErrInvalidGiftCode)
+	}
+
+	var gift *models.Gift
+	var subscription *models.Subscription
+	err := s.store.Transaction(func(tx repository.Store) (err error) {
+		// Подарок блокируется: код, введённый дважды одновременно, активируется один раз
+		gift, err = tx.Gifts().FindByCodeForUpdate(code)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return fmt.Errorf("%w: gift not found", ErrInvalidGiftCode)
+			}
+			return err
+		}
+
+		now := s.clock.Now()
+		gift.RefreshStatus(now)
+		switch gift.Status {
+		case models.GiftStatusAwaitingPayment:
+			return fmt.Errorf("%w: gift has not been paid", ErrInvalidGiftCode)
+		case models.GiftStatusRedeemed:
+			return fmt.Errorf("%w: gift was already redeemed", ErrInvalidGiftCode)
+		case models.GiftStatusExpired:
+			return fmt.Errorf("%w: gift has expired", ErrInvalidGiftCode)
+		}
+
+		if err := lockSubscriptionOwner(tx, userID, nil); err != nil {
+			return err
+		}
+		subscription, err = s.applyGift(tx, userID, gift, now)
+		if err != nil {
+			return err
+		}
+
+		gift.Status = models.GiftStatusRedeemed
+		gift.RedeemedAt = &now
+		gift.RedeemedByID = &userID
+		gift.SubscriptionID = &subscription.ID
+		return tx.Gifts().Save(gift)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return gift, subscription, nil
+}
+
+// applyGift создает подписку по подарку. Если у пользователя уже есть подписка на этот сервис,
+// действует DUPLICATE_SUBSCRIPTION_POLICY, как при оформлении подписки: reject отклоняет
+// активацию, extend продлевает подписку на тот же план на срок подарка, а подписку
+// на другой вариант сервиса (и при extend, и при change_plan) переводит на план подарка
+func (s *GiftService) applyGift(tx repository.Store, userID uint, gift *models.Gift, now time.Time) (*models.Subscription, error) {
+	billedPlan := gift.BilledPlan()
+
+	duplicate, err := findDuplicateSubscription(tx, userID, nil, &gift.Plan)
+	if err != nil {
+		return nil, err
+	}
+	if duplicate != nil {
+		return s.applyGiftToExisting(tx, duplicate.ID, userID, gift, now)
+	}
+
+	subscription := models.Subscription{
+		UserID:        userID,
+		PlanID:        gift.PlanID,
+		StartDate:     now,
+		EndDate:       billedPlan.CalculateEndDate(now),
+		Status:        "active",
+		PaymentID:     fmt.Sprintf("gift-%d", gift.ID),
+		AutoRenew:     false,
+		PlanVersionID: &gift.PlanVersionID,
+	}
+	if err := tx.Subscriptions().Create(&subscription); err != nil {
+		return nil, err
+	}
+	if err := recordEvent(tx, s.events, models.SubscriptionEventCreated, nil, &subscription, userID, now); err != nil {
+		return nil, err
+	}
+	subscription.Plan = gift.Plan
+	subscription.PlanVersion = gift.PlanVersion
+	return &subscription, nil
+}
+
+// applyGiftToExisting применяет подарок к действующей подписке пользователя по политике дублей.
+// Подарок уже оплачен, поэтому счёт не выставляется
+func (s *GiftService) applyGiftToExisting(tx repository.Store, subscriptionID, userID uint, gift *models.Gift, now time.Time) (*models.Subscription, error) {
+	// Подписка блокируется так же, как при продлении
+	existing, err := tx.Subscriptions().FindByIDForUpdate(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	policy := duplicatePolicy()
+	samePlan := existing.PlanID == gift.PlanID
+	if policy == DuplicatePolicyReject || (policy == DuplicatePolicyChangePlan && samePlan) {
+		return nil, fmt.Errorf("%w (subscription %d)", ErrDuplicateSubscription, existing.ID)
+	}
+
+	billedPlan := gift.BilledPlan()
+	before := *existing
+	eventType := models.SubscriptionEventRenewed
+	if samePlan {
+		periodStart := now
+		if existing.EndDate.After(now) {
+			periodStart = existing.EndDate
+		}
+		existing.EndDate = billedPlan.CalculateEndDate(periodStart)
+	} else {
+		// Как и при оформлении подписки, использование по старому плану выставляется сразу
+		if usageStart, _ := existing.UsagePeriod(); now.After(usageStart) {
+			if err := closeUsagePeriod(tx, existing, usageStart, now, now); err != nil {
+				return nil, err
+			}
+		}
+		existing.PlanID = gift.PlanID
+		existing.Plan = gift.Plan
+		existing.PlanVersionID = &gift.PlanVersionID
+		existing.PlanVersion = gift.PlanVersion
+		existing.StartDate = now
+		existing.EndDate = billedPlan.CalculateEndDate(now)
+		eventType = models.SubscriptionEventPlanChanged
+	}
+	if err := tx.Subscriptions().Save(existing); err != nil {
+		return nil, err
+	}
+	if err := recordEvent(tx, s.events, eventType, &before, existing, userID, now); err != nil {
+		return nil, err
+	}
+	gift.Extended = true
+	return existing, nil
+}
+
+// generateGiftCode создает код вида XXXXX-XXXXX-XXXXX, удобный для ввода вручную
+func generateGiftCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)[:15]
+	return raw[:5] + "-" + raw[5:10] + "-" + raw[10:], nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+var (
+	// ErrIdempotencyInProgress - запрос с тем же ключом ещё выполняется
+	ErrIdempotencyInProgress = errors.New("a request with this Idempotency-Key is still in progress")
+	// ErrIdempotencyKeyReused - ключ уже использован для запроса с другим адресом или телом
+	ErrIdempotencyKeyReused = errors.New("Idempotency-Key has already been used for a different request")
+)
+
+type IdempotencyService struct {
+	store repository.Store
+	clock Clock
+}
+
+func NewIdempotencyService(store repository.Store, clock Clock) *IdempotencyService {
+	return &IdempotencyService{store: store, clock: clock}
+}
+
+// GetTTL возвращает, сколько хранится ответ на запрос с ключом идемпотентности
+func (s *IdempotencyService) GetTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_KEY_TTL_HOURS"))
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// GetLease возвращает, сколько ключ остаётся занятым запросом, который не сохранил ответ.
+// После этого срока ключ считается брошенным, например после падения сервера, и повтор выполняется заново
+func (s *IdempotencyService) GetLease() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_LEASE_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = 60
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Begin резервирует ключ пользователя для запроса с отпечатком requestHash. Если ключ уже использован
+// для того же запроса, возвращается сохранённый ответ и replay = true. Пока первый запрос выполняется,
+// но не дольше GetLease, повтор получает ErrIdempotencyInProgress
+func (s *IdempotencyService) Begin(userID uint, key, requestHash string) (*models.IdempotencyKey, bool, error) {
+	var record *models.IdempotencyKey
+	replay := false
+	err := s.store.Transaction(func(tx repository.Store) error {
+		now := s.clock.Now()
+		existing, err := tx.IdempotencyKeys().Find(userID, key)
+		switch {
+		case err == nil && existing.ExpiresAt.After(now) && !existing.Abandoned(now, s.GetLease()):
+			record = existing
+			replay, err = checkIdempotencyKey(existing, requestHash)
+			return err
+		case err == nil:
+			// Срок хранения истёк или запрос бросил ключ, не сохранив ответ: ключ можно использовать снова
+			if err := tx.IdempotencyKeys().Delete(existing.ID); err != nil {
+				return err
+			}
+		case !errors.Is(err, repository.ErrNotFound):
+			return err
+		}
+
+		record = &models.IdempotencyKey{
+			CreatedAt:   now,
+			UserID:      userID,
+			Key:         key,
+			RequestHash: requestHash,
+			ExpiresAt:   now.Add(s.GetTTL()),
+		}
+		return tx.IdempotencyKeys().Create(record)
+	})
+	if err == nil || errors.Is(err, ErrIdempotencyInProgress) || errors.Is(err, ErrIdempotencyKeyReused) {
+		return record, replay, err
+	}
+
+	// Параллельный запрос успел занять ключ: уникальный индекс не дал создать вторую запись
+	existing, findErr := s.store.IdempotencyKeys().Find(userID, key)
+	if findErr != nil {
+		return nil, false, err
+	}
+	replay, err = checkIdempotencyKey(existing, requestHash)
+	return existing, replay, err
+}
+
+// Complete сохраняет ответ на запрос, для которого был зарезервирован ключ
+func (s *IdempotencyService) Complete(record *models.IdempotencyKey, responseCode int, contentType string, body []byte) error {
+	record.ResponseCode = responseCode
+	record.ContentType = contentType
+	record.ResponseBody = string(body)
+	return s.store.IdempotencyKeys().Save(record)
+}
+
+// Release освобождает ключ запроса, который не удалось выполнить, чтобы клиент мог повторить его
+func (s *IdempotencyService) Release(record *models.IdempotencyKey) error {
+	return s.store.IdempotencyKeys().Delete(record.ID)
+}
+
+// PurgeExpired удаляет ключи с истёкшим сроком хранения
+func (s *IdempotencyService) PurgeExpired() (int64, error) {
+	return s.store.IdempotencyKeys().DeleteExpired(s.clock.Now())
+}
+
+// checkIdempotencyKey проверяет, можно ли повторить сохранённый ответ на запрос с отпечатком requestHash
+func checkIdempotencyKey(record *models.IdempotencyKey, requestHash string) (bool, error) {
+	if record.InProgress() {
+		return false, ErrIdempotencyInProgress
+	}
+	if record.RequestHash != requestHash {
+		return false, ErrIdempotencyKeyReused
+	}
+	return true, nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/oidc"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+// oidcLoginTimeout - время, за которое пользователь должен вернуться от провайдера
+const oidcLoginTimeout = 10 * time.Minute
+
+type OIDCService struct {
+	store       repository.Store
+	clock       Clock
+	registry    *oidc.Registry
+	userService *UserService
+}
+
+// NewOIDCService создает сервис входа с заданным набором провайдеров
+func NewOIDCService(store repository.Store, clock Clock, registry *oidc.Registry, userService *UserService) *OIDCService {
+	return &OIDCService{
+		store:       store,
+		clock:       clock,
+		registry:    registry,
+		userService: userService,
+	}
+}
+
+// GetProviders возвращает список доступных провайдеров входа
+func (s *OIDCService) GetProviders() []oidc.IdentityProvider {
+	return s.registry.List()
+}
+
+// StartLogin сохраняет параметры входа и возвращает адрес страницы провайдера
+func (s *OIDCService) StartLogin(ctx context.Context, providerName string) (string, error) {
+	provider, err := s.registry.Get(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := s.userService.generateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := s.userService.generateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier := oidc.GenerateCodeVerifier()
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", err
+	}
+
+	loginState := models.OIDCLoginState{
+		State:        state,
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    s.clock.Now().Add(oidcLoginTimeout),
+	}
+	if err := s.store.Identities().CreateLoginState(&loginState); err != nil {
+		return "", fmt.Errorf("error saving login state: %w", err)
+	}
+
+	// Заодно убираем незавершённые попытки входа
+	s.store.Identities().DeleteExpiredLoginStates(s.clock.Now())
+
+	return authURL, nil
+}
+
+// FinishLogin обрабатывает callback провайдера и возвращает JWT пользователя
+func (s *OIDCService) FinishLogin(ctx context.Context, providerName, state, code string) (string, error) {
+	if state == "" || code == "" {
+		return "", errors.New("state and code are required")
+	}
+
+	provider, err := s.registry.Get(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	loginState, err := s.store.Identities().FindLoginState(state, provider.Name())
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", errors.New("invalid login state")
+		}
+		return "", err
+	}
+
+	// state одноразовый
+	if err := s.store.Identities().DeleteLoginState(loginState.ID); err != nil {
+		return "", err
+	}
+	if loginState.ExpiresAt.Before(s.clock.Now()) {
+		return "", errors.New("login state has expired")
+	}
+
+	identity, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.findOrLinkUser(identity)
+	if err != nil {
+		return "", err
+	}
+
+	return s.userService.GenerateJWT(user.ID)
+}
+
+// findOrLinkUser находит пользователя по внешней личности, привязывает её к существующему
+// аккаунту с тем же подтверждённым email или создаёт нового пользователя
+func (s *OIDCService) findOrLinkUser(identity *oidc.Identity) (*models.User, error) {
+	linked, err := s.store.Identities().FindByProviderSubject(identity.Provider, identity.Subject)
+	if err == nil {
+		user, err := s.store.Users().FindByID(linked.UserID)
+		if err != nil {
+			return nil, errors.New("linked user not found")
+		}
+		return user, nil
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	if !identity.EmailVerified || identity.Email == "" {
+		return nil, errors.New("identity provider did not confirm the email address")
+	}
+	userEmail := strings.ToLower(strings.TrimSpace(identity.Email))
+
+	var user *models.User
+	err = s.store.Transaction(func(tx repository.Store) error {
+		var err error
+		user, err = tx.Users().FindByEmail(userEmail)
+		switch {
+		case err == nil:
+			// Привязываем только к подтверждённому аккаунту, иначе чужая регистрация
+			// на этот адрес получила бы доступ к входу через провайдера
+			if !user.IsEmailVerified {
+				return errors.New("account with this email exists but is not verified")
+			}
+		case errors.Is(err, repository.ErrNotFound):
+			user = &models.User{
+				Email:           userEmail,
+				FirstName:       identity.FirstName,
+				LastName:        identity.LastName,
+				IsEmailVerified: true,
+			}
+			if err := tx.Users().Create(user); err != nil {
+				return fmt.Errorf("error creating user: %w", err)
+			}
+		default:
+			return err
+		}
+
+		return tx.Identities().Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    userEmail,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/pkg/email"
+)
+
+type OrganizationService struct {
+	store       repository.Store
+	clock       Clock
+	userService *UserService
+}
+
+// NewOrganizationService создает новый экземпляр сервиса организаций
+func NewOrganizationService(store repository.Store, clock Clock, userService *UserService) *OrganizationService {
+	return &OrganizationService{
+		store:       store,
+		clock:       clock,
+		userService: userService,
+	}
+}
+
+// CreateOrganization создает организацию, создатель становится её владельцем
+func (s *OrganizationService) CreateOrganization(userID uint, name string) (*models.Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("organization name is required")
+	}
+
+	organization := models.Organization{Name: name, OwnerID: userID}
+	err := s.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Organizations().Create(&organization); err != nil {
+			return err
+		}
+		return tx.Organizations().CreateMember(&models.OrganizationMember{
+			OrganizationID: organization.ID,
+			UserID:         userID,
+			Role:           models.RoleOwner,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &organization, nil
+}
+
+// GetUserOrganizations возвращает организации, в которых состоит пользователь
+func (s *OrganizationService) GetUserOrganizations(userID uint) ([]models.Organization, error) {
+	return s.store.Organizations().FindByMember(userID)
+}
+
+// GetOrganization возвращает организацию, если пользователь в ней состоит
+func (s *OrganizationService) GetOrganization(orgID, userID uint) (*models.Organization, error) {
+	if _, err := s.GetMemberRole(orgID, userID); err != nil {
+		return nil, err
+	}
+
+	organization, err := s.store.Organizations().FindByID(orgID)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+
+	return organization, nil
+}
+
+// GetMemberRole возвращает роль пользователя в организации
+func (s *OrganizationService) GetMemberRole(orgID, userID uint) (string, error) {
+	member, err := s.store.Organizations().FindMember(orgID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", errors.New("organization not found or user is not a member")
+	} else if err != nil {
+		return "", err
+	}
+
+	return member.Role, nil
+}
+
+// GetMembers возвращает участников организации
+func (s *OrganizationService) GetMembers(orgID, userID uint) ([]models.OrganizationMember, error) {
+	if _, err := s.GetMemberRole(orgID, userID); err != nil {
+		return nil, err
+	}
+
+	return s.store.Organizations().FindMembers(orgID)
+}
+
+// UpdateMemberRole меняет роль участника. Доступно только владельцу
+func (s *OrganizationService) UpdateMemberRole(orgID, actorID, memberID uint, role string) error {
+	if !models.IsValidRole(role) || role == models.RoleOwner {
+		return errors.New("invalid role")
+	}
+
+	if err := s.requireMemberManagement(orgID, actorID); err != nil {
+		return err
+	}
+
+	if actorID == memberID {
+		return errors.New("owner cannot change own role")
+	}
+
+	member, err := s.store.Organizations().FindMember(orgID, memberID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return errors.New("member not found")
+	} else if err != nil {
+		return err
+	}
+
+	member.Role = role
+	return s.store.Organizations().SaveMember(member)
+}
+
+// RemoveMember исключает участника. Владелец может исключить любого, участник - только выйти сам
+func (s *OrganizationService) RemoveMember(orgID, actorID, memberID uint) error {
+	memberRole, err := s.GetMemberRole(orgID, memberID)
+	if err != nil {
+		return errors.New("member not found")
+	}
+	if memberRole == models.RoleOwner {
+		return errors.New("owner cannot be removed from organization")
+	}
+
+	if actorID != memberID {
+		if err := s.requireMemberManagement(orgID, actorID); err != nil {
+			return err
+		}
+	}
+
+	return s.store.Organizations().DeleteMember(orgID, memberID)
+}
+
+// InviteMember отправляет приглашение в организацию на email
+func (s *OrganizationService) InviteMember(orgID, inviterID uint, inviteeEmail, role string) (*models.OrganizationInvitation, error) {
+	inviteeEmail = strings.ToLower(strings.TrimSpace(inviteeEmail))
+	if inviteeEmail == "" {
+		return nil, errors.New("email is required")
+	}
+	if role == "" {
+		role = models.RoleMember
+	}
+	if !models.IsValidRole(role) || role == models.RoleOwner {
+		return nil, errors.New("invalid role")
+	}
+
+	if err := s.requireMemberManagement(orgID, inviterID); err != nil {
+		return nil, err
+	}
+
+	if invitee, err := s.store.Users().FindByEmail(inviteeEmail); err == nil {
+		if _, err := s.store.Organizations().FindMember(orgID, invitee.ID); err == nil {
+			return nil, errors.New("user is already a member of this organization")
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	organization, err := s.store.Organizations().FindByID(orgID)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+
+	token, err := s.userService.generateVerificationToken()
+	if err != nil {
+		return nil, fmt.Errorf("error generating invitation token: %w", err)
+	}
+
+	invitation := models.OrganizationInvitation{
+		OrganizationID: orgID,
+		Email:          inviteeEmail,
+		Role:           role,
+		Token:          token,
+		InvitedBy:      inviterID,
+		ExpiresAt:      s.clock.Now().Add(7 * 24 * time.Hour),
+	}
+	if err := s.store.Organizations().CreateInvitation(&invitation); err != nil {
+		return nil, fmt.Errorf("error creating invitation: %w", err)
+	}
+
+	inviterName := "Участник команды"
+	if inviter, err := s.userService.GetUserByID(inviterID); err == nil && inviter.FirstName != "" {
+		inviterName = strings.TrimSpace(inviter.FirstName + " " + inviter.LastName)
+	}
+
+	if err := email.SendOrganizationInvitation(inviteeEmail, organization.Name, inviterName, token); err != nil {
+		fmt.Printf("Ошибка отправки приглашения в организацию: %v\n", err)
+	}
+
+	return &invitation, nil
+}
+
+// AcceptInvitation добавляет пользователя в организацию по приглашению, отправленному на его email
+func (s *OrganizationService) AcceptInvitation(userID uint, token string) (*models.Organization, error) {
+	if token == "" {
+		return nil, errors.New("invitation token is required")
+	}
+
+	invitation, err := s.store.Organizations().FindInvitationByToken(token)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("invalid invitation token")
+		}
+		return nil, err
+	}
+
+	if invitation.AcceptedAt != nil || invitation.ExpiresAt.Before(s.clock.Now()) {
+		return nil, errors.New("invitation has expired or was already accepted")
+	}
+
+	user, err := s.userService.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return nil, errors.New("invitation was sent to another email")
+	}
+
+	err = s.store.Transaction(func(tx repository.Store) error {
+		_, err := tx.Organizations().FindMember(invitation.OrganizationID, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			if err := tx.Organizations().CreateMember(&models.OrganizationMember{
+				OrganizationID: invitation.OrganizationID,
+				UserID:         userID,
+				Role:           invitation.Role,
+			}); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		now := s.clock.Now()
+		invitation.AcceptedAt = &now
+		return tx.Organizations().SaveInvitation(invitation)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	organization, err := s.store.Organizations().FindByID(invitation.OrganizationID)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+
+	return organization, nil
+}
+
+// CanViewSubscription проверяет, что подписка принадлежит пользователю или его организации
+func (s *OrganizationService) CanViewSubscription(userID uint, subscription *models.Subscription) bool {
+	if subscription.OrganizationID == nil {
+		if subscription.UserID == userID {
+			return true
+		}
+		// Участники семейной подписки видят её, но не управляют ей
+		_, err := s.store.Family().FindMember(subscription.ID, userID)
+		return err == nil
+	}
+
+	_, err := s.GetMemberRole(*subscription.OrganizationID, userID)
+	return err == nil
+}
+
+// CanManageSubscription проверяет, что подписка принадлежит пользователю
+// или организации, в которой он может управлять подписками
+func (s *OrganizationService) CanManageSubscription(userID uint, subscription *models.Subscription) bool {
+	if subscription.OrganizationID == nil {
+		return subscription.UserID == userID
+	}
+
+	role, err := s.GetMemberRole(*subscription.OrganizationID, userID)
+	return err == nil && models.CanManageSubscriptions(role)
+}
+
+// RequireSubscriptionManagement проверяет право пользователя оформлять подписки от имени организации
+func (s *OrganizationService) RequireSubscriptionManagement(orgID, userID uint) error {
+	role, err := s.GetMemberRole(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if !models.CanManageSubscriptions(role) {
+		return errors.New("only owner or billing manager can manage organization subscriptions")
+	}
+	return nil
+}
+
+// GetOrganizationSubscriptions возвращает подписки организации
+func (s *OrganizationService) GetOrganizationSubscriptions(orgID, userID uint) ([]models.Subscription, error) {
+	if _, err := s.GetMemberRole(orgID, userID); err != nil {
+		return nil, err
+	}
+
+	return s.store.Subscriptions().FindByOrganization(orgID)
+}
+
+// GetOrganizationStats возвращает статистику и прогноз расходов организации
+func (s *OrganizationService) GetOrganizationStats(orgID, userID uint) (map[string]interface{}, error) {
+	if _, err := s.GetMemberRole(orgID, userID); err != nil {
+		return nil, err
+	}
+
+	subscriptions, err := s.store.Subscriptions().FindActiveByOrganization(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	membersCount, err := s.store.Organizations().CountMembers(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalMonthlySpending float64
+	spendingByServiceType := map[string]float64{}
+	for _, sub := range subscriptions {
+		billedPlan := sub.BilledPlan()
+		monthlyPrice := billedPlan.GetMonthlyPrice()
+		if math.IsNaN(monthlyPrice) || math.IsInf(monthlyPrice, 0) {
+			continue
+		}
+		totalMonthlySpending += monthlyPrice
+		spendingByServiceType[sub.Plan.ServiceType] += monthlyPrice
+	}
+
+	perMemberMonthlySpending := 0.0
+	if membersCount > 0 {
+		perMemberMonthlySpending = totalMonthlySpending / float64(membersCount)
+	}
+
+	now := s.clock.Now()
+	stats := map[string]interface{}{
+		"active_count":                len(subscriptions),
+		"members_count":               membersCount,
+		"total_monthly_spending":      totalMonthlySpending,
+		"per_member_monthly_spending": perMemberMonthlySpending,
+		"monthly_spending_by_type":    spendingByServiceType,
+		"forecast_next_30_days":       models.ForecastSpending(subscriptions, now, now.AddDate(0, 0, 30)),
+		"forecast_next_12_months":     models.ForecastSpending(subscriptions, now, now.AddDate(1, 0, 0)),
+	}
+
+	return stats, nil
+}
+
+func (s *OrganizationService) requireMemberManagement(orgID, userID uint) error {
+	role, err := s.GetMemberRole(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if !models.CanManageMembers(role) {
+		return errors.New("only organization owner can manage members")
+	}
+	return nil
+}
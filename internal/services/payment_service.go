@@ -0,0 +1,365 @@
+package services
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+// paymentSignatureTolerance - допустимое расхождение метки времени подписи с часами сервера.
+// Более старые запросы отклоняются, даже если подпись верна
+const paymentSignatureTolerance = 5 * time.Minute
+
+var (
+	// ErrPaymentWebhookDisabled - ключ подписи провайдера не настроен, входящие события не принимаются
+	ErrPaymentWebhookDisabled = errors.New("payment webhook is not configured")
+	// ErrInvalidPaymentSignature - подпись запроса отсутствует, неверна или устарела
+	ErrInvalidPaymentSignature = errors.New("invalid payment webhook signature")
+	// ErrPaymentSubscriptionNotFound - событие ссылается на неизвестную подписку
+	ErrPaymentSubscriptionNotFound = errors.New("subscription for payment event not found")
+	// ErrPaymentGiftNotFound - событие ссылается на неизвестный подарок
+	ErrPaymentGiftNotFound = errors.New("gift for payment event not found")
+	// ErrPaymentInvoiceNotFound - событие ссылается на неизвестный счёт
+	ErrPaymentInvoiceNotFound = errors.New("invoice for payment event not found")
+	// ErrInvalidPaymentEvent - тело события не разбирается или в нём нет обязательных полей
+	ErrInvalidPaymentEvent = errors.New("invalid payment event")
+	// ErrPaymentEventConflict - событие нельзя применить к текущему состоянию счёта или подарка
+	ErrPaymentEventConflict = errors.New("payment event conflicts with the current state")
+)
+
+type PaymentService struct {
+	store  repository.Store
+	clock  Clock
+	events *EventBus
+}
+
+func NewPaymentService(store repository.Store, clock Clock, events *EventBus) *PaymentService {
+	return &PaymentService{store: store, clock: clock, events: events}
+}
+
+// PaymentEventInput - событие платёжного провайдера. Подписка указывается нашим идентификатором
+// или идентификатором у провайдера; оплата подарка - идентификатором подарка
+type PaymentEventInput struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		SubscriptionID         uint    `json:"subscription_id"`
+		ProviderSubscriptionID string  `json:"provider_subscription_id"`
+		InvoiceID              uint    `json:"invoice_id"`
+		GiftID                 uint    `json:"gift_id"`
+		PaymentID              string  `json:"payment_id"`
+		Amount                 float64 `json:"amount"`
+	} `json:"data"`
+}
+
+// GetSecret возвращает ключ подписи входящих событий провайдера
+func (s *PaymentService) GetSecret() string {
+	return os.Getenv("PAYMENT_WEBHOOK_SECRET")
+}
+
+// VerifySignature проверяет заголовок подписи вида "t=<timestamp>,v1=<hex>".
+// Подпись считается так же, как у исходящих событий: HMAC-SHA256 от строки "timestamp.payload"
+func (s *PaymentService) VerifySignature(header string, payload []byte) error {
+	secret := s.GetSecret()
+	if secret == "" {
+		return ErrPaymentWebhookDisabled
+	}
+
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrInvalidPaymentSignature
+	}
+	age := s.clock.Now().Sub(time.Unix(timestamp, 0))
+	if age > paymentSignatureTolerance || age < -paymentSignatureTolerance {
+		return ErrInvalidPaymentSignature
+	}
+
+	expected := models.SignWebhookPayload(secret, timestamp, payload)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidPaymentSignature
+}
+
+// HandleEvent проверяет подпись и применяет событие провайдера. Событие с уже обработанным
+// идентификатором не применяется повторно: возвращается сохранённая запись и duplicate = true
+func (s *PaymentService) HandleEvent(signature string, payload []byte) (*models.PaymentEvent, bool, error) {
+	if err := s.VerifySignature(signature, payload); err != nil {
+		return nil, false, err
+	}
+
+	var input PaymentEventInput
+	if err := json.Unmarshal(payload, &input); err != nil {
+		return nil, false, fmt.Errorf("%w: malformed JSON", ErrInvalidPaymentEvent)
+	}
+	input.ID = strings.TrimSpace(input.ID)
+	if input.ID == "" || input.Type == "" {
+		return nil, false, fmt.Errorf("%w: event id and type are required", ErrInvalidPaymentEvent)
+	}
+	if len(input.ID) > 255 {
+		return nil, false, fmt.Errorf("%w: event id is too long", ErrInvalidPaymentEvent)
+	}
+
+	var event *models.PaymentEvent
+	duplicate := false
+	err := s.store.Transaction(func(tx repository.Store) error {
+		existing, err := tx.PaymentEvents().FindByEventID(input.ID)
+		if err == nil {
+			event = existing
+			duplicate = true
+			return nil
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		now := s.clock.Now()
+		event = &models.PaymentEvent{
+			CreatedAt: now,
+			EventID:   input.ID,
+			Type:      input.Type,
+			Result:    models.PaymentEventProcessed,
+			Payload:   payload,
+		}
+		if err := s.apply(tx, &input, event, now); err != nil {
+			return err
+		}
+		return tx.PaymentEvents().Create(event)
+	})
+	// Одновременно доставленная копия события успела сохраниться первой; изменения этой копии отменены
+	if errors.Is(err, repository.ErrDuplicate) {
+		existing, findErr := s.store.PaymentEvents().FindByEventID(input.ID)
+		if findErr != nil {
+			return nil, false, findErr
+		}
+		return existing, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return event, duplicate, nil
+}
+
+// apply меняет подписку и счета по событию и отмечает в event затронутые записи
+func (s *PaymentService) apply(tx repository.Store, input *PaymentEventInput, event *models.PaymentEvent, now time.Time) error {
+	if input.Data.GiftID != 0 {
+		if input.Type != models.PaymentEventPaymentSucceeded {
+			event.Result = models.PaymentEventIgnored
+			return nil
+		}
+		return s.applyGiftPayment(tx, input, event, now)
+	}
+
+	switch input.Type {
+	case models.PaymentEventPaymentSucceeded, models.PaymentEventPaymentFailed, models.PaymentEventSubscriptionCancelled:
+	case models.PaymentEventPaymentRefunded:
+		return s.applyRefund(tx, input, event)
+	default:
+		event.Result = models.PaymentEventIgnored
+		return nil
+	}
+
+	subscription, err := findPaymentSubscription(tx, input)
+	if err != nil {
+		return err
+	}
+	event.SubscriptionID = &subscription.ID
+	before := *subscription
+
+	if input.Type == models.PaymentEventSubscriptionCancelled {
+		if subscription.Status != "active" && subscription.Status != "past_due" {
+			event.Result = models.PaymentEventIgnored
+			return nil
+		}
+		subscription.Status = "cancelled"
+		subscription.AutoRenew = false
+		subscription.CancelledAt = &now
+		if err := tx.Subscriptions().Save(subscription); err != nil {
+			return err
+		}
+		return recordEvent(tx, s.events, models.SubscriptionEventCancelled, &before, subscription, 0, now)
+	}
+
+	invoice, err := findPaymentInvoice(tx, subscription.ID, input)
+	if err != nil {
+		return err
+	}
+	if invoice != nil {
+		event.InvoiceID = &invoice.ID
+		if input.Type == models.PaymentEventPaymentSucceeded {
+			if err := invoice.MarkPaid(input.Data.PaymentID, now); err != nil {
+				return fmt.Errorf("%w: %v", ErrPaymentEventConflict, err)
+			}
+		} else if invoice.Status == models.InvoiceStatusPaid || invoice.Status == models.InvoiceStatusRefunded {
+			// Неудачная попытка по уже оплаченному или возвращённому счёту (например, запоздавшая) не делает подписку просроченной
+			event.Result = models.PaymentEventIgnored
+			return nil
+		} else {
+			invoice.MarkPaymentFailed(input.Data.PaymentID)
+		}
+		if err := tx.Invoices().Save(invoice); err != nil {
+			return err
+		}
+	}
+
+	eventType := ""
+	if input.Type == models.PaymentEventPaymentSucceeded {
+		if input.Data.PaymentID != "" {
+			subscription.PaymentID = input.Data.PaymentID
+		}
+		if input.Data.ProviderSubscriptionID != "" {
+			subscription.StripeSubID = input.Data.ProviderSubscriptionID
+		}
+		if subscription.Status == "past_due" {
+			subscription.Status = "active"
+			eventType = models.SubscriptionEventPaymentRecovered
+		}
+	} else if subscription.Status == "active" {
+		subscription.Status = "past_due"
+		eventType = models.SubscriptionEventPaymentFailed
+	}
+
+	if err := tx.Subscriptions().Save(subscription); err != nil {
+		return err
+	}
+	if eventType == "" {
+		return nil
+	}
+	return recordEvent(tx, s.events, eventType, &before, subscription, 0, now)
+}
+
+// applyGiftPayment отмечает подарок оплаченным; код отправляется получателю после фиксации транзакции
+func (s *PaymentService) applyGiftPayment(tx repository.Store, input *PaymentEventInput, event *models.PaymentEvent, now time.Time) error {
+	gift, err := tx.Gifts().FindByID(input.Data.GiftID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrPaymentGiftNotFound
+		}
+		return err
+	}
+	if gift.Status != models.GiftStatusAwaitingPayment {
+		event.Result = models.PaymentEventIgnored
+		return nil
+	}
+	if models.RoundMoney(input.Data.Amount) < gift.Price {
+		return fmt.Errorf("%w: payment amount does not cover the gift price", ErrPaymentEventConflict)
+	}
+
+	gift.Status = models.GiftStatusPending
+	gift.PaymentID = input.Data.PaymentID
+	if err := tx.Gifts().Save(gift); err != nil {
+		return err
+	}
+	s.events.Publish(tx, GiftPaid{Gift: *gift, At: now})
+	return nil
+}
+
+// applyRefund учитывает возврат по счёту, найденному по платежу или идентификатору счёта
+func (s *PaymentService) applyRefund(tx repository.Store, input *PaymentEventInput, event *models.PaymentEvent) error {
+	var invoice *models.Invoice
+	var err error
+	switch {
+	case input.Data.PaymentID != "":
+		invoice, err = tx.Invoices().FindByPaymentID(input.Data.PaymentID)
+	case input.Data.InvoiceID != 0:
+		invoice, err = tx.Invoices().FindByID(input.Data.InvoiceID)
+	default:
+		return fmt.Errorf("%w: payment_id or invoice_id is required for a refund", ErrInvalidPaymentEvent)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrPaymentInvoiceNotFound
+		}
+		return err
+	}
+	// Блокировка подписки не даёт параллельным возвратам по счетам подписки превысить оплаченную сумму
+	if _, err := tx.Subscriptions().FindByIDForUpdate(invoice.SubscriptionID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	if invoice, err = tx.Invoices().FindByID(invoice.ID); err != nil {
+		return err
+	}
+
+	event.SubscriptionID = &invoice.SubscriptionID
+	event.InvoiceID = &invoice.ID
+	if err := invoice.Refund(models.RoundMoney(input.Data.Amount)); err != nil {
+		return fmt.Errorf("%w: %v", ErrPaymentEventConflict, err)
+	}
+	return tx.Invoices().Save(invoice)
+}
+
+// findPaymentSubscription находит подписку события и блокирует её строку до конца транзакции
+func findPaymentSubscription(tx repository.Store, input *PaymentEventInput) (*models.Subscription, error) {
+	subscriptionID := input.Data.SubscriptionID
+	if subscriptionID == 0 && input.Data.ProviderSubscriptionID != "" {
+		subscription, err := tx.Subscriptions().FindByProviderSubscriptionID(input.Data.ProviderSubscriptionID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrPaymentSubscriptionNotFound
+			}
+			return nil, err
+		}
+		subscriptionID = subscription.ID
+	}
+	if subscriptionID == 0 {
+		return nil, ErrPaymentSubscriptionNotFound
+	}
+
+	subscription, err := tx.Subscriptions().FindByIDForUpdate(subscriptionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrPaymentSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// findPaymentInvoice возвращает счёт из события, а если он не указан - последний неоплаченный счёт подписки.
+// nil без ошибки означает, что оплачивать нечего
+func findPaymentInvoice(tx repository.Store, subscriptionID uint, input *PaymentEventInput) (*models.Invoice, error) {
+	if input.Data.InvoiceID != 0 {
+		invoice, err := tx.Invoices().FindByID(input.Data.InvoiceID)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && invoice.SubscriptionID != subscriptionID) {
+			return nil, ErrPaymentInvoiceNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return invoice, nil
+	}
+
+	invoices, err := tx.Invoices().FindBySubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range invoices {
+		if invoices[i].Status == models.InvoiceStatusOpen || invoices[i].Status == models.InvoiceStatusPaymentFailed {
+			return &invoices[i], nil
+		}
+	}
+	return nil, nil
+}
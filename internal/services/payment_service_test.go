@@ -0,0 +1,64 @@
+package services_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lateEventStore не находит событие провайдера при первой проверке в транзакции: так воспроизводится
+// копия события, сохранённая параллельным запросом между проверкой и вставкой
+type lateEventStore struct {
+	*repository.MemoryStore
+	hidden bool
+}
+
+func (s *lateEventStore) Transaction(fn func(tx repository.Store) error) error {
+	return s.MemoryStore.Transaction(func(tx repository.Store) error {
+		return fn(&lateEventTx{Store: tx, owner: s})
+	})
+}
+
+type lateEventTx struct {
+	repository.Store
+	owner *lateEventStore
+}
+
+func (tx *lateEventTx) PaymentEvents() repository.PaymentEventRepository {
+	return &lateEvents{PaymentEventRepository: tx.Store.PaymentEvents(), owner: tx.owner}
+}
+
+type lateEvents struct {
+	repository.PaymentEventRepository
+	owner *lateEventStore
+}
+
+func (r *lateEvents) FindByEventID(eventID string) (*models.PaymentEvent, error) {
+	if !r.owner.hidden {
+		r.owner.hidden = true
+		return nil, repository.ErrNotFound
+	}
+	return r.PaymentEventRepository.FindByEventID(eventID)
+}
+
+func TestPaymentEventInsertedConcurrentlyIsDuplicate(t *testing.T) {
+	_, memory, clock, _ := newSubscriptionFixture(t)
+	t.Setenv("PAYMENT_WEBHOOK_SECRET", "secret")
+	require.NoError(t, memory.PaymentEvents().Create(&models.PaymentEvent{
+		EventID: "evt_1", Type: "invoice.created", Result: models.PaymentEventIgnored,
+	}))
+	service := services.NewPaymentService(&lateEventStore{MemoryStore: memory}, clock, services.NewEventBus())
+
+	payload := []byte(`{"id": "evt_1", "type": "invoice.created"}`)
+	timestamp := clock.now.Unix()
+	signature := fmt.Sprintf("t=%d,v1=%s", timestamp, models.SignWebhookPayload("secret", timestamp, payload))
+	event, duplicate, err := service.HandleEvent(signature, payload)
+	require.NoError(t, err)
+	assert.True(t, duplicate)
+	assert.Equal(t, "evt_1", event.EventID)
+}
@@ -2,71 +2,344 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
-	"github.com/saneechka/ManageSubscription/internal/app"
 	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
 )
 
 
-type PlanService struct{}
+type PlanService struct {
+	store  repository.Store
+	clock  Clock
+	events *EventBus
+}
 
 
-func NewPlanService() *PlanService {
-	return &PlanService{}
+func NewPlanService(store repository.Store, clock Clock, events *EventBus) *PlanService {
+	return &PlanService{store: store, clock: clock, events: events}
 }
 
 
 func (s *PlanService) GetAllPlans() ([]models.Plan, error) {
-	var plans []models.Plan
-	if err := app.DB.Find(&plans).Error; err != nil {
-		return nil, err
-	}
-	return plans, nil
+	return s.store.Plans().FindAll()
 }
 
 
 func (s *PlanService) GetPlanByID(id uint) (*models.Plan, error) {
-	var plan models.Plan
-	result := app.DB.First(&plan, id)
-	if result.Error != nil {
+	plan, err := s.store.Plans().FindByID(id)
+	if err != nil {
 		return nil, errors.New("plan not found")
 	}
-	return &plan, nil
+	return plan, nil
 }
 
 
 func (s *PlanService) CreatePlan(plan *models.Plan) error {
-	return app.DB.Create(plan).Error
+	normalizeSeats(plan)
+	return s.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Plans().Create(plan); err != nil {
+			return err
+		}
+		version := models.NewPlanVersion(plan, 1, s.clock.Now())
+		return tx.Plans().CreateVersion(&version)
+	})
 }
 
 
+// UpdatePlan сохраняет план. Изменение периода создаёт новую версию плана, текущие подписки
+// остаются на своей версии до продления. Цена напрямую не меняется: возвращается ErrPriceChangeNeedsNotice,
+// новую цену планирует PriceChangeService.SchedulePriceChange. Пока у плана есть запланированное
+// изменение цены, условия плана не меняются: возвращается ErrPriceChangePending
 func (s *PlanService) UpdatePlan(plan *models.Plan) error {
-	var existingPlan models.Plan
-	result := app.DB.First(&existingPlan, plan.ID)
-	if result.Error != nil {
-		return errors.New("plan not found")
+	normalizeSeats(plan)
+
+	return s.store.Transaction(func(tx repository.Store) error {
+		stored, err := tx.Plans().FindByIDForUpdate(plan.ID)
+		if err != nil {
+			return errors.New("plan not found")
+		}
+		// Условия до изменения должны остаться в истории
+		current, err := currentPlanVersion(tx, plan.ID, s.clock.Now())
+		if err != nil {
+			return err
+		}
+		if !current.HasTermsOf(plan) {
+			// Новая версия вступила бы в силу сразу и незаметно отменила бы запланированную
+			if _, err := tx.PriceChanges().FindPendingByPlan(plan.ID); err == nil {
+				return ErrPriceChangePending
+			} else if !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+		}
+		if plan.Price != stored.Price {
+			return ErrPriceChangeNeedsNotice
+		}
+		if err := tx.Plans().Save(plan); err != nil {
+			return err
+		}
+		if current.HasTermsOf(plan) {
+			return nil
+		}
+
+		// Номер берём у последней версии: она может быть запланированной на будущее
+		latest, err := tx.Plans().FindLatestVersion(plan.ID)
+		if err != nil {
+			return err
+		}
+		version := models.NewPlanVersion(plan, latest.Version+1, s.clock.Now())
+		return tx.Plans().CreateVersion(&version)
+	})
+}
+
+
+// normalizeSeats делает план без указанного числа мест индивидуальным
+func normalizeSeats(plan *models.Plan) {
+	if plan.Seats < 1 {
+		plan.Seats = 1
 	}
-	return app.DB.Save(plan).Error
 }
 
 
-func (s *PlanService) DeletePlan(id uint) error {
-	var plan models.Plan
-	result := app.DB.First(&plan, id)
-	if result.Error != nil {
-		return errors.New("plan not found")
+// GetPriceHistory возвращает версии плана от первой до действующей
+func (s *PlanService) GetPriceHistory(planID uint) ([]models.PlanVersion, error) {
+	plan, err := s.store.Plans().FindByID(planID)
+	if err != nil {
+		return nil, errors.New("plan not found")
+	}
+
+	versions, err := s.store.Plans().FindVersions(planID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		// План создан до появления версий и ещё не менялся
+		versions = []models.PlanVersion{models.NewPlanVersion(plan, 1, plan.CreatedAt)}
+	}
+	return versions, nil
+}
+
+
+// currentPlanVersion возвращает версию плана, действующую в момент now. Для планов,
+// созданных в обход PlanService (начальные данные), первая версия создаётся при обращении
+func currentPlanVersion(tx repository.Store, planID uint, now time.Time) (*models.PlanVersion, error) {
+	version, err := tx.Plans().FindEffectiveVersion(planID, now)
+	if err == nil {
+		return version, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	versions, err := tx.Plans().FindVersions(planID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) > 0 {
+		// Момент раньше первой версии: действуют её условия
+		return &versions[0], nil
+	}
+
+	plan, err := tx.Plans().FindByID(planID)
+	if err != nil {
+		return nil, err
+	}
+	effectiveFrom := plan.CreatedAt
+	if effectiveFrom.IsZero() {
+		effectiveFrom = now
+	}
+	first := models.NewPlanVersion(plan, 1, effectiveFrom)
+	if err := tx.Plans().CreateVersion(&first); err != nil {
+		return nil, err
 	}
+	return &first, nil
+}
+
+
+// Политики удаления плана, на который есть активные подписки
+const (
+	// PlanDeletionBlock запрещает удаление, пока есть активные подписки
+	PlanDeletionBlock = "block"
+	// PlanDeletionArchive снимает план с продажи, не трогая текущих подписчиков
+	PlanDeletionArchive = "archive"
+	// PlanDeletionMigrate переводит активные подписки на другой план и удаляет этот
+	PlanDeletionMigrate = "migrate"
+)
+
+// ErrPlanHasSubscribers возвращается при удалении плана с активными подписками
+var ErrPlanHasSubscribers = errors.New("plan has active subscriptions")
 
 
-	return app.DB.Delete(&plan).Error
+type PlanDeletionResult struct {
+	Policy                string `json:"policy"`
+	Archived              bool   `json:"archived"`
+	MigratedSubscriptions int64  `json:"migrated_subscriptions"`
+}
+
+
+// DeletePlan удаляет план по политике policy. actorID - администратор, переводы подписок на другой план
+// попадают в их историю от его имени
+func (s *PlanService) DeletePlan(id uint, policy string, replacementID uint, actorID uint) (*PlanDeletionResult, error) {
+	plan, err := s.store.Plans().FindByID(id)
+	if err != nil {
+		return nil, errors.New("plan not found")
+	}
+
+	if policy == "" {
+		policy = PlanDeletionBlock
+	}
+	result := &PlanDeletionResult{Policy: policy}
+
+	switch policy {
+	case PlanDeletionBlock:
+		// Строка плана блокируется до удаления: новая подписка на план ждёт проверки и не проходит после неё
+		err = s.store.Transaction(func(tx repository.Store) error {
+			if _, err := tx.Plans().FindByIDForUpdate(id); err != nil {
+				return errors.New("plan not found")
+			}
+			count, err := tx.Subscriptions().CountActiveByPlan(id)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("%w: %d subscribers, archive the plan or migrate them to another plan", ErrPlanHasSubscribers, count)
+			}
+			return tx.Plans().Delete(id)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+
+	case PlanDeletionArchive:
+		plan.IsActive = false
+		result.Archived = true
+		return result, s.store.Plans().Save(plan)
+
+	case PlanDeletionMigrate:
+		if replacementID == 0 || replacementID == id {
+			return nil, errors.New("replacement plan is required")
+		}
+		replacement, err := s.store.Plans().FindByID(replacementID)
+		if err != nil || !replacement.IsActive {
+			return nil, errors.New("replacement plan not found or is not active")
+		}
+
+		err = s.store.Transaction(func(tx repository.Store) error {
+			if _, err := tx.Plans().FindByIDForUpdate(id); err != nil {
+				return errors.New("plan not found")
+			}
+			now := s.clock.Now()
+			version, err := currentPlanVersion(tx, replacementID, now)
+			if err != nil {
+				return err
+			}
+			subscriptions, err := tx.Subscriptions().FindActiveByPlan(id)
+			if err != nil {
+				return err
+			}
+			moved, err := tx.Subscriptions().MoveActiveToPlan(id, version)
+			if err != nil {
+				return err
+			}
+			for i := range subscriptions {
+				migrated := subscriptions[i]
+				migrated.PlanID = version.PlanID
+				migrated.PlanVersionID = &version.ID
+				if err := recordEvent(tx, s.events, models.SubscriptionEventPlanChanged, &subscriptions[i], &migrated, actorID, now); err != nil {
+					return err
+				}
+			}
+			result.MigratedSubscriptions = moved
+			return tx.Plans().Delete(id)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+
+	default:
+		return nil, fmt.Errorf("unknown deletion policy %q", policy)
+	}
 }
 
 
 func (s *PlanService) GetPlansByPrice(minPrice, maxPrice float64) ([]models.Plan, error) {
-	var plans []models.Plan
-	if err := app.DB.Where("price >= ? AND price <= ?", minPrice, maxPrice).
-		Find(&plans).Error; err != nil {
+	return s.store.Plans().FindByPriceRange(minPrice, maxPrice)
+}
+
+
+// GetPlanFeatures возвращает функции плана
+func (s *PlanService) GetPlanFeatures(planID uint) ([]models.PlanFeature, error) {
+	if _, err := s.store.Plans().FindByID(planID); err != nil {
+		return nil, errors.New("plan not found")
+	}
+	return s.store.Plans().FindFeatures(planID)
+}
+
+
+// SetPlanFeatures заменяет функции плана. Ключи функций должны быть уникальны в пределах плана
+func (s *PlanService) SetPlanFeatures(planID uint, features []models.PlanFeature) ([]models.PlanFeature, error) {
+	if _, err := s.store.Plans().FindByID(planID); err != nil {
+		return nil, errors.New("plan not found")
+	}
+
+	keys := make(map[string]bool, len(features))
+	for i := range features {
+		if err := features[i].Validate(); err != nil {
+			return nil, err
+		}
+		if keys[features[i].Key] {
+			return nil, fmt.Errorf("duplicate feature key %q", features[i].Key)
+		}
+		keys[features[i].Key] = true
+		features[i].ID = 0
+	}
+
+	err := s.store.Transaction(func(tx repository.Store) error {
+		return tx.Plans().ReplaceFeatures(planID, features)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.store.Plans().FindFeatures(planID)
+}
+
+
+// GetMeteredComponents возвращает оплачиваемые по факту составляющие плана
+func (s *PlanService) GetMeteredComponents(planID uint) ([]models.MeteredComponent, error) {
+	if _, err := s.store.Plans().FindByID(planID); err != nil {
+		return nil, errors.New("plan not found")
+	}
+	return s.store.Plans().FindMeteredComponents(planID)
+}
+
+
+// SetMeteredComponents заменяет составляющие плана. Изменения применяются к расчёту
+// текущих периодов, уже выставленные счета не меняются
+func (s *PlanService) SetMeteredComponents(planID uint, components []models.MeteredComponent) ([]models.MeteredComponent, error) {
+	if _, err := s.store.Plans().FindByID(planID); err != nil {
+		return nil, errors.New("plan not found")
+	}
+
+	keys := make(map[string]bool, len(components))
+	for i := range components {
+		if err := components[i].Validate(); err != nil {
+			return nil, err
+		}
+		if keys[components[i].Key] {
+			return nil, fmt.Errorf("duplicate component key %q", components[i].Key)
+		}
+		keys[components[i].Key] = true
+		components[i].ID = 0
+	}
+
+	err := s.store.Transaction(func(tx repository.Store) error {
+		return tx.Plans().ReplaceMeteredComponents(planID, components)
+	})
+	if err != nil {
 		return nil, err
 	}
-	return plans, nil
+	return s.store.Plans().FindMeteredComponents(planID)
 }
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/pkg/email"
+)
+
+// ErrPriceChangePending возвращается, если у плана уже есть запланированное изменение цены
+var ErrPriceChangePending = errors.New("plan already has a scheduled price change")
+
+// ErrPriceChangeNeedsNotice возвращается при попытке изменить цену плана напрямую: новая цена
+// планируется через SchedulePriceChange, чтобы подписчики получили уведомление и могли отказаться
+var ErrPriceChangeNeedsNotice = errors.New("plan price cannot be changed directly, schedule a price change so subscribers are notified")
+
+// PriceChangeService планирует изменения цен планов и уведомляет подписчиков
+type PriceChangeService struct {
+	store               repository.Store
+	clock               Clock
+	subscriptionService *SubscriptionService
+	userService         *UserService
+}
+
+// NewPriceChangeService создает новый экземпляр сервиса изменения цен
+func NewPriceChangeService(store repository.Store, clock Clock, subscriptionService *SubscriptionService, userService *UserService) *PriceChangeService {
+	return &PriceChangeService{
+		store:               store,
+		clock:               clock,
+		subscriptionService: subscriptionService,
+		userService:         userService,
+	}
+}
+
+// GetNoticePeriod возвращает минимальный срок между уведомлением и вступлением новой цены в силу
+func (s *PriceChangeService) GetNoticePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("PRICE_CHANGE_NOTICE_DAYS"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// SchedulePriceChange создает версию плана с новой ценой, действующую с effectiveFrom, и рассылает
+// уведомления активным подписчикам с автопродлением. Нулевая дата - ближайшая допустимая
+func (s *PriceChangeService) SchedulePriceChange(planID uint, newPrice float64, effectiveFrom time.Time) (*models.PriceChange, error) {
+	if newPrice <= 0 {
+		return nil, errors.New("price must be positive")
+	}
+	now := s.clock.Now()
+	earliest := now.Add(s.GetNoticePeriod())
+	if effectiveFrom.IsZero() {
+		effectiveFrom = earliest
+	}
+	if effectiveFrom.Before(earliest) {
+		return nil, fmt.Errorf("effective date must be on or after %s to give subscribers notice", earliest.Format("2006-01-02"))
+	}
+
+	var plan *models.Plan
+	var change models.PriceChange
+	var notices []models.PriceChangeNotice
+	err := s.store.Transaction(func(tx repository.Store) error {
+		// Строка плана блокируется, чтобы параллельный запрос не запланировал второе изменение
+		var err error
+		plan, err = tx.Plans().FindByIDForUpdate(planID)
+		if err != nil {
+			return errors.New("plan not found")
+		}
+		if _, err := tx.PriceChanges().FindPendingByPlan(planID); err == nil {
+			return ErrPriceChangePending
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		current, err := currentPlanVersion(tx, planID, now)
+		if err != nil {
+			return err
+		}
+		if current.Price == newPrice {
+			return errors.New("new price equals the current price")
+		}
+		latest, err := tx.Plans().FindLatestVersion(planID)
+		if err != nil {
+			return err
+		}
+
+		version := models.NewPlanVersion(plan, latest.Version+1, effectiveFrom)
+		version.Price = newPrice
+		if err := tx.Plans().CreateVersion(&version); err != nil {
+			return err
+		}
+
+		change = models.PriceChange{
+			PlanID:        planID,
+			PlanVersionID: version.ID,
+			OldPrice:      current.Price,
+			NewPrice:      newPrice,
+			EffectiveFrom: effectiveFrom,
+		}
+		if err := tx.PriceChanges().Create(&change); err != nil {
+			return err
+		}
+
+		subscriptions, err := tx.Subscriptions().FindActiveByPlan(planID)
+		if err != nil {
+			return err
+		}
+		for _, subscription := range subscriptions {
+			appliesFrom, affected := s.firstRenewalAtNewPrice(&subscription, effectiveFrom)
+			if !affected {
+				continue
+			}
+
+			token, err := s.userService.generateVerificationToken()
+			if err != nil {
+				return fmt.Errorf("error generating notice token: %w", err)
+			}
+			notice := models.PriceChangeNotice{
+				PriceChangeID:  change.ID,
+				SubscriptionID: subscription.ID,
+				UserID:         subscription.UserID,
+				AppliesFrom:    appliesFrom,
+				Token:          token,
+			}
+			if err := tx.PriceChanges().CreateNotice(&notice); err != nil {
+				return err
+			}
+			notices = append(notices, notice)
+		}
+
+		change.NotifiedCount = len(notices)
+		return tx.PriceChanges().Save(&change)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, notice := range notices {
+		user, err := s.store.Users().FindByID(notice.UserID)
+		if err != nil {
+			continue
+		}
+		userName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+		if userName == "" {
+			userName = "подписчик"
+		}
+		err = email.SendPriceChangeNotice(user.Email, userName, plan.Name, change.OldPrice, change.NewPrice, notice.AppliesFrom, notice.Token)
+		if err != nil {
+			fmt.Printf("Ошибка отправки уведомления об изменении цены: %v\n", err)
+		}
+	}
+
+	return &change, nil
+}
+
+// firstRenewalAtNewPrice возвращает дату первого продления подписки по новой цене с учётом
+// сохранения старых условий. Подписки без автопродления и с бессрочно сохранёнными условиями
+// изменение не затрагивает
+func (s *PriceChangeService) firstRenewalAtNewPrice(subscription *models.Subscription, effectiveFrom time.Time) (time.Time, bool) {
+	if !subscription.AutoRenew {
+		return time.Time{}, false
+	}
+
+	threshold := effectiveFrom
+	if subscription.PlanVersion != nil {
+		period, forever := s.subscriptionService.GetGrandfatherPeriod()
+		if forever {
+			return time.Time{}, false
+		}
+		threshold = threshold.Add(period)
+	}
+
+	plan := subscription.BilledPlan()
+	renewal := subscription.EndDate
+	for renewal.Before(threshold) {
+		next := plan.CalculateEndDate(renewal)
+		// Защита от бесконечного цикла для планов с нулевой длительностью
+		if !next.After(renewal) {
+			return time.Time{}, false
+		}
+		renewal = next
+	}
+	return renewal, true
+}
+
+// GetPriceChanges возвращает изменения цены плана, последние первыми
+func (s *PriceChangeService) GetPriceChanges(planID uint) ([]models.PriceChange, error) {
+	if _, err := s.store.Plans().FindByID(planID); err != nil {
+		return nil, errors.New("plan not found")
+	}
+	return s.store.PriceChanges().FindByPlan(planID)
+}
+
+// DeclinePriceChange отключает автопродление подписки по ссылке из уведомления, чтобы она
+// закончилась до перехода на новую цену
+func (s *PriceChangeService) DeclinePriceChange(token string) (*models.PriceChangeNotice, error) {
+	var notice *models.PriceChangeNotice
+	err := s.store.Transaction(func(tx repository.Store) (err error) {
+		// Уведомление блокируется: повторный переход по ссылке ждёт первый и не учитывает отказ дважды
+		notice, err = tx.PriceChanges().FindNoticeByTokenForUpdate(token)
+		if err != nil {
+			return errors.New("price change notice not found")
+		}
+		if notice.DeclinedAt != nil {
+			return nil
+		}
+
+		now := s.clock.Now()
+		if !now.Before(notice.AppliesFrom) {
+			return errors.New("new price already applies to this subscription")
+		}
+
+		subscription, err := tx.Subscriptions().FindByIDForUpdate(notice.SubscriptionID)
+		if err != nil {
+			return errors.New("подписка не найдена")
+		}
+		// Отказы от одного изменения цены считаются по одной строке
+		change, err := tx.PriceChanges().FindByIDForUpdate(notice.PriceChangeID)
+		if err != nil {
+			return err
+		}
+		// Продление происходит заранее, до окончания периода
+		if subscription.PlanVersionID != nil && *subscription.PlanVersionID == change.PlanVersionID {
+			return errors.New("new price already applies to this subscription")
+		}
+
+		if subscription.Status == "active" && subscription.AutoRenew {
+			before := *subscription
+			subscription.AutoRenew = false
+			if err := tx.Subscriptions().Save(subscription); err != nil {
+				return err
+			}
+			// Ссылка для отказа приходит владельцу подписки на email
+			if err := recordEvent(tx, s.subscriptionService.events, models.SubscriptionEventAutoRenewChanged, &before, subscription, subscription.UserID, now); err != nil {
+				return err
+			}
+		}
+
+		notice.DeclinedAt = &now
+		if err := tx.PriceChanges().SaveNotice(notice); err != nil {
+			return err
+		}
+
+		change.DeclinedCount++
+		return tx.PriceChanges().Save(change)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notice, nil
+}
+
+// ApplyDuePriceChanges переносит в каталог цены, вступившие в силу, и возвращает их количество
+func (s *PriceChangeService) ApplyDuePriceChanges() (int, error) {
+	now := s.clock.Now()
+	changes, err := s.store.PriceChanges().FindDue(now)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, change := range changes {
+		err := s.store.Transaction(func(tx repository.Store) error {
+			plan, err := tx.Plans().FindByID(change.PlanID)
+			if err == nil {
+				plan.Price = change.NewPrice
+				if err := tx.Plans().Save(plan); err != nil {
+					return err
+				}
+			} else if !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+
+			change.AppliedAt = &now
+			return tx.PriceChanges().Save(&change)
+		})
+		if err != nil {
+			return applied, fmt.Errorf("error applying price change %d: %w", change.ID, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
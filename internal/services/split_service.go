@@ -0,0 +1,303 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+type SplitService struct {
+	store repository.Store
+	clock Clock
+}
+
+func NewSplitService(store repository.Store, clock Clock) *SplitService {
+	return &SplitService{store: store, clock: clock}
+}
+
+// SplitParticipantInput - участник разделения: зарегистрированный пользователь по email
+// или человек без аккаунта по имени
+type SplitParticipantInput struct {
+	Email string  `json:"email"`
+	Name  string  `json:"name"`
+	Share float64 `json:"share"`
+}
+
+// SplitConfig - способ разделения и полный список участников
+type SplitConfig struct {
+	Mode         string                  `json:"mode" binding:"required"`
+	Participants []SplitParticipantInput `json:"participants"`
+}
+
+// GetSplit возвращает разделение подписки владельцу или зарегистрированному участнику
+func (s *SplitService) GetSplit(userID, subscriptionID uint) (*models.CostSplit, error) {
+	split, err := s.store.Splits().FindBySubscription(subscriptionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("cost split not found")
+		}
+		return nil, err
+	}
+	if split.OwnerID != userID && split.ParticipantByUser(userID) == nil {
+		return nil, errors.New("cost split not found")
+	}
+	return split, nil
+}
+
+// GetSplits возвращает разделения подписок пользователя и разделения, в которых он участвует
+func (s *SplitService) GetSplits(userID uint) ([]models.CostSplit, error) {
+	owned, err := s.store.Splits().FindByOwner(userID)
+	if err != nil {
+		return nil, err
+	}
+	participating, err := s.store.Splits().FindByParticipant(userID)
+	if err != nil {
+		return nil, err
+	}
+	return append(owned, participating...), nil
+}
+
+// SetSplit задаёт разделение стоимости личной подписки владельца. Участники, которых нет в новом списке,
+// перестают получать начисления, но остаются в разделении с накопленным долгом
+func (s *SplitService) SetSplit(ownerID, subscriptionID uint, config SplitConfig) (*models.CostSplit, error) {
+	subscription, err := s.store.Subscriptions().FindByID(subscriptionID)
+	if err != nil || subscription.UserID != ownerID {
+		return nil, errors.New("подписка не найдена или не принадлежит пользователю")
+	}
+	if subscription.OrganizationID != nil {
+		return nil, errors.New("cost splitting is available for personal subscriptions only")
+	}
+
+	var split *models.CostSplit
+	err = s.store.Transaction(func(tx repository.Store) error {
+		split, err = tx.Splits().FindBySubscription(subscriptionID)
+		if errors.Is(err, repository.ErrNotFound) {
+			split = &models.CostSplit{SubscriptionID: subscriptionID, OwnerID: ownerID}
+		} else if err != nil {
+			return err
+		}
+		split.Mode = strings.ToLower(strings.TrimSpace(config.Mode))
+
+		for i := range split.Participants {
+			split.Participants[i].Active = false
+		}
+		for _, input := range config.Participants {
+			participant, err := s.matchParticipant(tx, split, ownerID, input)
+			if err != nil {
+				return err
+			}
+			if participant.Active {
+				return fmt.Errorf("%s is listed more than once", participant.Name)
+			}
+			participant.Active = true
+			participant.Share = input.Share
+		}
+
+		if err := split.Validate(); err != nil {
+			return err
+		}
+		return tx.Splits().Save(split)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return split, nil
+}
+
+// matchParticipant находит участника разделения по email или имени, а если его нет - добавляет
+func (s *SplitService) matchParticipant(tx repository.Store, split *models.CostSplit, ownerID uint, input SplitParticipantInput) (*models.SplitParticipant, error) {
+	if participantEmail := strings.TrimSpace(input.Email); participantEmail != "" {
+		user, err := tx.Users().FindByEmail(strings.ToLower(participantEmail))
+		if err != nil {
+			return nil, fmt.Errorf("user %s not found, add them by name instead", participantEmail)
+		}
+		if user.ID == ownerID {
+			return nil, errors.New("the owner pays for the subscription and cannot be a participant")
+		}
+		if participant := split.ParticipantByUser(user.ID); participant != nil {
+			return participant, nil
+		}
+		name := displayName(user)
+		if name == "" {
+			name = user.Email
+		}
+		split.Participants = append(split.Participants, models.SplitParticipant{UserID: &user.ID, Name: name})
+		return &split.Participants[len(split.Participants)-1], nil
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, errors.New("participant email or name is required")
+	}
+	for i := range split.Participants {
+		if split.Participants[i].UserID == nil && strings.EqualFold(split.Participants[i].Name, name) {
+			return &split.Participants[i], nil
+		}
+	}
+	split.Participants = append(split.Participants, models.SplitParticipant{Name: name})
+	return &split.Participants[len(split.Participants)-1], nil
+}
+
+// SettleUp - оплата участником долга владельцу
+type SettleUp struct {
+	ParticipantID uint    `json:"participant_id" binding:"required"`
+	Amount        float64 `json:"amount" binding:"required"`
+	Note          string  `json:"note"`
+}
+
+// SettleUp записывает оплату участника. Записать оплату может владелец или сам участник
+func (s *SplitService) SettleUp(actorID, subscriptionID uint, payment SettleUp) (*models.SplitLedgerEntry, error) {
+	amount := models.RoundMoney(payment.Amount)
+	if amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	if len([]rune(payment.Note)) > 255 {
+		return nil, errors.New("note is too long")
+	}
+
+	var entry *models.SplitLedgerEntry
+	err := s.store.Transaction(func(tx repository.Store) error {
+		split, err := tx.Splits().FindBySubscription(subscriptionID)
+		if err != nil {
+			return errors.New("cost split not found")
+		}
+
+		var participant *models.SplitParticipant
+		for i := range split.Participants {
+			if split.Participants[i].ID == payment.ParticipantID {
+				participant = &split.Participants[i]
+			}
+		}
+		if participant == nil {
+			return errors.New("participant not found")
+		}
+		isSelf := participant.UserID != nil && *participant.UserID == actorID
+		if split.OwnerID != actorID && !isSelf {
+			return errors.New("only the owner or the participant can record a payment")
+		}
+		if amount > participant.Balance {
+			return fmt.Errorf("amount exceeds the outstanding balance of %.2f", participant.Balance)
+		}
+
+		participant.Balance = models.RoundMoney(participant.Balance - amount)
+		if err := tx.Splits().Save(split); err != nil {
+			return err
+		}
+		entry = &models.SplitLedgerEntry{
+			SplitID:       split.ID,
+			ParticipantID: participant.ID,
+			Kind:          models.SplitEntryPayment,
+			Amount:        amount,
+			BalanceAfter:  participant.Balance,
+			RecordedByID:  &actorID,
+			Note:          strings.TrimSpace(payment.Note),
+			CreatedAt:     s.clock.Now(),
+		}
+		return tx.Splits().CreateEntry(entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetLedger возвращает журнал начислений и оплат разделения, последние записи первыми
+func (s *SplitService) GetLedger(userID, subscriptionID uint) ([]models.SplitLedgerEntry, error) {
+	split, err := s.GetSplit(userID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.Splits().FindEntries(split.ID)
+}
+
+// chargeSplit начисляет участникам разделения их доли суммы amount, выставленной счётом invoiceID
+func chargeSplit(tx repository.Store, subscription *models.Subscription, invoiceID uint, amount float64, now time.Time) error {
+	split, err := tx.Splits().FindBySubscription(subscription.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	var entries []models.SplitLedgerEntry
+	for i := range split.Participants {
+		participant := &split.Participants[i]
+		share := split.ParticipantAmount(amount, participant)
+		if share <= 0 {
+			continue
+		}
+		participant.Balance = models.RoundMoney(participant.Balance + share)
+		entries = append(entries, models.SplitLedgerEntry{
+			SplitID:       split.ID,
+			ParticipantID: participant.ID,
+			Kind:          models.SplitEntryCharge,
+			Amount:        share,
+			BalanceAfter:  participant.Balance,
+			InvoiceID:     &invoiceID,
+			CreatedAt:     now,
+		})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := tx.Splits().Save(split); err != nil {
+		return err
+	}
+	for i := range entries {
+		if err := tx.Splits().CreateEntry(&entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitShares - доли пользователя в разделениях стоимости для статистики подписок
+type splitShares struct {
+	// participantMonthly - ежемесячные доли пользователя в чужих подписках
+	participantMonthly float64
+	owedByMe           float64
+	owedToMe           float64
+}
+
+// collectSplitShares считает доли и долги пользователя по разделениям, в которых он участвует,
+// и долги участников по разделениям его подписок
+func collectSplitShares(tx repository.Store, userID uint) (*splitShares, error) {
+	shares := &splitShares{}
+
+	participating, err := tx.Splits().FindByParticipant(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range participating {
+		split := &participating[i]
+		participant := split.ParticipantByUser(userID)
+		shares.owedByMe += participant.Balance
+
+		subscription, err := tx.Subscriptions().FindByID(split.SubscriptionID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if subscription.Status == "active" {
+			billedPlan := subscription.BilledPlan()
+			shares.participantMonthly += split.ParticipantAmount(billedPlan.GetMonthlyPrice(), participant)
+		}
+	}
+
+	owned, err := tx.Splits().FindByOwner(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range owned {
+		shares.owedToMe += owned[i].OutstandingBalance()
+	}
+	return shares, nil
+}
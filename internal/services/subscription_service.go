@@ -2,180 +2,507 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"math"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/saneechka/ManageSubscription/internal/app"
 	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
 )
 
-type SubscriptionService struct{}
+type SubscriptionService struct {
+	store  repository.Store
+	clock  Clock
+	events *EventBus
+}
 
-func NewSubscriptionService() *SubscriptionService {
-	return &SubscriptionService{}
+func NewSubscriptionService(store repository.Store, clock Clock, events *EventBus) *SubscriptionService {
+	return &SubscriptionService{store: store, clock: clock, events: events}
 }
 
 func (s *SubscriptionService) GetUserSubscriptions(userID uint) ([]models.Subscription, error) {
-	var subscriptions []models.Subscription
-	result := app.DB.Where("user_id = ?", userID).
-		Preload("Plan").
-		Order("created_at desc").
-		Find(&subscriptions)
-
-	if result.Error != nil {
-		return nil, result.Error
-	}
-
-	return subscriptions, nil
+	return s.store.Subscriptions().FindByUser(userID)
 }
 
+// GetActiveSubscriptions возвращает активные подписки пользователя и семейные подписки,
+// в которых он занимает место (помечены Shared)
 func (s *SubscriptionService) GetActiveSubscriptions(userID uint) ([]models.Subscription, error) {
-	var subscriptions []models.Subscription
-	result := app.DB.Where("user_id = ? AND status = ?", userID, "active").
-		Preload("Plan").
-		Order("end_date asc").
-		Find(&subscriptions)
-
-	if result.Error != nil {
-		return nil, result.Error
+	subscriptions, err := s.store.Subscriptions().FindActiveByUser(userID)
+	if err != nil {
+		return nil, err
 	}
-
-	return subscriptions, nil
+	shared, err := findSharedSubscriptions(s.store, userID)
+	if err != nil {
+		return nil, err
+	}
+	return append(subscriptions, shared...), nil
 }
 
 func (s *SubscriptionService) GetSubscriptionStats(userID uint) (map[string]interface{}, error) {
-	type PlanWithMonthlyPrice struct {
-		models.Plan
-		MonthlyPrice float64
-	}
-
 	// Получаем все активные подписки пользователя
 	subscriptions, err := s.GetActiveSubscriptions(userID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Рассчитываем общую ежемесячную стоимость
+	// Рассчитываем общую ежемесячную стоимость. Семейные подписки делятся поровну
+	// между занятыми местами: monthly_share - доля пользователя.
+	// effective_monthly_share - сколько пользователь платит сам с учётом разделения стоимости:
+	// за свои подписки без долей участников, за чужие - свою долю в разделении
+	shares, err := collectSplitShares(s.store, userID)
+	if err != nil {
+		return nil, err
+	}
 	var totalMonthlySpending float64 = 0
+	var monthlyShare float64 = 0
+	effectiveShare := shares.participantMonthly
+	sharedCount := 0
 	for _, sub := range subscriptions {
-		monthlyPrice := sub.Plan.GetMonthlyPrice()
+		billedPlan := sub.BilledPlan()
+		monthlyPrice := billedPlan.GetMonthlyPrice()
 		// Проверка на NaN и бесконечность
-		if !math.IsNaN(monthlyPrice) && !math.IsInf(monthlyPrice, 0) {
+		if math.IsNaN(monthlyPrice) || math.IsInf(monthlyPrice, 0) {
+			continue
+		}
+		if sub.Shared {
+			sharedCount++
+		} else {
 			totalMonthlySpending += monthlyPrice
+
+			split, err := s.store.Splits().FindBySubscription(sub.ID)
+			switch {
+			case err == nil:
+				effectiveShare += split.OwnerAmount(monthlyPrice)
+			case errors.Is(err, repository.ErrNotFound):
+				effectiveShare += monthlyPrice
+			default:
+				return nil, err
+			}
 		}
+
+		seats, err := occupiedSeats(s.store, &sub)
+		if err != nil {
+			return nil, err
+		}
+		monthlyShare += models.SeatShare(monthlyPrice, seats)
 	}
 
 	// Создаем структуру статистики
 	stats := map[string]interface{}{
-		"active_count":           len(subscriptions),
-		"total_monthly_spending": totalMonthlySpending,
+		"active_count":            len(subscriptions),
+		"shared_count":            sharedCount,
+		"total_monthly_spending":  totalMonthlySpending,
+		"monthly_share":           models.RoundMoney(monthlyShare),
+		"effective_monthly_share": models.RoundMoney(effectiveShare),
+		"split_owed_by_me":        models.RoundMoney(shares.owedByMe),
+		"split_owed_to_me":        models.RoundMoney(shares.owedToMe),
 	}
 
 	return stats, nil
 }
 
-func (s *SubscriptionService) Subscribe(userID uint, planID uint, paymentID string) (*models.Subscription, error) {
-	var plan models.Plan
-	if err := app.DB.First(&plan, planID).Error; err != nil {
-		return nil, errors.New("план подписки не найден")
-	}
-
-	now := time.Now()
-	subscription := models.Subscription{
-		UserID:    userID,
-		PlanID:    planID,
-		StartDate: now,
-		EndDate:   plan.CalculateEndDate(now),
-		Status:    "active",
-		PaymentID: paymentID,
-		AutoRenew: true,
-	}
+// Subscribe оформляет подписку пользователя. Непустой promoCode применяет скидку по купону
+func (s *SubscriptionService) Subscribe(userID uint, planID uint, paymentID string, promoCode string) (*models.Subscription, error) {
+	return s.createSubscription(userID, nil, planID, paymentID, promoCode)
+}
 
-	if err := app.DB.Create(&subscription).Error; err != nil {
+// SubscribeOrganization оформляет подписку, владельцем которой является организация
+func (s *SubscriptionService) SubscribeOrganization(userID uint, organizationID uint, planID uint, paymentID string, promoCode string) (*models.Subscription, error) {
+	member, err := s.store.Organizations().FindMember(organizationID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("organization not found or user is not a member")
+		}
 		return nil, err
 	}
+	if !models.CanManageSubscriptions(member.Role) {
+		return nil, errors.New("only owner or billing manager can manage organization subscriptions")
+	}
+	return s.createSubscription(userID, &organizationID, planID, paymentID, promoCode)
+}
+
+func (s *SubscriptionService) createSubscription(userID uint, organizationID *uint, planID uint, paymentID string, promoCode string) (*models.Subscription, error) {
+	now := s.clock.Now()
+	var plan *models.Plan
+	var subscription models.Subscription
+	result := &subscription
+	err := s.store.Transaction(func(tx repository.Store) (err error) {
+		// Подписки одного владельца создаются по очереди, иначе параллельные запросы
+		// не увидят друг друга и оба пройдут проверку повторной подписки
+		if err := lockSubscriptionOwner(tx, userID, organizationID); err != nil {
+			return err
+		}
+		// План нельзя удалить, пока на него оформляется подписка
+		plan, err = tx.Plans().FindByIDForShare(planID)
+		if err != nil {
+			return errors.New("план подписки не найден")
+		}
+		if !plan.IsActive {
+			return errors.New("план подписки снят с продажи")
+		}
+		subscription = models.Subscription{
+			UserID:         userID,
+			OrganizationID: organizationID,
+			PlanID:         planID,
+			StartDate:      now,
+			EndDate:        plan.CalculateEndDate(now),
+			Status:         "active",
+			PaymentID:      paymentID,
+			AutoRenew:      true,
+		}
+
+		duplicate, err := findDuplicateSubscription(tx, userID, organizationID, plan)
+		if err != nil {
+			return err
+		}
+		if duplicate != nil {
+			// Существующая подписка блокируется так же, как при продлении
+			result, err = tx.Subscriptions().FindByIDForUpdate(duplicate.ID)
+			if err != nil {
+				return err
+			}
+			return s.resolveDuplicate(tx, result, plan, promoCode, userID, now)
+		}
 
-	// Загружаем связанный план в подписку для возврата в ответе
-	if err := app.DB.Model(&subscription).Association("Plan").Find(&subscription.Plan); err != nil {
+		version, err := currentPlanVersion(tx, planID, now)
+		if err != nil {
+			return err
+		}
+		subscription.PlanVersionID = &version.ID
+		subscription.PlanVersion = version
+		if err := tx.Subscriptions().Create(&subscription); err != nil {
+			return err
+		}
+		if err := recordEvent(tx, s.events, models.SubscriptionEventCreated, nil, &subscription, userID, now); err != nil {
+			return err
+		}
+
+		billedPlan := version.ApplyTo(*plan)
+		invoice := models.NewSubscriptionInvoice(&subscription, billedPlan)
+		if promoCode != "" {
+			if err := redeemCoupon(tx, promoCode, &subscription, &invoice, billedPlan.Price, now); err != nil {
+				return err
+			}
+		}
+		return tx.Invoices().Create(&invoice)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &subscription, nil
+	// Подставляем план в подписку для возврата в ответе
+	result.Plan = *plan
+
+	return result, nil
 }
 
-func (s *SubscriptionService) CancelSubscription(subscriptionID uint) error {
-	var subscription models.Subscription
-	if err := app.DB.First(&subscription, subscriptionID).Error; err != nil {
-		return errors.New("подписка не найдена")
+// Политики обработки повторной подписки на сервис, на который у владельца уже есть активная подписка
+const (
+	// DuplicatePolicyReject - повторная подписка отклоняется с ErrDuplicateSubscription
+	DuplicatePolicyReject = "reject"
+	// DuplicatePolicyExtend - подписка на тот же план продлевает существующую на период,
+	// а подписка на другой вариант сервиса переводит её на этот план
+	DuplicatePolicyExtend = "extend"
+	// DuplicatePolicyChangePlan - подписка на другой вариант сервиса переводит существующую
+	// подписку на этот план, повторная подписка на тот же план отклоняется
+	DuplicatePolicyChangePlan = "change_plan"
+)
+
+// ErrDuplicateSubscription - у владельца уже есть активная подписка на этот сервис
+var ErrDuplicateSubscription = errors.New("an active subscription to this service already exists")
+
+// GetDuplicatePolicy возвращает политику обработки повторной подписки на тот же сервис
+func (s *SubscriptionService) GetDuplicatePolicy() string {
+	return duplicatePolicy()
+}
+
+// duplicatePolicy читает DUPLICATE_SUBSCRIPTION_POLICY; ей же следует активация подарков
+func duplicatePolicy() string {
+	switch policy := os.Getenv("DUPLICATE_SUBSCRIPTION_POLICY"); policy {
+	case DuplicatePolicyExtend, DuplicatePolicyChangePlan:
+		return policy
+	default:
+		return DuplicatePolicyReject
 	}
+}
 
-	now := time.Now()
-	subscription.Status = "cancelled"
-	subscription.AutoRenew = false
-	subscription.CancelledAt = &now
+// lockSubscriptionOwner блокирует строку владельца подписок: организации или пользователя
+func lockSubscriptionOwner(tx repository.Store, userID uint, organizationID *uint) error {
+	if organizationID != nil {
+		_, err := tx.Organizations().FindByIDForUpdate(*organizationID)
+		return err
+	}
+	_, err := tx.Users().FindByIDForUpdate(userID)
+	return err
+}
+
+// findDuplicateSubscription возвращает активную подписку владельца на сервис плана plan,
+// то есть на любой план, для которого models.Plan.SameService истинно, или nil, если её нет.
+// Подписка на тот же план предпочтительнее
+func findDuplicateSubscription(tx repository.Store, userID uint, organizationID *uint, plan *models.Plan) (*models.Subscription, error) {
+	var subscriptions []models.Subscription
+	var err error
+	if organizationID != nil {
+		subscriptions, err = tx.Subscriptions().FindActiveByOrganization(*organizationID)
+	} else {
+		subscriptions, err = tx.Subscriptions().FindActiveByUser(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return app.DB.Save(&subscription).Error
+	var duplicate *models.Subscription
+	for i := range subscriptions {
+		if subscriptions[i].PlanID == plan.ID {
+			return &subscriptions[i], nil
+		}
+		if duplicate == nil && subscriptions[i].Plan.SameService(plan) {
+			duplicate = &subscriptions[i]
+		}
+	}
+	return duplicate, nil
 }
 
-func (s *SubscriptionService) UpdateAutoRenewal(subscriptionID uint, autoRenew bool) error {
-	var subscription models.Subscription
-	if err := app.DB.First(&subscription, subscriptionID).Error; err != nil {
-		return errors.New("подписка не найдена")
+// resolveDuplicate применяет политику повторной подписки к существующей подписке на сервис плана plan
+func (s *SubscriptionService) resolveDuplicate(tx repository.Store, existing *models.Subscription, plan *models.Plan, promoCode string, actorID uint, now time.Time) error {
+	policy := s.GetDuplicatePolicy()
+	samePlan := existing.PlanID == plan.ID
+	if policy == DuplicatePolicyReject || (policy == DuplicatePolicyChangePlan && samePlan) {
+		return fmt.Errorf("%w (subscription %d)", ErrDuplicateSubscription, existing.ID)
+	}
+	// Купон применяется только к новой подписке: у существующей может быть свой
+	if promoCode != "" {
+		return fmt.Errorf("%w: promo code can only be applied to a new subscription", ErrInvalidPromoCode)
 	}
 
-	if subscription.Status != "active" {
-		return errors.New("нельзя изменить настройки автопродления для неактивной подписки")
+	if samePlan {
+		periodStart := now
+		if existing.EndDate.After(now) {
+			periodStart = existing.EndDate
+		}
+		return s.renew(tx, existing, periodStart, actorID)
 	}
 
-	subscription.AutoRenew = autoRenew
-	return app.DB.Save(&subscription).Error
+	// Переход на другой вариант сервиса начинает новый период по новому плану, остаток текущего
+	// периода не пересчитывается. Использование по старому плану выставляется сразу
+	version, err := currentPlanVersion(tx, plan.ID, now)
+	if err != nil {
+		return err
+	}
+	if usageStart, _ := existing.UsagePeriod(); now.After(usageStart) {
+		if err := closeUsagePeriod(tx, existing, usageStart, now, now); err != nil {
+			return err
+		}
+	}
+	billedPlan := version.ApplyTo(*plan)
+	before := *existing
+	existing.PlanID = plan.ID
+	existing.PlanVersionID = &version.ID
+	existing.PlanVersion = version
+	existing.StartDate = now
+	existing.EndDate = billedPlan.CalculateEndDate(now)
+	if err := tx.Subscriptions().Save(existing); err != nil {
+		return err
+	}
+	if err := recordEvent(tx, s.events, models.SubscriptionEventPlanChanged, &before, existing, actorID, now); err != nil {
+		return err
+	}
+
+	invoice := models.NewSubscriptionInvoice(existing, billedPlan)
+	return tx.Invoices().Create(&invoice)
 }
 
-func (s *SubscriptionService) RenewSubscriptions() error {
+// Причины, по которым подписки попадают в отчёт о возможных дублях
+const (
+	DuplicateSameService     = "same_service"
+	DuplicateSameServiceType = "same_service_type"
+)
 
-	var subscriptionsToRenew []models.Subscription
-	now := time.Now()
-	tomorrow := now.Add(24 * time.Hour)
+// DuplicateSubscriptions - группа активных подписок одного владельца на один сервис
+// или на сервисы одного типа
+type DuplicateSubscriptions struct {
+	UserID         uint   `json:"user_id"`
+	OrganizationID *uint  `json:"organization_id,omitempty"`
+	Reason         string `json:"reason"`
+	// Service - название сервиса или тип сервиса, по которому совпали подписки
+	Service       string                `json:"service"`
+	Subscriptions []models.Subscription `json:"subscriptions"`
+}
 
-	result := app.DB.Where("status = ? AND auto_renew = ? AND end_date BETWEEN ? AND ?",
-		"active", true, now, tomorrow).
-		Preload("Plan").
-		Find(&subscriptionsToRenew)
+// GetUserDuplicateSubscriptions возвращает возможные дубли среди личных активных подписок пользователя
+func (s *SubscriptionService) GetUserDuplicateSubscriptions(userID uint) ([]DuplicateSubscriptions, error) {
+	subscriptions, err := s.store.Subscriptions().FindActiveByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return groupDuplicateSubscriptions(subscriptions), nil
+}
 
-	if result.Error != nil {
-		return result.Error
+// GetDuplicateSubscriptions возвращает возможные дубли среди активных подписок всех владельцев
+func (s *SubscriptionService) GetDuplicateSubscriptions() ([]DuplicateSubscriptions, error) {
+	subscriptions, err := s.store.Subscriptions().FindActive()
+	if err != nil {
+		return nil, err
 	}
+	return groupDuplicateSubscriptions(subscriptions), nil
+}
 
-	for _, sub := range subscriptionsToRenew {
+// groupDuplicateSubscriptions группирует подписки каждого владельца по названию сервиса, а затем
+// по типу сервиса. Группа по типу попадает в отчёт, только если в ней несколько разных сервисов:
+// иначе она повторяет группу по названию
+func groupDuplicateSubscriptions(subscriptions []models.Subscription) []DuplicateSubscriptions {
+	type owner struct {
+		userID         uint
+		organizationID uint
+	}
+	var owners []owner
+	byOwner := map[owner][]models.Subscription{}
+	for _, subscription := range subscriptions {
+		key := owner{userID: subscription.UserID}
+		if subscription.OrganizationID != nil {
+			key = owner{organizationID: *subscription.OrganizationID}
+		}
+		if _, ok := byOwner[key]; !ok {
+			owners = append(owners, key)
+		}
+		byOwner[key] = append(byOwner[key], subscription)
+	}
 
-		renewalDate := now
-		sub.StartDate = sub.EndDate
-		sub.EndDate = sub.Plan.CalculateEndDate(sub.EndDate)
-		sub.RenewalDate = &renewalDate
+	report := []DuplicateSubscriptions{}
+	for _, key := range owners {
+		owned := byOwner[key]
+		report = appendDuplicateGroups(report, owned, DuplicateSameService, func(plan *models.Plan) string {
+			return strings.ToLower(strings.TrimSpace(plan.Name))
+		})
+		report = appendDuplicateGroups(report, owned, DuplicateSameServiceType, func(plan *models.Plan) string {
+			return strings.ToLower(strings.TrimSpace(plan.ServiceType))
+		})
+	}
+	return report
+}
 
-		if err := app.DB.Save(&sub).Error; err != nil {
+// appendDuplicateGroups добавляет в report группы подписок с одинаковым непустым ключом плана
+func appendDuplicateGroups(report []DuplicateSubscriptions, subscriptions []models.Subscription, reason string, key func(plan *models.Plan) string) []DuplicateSubscriptions {
+	var keys []string
+	groups := map[string][]models.Subscription{}
+	for _, subscription := range subscriptions {
+		value := key(&subscription.Plan)
+		if value == "" {
+			continue
+		}
+		if _, ok := groups[value]; !ok {
+			keys = append(keys, value)
+		}
+		groups[value] = append(groups[value], subscription)
+	}
 
+	for _, value := range keys {
+		group := groups[value]
+		if len(group) < 2 {
+			continue
+		}
+		if reason == DuplicateSameServiceType && allSameService(group) {
 			continue
 		}
+		first := group[0]
+		service := first.Plan.Name
+		if reason == DuplicateSameServiceType {
+			service = first.Plan.ServiceType
+		}
+		report = append(report, DuplicateSubscriptions{
+			UserID:         first.UserID,
+			OrganizationID: first.OrganizationID,
+			Reason:         reason,
+			Service:        service,
+			Subscriptions:  group,
+		})
+	}
+	return report
+}
+
+func allSameService(subscriptions []models.Subscription) bool {
+	for i := 1; i < len(subscriptions); i++ {
+		if !subscriptions[0].Plan.SameService(&subscriptions[i].Plan) {
+			return false
+		}
 	}
+	return true
+}
 
-	return nil
+// CancelSubscription отменяет подписку; actorID - пользователь, отменивший её
+func (s *SubscriptionService) CancelSubscription(subscriptionID uint, actorID uint) error {
+	return s.store.Transaction(func(tx repository.Store) error {
+		return s.cancel(tx, subscriptionID, actorID)
+	})
 }
 
-func (s *SubscriptionService) CheckExpiredSubscriptions() error {
-	var expiredSubscriptions []models.Subscription
-	now := time.Now()
+// cancel отменяет подписку в транзакции tx, блокируя её строку
+func (s *SubscriptionService) cancel(tx repository.Store, subscriptionID uint, actorID uint) error {
+	subscription, err := tx.Subscriptions().FindByIDForUpdate(subscriptionID)
+	if err != nil {
+		return errors.New("подписка не найдена")
+	}
 
-	result := app.DB.Where("status = ? AND end_date < ?", "active", now).
-		Find(&expiredSubscriptions)
+	now := s.clock.Now()
+	before := *subscription
+	subscription.Status = "cancelled"
+	subscription.AutoRenew = false
+	subscription.CancelledAt = &now
 
-	if result.Error != nil {
-		return result.Error
+	if err := tx.Subscriptions().Save(subscription); err != nil {
+		return err
+	}
+	return recordEvent(tx, s.events, models.SubscriptionEventCancelled, &before, subscription, actorID, now)
+}
+
+func (s *SubscriptionService) UpdateAutoRenewal(subscriptionID uint, autoRenew bool, actorID uint) error {
+	return s.store.Transaction(func(tx repository.Store) error {
+		subscription, err := tx.Subscriptions().FindByIDForUpdate(subscriptionID)
+		if err != nil {
+			return errors.New("подписка не найдена")
+		}
+
+		if subscription.Status != "active" {
+			return errors.New("нельзя изменить настройки автопродления для неактивной подписки")
+		}
+		if subscription.AutoRenew == autoRenew {
+			return nil
+		}
+
+		before := *subscription
+		subscription.AutoRenew = autoRenew
+		if err := tx.Subscriptions().Save(subscription); err != nil {
+			return err
+		}
+		return recordEvent(tx, s.events, models.SubscriptionEventAutoRenewChanged, &before, subscription, actorID, s.clock.Now())
+	})
+}
+
+func (s *SubscriptionService) RenewSubscriptions() error {
+	now := s.clock.Now()
+	tomorrow := now.Add(24 * time.Hour)
+
+	subscriptionsToRenew, err := s.store.Subscriptions().FindDueForRenewal(now, tomorrow)
+	if err != nil {
+		return err
 	}
 
-	for _, sub := range expiredSubscriptions {
-		sub.Status = "expired"
-		if err := app.DB.Save(&sub).Error; err != nil {
+	for _, due := range subscriptionsToRenew {
+		err := s.store.Transaction(func(tx repository.Store) error {
+			sub, err := tx.Subscriptions().FindByIDForUpdate(due.ID)
+			if err != nil {
+				return err
+			}
+			// Пока задача шла, подписку могли продлить вручную или отменить
+			if sub.Status != "active" || !sub.AutoRenew || sub.EndDate.After(tomorrow) {
+				return nil
+			}
+			return s.renew(tx, sub, sub.EndDate, 0)
+		})
+		if err != nil {
 
 			continue
 		}
@@ -184,131 +511,259 @@ func (s *SubscriptionService) CheckExpiredSubscriptions() error {
 	return nil
 }
 
-func (s *SubscriptionService) GetSubscriptionByID(subscriptionID uint) (*models.Subscription, error) {
-	var subscription models.Subscription
-	result := app.DB.Where("id = ?", subscriptionID).
-		Preload("Plan").
-		First(&subscription)
+// renew переводит подписку на период, начинающийся в periodStart, и выставляет счёт за него.
+// Перерасход за текущий период выставляется отдельно, когда период закончится (UsageService.BillClosedPeriods).
+// actorID 0 - автопродление. Подписка должна быть прочитана в транзакции tx с блокировкой строки
+func (s *SubscriptionService) renew(tx repository.Store, subscription *models.Subscription, periodStart time.Time, actorID uint) error {
+	// Открытый период учёта продолжается до начала нового периода
+	if subscription.UsageBilledThrough == nil {
+		usageStart, _ := subscription.UsagePeriod()
+		subscription.UsageBilledThrough = &usageStart
+	}
+	before := *subscription
+	if err := s.pinRenewalVersion(tx, subscription, periodStart); err != nil {
+		return err
+	}
 
-	if result.Error != nil {
-		return nil, errors.New("подписка не найдена")
+	now := s.clock.Now()
+	billedPlan := subscription.BilledPlan()
+	subscription.StartDate = periodStart
+	subscription.EndDate = billedPlan.CalculateEndDate(periodStart)
+	subscription.Status = "active"
+	subscription.RenewalDate = &now
+	if err := tx.Subscriptions().Save(subscription); err != nil {
+		return err
+	}
+	if err := recordEvent(tx, s.events, models.SubscriptionEventRenewed, &before, subscription, actorID, now); err != nil {
+		return err
 	}
 
-	return &subscription, nil
+	invoice := models.NewSubscriptionInvoice(subscription, billedPlan)
+	if err := applyRenewalDiscount(tx, subscription, &invoice, billedPlan.Price); err != nil {
+		return err
+	}
+	if err := tx.Invoices().Create(&invoice); err != nil {
+		return err
+	}
+	if err := chargeSplit(tx, subscription, invoice.ID, invoice.Total, now); err != nil {
+		return err
+	}
+	// После окончания подписки период учёта уже закрыт: перерасход сразу попадает в счёт продления
+	if usageStart, usageEnd := subscription.UsagePeriod(); usageEnd.After(usageStart) && !usageEnd.After(now) {
+		return closeUsagePeriod(tx, subscription, usageStart, usageEnd, now)
+	}
+	return nil
 }
 
-func (s *SubscriptionService) GetSubscriptionsByProviderName(userID uint, providerName string) ([]models.Subscription, error) {
-	var subscriptions []models.Subscription
-
-	result := app.DB.Joins("JOIN plans ON subscriptions.plan_id = plans.id").
-		Where("subscriptions.user_id = ? AND plans.name LIKE ?", userID, "%"+providerName+"%").
-		Preload("Plan").
-		Find(&subscriptions)
+// GetGrandfatherPeriod возвращает, сколько после изменения цены продления идут по старой версии плана.
+// forever - подписчики сохраняют старые условия всегда
+func (s *SubscriptionService) GetGrandfatherPeriod() (period time.Duration, forever bool) {
+	value := os.Getenv("PLAN_GRANDFATHER_DAYS")
+	if value == "forever" {
+		return 0, true
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		days = 0
+	}
+	return time.Duration(days) * 24 * time.Hour, false
+}
 
-	if result.Error != nil {
-		return nil, result.Error
+// pinRenewalVersion выбирает версию плана для периода, начинающегося в periodStart: подписка
+// переходит на действующую версию, если период сохранения старых условий после изменения цены закончился
+func (s *SubscriptionService) pinRenewalVersion(tx repository.Store, subscription *models.Subscription, periodStart time.Time) error {
+	current, err := currentPlanVersion(tx, subscription.PlanID, periodStart)
+	if err != nil {
+		return err
+	}
+	if subscription.PlanVersion != nil && subscription.PlanVersion.ID != current.ID {
+		period, forever := s.GetGrandfatherPeriod()
+		if forever || periodStart.Before(current.EffectiveFrom.Add(period)) {
+			return nil
+		}
 	}
 
-	return subscriptions, nil
+	subscription.PlanVersionID = &current.ID
+	subscription.PlanVersion = current
+	return nil
 }
 
-func (s *SubscriptionService) SearchSubscriptions(userID uint, query string, status string, sortBy string) ([]models.Subscription, error) {
-	var subscriptions []models.Subscription
+func (s *SubscriptionService) CheckExpiredSubscriptions() error {
+	expiredSubscriptions, err := s.store.Subscriptions().FindExpired(s.clock.Now())
+	if err != nil {
+		return err
+	}
 
-	dbQuery := app.DB.Where("user_id = ?", userID)
+	for _, expired := range expiredSubscriptions {
+		err := s.store.Transaction(func(tx repository.Store) error {
+			sub, err := tx.Subscriptions().FindByIDForUpdate(expired.ID)
+			if err != nil {
+				return err
+			}
+			now := s.clock.Now()
+			// Подписку могли продлить или отменить после выборки
+			if sub.Status != "active" || !sub.EndDate.Before(now) {
+				return nil
+			}
+
+			before := *sub
+			sub.Status = "expired"
+			if err := tx.Subscriptions().Save(sub); err != nil {
+				return err
+			}
+			return recordEvent(tx, s.events, models.SubscriptionEventExpired, &before, sub, 0, now)
+		})
+		if err != nil {
 
-	if status != "" {
-		dbQuery = dbQuery.Where("status = ?", status)
+			continue
+		}
 	}
 
-	if query != "" {
-		dbQuery = dbQuery.Joins("JOIN plans ON subscriptions.plan_id = plans.id").
-			Where("plans.name LIKE ?", "%"+query+"%")
-	}
+	return nil
+}
 
-	switch sortBy {
-	case "price_asc":
-		dbQuery = dbQuery.Joins("JOIN plans ON subscriptions.plan_id = plans.id").
-			Order("plans.price ASC")
-	case "price_desc":
-		dbQuery = dbQuery.Joins("JOIN plans ON subscriptions.plan_id = plans.id").
-			Order("plans.price DESC")
-	case "date_asc":
-		dbQuery = dbQuery.Order("created_at ASC")
-	case "date_desc":
-		dbQuery = dbQuery.Order("created_at DESC")
-	default:
-		dbQuery = dbQuery.Order("created_at DESC")
+func (s *SubscriptionService) GetSubscriptionByID(subscriptionID uint) (*models.Subscription, error) {
+	subscription, err := s.store.Subscriptions().FindByID(subscriptionID)
+	if err != nil {
+		return nil, errors.New("подписка не найдена")
 	}
 
-	result := dbQuery.Preload("Plan").Find(&subscriptions)
+	return subscription, nil
+}
 
-	if result.Error != nil {
-		return nil, result.Error
-	}
+// GetHistory возвращает историю подписки, последние события первыми
+func (s *SubscriptionService) GetHistory(subscriptionID uint) ([]models.SubscriptionEvent, error) {
+	return s.store.SubscriptionEvents().FindBySubscription(subscriptionID)
+}
 
-	return subscriptions, nil
+// GetInvoices возвращает счета подписки, последние первыми
+func (s *SubscriptionService) GetInvoices(subscriptionID uint) ([]models.Invoice, error) {
+	return s.store.Invoices().FindBySubscription(subscriptionID)
 }
 
-// RenewSubscription обновляет подписку на новый период
-func (s *SubscriptionService) RenewSubscription(subscriptionID uint) error {
-	var subscription models.Subscription
-	if err := app.DB.Preload("Plan").First(&subscription, subscriptionID).Error; err != nil {
-		return errors.New("подписка не найдена")
+// Причины, по которым подписка попадает в отчёт о потерянных подписках
+const (
+	OrphanPlanMissing         = "plan_missing"
+	OrphanPlanDeleted         = "plan_deleted"
+	OrphanUserDeleted         = "user_deleted"
+	OrphanOrganizationDeleted = "organization_deleted"
+)
+
+// OrphanedSubscription - активная подписка, ссылающаяся на удалённую запись
+type OrphanedSubscription struct {
+	Subscription models.Subscription `json:"subscription"`
+	Reason       string              `json:"reason"`
+}
+
+// GetOrphanedSubscriptions возвращает активные подписки на удалённые планы,
+// а также подписки удалённых пользователей и организаций
+func (s *SubscriptionService) GetOrphanedSubscriptions() ([]OrphanedSubscription, error) {
+	subscriptions, err := s.store.Subscriptions().FindOrphaned()
+	if err != nil {
+		return nil, err
 	}
 
-	if subscription.Status != "active" && subscription.Status != "expired" {
-		return errors.New("можно продлить только активную или истекшую подписку")
+	report := make([]OrphanedSubscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		reason := OrphanUserDeleted
+		switch {
+		case subscription.Plan.ID == 0:
+			reason = OrphanPlanMissing
+		case subscription.Plan.DeletedAt.Valid:
+			reason = OrphanPlanDeleted
+		case subscription.OrganizationID != nil:
+			reason = OrphanOrganizationDeleted
+		}
+		report = append(report, OrphanedSubscription{Subscription: subscription, Reason: reason})
 	}
+	return report, nil
+}
 
-	// Обновляем даты
-	now := time.Now()
-	newStartDate := now
+func (s *SubscriptionService) GetSubscriptionsByProviderName(userID uint, providerName string) ([]models.Subscription, error) {
+	return s.store.Subscriptions().FindByUserAndPlanName(userID, providerName)
+}
 
-	// Если подписка еще не истекла, продлеваем от даты окончания
-	if subscription.Status == "active" && subscription.EndDate.After(now) {
-		newStartDate = subscription.EndDate
-	}
+func (s *SubscriptionService) SearchSubscriptions(userID uint, query string, status string, sortBy string) ([]models.Subscription, error) {
+	return s.store.Subscriptions().Search(userID, repository.SubscriptionFilter{
+		Query:  query,
+		Status: status,
+		SortBy: sortBy,
+	})
+}
 
-	subscription.StartDate = newStartDate
-	subscription.EndDate = subscription.Plan.CalculateEndDate(newStartDate)
-	subscription.Status = "active"
-	subscription.RenewalDate = &now
+// RenewSubscription обновляет подписку на новый период по запросу пользователя actorID
+func (s *SubscriptionService) RenewSubscription(subscriptionID uint, actorID uint) error {
+	// Строка подписки блокируется до конца продления: параллельное автопродление дождётся его
+	// и увидит новую дату окончания, а не продлит подписку второй раз
+	return s.store.Transaction(func(tx repository.Store) error {
+		subscription, err := tx.Subscriptions().FindByIDForUpdate(subscriptionID)
+		if err != nil {
+			return errors.New("подписка не найдена")
+		}
+
+		if subscription.Status != "active" && subscription.Status != "expired" {
+			return errors.New("можно продлить только активную или истекшую подписку")
+		}
 
-	return app.DB.Save(&subscription).Error
+		// Обновляем даты
+		now := s.clock.Now()
+		newStartDate := now
+
+		// Если подписка еще не истекла, продлеваем от даты окончания
+		if subscription.Status == "active" && subscription.EndDate.After(now) {
+			newStartDate = subscription.EndDate
+		}
+
+		return s.renew(tx, subscription, newStartDate, actorID)
+	})
 }
 
 // GetPlansForService возвращает все доступные планы подписки для указанного сервиса
 // Это позволит получить как месячные, так и годовые варианты одного сервиса
 func (s *SubscriptionService) GetPlansForService(serviceName string) ([]models.Plan, error) {
-	var plans []models.Plan
-	result := app.DB.Where("name = ? AND is_active = true", serviceName).
-		Order("duration asc").
-		Find(&plans)
-
-	if result.Error != nil {
-		return nil, result.Error
-	}
-
-	return plans, nil
+	return s.store.Plans().FindActiveByName(serviceName)
 }
 
 // GetRelatedPlans возвращает все планы, связанные с указанным планом (по имени сервиса)
 // Например, для месячного плана найдет годовой и наоборот
 func (s *SubscriptionService) GetRelatedPlans(planID uint) ([]models.Plan, error) {
-	var basePlan models.Plan
-	if err := app.DB.First(&basePlan, planID).Error; err != nil {
+	basePlan, err := s.store.Plans().FindByID(planID)
+	if err != nil {
 		return nil, errors.New("план не найден")
 	}
 
-	var relatedPlans []models.Plan
-	result := app.DB.Where("name = ? AND is_active = true AND id != ?", basePlan.Name, planID).
-		Order("duration asc").
-		Find(&relatedPlans)
+	plans, err := s.store.Plans().FindActiveByName(basePlan.Name)
+	if err != nil {
+		return nil, err
+	}
 
-	if result.Error != nil {
-		return nil, result.Error
+	relatedPlans := []models.Plan{}
+	for _, plan := range plans {
+		if plan.ID != planID {
+			relatedPlans = append(relatedPlans, plan)
+		}
 	}
 
 	return relatedPlans, nil
 }
+
+// recordEvent добавляет событие в историю подписки и публикует доменное событие, которое получат
+// подписчики events после фиксации tx: вебхуки, журнал аудита
+func recordEvent(tx repository.Store, events *EventBus, eventType string, before, after *models.Subscription, actorID uint, now time.Time) error {
+	event, err := models.NewSubscriptionEvent(eventType, before, after, actorID, now)
+	if err != nil {
+		return err
+	}
+	if err := tx.SubscriptionEvents().Create(&event); err != nil {
+		return err
+	}
+	change := SubscriptionChange{Subscription: *after, ActorID: actorID, At: now}
+	if before != nil {
+		previous := *before
+		change.Before = &previous
+	}
+	if domainEvent := newSubscriptionEvent(eventType, change); domainEvent != nil {
+		events.Publish(tx, domainEvent)
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package services_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+	"github.com/saneechka/ManageSubscription/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func newSubscriptionFixture(t *testing.T) (*services.SubscriptionService, *repository.MemoryStore, *fixedClock, *models.Plan) {
+	t.Helper()
+
+	store := repository.NewMemoryStore()
+	clock := &fixedClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	plan := &models.Plan{Name: "Кинопоиск", Price: 299, Duration: 1, PeriodType: "months", IsActive: true}
+	require.NoError(t, store.Plans().Create(plan))
+	// Владельцы подписок в тестах: создание подписки блокирует строку пользователя
+	for id := uint(1); id <= 7; id++ {
+		require.NoError(t, store.Users().Create(&models.User{ID: id, Email: fmt.Sprintf("user%d@example.com", id)}))
+	}
+
+	return services.NewSubscriptionService(store, clock, services.NewEventBus()), store, clock, plan
+}
+
+func TestSubscribeUsesClock(t *testing.T) {
+	service, _, clock, plan := newSubscriptionFixture(t)
+
+	subscription, err := service.Subscribe(7, plan.ID, "payment-1", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, clock.now, subscription.StartDate)
+	assert.Equal(t, time.Date(2025, 2, 15, 12, 0, 0, 0, time.UTC), subscription.EndDate)
+	assert.Equal(t, "Кинопоиск", subscription.Plan.Name)
+}
+
+func TestRenewSubscriptionsExtendsOnlyDueAutoRenewals(t *testing.T) {
+	service, store, clock, plan := newSubscriptionFixture(t)
+
+	due, err := service.Subscribe(1, plan.ID, "", "")
+	require.NoError(t, err)
+	manual, err := service.Subscribe(2, plan.ID, "", "")
+	require.NoError(t, err)
+	require.NoError(t, service.UpdateAutoRenewal(manual.ID, false, manual.UserID))
+	later, err := service.Subscribe(3, plan.ID, "", "")
+	require.NoError(t, err)
+
+	// Переносимся за 12 часов до окончания первых подписок
+	clock.now = due.EndDate.Add(-12 * time.Hour)
+	later.EndDate = clock.now.Add(72 * time.Hour)
+	require.NoError(t, store.Subscriptions().Save(later))
+
+	require.NoError(t, service.RenewSubscriptions())
+
+	renewed, err := store.Subscriptions().FindByID(due.ID)
+	require.NoError(t, err)
+	assert.Equal(t, due.EndDate, renewed.StartDate)
+	assert.Equal(t, time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC), renewed.EndDate)
+	require.NotNil(t, renewed.RenewalDate)
+	assert.Equal(t, clock.now, *renewed.RenewalDate)
+
+	notRenewed, err := store.Subscriptions().FindByID(manual.ID)
+	require.NoError(t, err)
+	assert.Equal(t, manual.EndDate, notRenewed.EndDate)
+
+	notDue, err := store.Subscriptions().FindByID(later.ID)
+	require.NoError(t, err)
+	assert.Nil(t, notDue.RenewalDate)
+}
+
+func TestCheckExpiredSubscriptions(t *testing.T) {
+	service, store, clock, plan := newSubscriptionFixture(t)
+
+	subscription, err := service.Subscribe(1, plan.ID, "", "")
+	require.NoError(t, err)
+
+	require.NoError(t, service.CheckExpiredSubscriptions())
+	current, err := store.Subscriptions().FindByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "active", current.Status)
+
+	clock.now = subscription.EndDate.Add(time.Minute)
+	require.NoError(t, service.CheckExpiredSubscriptions())
+
+	expired, err := store.Subscriptions().FindByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "expired", expired.Status)
+
+	active, err := service.GetActiveSubscriptions(1)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+}
+
+func TestRenewalKeepsGrandfatheredPrice(t *testing.T) {
+	t.Setenv("PLAN_GRANDFATHER_DAYS", "45")
+	service, store, clock, plan := newSubscriptionFixture(t)
+
+	subscription, err := service.Subscribe(1, plan.ID, "", "")
+	require.NoError(t, err)
+
+	// Новая цена вступает в силу через сутки после оформления подписки
+	clock.now = clock.now.Add(24 * time.Hour)
+	latest, err := store.Plans().FindLatestVersion(plan.ID)
+	require.NoError(t, err)
+	plan.Price = 349
+	version := models.NewPlanVersion(plan, latest.Version+1, clock.now)
+	require.NoError(t, store.Plans().CreateVersion(&version))
+	require.NoError(t, store.Plans().Save(plan))
+
+	// Первое продление попадает в льготный период и остаётся по старой цене
+	clock.now = subscription.EndDate.Add(-12 * time.Hour)
+	require.NoError(t, service.RenewSubscriptions())
+	renewed, err := service.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 299.0, renewed.BilledPlan().Price)
+
+	clock.now = renewed.EndDate.Add(-12 * time.Hour)
+	require.NoError(t, service.RenewSubscriptions())
+	renewed, err = service.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 349.0, renewed.BilledPlan().Price)
+	assert.Equal(t, 2, renewed.PlanVersion.Version)
+}
+
+func TestDuplicateSubscriptionPolicies(t *testing.T) {
+	service, store, clock, plan := newSubscriptionFixture(t)
+	yearly := &models.Plan{Name: "кинопоиск ", Price: 2990, Duration: 1, PeriodType: "years", IsActive: true}
+	require.NoError(t, store.Plans().Create(yearly))
+
+	subscription, err := service.Subscribe(1, plan.ID, "", "")
+	require.NoError(t, err)
+
+	// По умолчанию повторная подписка на тот же сервис отклоняется
+	_, err = service.Subscribe(1, plan.ID, "", "")
+	assert.ErrorIs(t, err, services.ErrDuplicateSubscription)
+	_, err = service.Subscribe(1, yearly.ID, "", "")
+	assert.ErrorIs(t, err, services.ErrDuplicateSubscription, "another variant of the same service")
+	_, err = service.Subscribe(2, plan.ID, "", "")
+	assert.NoError(t, err, "other users are not affected")
+
+	t.Setenv("DUPLICATE_SUBSCRIPTION_POLICY", services.DuplicatePolicyExtend)
+	extended, err := service.Subscribe(1, plan.ID, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, subscription.ID, extended.ID)
+	assert.Equal(t, subscription.EndDate, extended.StartDate)
+	assert.Equal(t, time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC), extended.EndDate)
+
+	t.Setenv("DUPLICATE_SUBSCRIPTION_POLICY", services.DuplicatePolicyChangePlan)
+	_, err = service.Subscribe(1, plan.ID, "", "")
+	assert.ErrorIs(t, err, services.ErrDuplicateSubscription, "nothing to change")
+	changed, err := service.Subscribe(1, yearly.ID, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, subscription.ID, changed.ID)
+	assert.Equal(t, yearly.ID, changed.PlanID)
+	assert.Equal(t, clock.now, changed.StartDate)
+	assert.Equal(t, time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC), changed.EndDate)
+
+	active, err := service.GetActiveSubscriptions(1)
+	require.NoError(t, err)
+	assert.Len(t, active, 1)
+	history, err := service.GetHistory(subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, models.SubscriptionEventPlanChanged, history[0].Type)
+	invoices, err := service.GetInvoices(subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, invoices, 3)
+	totals := []float64{invoices[0].Total, invoices[1].Total, invoices[2].Total}
+	assert.ElementsMatch(t, []float64{299, 299, 2990}, totals)
+}
+
+func TestDuplicateSubscriptionsReport(t *testing.T) {
+	service, store, _, _ := newSubscriptionFixture(t)
+	plan := &models.Plan{Name: "Кинопоиск", Price: 399, Duration: 1, PeriodType: "months", IsActive: true, ServiceType: "streaming"}
+	require.NoError(t, store.Plans().Create(plan))
+	okko := &models.Plan{Name: "Okko", Price: 199, Duration: 1, PeriodType: "months", IsActive: true, ServiceType: "streaming"}
+	music := &models.Plan{Name: "Яндекс Музыка", Price: 199, Duration: 1, PeriodType: "months", IsActive: true, ServiceType: "music"}
+	require.NoError(t, store.Plans().Create(okko))
+	require.NoError(t, store.Plans().Create(music))
+
+	// Дубли могли остаться с того времени, когда повторная подписка не проверялась
+	for _, subscription := range []models.Subscription{
+		{UserID: 1, PlanID: plan.ID, Status: "active"},
+		{UserID: 1, PlanID: plan.ID, Status: "active"},
+		{UserID: 1, PlanID: okko.ID, Status: "active"},
+		{UserID: 1, PlanID: music.ID, Status: "active"},
+		{UserID: 2, PlanID: plan.ID, Status: "active"},
+		{UserID: 2, PlanID: plan.ID, Status: "cancelled"},
+	} {
+		require.NoError(t, store.Subscriptions().Create(&subscription))
+	}
+
+	report, err := service.GetDuplicateSubscriptions()
+	require.NoError(t, err)
+	require.Len(t, report, 2)
+	assert.Equal(t, services.DuplicateSameService, report[0].Reason)
+	assert.Equal(t, "Кинопоиск", report[0].Service)
+	assert.Len(t, report[0].Subscriptions, 2)
+	assert.Equal(t, services.DuplicateSameServiceType, report[1].Reason)
+	assert.Equal(t, "streaming", report[1].Service)
+	assert.Len(t, report[1].Subscriptions, 3)
+	for _, group := range report {
+		assert.Equal(t, uint(1), group.UserID)
+	}
+
+	report, err = service.GetUserDuplicateSubscriptions(2)
+	require.NoError(t, err)
+	assert.Empty(t, report)
+}
+
+func TestConcurrentRenewalsExtendOnce(t *testing.T) {
+	service, _, clock, plan := newSubscriptionFixture(t)
+	subscription, err := service.Subscribe(1, plan.ID, "", "")
+	require.NoError(t, err)
+	// Подписка попадает в окно автопродления
+	clock.now = subscription.EndDate.Add(-12 * time.Hour)
+
+	const manual = 20
+	// Все запросы стартуют одновременно, чтобы задача успела выбрать подписку до ручных продлений
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < manual; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			assert.NoError(t, service.RenewSubscription(subscription.ID, 1))
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			assert.NoError(t, service.RenewSubscriptions())
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	history, err := service.GetHistory(subscription.ID)
+	require.NoError(t, err)
+	renewals, automatic := 0, 0
+	for _, event := range history {
+		if event.Type != models.SubscriptionEventRenewed {
+			continue
+		}
+		renewals++
+		if event.ActorID == nil {
+			automatic++
+		}
+	}
+	assert.Equal(t, manual, renewals-automatic)
+	assert.LessOrEqual(t, automatic, 1, "the job renews a period only once")
+
+	stored, err := service.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, subscription.EndDate.AddDate(0, renewals, 0), stored.EndDate, "every renewal extends by exactly one period")
+	invoices, err := service.GetInvoices(subscription.ID)
+	require.NoError(t, err)
+	assert.Len(t, invoices, renewals+1)
+}
+
+// dueHookStore вызывает onDue сразу после выборки подписок для автопродления:
+// так запрос, пришедший между выборкой и продлением, воспроизводится без гонки в тесте
+type dueHookStore struct {
+	*repository.MemoryStore
+	onDue func()
+}
+
+func (s *dueHookStore) Subscriptions() repository.SubscriptionRepository {
+	return &dueHookSubscriptions{SubscriptionRepository: s.MemoryStore.Subscriptions(), onDue: s.onDue}
+}
+
+type dueHookSubscriptions struct {
+	repository.SubscriptionRepository
+	onDue func()
+}
+
+func (r *dueHookSubscriptions) FindDueForRenewal(from, to time.Time) ([]models.Subscription, error) {
+	subscriptions, err := r.SubscriptionRepository.FindDueForRenewal(from, to)
+	r.onDue()
+	return subscriptions, err
+}
+
+func TestRenewalJobSkipsSubscriptionRenewedAfterSelection(t *testing.T) {
+	_, memory, clock, plan := newSubscriptionFixture(t)
+	store := &dueHookStore{MemoryStore: memory}
+	service := services.NewSubscriptionService(store, clock, services.NewEventBus())
+
+	subscription, err := service.Subscribe(1, plan.ID, "", "")
+	require.NoError(t, err)
+	clock.now = subscription.EndDate.Add(-12 * time.Hour)
+	store.onDue = func() {
+		require.NoError(t, service.RenewSubscription(subscription.ID, 1))
+	}
+
+	require.NoError(t, service.RenewSubscriptions())
+
+	stored, err := service.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, subscription.EndDate.AddDate(0, 1, 0), stored.EndDate, "renewed once, by the user")
+	history, err := service.GetHistory(subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.NotNil(t, history[0].ActorID)
+}
+
+// staleReadStore сохраняет подписку ещё раз сразу после FindByIDForUpdate в транзакции: так
+// воспроизводится изменение, записанное между чтением и сохранением, если блокировка не сработала
+type staleReadStore struct {
+	*repository.MemoryStore
+}
+
+func (s *staleReadStore) Transaction(fn func(tx repository.Store) error) error {
+	return s.MemoryStore.Transaction(func(tx repository.Store) error {
+		return fn(&staleReadTx{Store: tx})
+	})
+}
+
+type staleReadTx struct {
+	repository.Store
+}
+
+func (tx *staleReadTx) Subscriptions() repository.SubscriptionRepository {
+	return &staleReadSubscriptions{SubscriptionRepository: tx.Store.Subscriptions()}
+}
+
+type staleReadSubscriptions struct {
+	repository.SubscriptionRepository
+}
+
+func (r *staleReadSubscriptions) FindByIDForUpdate(id uint) (*models.Subscription, error) {
+	subscription, err := r.SubscriptionRepository.FindByIDForUpdate(id)
+	if err != nil {
+		return nil, err
+	}
+	concurrent := *subscription
+	if err := r.SubscriptionRepository.Save(&concurrent); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func TestRenewSubscriptionWithStaleVersionConflicts(t *testing.T) {
+	_, memory, clock, plan := newSubscriptionFixture(t)
+	subscription, err := services.NewSubscriptionService(memory, clock, services.NewEventBus()).Subscribe(1, plan.ID, "", "")
+	require.NoError(t, err)
+	service := services.NewSubscriptionService(&staleReadStore{MemoryStore: memory}, clock, services.NewEventBus())
+
+	err = service.RenewSubscription(subscription.ID, 1)
+	assert.ErrorIs(t, err, repository.ErrConflict, "a stale copy is not saved over a newer version")
+
+	stored, err := service.GetSubscriptionByID(subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, subscription.EndDate, stored.EndDate)
+	assert.Equal(t, subscription.Version, stored.Version, "the renewal is rolled back")
+	invoices, err := service.GetInvoices(subscription.ID)
+	require.NoError(t, err)
+	assert.Len(t, invoices, 1)
+}
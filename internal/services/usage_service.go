@@ -0,0 +1,264 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+// UsageService принимает данные об использовании составляющих планов и считает перерасход
+type UsageService struct {
+	store repository.Store
+	clock Clock
+}
+
+// NewUsageService создает новый экземпляр сервиса учёта использования
+func NewUsageService(store repository.Store, clock Clock) *UsageService {
+	return &UsageService{store: store, clock: clock}
+}
+
+// UsageReport - сообщение внешней системы об использовании составляющей подписки
+type UsageReport struct {
+	SubscriptionID uint
+	Component      string
+	Quantity       float64
+	// RecordedAt - момент использования; если не задан, используется время приёма
+	RecordedAt time.Time
+	// EventID - идентификатор события у отправителя для защиты от повторного учёта
+	EventID string
+}
+
+// PeriodUsage - использование составляющих подписки за расчётный период
+type PeriodUsage struct {
+	SubscriptionID uint                    `json:"subscription_id"`
+	PeriodStart    time.Time               `json:"period_start"`
+	PeriodEnd      time.Time               `json:"period_end"`
+	Components     []models.ComponentUsage `json:"components"`
+	OverageAmount  float64                 `json:"overage_amount"`
+}
+
+// RecordUsage сохраняет использование. Повторное событие подписки с тем же EventID не учитывается:
+// возвращается сохранённая ранее запись и created = false
+func (s *UsageService) RecordUsage(apiKeyID uint, report UsageReport) (record *models.UsageRecord, created bool, err error) {
+	if report.Quantity <= 0 {
+		return nil, false, errors.New("quantity must be positive")
+	}
+	report.EventID = strings.TrimSpace(report.EventID)
+
+	err = s.store.Transaction(func(tx repository.Store) error {
+		// Подписка блокируется, чтобы период не закрылся между проверкой и сохранением использования
+		subscription, err := tx.Subscriptions().FindByIDForUpdate(report.SubscriptionID)
+		if err != nil {
+			return errors.New("subscription not found")
+		}
+		record, created, err = s.recordUsage(tx, subscription, apiKeyID, report)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return record, created, nil
+}
+
+// recordUsage проверяет и сохраняет использование подписки, заблокированной в транзакции tx
+func (s *UsageService) recordUsage(tx repository.Store, subscription *models.Subscription, apiKeyID uint, report UsageReport) (*models.UsageRecord, bool, error) {
+	if report.EventID != "" {
+		existing, err := tx.Usage().FindByEventID(subscription.ID, report.EventID)
+		if err == nil {
+			return existing, false, nil
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return nil, false, err
+		}
+	}
+
+	if subscription.Status != "active" {
+		return nil, false, errors.New("subscription is not active")
+	}
+
+	components, err := tx.Plans().FindMeteredComponents(subscription.PlanID)
+	if err != nil {
+		return nil, false, err
+	}
+	known := false
+	for _, component := range components {
+		known = known || component.Key == report.Component
+	}
+	if !known {
+		return nil, false, errors.New("plan has no metered component " + report.Component)
+	}
+
+	now := s.clock.Now()
+	if report.RecordedAt.IsZero() {
+		report.RecordedAt = now
+	}
+	if report.RecordedAt.After(now) {
+		return nil, false, errors.New("usage cannot be recorded in the future")
+	}
+	// Закрытые периоды уже выставлены в счетах. Досрочное продление период не закрывает
+	if periodStart, _ := subscription.UsagePeriod(); report.RecordedAt.Before(periodStart) {
+		return nil, false, errors.New("billing period of this usage is already closed")
+	}
+
+	record := &models.UsageRecord{
+		SubscriptionID: subscription.ID,
+		ComponentKey:   report.Component,
+		Quantity:       report.Quantity,
+		RecordedAt:     report.RecordedAt,
+		APIKeyID:       apiKeyID,
+	}
+	if report.EventID != "" {
+		record.EventID = &report.EventID
+	}
+	if err := tx.Usage().Create(record); err != nil {
+		return nil, false, err
+	}
+	return record, true, nil
+}
+
+// GetCurrentUsage возвращает использование подписки в открытом периоде учёта
+func (s *UsageService) GetCurrentUsage(subscriptionID uint) (*PeriodUsage, error) {
+	subscription, err := s.store.Subscriptions().FindByID(subscriptionID)
+	if err != nil {
+		return nil, errors.New("подписка не найдена")
+	}
+
+	periodStart, periodEnd := subscription.UsagePeriod()
+	components, err := periodUsage(s.store, subscription, periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &PeriodUsage{
+		SubscriptionID: subscription.ID,
+		PeriodStart:    periodStart,
+		PeriodEnd:      periodEnd,
+		Components:     components,
+	}
+	for _, component := range components {
+		usage.OverageAmount = models.RoundMoney(usage.OverageAmount + component.OverageAmount)
+	}
+	return usage, nil
+}
+
+// BillClosedPeriods выставляет счета за перерасход в периодах учёта использования, закончившихся
+// к текущему моменту, и возвращает число закрытых периодов. Период закрывается только после
+// окончания, поэтому досрочное продление не отсекает использование, переданное до конца периода
+func (s *UsageService) BillClosedPeriods() (int, error) {
+	now := s.clock.Now()
+	due, err := s.store.Subscriptions().FindUsageBillingDue(now)
+	if err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	for _, candidate := range due {
+		err := s.store.Transaction(func(tx repository.Store) error {
+			subscription, err := tx.Subscriptions().FindByIDForUpdate(candidate.ID)
+			if err != nil {
+				return err
+			}
+			// Период мог закрыть параллельный запуск задачи
+			for {
+				start, end := subscription.UsagePeriod()
+				if !end.After(start) || end.After(now) {
+					return nil
+				}
+				if err := closeUsagePeriod(tx, subscription, start, end, now); err != nil {
+					return err
+				}
+				closed++
+			}
+		})
+		if err != nil {
+			return closed, fmt.Errorf("error billing usage of subscription %d: %w", candidate.ID, err)
+		}
+	}
+	return closed, nil
+}
+
+// closeUsagePeriod выставляет перерасход подписки в интервале [from, to) и перестаёт принимать
+// использование до to. Строки перерасхода добавляются в неоплаченный счёт продления, период
+// которого начинается в to; если такого счёта нет или он уже оплачен, выставляется отдельный счёт
+func closeUsagePeriod(tx repository.Store, subscription *models.Subscription, from, to, now time.Time) error {
+	// Блокировка подписки ждёт RecordUsage, который проверяет период под той же блокировкой,
+	// поэтому использование не может попасть в закрытый период после подсчёта
+	locked, err := tx.Subscriptions().FindByIDForUpdate(subscription.ID)
+	if err != nil {
+		return err
+	}
+	if locked.Version != subscription.Version {
+		return repository.ErrConflict
+	}
+
+	usage, err := periodUsage(tx, subscription, from, to)
+	if err != nil {
+		return err
+	}
+	subscription.UsageBilledThrough = &to
+	if err := tx.Subscriptions().Save(subscription); err != nil {
+		return err
+	}
+
+	overage := models.NewOverageInvoice(subscription, from, to, usage)
+	if len(overage.Lines) == 0 {
+		return nil
+	}
+	renewal, err := findRenewalInvoice(tx, subscription.ID, to)
+	if err != nil {
+		return err
+	}
+	if renewal != nil {
+		if err := tx.Invoices().AddLines(renewal, overage.Lines); err != nil {
+			return err
+		}
+		return chargeSplit(tx, subscription, renewal.ID, overage.Total, now)
+	}
+	if err := tx.Invoices().Create(&overage); err != nil {
+		return err
+	}
+	return chargeSplit(tx, subscription, overage.ID, overage.Total, now)
+}
+
+// findRenewalInvoice возвращает неоплаченный счёт за период подписки, начинающийся в periodStart,
+// или nil, если его нет
+func findRenewalInvoice(tx repository.Store, subscriptionID uint, periodStart time.Time) (*models.Invoice, error) {
+	invoices, err := tx.Invoices().FindBySubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range invoices {
+		invoice := &invoices[i]
+		if !invoice.PeriodStart.Equal(periodStart) || (invoice.Status != models.InvoiceStatusOpen && invoice.Status != models.InvoiceStatusPaymentFailed) {
+			continue
+		}
+		for _, line := range invoice.Lines {
+			if line.Kind == models.InvoiceLineSubscription {
+				return invoice, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// periodUsage считает использование составляющих плана подписки в интервале [from, to)
+func periodUsage(tx repository.Store, subscription *models.Subscription, from, to time.Time) ([]models.ComponentUsage, error) {
+	components, err := tx.Plans().FindMeteredComponents(subscription.PlanID)
+	if err != nil || len(components) == 0 {
+		return []models.ComponentUsage{}, err
+	}
+	totals, err := tx.Usage().SumByComponent(subscription.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]models.ComponentUsage, 0, len(components))
+	for _, component := range components {
+		usage = append(usage, models.NewComponentUsage(component, totals[component.Key]))
+	}
+	return usage, nil
+}
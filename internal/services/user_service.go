@@ -6,14 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
-	"github.com/saneechka/ManageSubscription/internal/app"
 	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
 	"github.com/saneechka/ManageSubscription/pkg/email"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
 type JWTClaims struct {
@@ -21,40 +22,31 @@ type JWTClaims struct {
 	jwt.StandardClaims
 }
 
-type UserService struct{}
+type UserService struct {
+	store  repository.Store
+	clock  Clock
+	events *EventBus
+}
 
-// Register регистрирует нового пользователя и отправляет письмо с подтверждением
+// Register регистрирует нового пользователя и публикует UserRegistered
 func (s *UserService) Register(user *models.User) error {
-	if app.DB == nil {
-		return errors.New("database connection is nil")
-	}
-
-	// Добавляем логирование
 	fmt.Println("Регистрация пользователя:", user.Email)
-	fmt.Println("Исходная длина пароля:", len(user.Password))
 
-	var existingUser models.User
-	result := app.DB.Where("email = ?", user.Email).First(&existingUser)
-	if result.Error == nil {
+	if err := models.ValidatePasswordStrength(user.Password, user.Email); err != nil {
+		return err
+	}
+
+	_, err := s.store.Users().FindByEmail(user.Email)
+	if err == nil {
 		return errors.New("user with this email already exists")
-	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("database error while checking existing user: %w", result.Error)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("database error while checking existing user: %w", err)
 	}
 
 	// Хешируем пароль
-	plainPassword := user.Password // сохраняем обычный пароль для проверки
-	if err := user.HashPassword(); err != nil {
+	if err := user.HashPasswordWithCost(s.GetPasswordCost()); err != nil {
 		return fmt.Errorf("error hashing password: %w", err)
 	}
-	fmt.Println("Хешированная длина пароля:", len(user.Password))
-
-	// Проверка, что хеширование работает
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(plainPassword))
-	if err != nil {
-		fmt.Println("ВНИМАНИЕ: Проверка хеширования не прошла:", err)
-	} else {
-		fmt.Println("Хеширование пароля работает корректно")
-	}
 
 	// Генерируем токен подтверждения
 	token, err := s.generateVerificationToken()
@@ -64,29 +56,30 @@ func (s *UserService) Register(user *models.User) error {
 
 	// Устанавливаем токен и дату истечения срока (24 часа)
 	user.VerificationToken = token
-	expiresAt := time.Now().Add(24 * time.Hour)
+	expiresAt := s.clock.Now().Add(24 * time.Hour)
 	user.TokenExpiresAt = &expiresAt
 	user.IsEmailVerified = false
 
-	// Создаем пользователя в базе данных
-	if err := app.DB.Create(user).Error; err != nil {
-		return fmt.Errorf("error creating user: %w", err)
-	}
+	// Создаем пользователя в базе данных; письмо с подтверждением отправит подписчик UserRegistered
+	return s.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Create(user); err != nil {
+			return fmt.Errorf("error creating user: %w", err)
+		}
+		s.events.Publish(tx, UserRegistered{User: *user, At: s.clock.Now()})
+		return nil
+	})
+}
 
-	// Отправляем письмо с подтверждением асинхронно
-	userName := user.FirstName
+// SendVerificationEmail - подписчик UserRegistered: отправляет письмо с подтверждением email.
+// Ошибка отправки не отменяет регистрацию, пользователь может запросить письмо повторно
+func (s *UserService) SendVerificationEmail(event UserRegistered) error {
+	userName := event.User.FirstName
 	if userName == "" {
 		userName = "пользователь"
 	}
-
-	// Асинхронная отправка, не блокирующая основной поток
-	if err := email.SendVerificationEmail(user.Email, userName, token); err != nil {
-		// Просто логируем ошибку, но не возвращаем её, чтобы не блокировать регистрацию
-		fmt.Printf("Ошибка отправки письма с подтверждением: %v\n", err)
-	} else {
-		fmt.Printf("Письмо с подтверждением для %s будет отправлено асинхронно\n", user.Email)
+	if err := email.SendVerificationEmail(event.User.Email, userName, event.User.VerificationToken); err != nil {
+		return fmt.Errorf("error sending verification email: %w", err)
 	}
-
 	return nil
 }
 
@@ -115,52 +108,24 @@ func (s *UserService) Login(email, password string) (string, error) {
 	// Добавляем логирование для отладки
 	fmt.Println("Попытка входа:", email)
 
-	var user models.User
-	result := app.DB.Where("email = ?", email).First(&user)
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	user, err := s.store.Users().FindByEmail(email)
+	if errors.Is(err, repository.ErrNotFound) {
 		fmt.Println("Пользователь не найден:", email)
 		return "", errors.New("invalid email or password")
-	} else if result.Error != nil {
-		fmt.Println("Ошибка базы данных:", result.Error)
-		return "", result.Error
+	} else if err != nil {
+		fmt.Println("Ошибка базы данных:", err)
+		return "", err
 	}
 
-	fmt.Println("Длина хеша пароля:", len(user.Password))
-
-	err := user.CheckPassword(password)
-	if err != nil {
-		fmt.Println("Ошибка стандартной проверки пароля:", err)
-
-		if user.Password == password {
-			fmt.Println("Незахешированный пароль совпадает! Исправляем ситуацию...")
-
-			oldPass := user.Password
-			if err := user.HashPassword(); err != nil {
-				fmt.Println("Не удалось захешировать пароль:", err)
-
-			} else {
-
-				if err := app.DB.Save(&user).Error; err != nil {
-					fmt.Println("Ошибка при обновлении пароля:", err)
-
-					user.Password = oldPass
-				}
-			}
-
-			if !user.IsEmailVerified {
-				return "", errors.New("email not verified. please check your email for verification link")
-			}
-
-			token, err := s.GenerateJWT(user.ID)
-			if err != nil {
-				return "", err
-			}
-			return token, nil
-		}
-
+	if err := user.CheckPassword(password); err != nil {
 		return "", errors.New("invalid email or password")
 	}
 
+	// Пересчитываем хеш, если изменилась настроенная стоимость bcrypt
+	if cost := s.GetPasswordCost(); user.NeedsRehash(cost) {
+		s.rehashPassword(user, password, cost)
+	}
+
 	// Проверяем, подтвержден ли email
 	if !user.IsEmailVerified {
 		return "", errors.New("email not verified. please check your email for verification link")
@@ -174,6 +139,57 @@ func (s *UserService) Login(email, password string) (string, error) {
 	return token, nil
 }
 
+// GetPasswordCost возвращает стоимость bcrypt из переменной окружения BCRYPT_COST
+func (s *UserService) GetPasswordCost() int {
+	cost, err := strconv.Atoi(os.Getenv("BCRYPT_COST"))
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+// rehashPassword прозрачно обновляет хеш пароля после успешного входа.
+// Ошибки только логируются: вход пользователя от них не зависит
+func (s *UserService) rehashPassword(user *models.User, password string, cost int) {
+	rehashed := models.User{Password: password}
+	if err := rehashed.HashPasswordWithCost(cost); err != nil {
+		fmt.Println("Не удалось пересчитать хеш пароля:", err)
+		return
+	}
+
+	if err := s.store.Users().UpdatePassword(user.ID, rehashed.Password); err != nil {
+		fmt.Println("Ошибка при обновлении хеша пароля:", err)
+	}
+}
+
+// MigrateLegacyPasswords хеширует пароли, сохранённые в открытом виде.
+// Возвращает количество обновлённых записей
+func (s *UserService) MigrateLegacyPasswords() (int, error) {
+	users, err := s.store.Users().FindAllUnscoped()
+	if err != nil {
+		return 0, err
+	}
+
+	cost := s.GetPasswordCost()
+	migrated := 0
+	for _, user := range users {
+		if user.Password == "" || user.IsPasswordHashed() {
+			continue
+		}
+
+		if err := user.HashPasswordWithCost(cost); err != nil {
+			return migrated, fmt.Errorf("error hashing password for user %d: %w", user.ID, err)
+		}
+
+		if err := s.store.Users().UpdatePassword(user.ID, user.Password); err != nil {
+			return migrated, fmt.Errorf("error updating password for user %d: %w", user.ID, err)
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
 func (s *UserService) GetSecretKey() []byte {
 	key := os.Getenv("JWT_SECRET_KEY")
 	if key == "" {
@@ -183,7 +199,7 @@ func (s *UserService) GetSecretKey() []byte {
 }
 
 func (s *UserService) GenerateJWT(userID uint) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+	expirationTime := s.clock.Now().Add(24 * time.Hour)
 
 	claims := &JWTClaims{
 		UserID: userID,
@@ -204,10 +220,9 @@ func (s *UserService) GenerateJWT(userID uint) (string, error) {
 
 func (s *UserService) GetUserByID(id uint) (*models.User, error) {
 	if id == 1 {
-		var adminUser models.User
-		result := app.DB.First(&adminUser, id)
+		adminUser, err := s.store.Users().FindByID(id)
 
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		if errors.Is(err, repository.ErrNotFound) {
 			masterEmail := os.Getenv("MASTER_EMAIL")
 			if masterEmail == "" {
 				masterEmail = "admin@example.com"
@@ -218,37 +233,43 @@ func (s *UserService) GetUserByID(id uint) (*models.User, error) {
 				Email:           masterEmail,
 				FirstName:       "Admin",
 				LastName:        "User",
-				CreatedAt:       time.Now(),
-				UpdatedAt:       time.Now(),
+				CreatedAt:       s.clock.Now(),
+				UpdatedAt:       s.clock.Now(),
 				IsEmailVerified: true,
 			}, nil
-		} else if result.Error != nil {
-			return nil, result.Error
+		} else if err != nil {
+			return nil, err
 		}
 
-		return &adminUser, nil
+		return adminUser, nil
 	}
 
-	var user models.User
-	result := app.DB.First(&user, id)
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	user, err := s.store.Users().FindByID(id)
+	if errors.Is(err, repository.ErrNotFound) {
 		return nil, errors.New("user not found")
-	} else if result.Error != nil {
-		return nil, result.Error
+	} else if err != nil {
+		return nil, err
 	}
 
-	var subscription models.Subscription
-	subResult := app.DB.Where("user_id = ? AND status = 'active'", id).
-		Preload("Plan").First(&subscription)
-	if subResult.Error == nil {
-		user.ActivePlan = &subscription
+	subscriptions, err := s.store.Subscriptions().FindActiveByUser(id)
+	if err == nil && len(subscriptions) > 0 {
+		user.ActivePlan = &subscriptions[0]
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// UserExists проверяет, что пользователь существует и не удалён
+func (s *UserService) UserExists(id uint) (bool, error) {
+	_, err := s.store.Users().FindByID(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 func (s *UserService) UpdateUser(user *models.User) error {
-	return app.DB.Save(user).Error
+	return s.store.Users().Save(user)
 }
 
 // VerifyEmail проверяет токен верификации и активирует аккаунт пользователя
@@ -257,17 +278,16 @@ func (s *UserService) VerifyEmail(token string) error {
 		return errors.New("verification token is required")
 	}
 
-	var user models.User
-	result := app.DB.Where("verification_token = ?", token).First(&user)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	user, err := s.store.Users().FindByVerificationToken(token)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			return errors.New("invalid verification token")
 		}
-		return result.Error
+		return err
 	}
 
 	// Проверяем, не истек ли срок действия токена
-	if user.TokenExpiresAt != nil && user.TokenExpiresAt.Before(time.Now()) {
+	if user.TokenExpiresAt != nil && user.TokenExpiresAt.Before(s.clock.Now()) {
 		return errors.New("verification token has expired")
 	}
 
@@ -276,18 +296,23 @@ func (s *UserService) VerifyEmail(token string) error {
 	user.VerificationToken = ""
 	user.TokenExpiresAt = nil
 
-	return app.DB.Save(&user).Error
+	return s.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Save(user); err != nil {
+			return err
+		}
+		s.events.Publish(tx, EmailVerified{User: *user, At: s.clock.Now()})
+		return nil
+	})
 }
 
 // ResendVerificationEmail отправляет новое письмо с подтверждением
 func (s *UserService) ResendVerificationEmail(userEmail string) error {
-	var user models.User
-	result := app.DB.Where("email = ?", userEmail).First(&user)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	user, err := s.store.Users().FindByEmail(userEmail)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			return errors.New("user not found")
 		}
-		return result.Error
+		return err
 	}
 
 	// Если email уже подтвержден, вернуть ошибку
@@ -303,10 +328,10 @@ func (s *UserService) ResendVerificationEmail(userEmail string) error {
 
 	// Обновляем токен и срок действия
 	user.VerificationToken = token
-	expiresAt := time.Now().Add(24 * time.Hour)
+	expiresAt := s.clock.Now().Add(24 * time.Hour)
 	user.TokenExpiresAt = &expiresAt
 
-	if err := app.DB.Save(&user).Error; err != nil {
+	if err := s.store.Users().Save(user); err != nil {
 		return err
 	}
 
@@ -319,6 +344,119 @@ func (s *UserService) ResendVerificationEmail(userEmail string) error {
 	return email.SendVerificationEmail(user.Email, userName, token)
 }
 
+// RequestEmailChange создаёт запрос на смену email и отправляет ссылку подтверждения на новый адрес
+func (s *UserService) RequestEmailChange(userID uint, newEmail, password string) error {
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if newEmail == "" {
+		return errors.New("new email is required")
+	}
+
+	user, err := s.store.Users().FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("user not found")
+		}
+		return err
+	}
+
+	if err := user.CheckPassword(password); err != nil {
+		return errors.New("invalid password")
+	}
+
+	if strings.EqualFold(user.Email, newEmail) {
+		return errors.New("new email is the same as the current one")
+	}
+
+	if _, err := s.store.Users().FindByEmail(newEmail); err == nil {
+		return errors.New("user with this email already exists")
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	token, err := s.generateVerificationToken()
+	if err != nil {
+		return fmt.Errorf("error generating confirmation token: %w", err)
+	}
+
+	request := models.EmailChangeRequest{
+		UserID:         user.ID,
+		OldEmail:       user.Email,
+		NewEmail:       newEmail,
+		Token:          token,
+		TokenExpiresAt: s.clock.Now().Add(24 * time.Hour),
+	}
+
+	err = s.store.Transaction(func(tx repository.Store) error {
+		// Предыдущие неподтверждённые запросы больше не действительны
+		if err := tx.EmailChanges().DeletePendingByUser(user.ID); err != nil {
+			return err
+		}
+		return tx.EmailChanges().Create(&request)
+	})
+	if err != nil {
+		return fmt.Errorf("error creating email change request: %w", err)
+	}
+
+	userName := user.FirstName
+	if userName == "" {
+		userName = "пользователь"
+	}
+
+	if err := email.SendEmailChangeConfirmation(newEmail, userName, token); err != nil {
+		fmt.Printf("Ошибка отправки письма для смены email: %v\n", err)
+	}
+	if err := email.SendEmailChangeNotification(user.Email, userName, newEmail); err != nil {
+		fmt.Printf("Ошибка отправки уведомления о смене email: %v\n", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange подтверждает смену email по токену из письма
+func (s *UserService) ConfirmEmailChange(token string) error {
+	if token == "" {
+		return errors.New("confirmation token is required")
+	}
+
+	request, err := s.store.EmailChanges().FindByToken(token)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("invalid confirmation token")
+		}
+		return err
+	}
+
+	if request.ConfirmedAt != nil {
+		return errors.New("email change already confirmed")
+	}
+	if request.TokenExpiresAt.Before(s.clock.Now()) {
+		return errors.New("confirmation token has expired")
+	}
+
+	return s.store.Transaction(func(tx repository.Store) error {
+		existing, err := tx.Users().FindByEmail(request.NewEmail)
+		if err == nil && existing.ID != request.UserID {
+			return errors.New("user with this email already exists")
+		} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		user, err := tx.Users().FindByID(request.UserID)
+		if err != nil {
+			return err
+		}
+		user.Email = request.NewEmail
+		user.IsEmailVerified = true
+		if err := tx.Users().Save(user); err != nil {
+			return err
+		}
+
+		now := s.clock.Now()
+		request.ConfirmedAt = &now
+		return tx.EmailChanges().Save(request)
+	})
+}
+
 // generateVerificationToken создает новый случайный токен
 func (s *UserService) generateVerificationToken() (string, error) {
 	b := make([]byte, 16)
@@ -330,6 +468,6 @@ func (s *UserService) generateVerificationToken() (string, error) {
 }
 
 // NewUserService создает новый экземпляр сервиса пользователей
-func NewUserService() *UserService {
-	return &UserService{}
+func NewUserService(store repository.Store, clock Clock, events *EventBus) *UserService {
+	return &UserService{store: store, clock: clock, events: events}
 }
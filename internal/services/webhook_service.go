@@ -0,0 +1,423 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/saneechka/ManageSubscription/internal/models"
+	"github.com/saneechka/ManageSubscription/internal/repository"
+)
+
+const (
+	webhookSecretPrefix = "whsec_"
+	// webhookTimeout ограничивает ожидание ответа получателя, чтобы медленный получатель не задерживал остальных
+	webhookTimeout = 10 * time.Second
+	// webhookDeliveryLogSize - сколько последних доставок показывается в журнале получателя
+	webhookDeliveryLogSize = 100
+	// webhookClaimDuration - на сколько обработчик занимает доставку. Если он остановится, не записав
+	// результат, доставку отправит другой обработчик после этого срока
+	webhookClaimDuration = time.Minute
+)
+
+// ErrWebhookTargetForbidden - адрес получателя находится в локальной сети, loopback или link-local
+// (в том числе адрес метаданных облака 169.254.169.254)
+var ErrWebhookTargetForbidden = errors.New("webhook target address is not allowed")
+
+// webhookSharedAddressSpace - адреса операторского NAT (RFC 6598), они не маршрутизируются в интернет
+var webhookSharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+type WebhookService struct {
+	store  repository.Store
+	clock  Clock
+	client *http.Client
+}
+
+func NewWebhookService(store repository.Store, clock Clock) *WebhookService {
+	s := &WebhookService{store: store, clock: clock}
+	// Адрес проверяется при подключении, после разрешения имени: имя получателя может указывать
+	// на внутренний адрес или смениться после сохранения
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: s.checkDialAddress}
+	s.client = &http.Client{
+		Timeout: webhookTimeout,
+		// Прокси из окружения не используется: через него проверка адреса не работала бы
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// Перенаправление не выполняется, ответ 3xx считается неудачной попыткой
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return s
+}
+
+// GetAllowPrivateTargets возвращает, можно ли отправлять события на адреса локальной сети и loopback
+// (WEBHOOK_ALLOW_PRIVATE_TARGETS, по умолчанию нельзя). Разрешается для разработки и тестов
+func (s *WebhookService) GetAllowPrivateTargets() bool {
+	allow, err := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS"))
+	return err == nil && allow
+}
+
+// WebhookInput - настройки получателя событий. Пустой список Events подписывает на все события
+type WebhookInput struct {
+	URL         string   `json:"url" binding:"required"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+	Active      *bool    `json:"active"`
+}
+
+// webhookPayload - тело запроса к получателю
+type webhookPayload struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// GetEndpoints возвращает получателей пользователя, а при ownerID nil - получателей администратора
+func (s *WebhookService) GetEndpoints(ownerID *uint) ([]models.WebhookEndpoint, error) {
+	return s.store.Webhooks().FindEndpoints(ownerID)
+}
+
+// CreateEndpoint добавляет получателя и возвращает его вместе с ключом подписи.
+// Ключ показывается только в этом ответе
+func (s *WebhookService) CreateEndpoint(ownerID *uint, input WebhookInput) (*models.WebhookEndpoint, string, error) {
+	endpoint := &models.WebhookEndpoint{UserID: ownerID, Active: true}
+	if err := applyWebhookInput(endpoint, input, s.GetAllowPrivateTargets()); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	endpoint.Secret = webhookSecretPrefix + secret
+
+	if err := s.store.Webhooks().CreateEndpoint(endpoint); err != nil {
+		return nil, "", err
+	}
+	return endpoint, endpoint.Secret, nil
+}
+
+// UpdateEndpoint меняет адрес, описание, события и активность получателя; ключ подписи не меняется
+func (s *WebhookService) UpdateEndpoint(ownerID *uint, id uint, input WebhookInput) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.ownedEndpoint(ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyWebhookInput(endpoint, input, s.GetAllowPrivateTargets()); err != nil {
+		return nil, err
+	}
+	if err := s.store.Webhooks().SaveEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// DeleteEndpoint удаляет получателя вместе с журналом доставок
+func (s *WebhookService) DeleteEndpoint(ownerID *uint, id uint) error {
+	if _, err := s.ownedEndpoint(ownerID, id); err != nil {
+		return err
+	}
+	return s.store.Webhooks().DeleteEndpoint(id)
+}
+
+// GetDeliveries возвращает последние доставки получателю, последние первыми
+func (s *WebhookService) GetDeliveries(ownerID *uint, id uint) ([]models.WebhookDelivery, error) {
+	if _, err := s.ownedEndpoint(ownerID, id); err != nil {
+		return nil, err
+	}
+	return s.store.Webhooks().FindDeliveries(id, webhookDeliveryLogSize)
+}
+
+// SendTestEvent сразу отправляет получателю проверочное событие и возвращает результат доставки.
+// Неудачная проверочная доставка повторяется по тем же правилам, что и обычная
+func (s *WebhookService) SendTestEvent(ownerID *uint, id uint) (*models.WebhookDelivery, error) {
+	endpoint, err := s.ownedEndpoint(ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	eventID, payload, err := newWebhookEvent(models.WebhookEventTest, map[string]interface{}{"message": "Test event"}, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	delivery := newWebhookDelivery(endpoint.ID, eventID, models.WebhookEventTest, payload, now)
+	// Доставка сразу занята этим запросом, чтобы её не отправил и фоновый обработчик
+	claimedUntil := now.Add(webhookClaimDuration)
+	delivery.NextAttemptAt = &claimedUntil
+	if err := s.store.Webhooks().CreateDelivery(delivery); err != nil {
+		return nil, err
+	}
+	if err := s.attempt(delivery, endpoint); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// DeliverDue отправляет доставки, время попытки которых наступило, и возвращает число попыток.
+// Каждая доставка сначала занимается, поэтому несколько обработчиков не отправят её дважды
+func (s *WebhookService) DeliverDue() (int, error) {
+	now := s.clock.Now()
+	deliveries, err := s.store.Webhooks().FindDueDeliveries(now)
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		claimed, err := s.store.Webhooks().ClaimDelivery(delivery.ID, now, now.Add(webhookClaimDuration))
+		if err != nil {
+			return attempted, err
+		}
+		if !claimed {
+			continue
+		}
+		attempted++
+
+		endpoint, err := s.store.Webhooks().FindEndpointByID(delivery.EndpointID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return attempted, err
+		}
+		if endpoint == nil || !endpoint.Active {
+			delivery.Status = models.WebhookDeliveryFailed
+			delivery.LastError = "endpoint was disabled"
+			delivery.NextAttemptAt = nil
+			if err := s.store.Webhooks().SaveDelivery(delivery); err != nil {
+				return attempted, err
+			}
+			continue
+		}
+		if err := s.attempt(delivery, endpoint); err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+// GetDispatchInterval возвращает интервал, с которым сервер отправляет ожидающие доставки
+func (s *WebhookService) GetDispatchInterval() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("WEBHOOK_DISPATCH_INTERVAL_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = 15
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Run повторяет DeliverDue с интервалом interval, пока не отменён ctx
+func (s *WebhookService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.DeliverDue(); err != nil {
+				log.Printf("Ошибка доставки событий получателям: %v", err)
+			}
+		}
+	}
+}
+
+// attempt отправляет доставку получателю и сохраняет результат попытки
+func (s *WebhookService) attempt(delivery *models.WebhookDelivery, endpoint *models.WebhookEndpoint) error {
+	timestamp := s.clock.Now().Unix()
+	request, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		delivery.RecordAttempt(0, err, s.clock.Now())
+		return s.store.Webhooks().SaveDelivery(delivery)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "ManageSubscription-Webhooks/1.0")
+	request.Header.Set("X-Webhook-ID", delivery.EventID)
+	request.Header.Set("X-Webhook-Event", delivery.EventType)
+	request.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	request.Header.Set("X-Webhook-Signature", "sha256="+models.SignWebhookPayload(endpoint.Secret, timestamp, delivery.Payload))
+
+	responseCode := 0
+	response, err := s.client.Do(request)
+	if err == nil {
+		responseCode = response.StatusCode
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+		response.Body.Close()
+	}
+
+	delivery.RecordAttempt(responseCode, err, s.clock.Now())
+	return s.store.Webhooks().SaveDelivery(delivery)
+}
+
+// checkDialAddress отклоняет подключение к адресу локальной сети, loopback или link-local.
+// Вызывается для каждого подключения с уже разрешённым IP-адресом
+func (s *WebhookService) checkDialAddress(network, address string, _ syscall.RawConn) error {
+	if s.GetAllowPrivateTargets() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || isPrivateAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrWebhookTargetForbidden, host)
+	}
+	return nil
+}
+
+// isPrivateAddress проверяет, что адрес не доступен из интернета
+func isPrivateAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || webhookSharedAddressSpace.Contains(ip)
+}
+
+func (s *WebhookService) ownedEndpoint(ownerID *uint, id uint) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.store.Webhooks().FindEndpointByID(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("webhook endpoint not found")
+		}
+		return nil, err
+	}
+	sameOwner := (ownerID == nil && endpoint.UserID == nil) ||
+		(ownerID != nil && endpoint.UserID != nil && *ownerID == *endpoint.UserID)
+	if !sameOwner {
+		return nil, errors.New("webhook endpoint not found")
+	}
+	return endpoint, nil
+}
+
+// applyWebhookInput проверяет настройки получателя и переносит их в endpoint. Без allowPrivate
+// отклоняются адреса локальной сети, заданные IP-адресом или именем localhost; адреса, полученные
+// разрешением имени, проверяются при отправке
+func applyWebhookInput(endpoint *models.WebhookEndpoint, input WebhookInput, allowPrivate bool) error {
+	target, err := url.Parse(strings.TrimSpace(input.URL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if !allowPrivate {
+		host := strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+		ip := net.ParseIP(host)
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && isPrivateAddress(ip)) {
+			return errors.New("url must not point to a private, loopback or link-local address")
+		}
+	}
+	if len(target.String()) > 2048 {
+		return errors.New("url is too long")
+	}
+	if len([]rune(input.Description)) > 255 {
+		return errors.New("description is too long")
+	}
+
+	events := []string{}
+	seen := map[string]bool{}
+	for _, event := range input.Events {
+		event = strings.TrimSpace(event)
+		if !models.IsValidWebhookEvent(event) {
+			return fmt.Errorf("unknown event %q, available events: %s", event, strings.Join(models.WebhookEventTypes, ", "))
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	encoded, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	endpoint.URL = target.String()
+	endpoint.Description = strings.TrimSpace(input.Description)
+	endpoint.Events = encoded
+	if input.Active != nil {
+		endpoint.Active = *input.Active
+	}
+	return nil
+}
+
+// EnqueueSubscriptionEvent - подписчик шины событий: ставит изменение подписки в очередь доставки.
+// Выполняется после фиксации изменения, доставки отправляет Run.
+// Событие получают endpoints владельца подписки и администратора
+func (s *WebhookService) EnqueueSubscriptionEvent(event SubscriptionEvent) error {
+	change := event.Change()
+	eventType := event.EventName()
+	endpoints, err := s.store.Webhooks().FindEndpointsForUser(change.Subscription.UserID)
+	if err != nil {
+		return err
+	}
+
+	var eventID string
+	var payload json.RawMessage
+	for _, endpoint := range endpoints {
+		if !endpoint.Accepts(eventType) {
+			continue
+		}
+		// Все получатели события получают один идентификатор и одно тело запроса
+		if eventID == "" {
+			eventID, payload, err = newWebhookEvent(eventType, map[string]interface{}{"subscription": change.Subscription}, change.At)
+			if err != nil {
+				return err
+			}
+		}
+		if err := s.store.Webhooks().CreateDelivery(newWebhookDelivery(endpoint.ID, eventID, eventType, payload, change.At)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newWebhookEvent присваивает событию идентификатор и собирает тело запроса к получателям
+func newWebhookEvent(eventType string, data interface{}, now time.Time) (string, json.RawMessage, error) {
+	eventID, err := randomHex(16)
+	if err != nil {
+		return "", nil, fmt.Errorf("error generating event ID: %w", err)
+	}
+	eventID = "evt_" + eventID
+	payload, err := json.Marshal(webhookPayload{ID: eventID, Type: eventType, CreatedAt: now, Data: data})
+	if err != nil {
+		return "", nil, err
+	}
+	return eventID, payload, nil
+}
+
+// newWebhookDelivery создаёт доставку события, первая попытка которой выполняется сразу
+func newWebhookDelivery(endpointID uint, eventID, eventType string, payload json.RawMessage, now time.Time) *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		CreatedAt:     now,
+		EndpointID:    endpointID,
+		EventID:       eventID,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+	}
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,74 @@
+package email
+
+import (
+	"fmt"
+	"time"
+)
+
+// SendEmailChangeConfirmation отправляет на новый адрес ссылку для подтверждения смены email
+func SendEmailChangeConfirmation(toEmail, userName, token string) error {
+	appURL := getEnvOrDefault("APP_URL", "http://localhost:8080")
+	confirmationURL := fmt.Sprintf("%s/api/confirm-email-change?token=%s", appURL, token)
+
+	body := fmt.Sprintf(`
+		<html>
+			<body>
+				<h2>Здравствуйте, %s!</h2>
+				<p>Мы получили запрос на смену email вашего аккаунта на этот адрес.</p>
+				<p>Чтобы подтвердить смену, пожалуйста, <a href="%s">нажмите на эту ссылку</a>.</p>
+				<p>Если вы не запрашивали смену email, просто проигнорируйте это письмо.</p>
+				<p>Ссылка действительна в течение 24 часов.</p>
+				<br>
+				<p>С уважением,<br>
+				Команда Subscription Manager</p>
+			</body>
+		</html>
+	`, userName, confirmationURL)
+
+	sendAsync(toEmail, "Подтверждение смены email", body)
+	return nil
+}
+
+// SendEmailChangeNotification уведомляет старый адрес о запрошенной смене email
+func SendEmailChangeNotification(toEmail, userName, newEmail string) error {
+	body := fmt.Sprintf(`
+		<html>
+			<body>
+				<h2>Здравствуйте, %s!</h2>
+				<p>Для вашего аккаунта запрошена смена email на адрес <b>%s</b>.</p>
+				<p>Смена вступит в силу только после подтверждения с нового адреса.</p>
+				<p>Если это были не вы, смените пароль и обратитесь в поддержку.</p>
+				<br>
+				<p>С уважением,<br>
+				Команда Subscription Manager</p>
+			</body>
+		</html>
+	`, userName, newEmail)
+
+	sendAsync(toEmail, "Запрошена смена email", body)
+	return nil
+}
+
+// SendAccountDeletionScheduled сообщает об удалении аккаунта и даёт ссылку для его восстановления
+func SendAccountDeletionScheduled(toEmail, userName, restoreToken string, purgeAfter time.Time) error {
+	appURL := getEnvOrDefault("APP_URL", "http://localhost:8080")
+	restoreURL := fmt.Sprintf("%s/api/account/restore?token=%s", appURL, restoreToken)
+
+	body := fmt.Sprintf(`
+		<html>
+			<body>
+				<h2>Здравствуйте, %s!</h2>
+				<p>Ваш аккаунт удалён, активные подписки отменены.</p>
+				<p>Данные будут удалены окончательно <b>%s</b>. До этой даты вы можете
+				<a href="%s">восстановить аккаунт</a>.</p>
+				<p>Если вы не удаляли аккаунт, восстановите его и смените пароль.</p>
+				<br>
+				<p>С уважением,<br>
+				Команда Subscription Manager</p>
+			</body>
+		</html>
+	`, userName, purgeAfter.Format("02.01.2006"), restoreURL)
+
+	sendAsync(toEmail, "Аккаунт удалён", body)
+	return nil
+}
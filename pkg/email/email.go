@@ -85,24 +85,12 @@ func SendVerificationEmail(toEmail, userName, token string) error {
 
 // sendVerificationEmailSync - синхронная функция отправки письма
 func sendVerificationEmailSync(toEmail, userName, token string) error {
-	config := GetConfig()
-
-	// Создаем контекст с таймаутом
-	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
-	defer cancel()
-
 	// Формируем url для подтверждения с переданным токеном
 	appURL := getEnvOrDefault("APP_URL", "http://localhost:8080")
 	verificationURL := fmt.Sprintf("%s/verify-email?token=%s", appURL, token)
 
 	fmt.Printf("URL для подтверждения: %s\n", verificationURL)
 
-	// Создаем объект для отправки email
-	m := gomail.NewMessage()
-	m.SetHeader("From", fmt.Sprintf("%s <%s>", config.FromName, config.FromEmail))
-	m.SetHeader("To", toEmail)
-	m.SetHeader("Subject", "Подтверждение регистрации")
-
 	// Формируем HTML-тело письма
 	body := fmt.Sprintf(`
 		<html>
@@ -120,6 +108,39 @@ func sendVerificationEmailSync(toEmail, userName, token string) error {
 		</html>
 	`, userName, verificationURL)
 
+	return sendEmailSync(toEmail, "Подтверждение регистрации", body)
+}
+
+// sendAsync отправляет письмо в отдельной горутине и только логирует результат
+func sendAsync(toEmail, subject, body string) {
+	go func() {
+		fmt.Printf("Начинаем асинхронную отправку письма на адрес %s\n", toEmail)
+		if err := sendEmailSync(toEmail, subject, body); err != nil {
+			fmt.Printf("Ошибка при отправке письма: %v\n", err)
+		} else {
+			fmt.Printf("Письмо успешно отправлено на %s\n", toEmail)
+		}
+	}()
+}
+
+// sendEmailSync - синхронная отправка HTML-письма через текущий транспорт
+func sendEmailSync(toEmail, subject, body string) error {
+	return currentTransport().Send(toEmail, subject, body)
+}
+
+// sendSMTP - синхронная отправка HTML-письма через SMTP
+func sendSMTP(toEmail, subject, body string) error {
+	config := GetConfig()
+
+	// Создаем контекст с таймаутом
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	// Создаем объект для отправки email
+	m := gomail.NewMessage()
+	m.SetHeader("From", fmt.Sprintf("%s <%s>", config.FromName, config.FromEmail))
+	m.SetHeader("To", toEmail)
+	m.SetHeader("Subject", subject)
 	m.SetBody("text/html", body)
 
 	// Создаем диалер с настройками SMTP
@@ -0,0 +1,57 @@
+package email
+
+import (
+	"fmt"
+)
+
+// SendOrganizationInvitation отправляет приглашение присоединиться к организации
+func SendOrganizationInvitation(toEmail, organizationName, inviterName, token string) error {
+	appURL := getEnvOrDefault("APP_URL", "http://localhost:8080")
+	acceptURL := fmt.Sprintf("%s/invitations/accept?token=%s", appURL, token)
+
+	body := fmt.Sprintf(`
+		<html>
+			<body>
+				<h2>Здравствуйте!</h2>
+				<p>%s приглашает вас в команду <b>%s</b> в сервисе управления подписками.</p>
+				<p>Чтобы принять приглашение, войдите или зарегистрируйтесь с этим email и
+				<a href="%s">перейдите по ссылке</a>.</p>
+				<p>Приглашение действительно в течение 7 дней.</p>
+				<br>
+				<p>С уважением,<br>
+				Команда Subscription Manager</p>
+			</body>
+		</html>
+	`, inviterName, organizationName, acceptURL)
+
+	sendAsync(toEmail, "Приглашение в команду "+organizationName, body)
+	return nil
+}
+
+// SendFamilyInvitation отправляет приглашение занять место в семейной подписке
+func SendFamilyInvitation(toEmail, ownerName, planName, token string) error {
+	appURL := getEnvOrDefault("APP_URL", "http://localhost:8080")
+	acceptURL := fmt.Sprintf("%s/family/accept?token=%s", appURL, token)
+
+	if ownerName == "" {
+		ownerName = "Пользователь Subscription Manager"
+	}
+
+	body := fmt.Sprintf(`
+		<html>
+			<body>
+				<h2>Здравствуйте!</h2>
+				<p>%s приглашает вас присоединиться к семейной подписке <b>%s</b>.</p>
+				<p>Чтобы занять место, войдите или зарегистрируйтесь с этим email и
+				<a href="%s">перейдите по ссылке</a>. Оплачивает подписку владелец.</p>
+				<p>Приглашение действительно в течение 7 дней.</p>
+				<br>
+				<p>С уважением,<br>
+				Команда Subscription Manager</p>
+			</body>
+		</html>
+	`, ownerName, planName, acceptURL)
+
+	sendAsync(toEmail, "Приглашение в семейную подписку "+planName, body)
+	return nil
+}
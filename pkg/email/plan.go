@@ -0,0 +1,65 @@
+package email
+
+import (
+	"fmt"
+	"html"
+	"time"
+)
+
+// SendPriceChangeNotice сообщает подписчику о новой цене плана и даёт ссылку для отказа от продления
+func SendPriceChangeNotice(toEmail, userName, planName string, oldPrice, newPrice float64, appliesFrom time.Time, declineToken string) error {
+	appURL := getEnvOrDefault("APP_URL", "http://localhost:8080")
+	declineURL := fmt.Sprintf("%s/api/price-changes/decline?token=%s", appURL, declineToken)
+
+	body := fmt.Sprintf(`
+		<html>
+			<body>
+				<h2>Здравствуйте, %s!</h2>
+				<p>Стоимость плана <b>%s</b> меняется с %.2f ₽ на <b>%.2f ₽</b>.</p>
+				<p>Для вашей подписки новая цена начнёт действовать с продления <b>%s</b>.
+				До этого вы платите по прежней цене.</p>
+				<p>Если вы не хотите продлевать подписку по новой цене,
+				<a href="%s">отключите автопродление</a> до этой даты: подписка будет действовать
+				до конца оплаченного периода.</p>
+				<br>
+				<p>С уважением,<br>
+				Команда Subscription Manager</p>
+			</body>
+		</html>
+	`, userName, planName, oldPrice, newPrice, appliesFrom.Format("02.01.2006"), declineURL)
+
+	sendAsync(toEmail, "Изменение цены подписки "+planName, body)
+	return nil
+}
+
+// SendGiftCode отправляет получателю код подарочной подписки
+func SendGiftCode(toEmail, purchaserName, planName, message, code string, expiresAt time.Time) error {
+	appURL := getEnvOrDefault("APP_URL", "http://localhost:8080")
+	redeemURL := fmt.Sprintf("%s/gifts/redeem?code=%s", appURL, code)
+
+	note := ""
+	if message != "" {
+		note = fmt.Sprintf("<blockquote>%s</blockquote>", html.EscapeString(message))
+	}
+
+	body := fmt.Sprintf(`
+		<html>
+			<body>
+				<h2>Здравствуйте!</h2>
+				<p>%s дарит вам подписку <b>%s</b>.</p>
+				%s
+				<p>Ваш подарочный код: <b>%s</b></p>
+				<p>Чтобы активировать подарок, войдите или зарегистрируйтесь и
+				<a href="%s">введите код</a>. Если у вас уже есть подписка на этот сервис,
+				подарок продлит её.</p>
+				<p>Код действителен до %s.</p>
+				<br>
+				<p>С уважением,<br>
+				Команда Subscription Manager</p>
+			</body>
+		</html>
+	`, html.EscapeString(purchaserName), planName, note, code, redeemURL, expiresAt.Format("02.01.2006"))
+
+	sendAsync(toEmail, "Вам подарили подписку "+planName, body)
+	return nil
+}
@@ -0,0 +1,34 @@
+package email
+
+import "sync"
+
+// Transport доставляет готовое HTML-письмо получателю
+type Transport interface {
+	Send(toEmail, subject, body string) error
+}
+
+// TransportFunc позволяет использовать функцию как Transport
+type TransportFunc func(toEmail, subject, body string) error
+
+func (f TransportFunc) Send(toEmail, subject, body string) error {
+	return f(toEmail, subject, body)
+}
+
+var (
+	transportMu sync.RWMutex
+	transport   Transport = TransportFunc(sendSMTP)
+)
+
+// SetTransport заменяет способ доставки писем (по умолчанию SMTP).
+// Используется в тестах, чтобы не обращаться к почтовому серверу
+func SetTransport(t Transport) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	transport = t
+}
+
+func currentTransport() Transport {
+	transportMu.RLock()
+	defer transportMu.RUnlock()
+	return transport
+}